@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"webscreen/linuxRecorder/protocol"
+)
+
+// AudioSink 是会话专用的 PulseAudio/PipeWire null sink。会话里的应用通过 PULSE_SINK 输出到这里，
+// 再由 ffmpeg 从它的 monitor 采集并编码为 Opus，和视频共用一条连接发给 webscreen。
+type AudioSink struct {
+	Name     string
+	moduleID string
+}
+
+// NewAudioSink 创建 null sink，并设置 PULSE_SERVER/PULSE_SINK 供之后启动的子进程继承。
+// 必须在 NewSession 之前调用：Sway 会话会改写 XDG_RUNTIME_DIR，之后就找不到用户的声音服务了。
+func NewAudioSink(display int) (*AudioSink, error) {
+	if _, err := exec.LookPath("pactl"); err != nil {
+		return nil, fmt.Errorf("pactl not found, install pulseaudio-utils: %v", err)
+	}
+	if server := pulseServer(); server != "" {
+		os.Setenv("PULSE_SERVER", server)
+	}
+	name := fmt.Sprintf("webscreen_%d", display)
+	out, err := exec.Command("pactl", "load-module", "module-null-sink",
+		"sink_name="+name,
+		"sink_properties=device.description="+name,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("create null sink failed, is PulseAudio or PipeWire (pipewire-pulse) running for this user? %v", err)
+	}
+	os.Setenv("PULSE_SINK", name)
+	log.Printf("Created audio sink %s", name)
+	return &AudioSink{Name: name, moduleID: strings.TrimSpace(string(out))}, nil
+}
+
+// pulseServer 返回当前用户声音服务的 socket 地址，没有找到时返回空交给 libpulse 自己决定
+func pulseServer() string {
+	if server := os.Getenv("PULSE_SERVER"); server != "" {
+		return server
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	socket := filepath.Join(runtimeDir, "pulse", "native")
+	if !fileExists(socket) {
+		return ""
+	}
+	return "unix:" + socket
+}
+
+func (a *AudioSink) Close() {
+	if err := exec.Command("pactl", "unload-module", a.moduleID).Run(); err != nil {
+		log.Printf("Failed to remove audio sink %s: %v", a.Name, err)
+		return
+	}
+	log.Printf("Removed audio sink %s", a.Name)
+}
+
+// StartAudio 启动 ffmpeg 采集 sink 的 monitor，把 Opus 包推给 webscreen，直到 ffmpeg 退出或连接断开
+func (s *Session) StartAudio(sink *AudioSink) error {
+	encoder := []string{"-c:a", "libopus"}
+	if !HasEncoder("libopus") {
+		// ffmpeg 自带的 opus 编码器还是实验性的
+		encoder = []string{"-c:a", "opus", "-strict", "-2"}
+	}
+	cmdArgs := []string{
+		"-loglevel", "error",
+		"-f", "pulse",
+		"-fragment_size", "3840", // 20ms 的 48kHz 双声道 s16，降低采集延迟
+		"-i", sink.Name + ".monitor",
+		"-ac", "2",
+		"-ar", "48000",
+	}
+	cmdArgs = append(cmdArgs, encoder...)
+	cmdArgs = append(cmdArgs,
+		"-b:a", "128k",
+		"-application", "lowdelay",
+		"-frame_duration", "20", // 与 Agent.ServeAudioStream 每包 960 个采样对应
+		"-f", "ogg",
+		"-page_duration", "20000", // 每页一个包，默认 1 秒一页延迟太大
+		"-flush_packets", "1",
+		"pipe:1",
+	)
+	cmd := exec.CommandContext(s.ctx, "ffmpeg", cmdArgs...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	log.Printf("Running audio FFmpeg command: %s\n", strings.Join(cmd.Args, " "))
+	if err := s.SpawnProcess(cmd, "FFmpeg audio"); err != nil {
+		return err
+	}
+	go s.pushAudio(output)
+	return nil
+}
+
+// pushAudio 从 Ogg 流中取出 Opus 包，作为 FRAME_AUDIO 发送。暂停期间丢弃。
+func (s *Session) pushAudio(output io.Reader) {
+	err := readOggPackets(output, func(packet []byte) error {
+		// OpusHead/OpusTags 头包浏览器不需要
+		if bytes.HasPrefix(packet, []byte("OpusHead")) || bytes.HasPrefix(packet, []byte("OpusTags")) {
+			return nil
+		}
+		if s.audioPaused.Load() {
+			return nil
+		}
+		pts := uint64(time.Now().UnixNano() / 1e3)
+		return s.writeMedia(protocol.FRAME_AUDIO, pts, packet)
+	})
+	log.Printf("Audio capture stopped: %v", err)
+}
+
+// readOggPackets 依次取出 Ogg 流中的完整包（可能跨页），见 RFC 3533
+func readOggPackets(r io.Reader, handle func(packet []byte) error) error {
+	header := make([]byte, 27)
+	var packet []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		if string(header[0:4]) != "OggS" {
+			return fmt.Errorf("invalid ogg page")
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return err
+		}
+		size := 0
+		for _, l := range lacing {
+			size += int(l)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		pos := 0
+		for _, l := range lacing {
+			packet = append(packet, body[pos:pos+int(l)]...)
+			pos += int(l)
+			// 长度为 255 的段表示包在下一段继续
+			if l == 255 {
+				continue
+			}
+			if err := handle(packet); err != nil {
+				return err
+			}
+			packet = nil
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+	"webscreen/linuxRecorder/protocol"
+)
+
+// Clipboard 是会话的剪贴板（X11 的 CLIPBOARD 或 Wayland 的 selection），只处理文本。
+// 会话中的应用改变剪贴板时，实现调用构造时传入的 onChange。
+type Clipboard interface {
+	Get() ([]byte, error)
+	Set(content []byte) error
+	Close()
+}
+
+// 模拟快捷键用到的 Android KeyCode，由 InputController 映射到 X11/evdev
+const (
+	ANDROID_KEYCODE_C         = 31
+	ANDROID_KEYCODE_V         = 50
+	ANDROID_KEYCODE_X         = 52
+	ANDROID_KEYCODE_CTRL_LEFT = 113
+)
+
+// SHORTCUT_DELAY 是模拟复制按键后等应用更新剪贴板的时间
+const SHORTCUT_DELAY = 100 * time.Millisecond
+
+// SetupClipboard 接管会话的剪贴板，必须在 WaitSessionReady 之后调用
+func (s *Session) SetupClipboard() error {
+	var err error
+	switch s.sessionType {
+	case SESSION_TYPE_WAYLAND:
+		s.clipboard, err = NewWaylandClipboard(s.ctx, s.displayName, s.onClipboardChange)
+	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
+		s.clipboard, err = NewX11Clipboard(s.X11Display, s.onClipboardChange)
+	default:
+		err = fmt.Errorf("unsupported session type: %s", s.sessionType)
+	}
+	if err != nil {
+		return err
+	}
+	s.PushCleanup(s.clipboard.Close)
+	return nil
+}
+
+// GetClipboard 按 copyKey 模拟复制/剪切后读取剪贴板，发给 webscreen
+func (s *Session) GetClipboard(copyKey byte) {
+	if s.clipboard == nil {
+		return
+	}
+	if s.controller != nil {
+		switch copyKey {
+		case COPY_KEY_COPY:
+			s.controller.PressShortcut(ANDROID_KEYCODE_CTRL_LEFT, ANDROID_KEYCODE_C)
+			time.Sleep(SHORTCUT_DELAY)
+		case COPY_KEY_CUT:
+			s.controller.PressShortcut(ANDROID_KEYCODE_CTRL_LEFT, ANDROID_KEYCODE_X)
+			time.Sleep(SHORTCUT_DELAY)
+		}
+	}
+	content, err := s.clipboard.Get()
+	if err != nil {
+		s.Warnf("failed to read clipboard: %v", err)
+		return
+	}
+	s.sendClipboard(content, true)
+}
+
+// SetClipboard 把 webscreen 发来的文本放到会话的剪贴板，paste 为 true 时模拟 Ctrl+V
+func (s *Session) SetClipboard(content []byte, paste bool) {
+	if s.clipboard == nil {
+		return
+	}
+	// 自己设置的内容不再推回 webscreen
+	s.clipboardMu.Lock()
+	s.lastClipboard = content
+	s.clipboardMu.Unlock()
+	if err := s.clipboard.Set(content); err != nil {
+		s.Warnf("failed to set clipboard: %v", err)
+		return
+	}
+	if paste && s.controller != nil {
+		s.controller.PressShortcut(ANDROID_KEYCODE_CTRL_LEFT, ANDROID_KEYCODE_V)
+	}
+}
+
+func (s *Session) onClipboardChange(content []byte) {
+	s.sendClipboard(content, false)
+}
+
+// sendClipboard 以 CLIPBOARD_DATA 发送剪贴板内容，force 为 false 时跳过与上次相同的内容
+func (s *Session) sendClipboard(content []byte, force bool) {
+	if !s.ready() {
+		return
+	}
+	if len(content) > MAX_CLIPBOARD_SIZE {
+		log.Printf("Clipboard content too large (%d bytes), not sent", len(content))
+		return
+	}
+	s.clipboardMu.Lock()
+	if !force && bytes.Equal(content, s.lastClipboard) {
+		s.clipboardMu.Unlock()
+		return
+	}
+	s.lastClipboard = content
+	s.clipboardMu.Unlock()
+	if err := s.link.WriteClipboard(protocol.CLIPBOARD_DATA, content); err != nil {
+		log.Printf("Failed to send clipboard: %v", err)
+	}
+}
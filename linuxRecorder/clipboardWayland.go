@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// waylandClipboard 通过 wl-clipboard 读写 Sway 会话的剪贴板。
+// wl-paste --watch 在每次变化时输出一行，随后再用 wl-paste 取出内容。
+type waylandClipboard struct {
+	env   []string
+	watch *exec.Cmd
+}
+
+// CLIPBOARD_MIME 是设置和读取剪贴板时使用的类型
+const CLIPBOARD_MIME = "text/plain;charset=utf-8"
+
+// NewWaylandClipboard 连接 waylandDisplay（例如 wayland-1），需要安装 wl-clipboard
+func NewWaylandClipboard(ctx context.Context, waylandDisplay string, onChange func(content []byte)) (*waylandClipboard, error) {
+	for _, bin := range []string{"wl-copy", "wl-paste"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			return nil, fmt.Errorf("%s not found, install wl-clipboard: %v", bin, err)
+		}
+	}
+	// XDG_RUNTIME_DIR 已由 initWaylandEnv 设置为会话目录
+	c := &waylandClipboard{
+		env: append(os.Environ(), "WAYLAND_DISPLAY="+waylandDisplay),
+	}
+
+	c.watch = exec.CommandContext(ctx, "wl-paste", "--type", "text", "--watch", "echo")
+	c.watch.Env = c.env
+	c.watch.Stderr = os.Stderr
+	output, err := c.watch.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.watch.Start(); err != nil {
+		return nil, fmt.Errorf("start wl-paste --watch: %v", err)
+	}
+	go func() {
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			content, err := c.Get()
+			if err != nil {
+				continue // 剪贴板被清空或不是文本
+			}
+			onChange(content)
+		}
+		c.watch.Wait()
+	}()
+	return c, nil
+}
+
+func (c *waylandClipboard) Get() ([]byte, error) {
+	cmd := exec.Command("wl-paste", "--no-newline", "--type", "text")
+	cmd.Env = c.env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	content, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("wl-paste: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return content, nil
+}
+
+// Set 调用 wl-copy，它会在后台继续运行以提供内容，直到剪贴板被替换或 Sway 退出
+func (c *waylandClipboard) Set(content []byte) error {
+	cmd := exec.Command("wl-copy", "--type", CLIPBOARD_MIME)
+	cmd.Env = c.env
+	cmd.Stdin = bytes.NewReader(content)
+	// 不能捕获输出：后台的 wl-copy 继承管道，Wait 会一直等到它退出
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wl-copy: %v", err)
+	}
+	return nil
+}
+
+func (c *waylandClipboard) Close() {
+	if c.watch.Process != nil {
+		c.watch.Process.Kill()
+	}
+}
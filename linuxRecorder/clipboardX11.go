@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xfixes"
+	"github.com/jezek/xgb/xproto"
+)
+
+// X11_CLIPBOARD_MAX 是不借助 INCR 能一次传完的内容上限（核心协议单个请求最大 256KB）
+const X11_CLIPBOARD_MAX = 256000
+
+// X11_CLIPBOARD_TIMEOUT 是等剪贴板所有者转换内容的时间
+const X11_CLIPBOARD_TIMEOUT = time.Second
+
+// x11Clipboard 用一个不可见窗口持有 CLIPBOARD selection。
+// 设置时成为所有者并响应其他应用的 SelectionRequest；读取时向当前所有者请求 UTF8_STRING；
+// 通过 XFixes 监听所有者变化，得知会话中的应用复制了新内容。
+type x11Clipboard struct {
+	conn     *xgb.Conn
+	win      xproto.Window
+	onChange func(content []byte)
+
+	atomClipboard xproto.Atom
+	atomUTF8      xproto.Atom
+	atomTargets   xproto.Atom
+	atomText      xproto.Atom
+	atomIncr      xproto.Atom
+	atomProperty  xproto.Atom
+
+	// 保护 owned/content，事件循环和 Set 并发访问
+	mu      sync.Mutex
+	owned   bool
+	content []byte
+	// Get 一次只发一个请求，结果由事件循环通过 replies 送回
+	getMu   sync.Mutex
+	replies chan clipboardReply
+}
+
+type clipboardReply struct {
+	content []byte
+	err     error
+}
+
+// NewX11Clipboard 连接 display 并开始处理剪贴板事件。没有 XFixes 时仍可读写，但收不到变化通知。
+func NewX11Clipboard(display string, onChange func(content []byte)) (*x11Clipboard, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	c := &x11Clipboard{
+		conn:     conn,
+		onChange: onChange,
+		replies:  make(chan clipboardReply, 1),
+	}
+	if err := c.init(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.serve()
+	return c, nil
+}
+
+func (c *x11Clipboard) init() error {
+	for name, atom := range map[string]*xproto.Atom{
+		"CLIPBOARD":           &c.atomClipboard,
+		"UTF8_STRING":         &c.atomUTF8,
+		"TARGETS":             &c.atomTargets,
+		"TEXT":                &c.atomText,
+		"INCR":                &c.atomIncr,
+		"WEBSCREEN_CLIPBOARD": &c.atomProperty,
+	} {
+		reply, err := xproto.InternAtom(c.conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			return fmt.Errorf("intern atom %s: %v", name, err)
+		}
+		*atom = reply.Atom
+	}
+
+	win, err := xproto.NewWindowId(c.conn)
+	if err != nil {
+		return err
+	}
+	screen := xproto.Setup(c.conn).DefaultScreen(c.conn)
+	if err := xproto.CreateWindowChecked(c.conn, 0, win, screen.Root, 0, 0, 1, 1, 0,
+		xproto.WindowClassInputOnly, screen.RootVisual, 0, nil).Check(); err != nil {
+		return fmt.Errorf("create clipboard window: %v", err)
+	}
+	c.win = win
+
+	if err := c.watchOwner(); err != nil {
+		log.Printf("Warning: XFixes unavailable, clipboard changes in the session will not be pushed: %v", err)
+	}
+	return nil
+}
+
+// watchOwner 让 X server 在 CLIPBOARD 所有者变化时通知我们
+func (c *x11Clipboard) watchOwner() error {
+	if err := xfixes.Init(c.conn); err != nil {
+		return err
+	}
+	// 使用 XFixes 的其他请求之前必须先协商版本
+	if _, err := xfixes.QueryVersion(c.conn, 5, 0).Reply(); err != nil {
+		return err
+	}
+	return xfixes.SelectSelectionInputChecked(c.conn, c.win, c.atomClipboard,
+		xfixes.SelectionEventMaskSetSelectionOwner).Check()
+}
+
+// serve 处理窗口收到的事件，连接关闭后退出
+func (c *x11Clipboard) serve() {
+	for {
+		ev, err := c.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("X11 clipboard error: %v", err)
+			continue
+		}
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			c.answer(e)
+		case xproto.SelectionClearEvent:
+			// 其他应用成为了所有者
+			c.mu.Lock()
+			c.owned = false
+			c.content = nil
+			c.mu.Unlock()
+		case xproto.SelectionNotifyEvent:
+			reply := c.readProperty(e)
+			select {
+			case c.replies <- reply:
+			default:
+			}
+		case xfixes.SelectionNotifyEvent:
+			if e.Owner == c.win || e.Owner == xproto.WindowNone {
+				continue
+			}
+			// Get 依赖本循环送回结果，不能在这里同步等待
+			go func() {
+				content, err := c.Get()
+				if err != nil {
+					log.Printf("Failed to read changed clipboard: %v", err)
+					return
+				}
+				c.onChange(content)
+			}()
+		}
+	}
+}
+
+// answer 响应其他应用读取剪贴板的请求，支持 TARGETS 和文本类型
+func (c *x11Clipboard) answer(e xproto.SelectionRequestEvent) {
+	property := e.Property
+	if property == xproto.AtomNone {
+		// 旧的客户端不指定 property，约定使用 target
+		property = e.Target
+	}
+	c.mu.Lock()
+	owned, content := c.owned, c.content
+	c.mu.Unlock()
+
+	switch {
+	case !owned || e.Selection != c.atomClipboard:
+		property = xproto.AtomNone
+	case e.Target == c.atomTargets:
+		targets := []xproto.Atom{c.atomTargets, c.atomUTF8, c.atomText, xproto.AtomString}
+		buf := make([]byte, 4*len(targets))
+		for i, atom := range targets {
+			xgb.Put32(buf[i*4:], uint32(atom))
+		}
+		xproto.ChangeProperty(c.conn, xproto.PropModeReplace, e.Requestor, property,
+			xproto.AtomAtom, 32, uint32(len(targets)), buf)
+	case e.Target == c.atomUTF8 || e.Target == c.atomText || e.Target == xproto.AtomString:
+		propertyType := c.atomUTF8
+		if e.Target == xproto.AtomString {
+			propertyType = xproto.AtomString
+		}
+		xproto.ChangeProperty(c.conn, xproto.PropModeReplace, e.Requestor, property,
+			propertyType, 8, uint32(len(content)), content)
+	default:
+		property = xproto.AtomNone
+	}
+
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	xproto.SendEvent(c.conn, false, e.Requestor, xproto.EventMaskNoEvent, string(notify.Bytes()))
+}
+
+// readProperty 读取所有者转换好的内容
+func (c *x11Clipboard) readProperty(e xproto.SelectionNotifyEvent) clipboardReply {
+	if e.Property == xproto.AtomNone {
+		return clipboardReply{err: errors.New("clipboard owner cannot provide text")}
+	}
+	reply, err := xproto.GetProperty(c.conn, true, c.win, e.Property,
+		xproto.GetPropertyTypeAny, 0, MAX_CLIPBOARD_SIZE/4).Reply()
+	if err != nil {
+		return clipboardReply{err: err}
+	}
+	if reply.Type == c.atomIncr {
+		return clipboardReply{err: errors.New("clipboard content too large for a single transfer")}
+	}
+	return clipboardReply{content: reply.Value}
+}
+
+func (c *x11Clipboard) Get() ([]byte, error) {
+	c.getMu.Lock()
+	defer c.getMu.Unlock()
+
+	c.mu.Lock()
+	if c.owned {
+		content := c.content
+		c.mu.Unlock()
+		return content, nil
+	}
+	c.mu.Unlock()
+
+	// 丢弃上一次超时后才到达的结果
+	select {
+	case <-c.replies:
+	default:
+	}
+	xproto.ConvertSelection(c.conn, c.win, c.atomClipboard, c.atomUTF8, c.atomProperty, xproto.TimeCurrentTime)
+	select {
+	case reply := <-c.replies:
+		return reply.content, reply.err
+	case <-time.After(X11_CLIPBOARD_TIMEOUT):
+		return nil, errors.New("clipboard owner did not respond")
+	}
+}
+
+func (c *x11Clipboard) Set(content []byte) error {
+	if len(content) > X11_CLIPBOARD_MAX {
+		return fmt.Errorf("clipboard content too large for X11 (%d bytes, max %d)", len(content), X11_CLIPBOARD_MAX)
+	}
+	c.mu.Lock()
+	c.owned = true
+	c.content = content
+	c.mu.Unlock()
+
+	if err := xproto.SetSelectionOwnerChecked(c.conn, c.win, c.atomClipboard, xproto.TimeCurrentTime).Check(); err != nil {
+		return err
+	}
+	reply, err := xproto.GetSelectionOwner(c.conn, c.atomClipboard).Reply()
+	if err != nil {
+		return err
+	}
+	if reply.Owner != c.win {
+		return errors.New("failed to become clipboard owner")
+	}
+	return nil
+}
+
+func (c *x11Clipboard) Close() {
+	c.conn.Close()
+}
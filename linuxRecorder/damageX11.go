@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/damage"
+	"github.com/jezek/xgb/xfixes"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11Damage 用 Damage 扩展监听根窗口（包括所有子窗口）的绘制。
+// 面积不小于 minArea 的变化，以及与焦点窗口重叠的任意变化（例如打字）会调用 onDamage；
+// 其他窗口的小变化（托盘时钟、闪烁的光标）被忽略。
+type x11Damage struct {
+	conn     *xgb.Conn
+	root     xproto.Window
+	damage   damage.Damage
+	minArea  int
+	onDamage func()
+}
+
+func NewX11Damage(display string, minArea int, onDamage func()) (*x11Damage, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	// Damage 的区域操作依赖 XFixes，要先协商两个扩展的版本
+	if err := xfixes.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XFixes: %v", err)
+	}
+	if _, err := xfixes.QueryVersion(conn, 5, 0).Reply(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XFixes: %v", err)
+	}
+	if err := damage.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Damage: %v", err)
+	}
+	if _, err := damage.QueryVersion(conn, 1, 1).Reply(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Damage: %v", err)
+	}
+	d := &x11Damage{conn: conn, minArea: minArea, onDamage: onDamage}
+	d.damage, err = damage.NewDamageId(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	d.root = xproto.Setup(conn).DefaultScreen(conn).Root
+	// BoundingBox：受损区域扩大时才通知，每次通知后清空，避免大量小矩形事件
+	if err := damage.CreateChecked(conn, d.damage, xproto.Drawable(d.root), damage.ReportLevelBoundingBox).Check(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Damage: %v", err)
+	}
+	go d.serve()
+	return d, nil
+}
+
+// serve 处理 Damage 事件，连接关闭后退出
+func (d *x11Damage) serve() {
+	for {
+		ev, err := d.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if e, ok := ev.(damage.NotifyEvent); ok {
+			damage.Subtract(d.conn, d.damage, 0, 0)
+			if int(e.Area.Width)*int(e.Area.Height) >= d.minArea || d.inFocusedWindow(e.Area) {
+				d.onDamage()
+			}
+		}
+	}
+}
+
+// inFocusedWindow 返回变化区域是否与焦点窗口重叠。没有焦点窗口（焦点在根窗口上）时返回 false。
+func (d *x11Damage) inFocusedWindow(area xproto.Rectangle) bool {
+	focus, err := xproto.GetInputFocus(d.conn).Reply()
+	if err != nil || focus.Focus == xproto.WindowNone || focus.Focus == xproto.InputFocusPointerRoot || focus.Focus == d.root {
+		return false
+	}
+	geom, err := xproto.GetGeometry(d.conn, xproto.Drawable(focus.Focus)).Reply()
+	if err != nil {
+		return false
+	}
+	pos, err := xproto.TranslateCoordinates(d.conn, focus.Focus, d.root, 0, 0).Reply()
+	if err != nil {
+		return false
+	}
+	x, y := int(pos.DstX), int(pos.DstY)
+	return int(area.X) < x+int(geom.Width) && x < int(area.X)+int(area.Width) &&
+		int(area.Y) < y+int(geom.Height) && y < int(area.Y)+int(area.Height)
+}
+
+func (d *x11Damage) Close() {
+	d.conn.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"webscreen/linuxRecorder/protocol"
+)
+
+// DesktopOptions 是 -desktop/-desktop_cmd/-startup/-env/-workdir 解析后的结果
+type DesktopOptions struct {
+	Desktop        string
+	DesktopCommand string
+	Startup        []string
+	// KEY=VALUE，按变量名排序
+	Env     []string
+	WorkDir string
+}
+
+// ParseDesktopOptions 校验桌面相关的参数。startup 是命令的 JSON 数组，env 是 JSON 对象，空字符串表示不设置。
+func ParseDesktopOptions(desktop, desktopCommand, startup, env, workDir string) (*DesktopOptions, error) {
+	opts := &DesktopOptions{Desktop: desktop, DesktopCommand: desktopCommand, WorkDir: workDir}
+	switch desktop {
+	case "", DESKTOP_XFCE, DESKTOP_OPENBOX, DESKTOP_NONE:
+	case DESKTOP_CUSTOM:
+		if strings.TrimSpace(desktopCommand) == "" {
+			return nil, fmt.Errorf("desktop %s needs -desktop_cmd", DESKTOP_CUSTOM)
+		}
+	default:
+		return nil, fmt.Errorf("invalid desktop: %s", desktop)
+	}
+	if startup != "" {
+		if err := json.Unmarshal([]byte(startup), &opts.Startup); err != nil {
+			return nil, fmt.Errorf("invalid startup commands: %v", err)
+		}
+		for _, c := range opts.Startup {
+			if strings.TrimSpace(c) == "" {
+				return nil, fmt.Errorf("empty startup command")
+			}
+		}
+	}
+	if env != "" {
+		var err error
+		if opts.Env, err = protocol.ParseEnv(env); err != nil {
+			return nil, err
+		}
+	}
+	if workDir != "" {
+		if !filepath.IsAbs(workDir) {
+			return nil, fmt.Errorf("workdir must be an absolute path: %s", workDir)
+		}
+		if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("workdir is not a directory: %s", workDir)
+		}
+	}
+	return opts, nil
+}
+
+// StartDesktop 按 -desktop 启动桌面。Sway 本身就是桌面，只执行 custom 命令；window 模式不启动桌面。
+func (s *Session) StartDesktop() {
+	if s.captureMode == CAPTURE_WINDOW {
+		return
+	}
+	desktop := s.desktop.Desktop
+	if s.sessionType == SESSION_TYPE_WAYLAND {
+		switch desktop {
+		case DESKTOP_CUSTOM:
+			s.WaylandRunCmd(s.desktop.DesktopCommand)
+		case DESKTOP_XFCE, DESKTOP_OPENBOX:
+			s.Warnf("desktop %s is not available on sway, using sway", desktop)
+		}
+		return
+	}
+	switch desktop {
+	case "", DESKTOP_XFCE:
+		s.X11RunXfce4Session()
+	case DESKTOP_OPENBOX:
+		if err := s.SpawnProcess(s.x11Command("openbox-session"), "openbox-session"); err != nil {
+			s.Warnf("failed to start openbox: %v", err)
+		}
+	case DESKTOP_CUSTOM:
+		s.X11RunCmd(s.desktop.DesktopCommand)
+	}
+}
+
+// x11Command 返回在本会话显示器上运行的命令，带上 -env 和 -workdir
+func (s *Session) x11Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(s.ctx, name, args...)
+	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	cmd.Env = append(cmd.Env, s.desktop.Env...)
+	cmd.Dir = s.desktop.WorkDir
+	return cmd
+}
+
+// waylandShellCommand 给 swaymsg exec 的命令加上 -env 和 -workdir。
+// 应用由 Sway 启动，继承的是 Sway 的环境，只能在命令里设置。
+func (s *Session) waylandShellCommand(cmdStr string) string {
+	var prefix strings.Builder
+	for _, kv := range s.desktop.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		fmt.Fprintf(&prefix, "export %s=%s; ", name, shellQuote(value))
+	}
+	if s.desktop.WorkDir != "" {
+		fmt.Fprintf(&prefix, "cd %s && ", shellQuote(s.desktop.WorkDir))
+	}
+	return prefix.String() + cmdStr
+}
+
+// LaunchApp 在运行中的会话里启动一个应用，webscreen 通过 CONTROL_LAUNCH 调用
+func (s *Session) LaunchApp(cmdStr string) {
+	log.Printf("Launch app: %s", cmdStr)
+	s.RunCmd(cmdStr)
+}
+
+// shellQuote 用单引号包裹参数，供 sh 解析
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
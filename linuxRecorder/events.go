@@ -1,11 +1,14 @@
 package main
 
+import "webscreen/linuxRecorder/protocol"
+
 type EventType byte
 
+// 输入事件的类型即 FRAME_CONTROL 的控制类型，见 linuxRecorder/protocol
 const (
-	EventTypeKeyboard EventType = 0x00
-	EventTypeMouse    EventType = 0x01
-	EventTypeTouch    EventType = 0x02
+	EventTypeKeyboard EventType = EventType(protocol.CONTROL_KEY)
+	EventTypeMouse    EventType = EventType(protocol.CONTROL_MOUSE)
+	EventTypeTouch    EventType = EventType(protocol.CONTROL_TOUCH)
 )
 
 type Event interface {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// 没有明显的画面变化和输入超过 IDLE_AFTER 后视为空闲
+	IDLE_AFTER          = 3 * time.Second
+	IDLE_CHECK_INTERVAL = 500 * time.Millisecond
+	// 焦点窗口以外小于这个面积的变化（托盘时钟、其他窗口闪烁的光标）不算活动，
+	// 焦点窗口里的任何变化都算，例如打字
+	DAMAGE_MIN_AREA = 64 * 64
+)
+
+// StartIdleMonitor 监听画面变化，记录桌面是否空闲并随 FRAME_STATS 上报。
+// 降帧本身由 ffmpeg 的 mpdecimate 完成（见 decimateFilter），编码器不会因为空闲切换而重启。
+// Sway 不需要监听：wf-recorder 去掉 -D 后只在 Sway 重绘时取帧，帧率本身就随画面变化。
+func (s *Session) StartIdleMonitor() error {
+	if s.idleFrameRate <= 0 || s.sessionType == SESSION_TYPE_WAYLAND {
+		return nil
+	}
+	s.markActive()
+	d, err := NewX11Damage(s.X11Display, DAMAGE_MIN_AREA, s.markActive)
+	if err != nil {
+		return err
+	}
+	s.PushCleanup(d.Close)
+	go func() {
+		ticker := time.NewTicker(IDLE_CHECK_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				if !s.idle.Load() && time.Since(time.Unix(0, s.lastActivity.Load())) > IDLE_AFTER {
+					s.setIdle(true)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// markActive 记录画面变化或输入
+func (s *Session) markActive() {
+	s.lastActivity.Store(time.Now().UnixNano())
+	if s.idle.Load() {
+		s.setIdle(false)
+	}
+}
+
+// setIdle 切换空闲状态，只影响上报，编码器照常运行
+func (s *Session) setIdle(idle bool) {
+	if !s.idle.CompareAndSwap(!idle, idle) {
+		return
+	}
+	if idle {
+		log.Printf("Desktop idle, static frames are dropped down to %d fps", s.idleFrameRate)
+	} else {
+		log.Println("Desktop active")
+	}
+}
+
+// decimateFilter 返回丢弃静止帧的 mpdecimate 滤镜，不降帧时返回空。
+// 画面有变化的帧照常编码，不需要等待编码器重启，也不会多出 IDR；
+// max 限制连续丢弃的帧数，静止画面仍以不低于 -idle_framerate 的帧率输出。
+func (s *Session) decimateFilter(frameRate int) string {
+	if s.idleFrameRate <= 0 || s.idleFrameRate >= frameRate {
+		return ""
+	}
+	return fmt.Sprintf("mpdecimate=max=%d", max(frameRate/s.idleFrameRate-1, 1))
+}
+
+// reportFrameRate 返回随 FRAME_STATS 上报的帧率：空闲时为 -idle_framerate，但不超过采集帧率
+func (s *Session) reportFrameRate() int {
+	frameRate := int(s.encodeRate.Load())
+	if s.idle.Load() && s.idleFrameRate > 0 && s.idleFrameRate < frameRate {
+		return s.idleFrameRate
+	}
+	return frameRate
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
-	"io"
-	"net"
+	"sync"
+	"webscreen/linuxRecorder/protocol"
 
 	"github.com/bendahl/uinput"
 	"github.com/jezek/xgb"
@@ -19,11 +19,15 @@ type InputController struct {
 	// ========== uinput (Wayland) 相关成员 ==========
 	keyboard uinput.Keyboard
 	mouse    uinput.Mouse
-	touch    uinput.MultiTouch
+	// 分辨率变化时 SetScreenSize 会替换 touch，touchMu 防止和触摸事件并发，也保护 target
+	touchMu sync.Mutex
+	touch   uinput.MultiTouch
 
 	// ========== X11 (xtest) 相关成员 ==========
 	conn *xgb.Conn
 	root xproto.Window
+	// window 模式下画面只有这个窗口，触摸坐标相对它；0 表示根窗口
+	target xproto.Window
 
 	screenWidth  uint16
 	screenHeight uint16
@@ -65,15 +69,7 @@ func NewInputController(controllerType string, display string, screenWidth uint1
 			kb.Close()
 			return nil, err
 		}
-		touch, err := uinput.CreateMultiTouch(
-			"/dev/uinput",
-			[]byte("webscreen_touch"),
-			int32(0),
-			int32(screenWidth),
-			int32(0),
-			int32(screenHeight),
-			10, // max slots
-		)
+		touch, err := createTouch(screenWidth, screenHeight)
 		if err != nil {
 			kb.Close()
 			m.Close()
@@ -90,6 +86,47 @@ func NewInputController(controllerType string, display string, screenWidth uint1
 	return ic, nil
 }
 
+// createTouch 创建坐标范围与屏幕一致的虚拟触摸屏，Sway 把整个范围映射到输出上
+func createTouch(screenWidth uint16, screenHeight uint16) (uinput.MultiTouch, error) {
+	return uinput.CreateMultiTouch(
+		"/dev/uinput",
+		[]byte("webscreen_touch"),
+		int32(0),
+		int32(screenWidth),
+		int32(0),
+		int32(screenHeight),
+		10, // max slots
+	)
+}
+
+// SetScreenSize 在显示器分辨率变化后更新屏幕范围。uinput 设备的坐标范围创建后不能修改，
+// Wayland 下重新创建触摸屏；X11 直接使用根窗口坐标，只需记录新的大小。
+func (ic *InputController) SetScreenSize(screenWidth uint16, screenHeight uint16) error {
+	ic.touchMu.Lock()
+	defer ic.touchMu.Unlock()
+	ic.screenWidth = screenWidth
+	ic.screenHeight = screenHeight
+	if ic.controllerType != CONTROLLER_TYPE_WAYLAND {
+		return nil
+	}
+	touch, err := createTouch(screenWidth, screenHeight)
+	if err != nil {
+		return err
+	}
+	if ic.touch != nil {
+		ic.touch.Close()
+	}
+	ic.touch = touch
+	return nil
+}
+
+// SetTargetWindow 让 X11 的触摸坐标相对 win，win 为 0 时恢复为根窗口
+func (ic *InputController) SetTargetWindow(win xproto.Window) {
+	ic.touchMu.Lock()
+	defer ic.touchMu.Unlock()
+	ic.target = win
+}
+
 // Close 释放所有资源
 func (ic *InputController) Close() {
 	if ic.keyboard != nil {
@@ -98,62 +135,47 @@ func (ic *InputController) Close() {
 	if ic.mouse != nil {
 		ic.mouse.Close()
 	}
+	ic.touchMu.Lock()
 	if ic.touch != nil {
 		ic.touch.Close()
 	}
+	ic.touchMu.Unlock()
 	if ic.conn != nil {
 		ic.conn.Close()
 	}
 }
 
-func (ic *InputController) ServeControlConn(conn net.Conn) error {
-	head := make([]byte, 1)
-	buff := make([]byte, 256) // 足够大以容纳任何事件的完整数据包
-	for {
-		_, err := io.ReadFull(conn, head)
+// HandleControl 处理 FRAME_CONTROL 中的输入事件，args 不含控制类型字节
+func (ic *InputController) HandleControl(controlType byte, args []byte) error {
+	switch controlType {
+	case protocol.CONTROL_KEY:
+		event, err := ParseKeyboardEvent(args)
 		if err != nil {
-			return fmt.Errorf("control connection error: %w", err)
+			return err
 		}
-		eventType := EventType(head[0])
-		// log.Printf("Received event type: 0x%X", head[0])
-		switch eventType {
-		case EventTypeKeyboard:
-			if _, err := io.ReadFull(conn, buff[:5]); err != nil {
-				return fmt.Errorf("failed to read keyboard event payload: %w", err)
-			}
-			event, err := ParseKeyboardEvent(buff[:5])
-			if err != nil {
-				return fmt.Errorf("failed to parse keyboard event: %w", err)
-			}
-			ic.HandleKeyboardEvent(event.(*KeyboardEvent).action, event.(*KeyboardEvent).keyCode)
-
-		case EventTypeMouse:
-			if _, err := io.ReadFull(conn, buff[:17]); err != nil {
-				return fmt.Errorf("failed to read mouse event payload: %w", err)
-			}
-			event, err := ParseMouseEvent(buff[:17])
-			if err != nil {
-				return fmt.Errorf("failed to parse mouse event: %w", err)
-			}
-			me := event.(*MouseEvent)
-			ic.HandleMouseEvent(me.action, me.deltaX, me.deltaY, me.buttons, me.wheelDeltaX, me.wheelDeltaY)
+		ke := event.(*KeyboardEvent)
+		ic.HandleKeyboardEvent(ke.action, ke.keyCode)
 
-		case EventTypeTouch:
-			if _, err := io.ReadFull(conn, buff[:9]); err != nil {
-				return fmt.Errorf("failed to read touch event payload: %w", err)
-			}
-			event, err := ParseTouchEvent(buff[:9])
-			if err != nil {
-				return fmt.Errorf("failed to parse touch event: %w", err)
-			}
-			te := event.(*TouchEvent)
-			ic.HandleTouchEvent(te.action, te.ptrID, te.x, te.y, te.pressure, te.buttons)
+	case protocol.CONTROL_MOUSE:
+		event, err := ParseMouseEvent(args)
+		if err != nil {
+			return err
+		}
+		me := event.(*MouseEvent)
+		ic.HandleMouseEvent(me.action, me.deltaX, me.deltaY, me.buttons, me.wheelDeltaX, me.wheelDeltaY)
 
-		default:
-			return fmt.Errorf("unknown event type: 0x%X", head[0])
-			// log.Printf("收到未知事件类型: 0x%X", head[0])
+	case protocol.CONTROL_TOUCH:
+		event, err := ParseTouchEvent(args)
+		if err != nil {
+			return err
 		}
+		te := event.(*TouchEvent)
+		ic.HandleTouchEvent(te.action, te.ptrID, te.x, te.y, te.pressure, te.buttons)
+
+	default:
+		return fmt.Errorf("unknown control type: 0x%X", controlType)
 	}
+	return nil
 }
 
 // HandleMouseEvent 处理鼠标事件并分发到对应底层接口
@@ -242,6 +264,8 @@ func (ic *InputController) HandleTouchEvent(action, ptrID byte, x, y, pressure u
 
 	// 传入的 x/y 为屏幕坐标
 	if ic.controllerType == CONTROLLER_TYPE_WAYLAND {
+		ic.touchMu.Lock()
+		defer ic.touchMu.Unlock()
 		if ic.touch == nil {
 			return
 		}
@@ -260,7 +284,13 @@ func (ic *InputController) HandleTouchEvent(action, ptrID byte, x, y, pressure u
 		// X11: 将归一化坐标映射到根窗口绝对坐标
 		// absX := scaleNormalizedToRange(x, ic.rootWidth)
 		// absY := scaleNormalizedToRange(y, ic.rootHeight)
-		xproto.WarpPointer(ic.conn, 0, ic.root, 0, 0, 0, 0, int16(x), int16(y))
+		ic.touchMu.Lock()
+		dst := ic.root
+		if ic.target != 0 {
+			dst = ic.target
+		}
+		ic.touchMu.Unlock()
+		xproto.WarpPointer(ic.conn, 0, dst, 0, 0, 0, 0, int16(x), int16(y))
 
 		// X11/XTest 原生态不支持多点触控（由于X11核心协议是在触摸屏流行之前设计的）。
 		// 在这里我们将单点触控降级为鼠标操作来实现基本的“点击”和“滑动”：
@@ -337,6 +367,16 @@ func (ic *InputController) HandleKeyboardEvent(action byte, keyCode int32) {
 	}
 }
 
+// PressShortcut 依次按下 keyCodes（Android KeyCode）再逆序抬起，用于模拟 Ctrl+C 等快捷键
+func (ic *InputController) PressShortcut(keyCodes ...int32) {
+	for _, keyCode := range keyCodes {
+		ic.HandleKeyboardEvent(KeyActionDown, keyCode)
+	}
+	for i := len(keyCodes) - 1; i >= 0; i-- {
+		ic.HandleKeyboardEvent(KeyActionUp, keyCodes[i])
+	}
+}
+
 func ParseKeyboardEvent(payload []byte) (event Event, err error) {
 	if len(payload) != 5 {
 		return nil, fmt.Errorf("invalid keyboard event payload length: %d", len(payload))
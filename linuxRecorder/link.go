@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+	"webscreen/linuxRecorder/protocol"
+)
+
+// STATS_INTERVAL 是向 webscreen 发送 FRAME_STATS 的间隔
+const STATS_INTERVAL = 2 * time.Second
+
+// MAX_PENDING_CONFIGS 是排队等待应用的 CONTROL_CONFIG 上限，driver 一次只发一个，超过时直接回复错误
+const MAX_PENDING_CONFIGS = 4
+
+// linkStats 统计本周期发出的数据，serveStats 定期发送后清零
+type linkStats struct {
+	videoPackets atomic.Int64
+	videoBytes   atomic.Int64
+	audioPackets atomic.Int64
+}
+
+// Handshake 交换 Hello，hello 是本会话的实际参数。之后才能发送其他帧。
+func (s *Session) Handshake(hello protocol.Hello) error {
+	hello.Version = protocol.VERSION
+	if err := s.link.WriteHello(hello); err != nil {
+		return fmt.Errorf("send hello: %v", err)
+	}
+	peer, err := s.link.ReadHello()
+	if err != nil {
+		return fmt.Errorf("read hello: %v", err)
+	}
+	log.Printf("Handshake done, protocol version %d, capabilities %v", peer.Version, hello.Capabilities)
+
+	s.linkMu.Lock()
+	s.linkReady = true
+	warnings := s.pendingWarnings
+	s.pendingWarnings = nil
+	s.linkMu.Unlock()
+	for _, msg := range warnings {
+		s.link.WriteLog(protocol.LOG_WARN, msg)
+	}
+	go s.serveStats()
+	return nil
+}
+
+// Warnf 记录警告，并通过 FRAME_LOG 告知 webscreen；握手前的警告在握手后发送
+func (s *Session) Warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", msg)
+	s.linkMu.Lock()
+	if !s.linkReady {
+		s.pendingWarnings = append(s.pendingWarnings, msg)
+		s.linkMu.Unlock()
+		return
+	}
+	s.linkMu.Unlock()
+	s.link.WriteLog(protocol.LOG_WARN, msg)
+}
+
+// ready 判断握手是否完成，之前只能发送 Hello
+func (s *Session) ready() bool {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	return s.linkReady
+}
+
+// ServeLink 处理 webscreen 发来的帧，连接断开后返回
+func (s *Session) ServeLink() error {
+	// 重启编码器较慢，配置由一个协程按收到的顺序应用，不阻塞输入事件
+	s.configs = make(chan protocol.Config, MAX_PENDING_CONFIGS)
+	defer close(s.configs)
+	go s.serveConfigs(s.configs)
+	for {
+		frameType, payload, err := s.link.ReadFrame(nil)
+		if err != nil {
+			return fmt.Errorf("link closed: %w", err)
+		}
+		switch frameType {
+		case protocol.FRAME_CONTROL:
+			controlType, args, err := protocol.SplitTyped(payload)
+			if err != nil {
+				log.Printf("Invalid control frame: %v", err)
+				continue
+			}
+			s.handleControl(controlType, args)
+		case protocol.FRAME_CLIPBOARD:
+			op, args, err := protocol.SplitTyped(payload)
+			if err != nil {
+				log.Printf("Invalid clipboard frame: %v", err)
+				continue
+			}
+			s.handleClipboard(op, args)
+		default:
+			log.Printf("Ignore frame type 0x%02X", byte(frameType))
+		}
+	}
+}
+
+func (s *Session) handleControl(controlType byte, args []byte) {
+	switch controlType {
+	case protocol.CONTROL_CONFIG:
+		var cfg protocol.Config
+		if err := json.Unmarshal(args, &cfg); err != nil {
+			log.Printf("Invalid config payload: %v", err)
+			return
+		}
+		select {
+		case s.configs <- cfg:
+		default:
+			s.link.WriteConfigResult(protocol.ConfigResult{Seq: cfg.Seq, Error: "too many pending config updates"})
+		}
+	case protocol.CONTROL_PAUSE:
+		if len(args) != 1 {
+			log.Printf("Invalid pause payload length: %d", len(args))
+			return
+		}
+		// 按顺序同步处理，保证连续的暂停/恢复不会乱序
+		if err := s.SetPaused(args[0] == 1); err != nil {
+			log.Printf("Failed to set paused=%v: %v", args[0] == 1, err)
+		}
+	case protocol.CONTROL_LAUNCH:
+		var launch protocol.Launch
+		if err := json.Unmarshal(args, &launch); err != nil || strings.TrimSpace(launch.Command) == "" {
+			log.Printf("Invalid launch payload: %q", args)
+			return
+		}
+		go s.LaunchApp(launch.Command)
+	case protocol.CONTROL_IDR:
+		go func() {
+			if err := s.ForceKeyFrame(); err != nil {
+				log.Printf("Failed to force key frame: %v", err)
+			}
+		}()
+	default:
+		if s.controller == nil {
+			return
+		}
+		// 输入可能只移动了光标，没有触发 Damage，也要恢复帧率
+		s.markActive()
+		if err := s.controller.HandleControl(controlType, args); err != nil {
+			log.Printf("Failed to handle control 0x%02X: %v", controlType, err)
+		}
+	}
+}
+
+// serveConfigs 依次应用 CONTROL_CONFIG 并回复 FRAME_CONFIG_RESULT，driver 收到回执后才更新自己的参数
+func (s *Session) serveConfigs(configs <-chan protocol.Config) {
+	for cfg := range configs {
+		result := protocol.ConfigResult{Seq: cfg.Seq}
+		if err := s.Reconfigure(cfg.Values); err != nil {
+			log.Printf("Failed to apply config %v: %v", cfg.Values, err)
+			result.Error = err.Error()
+		}
+		if err := s.link.WriteConfigResult(result); err != nil {
+			log.Printf("Failed to send config result: %v", err)
+		}
+	}
+}
+
+func (s *Session) handleClipboard(op byte, args []byte) {
+	// 复制和粘贴会按键，和其他输入一样恢复帧率
+	s.markActive()
+	switch op {
+	case protocol.CLIPBOARD_GET:
+		if len(args) != 1 {
+			log.Printf("Invalid get clipboard payload length: %d", len(args))
+			return
+		}
+		// 读取剪贴板要等其他应用响应，放到后台执行
+		go s.GetClipboard(args[0])
+	case protocol.CLIPBOARD_SET:
+		if len(args) < 9 {
+			log.Printf("Invalid set clipboard payload length: %d", len(args))
+			return
+		}
+		// args[0:8] 是网页端的序列号，不需要回执
+		paste := args[8] == 1
+		content := args[9:]
+		if len(content) > MAX_CLIPBOARD_SIZE {
+			log.Printf("Clipboard content too large (%d bytes), ignored", len(content))
+			return
+		}
+		// 同步处理，保证随后的读取和按键看到新内容
+		s.SetClipboard(content, paste)
+	default:
+		log.Printf("Ignore clipboard op 0x%02X", op)
+	}
+}
+
+// writeMedia 发送一帧视频或音频并计入统计
+func (s *Session) writeMedia(frameType protocol.FrameType, pts uint64, data []byte) error {
+	if err := s.link.WriteMedia(frameType, pts, data); err != nil {
+		return err
+	}
+	switch frameType {
+	case protocol.FRAME_VIDEO:
+		s.stats.videoPackets.Add(1)
+		s.stats.videoBytes.Add(int64(len(data)))
+	case protocol.FRAME_AUDIO:
+		s.stats.audioPackets.Add(1)
+	}
+	return nil
+}
+
+// serveStats 每 STATS_INTERVAL 发送一次统计，直到会话结束或连接断开
+func (s *Session) serveStats() {
+	ticker := time.NewTicker(STATS_INTERVAL)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats := protocol.Stats{
+				IntervalMs:   now.Sub(last).Milliseconds(),
+				VideoPackets: s.stats.videoPackets.Swap(0),
+				VideoBytes:   s.stats.videoBytes.Swap(0),
+				AudioPackets: s.stats.audioPackets.Swap(0),
+				FrameRate:    s.reportFrameRate(),
+				Idle:         s.idle.Load(),
+			}
+			last = now
+			if err := s.link.WriteStats(stats); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// envNamePattern 是 -env 接受的变量名
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnv 是会话自己设置的变量，-env 覆盖后应用会连不上显示器
+var reservedEnv = map[string]bool{
+	"DISPLAY":         true,
+	"WAYLAND_DISPLAY": true,
+	"XDG_RUNTIME_DIR": true,
+	"SWAYSOCK":        true,
+}
+
+// ParseEnv 解析并校验 driver 的 env 配置（即 recorder 的 -env），返回按变量名排序的 KEY=VALUE。
+// driver 创建会话前和 recorder 启动时用同一份规则检查。
+func ParseEnv(env string) ([]string, error) {
+	vars := map[string]string{}
+	if err := json.Unmarshal([]byte(env), &vars); err != nil {
+		return nil, fmt.Errorf("invalid env: %v, expected a JSON object", err)
+	}
+	kvs := make([]string, 0, len(vars))
+	for name, value := range vars {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid env name: %q", name)
+		}
+		if reservedEnv[name] {
+			return nil, fmt.Errorf("env %s is set by the session", name)
+		}
+		kvs = append(kvs, name+"="+value)
+	}
+	sort.Strings(kvs)
+	return kvs, nil
+}
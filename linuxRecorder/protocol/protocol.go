@@ -0,0 +1,286 @@
+// Package protocol 定义 webscreen 的 LinuxDriver 与 recorder 之间的连接格式。
+//
+// 连接建立后 recorder 先发送 FRAME_HELLO（JSON，见 Hello），driver 读到后回复自己的 Hello，版本不同则断开。
+// 之后的每一帧都是 [Type 1][Length 4][Payload]，不同类型的数据复用同一条连接：
+//
+//	FRAME_VIDEO         recorder -> driver  [PTS 8][Annex B NALU]
+//	FRAME_AUDIO         recorder -> driver  [PTS 8][Opus 包]
+//	FRAME_CONTROL       driver -> recorder  [ControlType 1][参数]，见 CONTROL_*
+//	FRAME_CLIPBOARD     双向                [ClipboardOp 1][参数]，见 CLIPBOARD_*
+//	FRAME_LOG           recorder -> driver  [LogLevel 1][UTF-8 文本]
+//	FRAME_STATS         recorder -> driver  JSON，见 Stats
+//	FRAME_CONFIG_RESULT recorder -> driver  JSON，见 ConfigResult，按 CONTROL_CONFIG 的顺序逐个回复
+//
+// 接收方忽略不认识的帧类型和控制类型，新增类型不需要升级版本；改变已有帧的格式时升级 VERSION。
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// VERSION 是当前的协议版本，双方必须一致
+const VERSION = 2
+
+type FrameType byte
+
+const (
+	FRAME_HELLO     FrameType = 0x01
+	FRAME_VIDEO     FrameType = 0x02
+	FRAME_AUDIO     FrameType = 0x03
+	FRAME_CONTROL   FrameType = 0x04
+	FRAME_CLIPBOARD FrameType = 0x05
+	FRAME_LOG       FrameType = 0x06
+	FRAME_STATS     FrameType = 0x07
+	// FRAME_CONFIG_RESULT 是 CONTROL_CONFIG 的回执，driver 等到它之后才更新自己的参数
+	FRAME_CONFIG_RESULT FrameType = 0x08
+)
+
+const (
+	HEADER_SIZE = 5
+	// MAX_FRAME_SIZE 限制单帧大小，超过时认为连接已经错乱
+	MAX_FRAME_SIZE = 16 * 1024 * 1024
+	// MAX_AUDIO_FRAME_SIZE 限制 FRAME_AUDIO 的大小。一个 Opus 包远小于此，驱动的音频缓冲区按它分配
+	MAX_AUDIO_FRAME_SIZE = 256 * 1024
+)
+
+// maxFrameSize 返回该类型的帧允许的最大正文长度
+func maxFrameSize(t FrameType) int {
+	if t == FRAME_AUDIO {
+		return MAX_AUDIO_FRAME_SIZE
+	}
+	return MAX_FRAME_SIZE
+}
+
+// FRAME_CONTROL 的第一个字节。输入事件的参数格式沿用之前的定义，见 sdriver/linux/sendEvent.go。
+const (
+	CONTROL_KEY    byte = 0x00 // [Action 1][KeyCode 4]
+	CONTROL_MOUSE  byte = 0x01 // [Action 1][X 4][Y 4][Buttons 4][WheelX 2][WheelY 2]
+	CONTROL_TOUCH  byte = 0x02 // [Action 1][PtrID 1][X 2][Y 2][Pressure 2][Buttons 1]
+	CONTROL_CONFIG byte = 0x10 // JSON，见 Config，由 recorder 重启编码器，resolution/scale 需要 CAP_RESIZE
+	CONTROL_PAUSE  byte = 0x11 // [paused 1]，1 暂停，0 恢复
+	CONTROL_IDR    byte = 0x12 // 无参数，请求尽快输出关键帧
+	CONTROL_LAUNCH byte = 0x13 // JSON，见 Launch，需要 CAP_LAUNCH
+)
+
+// FRAME_CLIPBOARD 的第一个字节
+const (
+	CLIPBOARD_GET  byte = 0x01 // driver -> recorder [copyKey 1]
+	CLIPBOARD_SET  byte = 0x02 // driver -> recorder [Sequence 8][Paste 1][文本]
+	CLIPBOARD_DATA byte = 0x03 // recorder -> driver [文本]
+)
+
+// FRAME_LOG 的第一个字节
+const (
+	LOG_INFO  byte = 0x00
+	LOG_WARN  byte = 0x01
+	LOG_ERROR byte = 0x02
+)
+
+// Hello 中的能力，recorder 只声明实际可用的功能
+const (
+	CAP_AUDIO     = "audio"
+	CAP_CLIPBOARD = "clipboard"
+	CAP_CONFIG    = "config"
+	CAP_PAUSE     = "pause"
+	CAP_IDR       = "idr"
+	CAP_RESIZE    = "resize"
+	CAP_LAUNCH    = "launch"
+)
+
+// Launch 是 CONTROL_LAUNCH 的参数，recorder 在会话里用 shell 执行 Command
+type Launch struct {
+	Command string `json:"command"`
+}
+
+// Config 是 CONTROL_CONFIG 的参数。recorder 按收到的顺序逐个应用，每个都回复一个带相同 Seq 的 ConfigResult
+type Config struct {
+	Seq    uint64            `json:"seq"`
+	Values map[string]string `json:"values"`
+}
+
+// ConfigResult 是 FRAME_CONFIG_RESULT 的内容，Error 为空表示新参数已经生效
+type ConfigResult struct {
+	Seq   uint64 `json:"seq"`
+	Error string `json:"error,omitempty"`
+}
+
+var ErrVersionMismatch = errors.New("linux recorder protocol version mismatch")
+
+// Hello 是连接建立后的第一帧。recorder 填写会话的实际参数，driver 只需填写 Version。
+type Hello struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Width        int      `json:"width,omitempty"`
+	Height       int      `json:"height,omitempty"`
+	Codec        string   `json:"codec,omitempty"`
+	Backend      string   `json:"backend,omitempty"`
+	Display      int      `json:"display,omitempty"`
+}
+
+// Has 判断对方是否声明了某项能力，还没有握手（h 为 nil）时返回 false
+func (h *Hello) Has(capability string) bool {
+	if h == nil {
+		return false
+	}
+	for _, c := range h.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats 是 recorder 定期发送的统计，计数均为 IntervalMs 内的增量。
+// FrameRate 是编码器当前的帧率，画面静止降帧时（Idle）低于设置的 frame_rate。
+type Stats struct {
+	IntervalMs   int64 `json:"interval_ms"`
+	VideoPackets int64 `json:"video_packets"`
+	VideoBytes   int64 `json:"video_bytes"`
+	AudioPackets int64 `json:"audio_packets"`
+	FrameRate    int   `json:"frame_rate,omitempty"`
+	Idle         bool  `json:"idle,omitempty"`
+}
+
+// Conn 在一条连接上收发帧。写入是并发安全的，读取只能在一个协程中进行。
+type Conn struct {
+	rw      io.ReadWriter
+	writeMu sync.Mutex
+	header  [HEADER_SIZE]byte
+}
+
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{rw: rw}
+}
+
+// WriteFrame 把 parts 拼成一帧发送，一次 Write 写完，避免和其他协程的帧交错
+func (c *Conn) WriteFrame(t FrameType, parts ...[]byte) error {
+	size := 0
+	for _, p := range parts {
+		size += len(p)
+	}
+	if size > maxFrameSize(t) {
+		return fmt.Errorf("frame 0x%02x too large: %d bytes", byte(t), size)
+	}
+	frame := make([]byte, HEADER_SIZE, HEADER_SIZE+size)
+	frame[0] = byte(t)
+	binary.BigEndian.PutUint32(frame[1:5], uint32(size))
+	for _, p := range parts {
+		frame = append(frame, p...)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.rw.Write(frame)
+	return err
+}
+
+// ReadFrame 读取下一帧。alloc 按帧类型返回容纳正文的缓冲区，为 nil 时每帧新分配。
+func (c *Conn) ReadFrame(alloc func(t FrameType, size int) []byte) (FrameType, []byte, error) {
+	if _, err := io.ReadFull(c.rw, c.header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(c.header[1:5])
+	if size > uint32(maxFrameSize(FrameType(c.header[0]))) {
+		return 0, nil, fmt.Errorf("frame 0x%02x too large: %d bytes", c.header[0], size)
+	}
+	var payload []byte
+	if alloc != nil {
+		payload = alloc(FrameType(c.header[0]), int(size))
+	} else {
+		payload = make([]byte, size)
+	}
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	return FrameType(c.header[0]), payload, nil
+}
+
+func (c *Conn) WriteHello(h Hello) error {
+	payload, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(FRAME_HELLO, payload)
+}
+
+// ReadHello 读取对方的 Hello，第一帧不是 Hello 或版本不同时返回错误
+func (c *Conn) ReadHello() (*Hello, error) {
+	t, payload, err := c.ReadFrame(nil)
+	if err != nil {
+		return nil, err
+	}
+	if t != FRAME_HELLO {
+		return nil, fmt.Errorf("expected hello, got frame type 0x%02X", byte(t))
+	}
+	h := &Hello{}
+	if err := json.Unmarshal(payload, h); err != nil {
+		return nil, fmt.Errorf("invalid hello: %v", err)
+	}
+	if h.Version != VERSION {
+		return nil, fmt.Errorf("%w: peer %d, local %d", ErrVersionMismatch, h.Version, VERSION)
+	}
+	return h, nil
+}
+
+// WriteMedia 发送一帧视频或音频
+func (c *Conn) WriteMedia(t FrameType, pts uint64, data []byte) error {
+	var ptsBuf [8]byte
+	binary.BigEndian.PutUint64(ptsBuf[:], pts)
+	return c.WriteFrame(t, ptsBuf[:], data)
+}
+
+// ParseMedia 拆出视频或音频帧的 PTS 和数据
+func ParseMedia(payload []byte) (pts uint64, data []byte, err error) {
+	if len(payload) < 8 {
+		return 0, nil, fmt.Errorf("media frame too short: %d bytes", len(payload))
+	}
+	return binary.BigEndian.Uint64(payload[0:8]), payload[8:], nil
+}
+
+func (c *Conn) WriteControl(controlType byte, args []byte) error {
+	return c.WriteFrame(FRAME_CONTROL, []byte{controlType}, args)
+}
+
+func (c *Conn) WriteConfig(cfg Config) error {
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return c.WriteControl(CONTROL_CONFIG, payload)
+}
+
+func (c *Conn) WriteConfigResult(r ConfigResult) error {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(FRAME_CONFIG_RESULT, payload)
+}
+
+func (c *Conn) WriteClipboard(op byte, args []byte) error {
+	return c.WriteFrame(FRAME_CLIPBOARD, []byte{op}, args)
+}
+
+func (c *Conn) WriteLog(level byte, msg string) error {
+	return c.WriteFrame(FRAME_LOG, []byte{level}, []byte(msg))
+}
+
+func (c *Conn) WriteStats(s Stats) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(FRAME_STATS, payload)
+}
+
+// SplitTyped 拆出控制、剪贴板、日志帧的子类型和参数
+func SplitTyped(payload []byte) (byte, []byte, error) {
+	if len(payload) == 0 {
+		return 0, nil, errors.New("empty frame")
+	}
+	return payload[0], payload[1:], nil
+}
@@ -3,22 +3,38 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"webscreen/linuxRecorder/protocol"
+	"webscreen/linuxRecorder/slot"
 )
 
 func main() {
-	tcpPort := flag.Int("tcp_port", 27184, "server listen port")
+	tcpPort := flag.Int("tcp_port", 0, "server listen port, 0 to use the port of the allocated slot")
+	display := flag.Int("display", 0, "X display number, 0 to allocate a free slot (display, port and runtime dir)")
+	runtimeDir := flag.String("runtime_dir", "", "directory for session files, defaults to the slot directory of -display")
+	listenHost := flag.String("listen", "", "address to accept the webscreen connection on, e.g. 127.0.0.1 when started over SSH; empty for all interfaces")
 	resolution := flag.String("resolution", "1920x1080", "virtual display resolution")
 	bitRate := flag.String("bitrate", "8M", "streaming bitrate, e.g. 4M, 800K, 1000000")
 	frameRate := flag.Int("framerate", 60, "frame rate for capturing")
 	codec := flag.String("codec", "h264", "video codec: h264 or hevc")
 	// cpuSet := flag.String("cpu_set", "", "optional CPU affinity for wf-recorder, for example 0 or 0-1")
 	backend := flag.String("backend", "wayland", "capture backend: wayland, xorg, or xvfb")
+	audio := flag.Bool("audio", false, "capture desktop audio through a per-session PulseAudio/PipeWire null sink")
+	capture := flag.String("capture", CAPTURE_DESKTOP, "what to stream: desktop, or window to follow the window of -app only")
+	app := flag.String("app", "", "command to start in the session, xterm if empty")
+	desktop := flag.String("desktop", "", "desktop for xorg/xvfb: xfce (default), openbox, none, or custom to run -desktop_cmd")
+	desktopCmd := flag.String("desktop_cmd", "", "command that starts the desktop when -desktop is custom")
+	startup := flag.String("startup", "", `JSON array of extra commands to start after -app, e.g. ["firefox"]`)
+	env := flag.String("env", "", `JSON object of environment variables for the desktop and apps, e.g. {"LANG":"en_US.UTF-8"}`)
+	workDir := flag.String("workdir", "", "working directory of the desktop and apps")
+	idleFrameRate := flag.Int("idle_framerate", 5, "frame rate while the screen is static, 0 to always encode at -framerate")
 	flag.Parse()
 	log.Printf("Starting %s capturer with resolution %s, bitrate %s, framerate %d, codec %s\n", *backend, *resolution, *bitRate, *frameRate, *codec)
 
@@ -34,36 +50,117 @@ func main() {
 		return
 	}
 
+	if *capture != CAPTURE_DESKTOP && *capture != CAPTURE_WINDOW {
+		log.Printf("Invalid capture mode: %s", *capture)
+		return
+	}
+	if *app == "" {
+		*app = "xterm"
+	}
+	desktopOptions, err := ParseDesktopOptions(*desktop, *desktopCmd, *startup, *env, *workDir)
+	if err != nil {
+		log.Printf("Invalid desktop options: %v", err)
+		return
+	}
+
+	sessionSlot, owned, err := resolveSlot(*display, *tcpPort, *runtimeDir)
+	if err != nil {
+		log.Printf("Failed to allocate session slot: %v", err)
+		return
+	}
+	if owned {
+		// webscreen 没有指定槽位，由 recorder 自己分配，退出时释放
+		defer sessionSlot.Release()
+	}
+
+	// 声音服务的环境变量要在 NewSession 改写 XDG_RUNTIME_DIR 之前确定
+	var audioSink *AudioSink
+	var audioErr error
+	if *audio {
+		audioSink, audioErr = NewAudioSink(sessionSlot.Display)
+		if audioErr == nil {
+			defer audioSink.Close()
+		}
+	}
+
 	var session *Session
 
 	parentCtx := context.Background()
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
-	session, err = NewSession(*backend, ctx)
+	session, err = NewSession(*backend, sessionSlot, ctx)
 	if err != nil {
 		log.Printf("Failed to create session  %s: %v", *backend, err)
 		return
 	}
+	if audioErr != nil {
+		session.Warnf("audio disabled: %v", audioErr)
+	}
+	session.captureMode = *capture
+	session.desktop = *desktopOptions
+	session.idleFrameRate = max(*idleFrameRate, 0)
 	err = session.LaunchSession(width, height, *frameRate)
 	if err != nil {
 		log.Fatal("Failed to launch session: ", err)
 	}
-	err = session.WaitSessionReady(*tcpPort)
+	// 通过 SSH 启动时 webscreen 从 stdout 得知槽位，随后经 SSH 转发连接
+	fmt.Println(sessionSlot.Announce())
+	err = session.WaitSessionReady(*listenHost, sessionSlot.Port)
 	if err != nil {
 		log.Fatal("Failed to setup session: ", err)
 	}
+	session.StartDesktop()
+
+	capabilities := []string{protocol.CAP_CONFIG, protocol.CAP_PAUSE, protocol.CAP_IDR, protocol.CAP_LAUNCH}
+	if audioSink != nil {
+		capabilities = append(capabilities, protocol.CAP_AUDIO)
+	}
+	if session.CanResize() {
+		capabilities = append(capabilities, protocol.CAP_RESIZE)
+	}
+	if err := session.SetupClipboard(); err != nil {
+		session.Warnf("clipboard disabled: %v", err)
+	} else {
+		capabilities = append(capabilities, protocol.CAP_CLIPBOARD)
+	}
 
 	err = session.SetupController()
 	if err != nil {
-		log.Printf("Warning: Failed to setup controller: %v", err)
+		session.Warnf("failed to setup controller: %v", err)
 	}
 
+	// 握手告诉 webscreen 会话的实际参数，之后才开始收发其他帧
+	err = session.Handshake(protocol.Hello{
+		Capabilities: capabilities,
+		Width:        width,
+		Height:       height,
+		Codec:        *codec,
+		Backend:      *backend,
+		Display:      sessionSlot.Display,
+	})
+	if err != nil {
+		log.Printf("Handshake with webscreen failed: %v", err)
+		session.CleanUp()
+		return
+	}
+	go func() {
+		if err := session.ServeLink(); err != nil {
+			log.Println("控制连接关闭:", err)
+		}
+	}()
+
 	// 监听 Ctrl+C，确保退出时执行清理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigChan // 阻塞直到收到信号
 		session.CleanUp()
+		if audioSink != nil {
+			audioSink.Close()
+		}
+		if owned {
+			sessionSlot.Release()
+		}
 		os.Exit(0)
 	}()
 
@@ -72,13 +169,57 @@ func main() {
 
 	log.Printf("Recorder initialized with backend: %s", *backend)
 
-	go session.RunCmd("xterm")
+	if *capture == CAPTURE_WINDOW {
+		if err := session.StartWindowCapture(*app); err != nil {
+			session.Warnf("window capture failed: %v", err)
+			return
+		}
+	} else {
+		go session.RunCmd(*app)
+	}
+	for _, c := range desktopOptions.Startup {
+		go session.RunCmd(c)
+	}
 
 	err = session.StartRecord(*codec, *resolution, *bitRate, *frameRate)
 	if err != nil {
 		log.Printf("Failed to start recording: %v", err)
 		return
 	}
+	if err := session.StartIdleMonitor(); err != nil {
+		session.Warnf("adaptive frame rate disabled: %v", err)
+	}
+	if audioSink != nil {
+		if err := session.StartAudio(audioSink); err != nil {
+			session.Warnf("failed to start audio capture: %v", err)
+		}
+	}
+
+	// 阻塞到连接断开或编码器退出，main 返回时执行 CleanUp
+	session.ServePushFrames()
+}
 
-	go session.ServePushFrames()
+// resolveSlot 返回本次会话使用的槽位。指定了 display 时使用 webscreen 分配好的资源，
+// owned 为 false；否则自己分配一个，退出时由调用者释放。
+func resolveSlot(display, tcpPort int, runtimeDir string) (*slot.Slot, bool, error) {
+	if display == 0 {
+		s, err := slot.Allocate()
+		if err != nil {
+			return nil, false, err
+		}
+		if tcpPort != 0 {
+			s.Port = tcpPort
+		}
+		return s, true, nil
+	}
+	if tcpPort == 0 {
+		return nil, false, fmt.Errorf("-tcp_port is required with -display")
+	}
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join(slot.BaseDir(), fmt.Sprintf("session-%d", display))
+	}
+	if err := os.MkdirAll(runtimeDir, 0700); err != nil {
+		return nil, false, err
+	}
+	return &slot.Slot{Display: display, Port: tcpPort, RuntimeDir: runtimeDir}, false, nil
 }
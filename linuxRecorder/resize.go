@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// 动态调整分辨率的范围，宽高必须是偶数（yuv420p 编码要求）
+const (
+	RESIZE_MIN_WIDTH  = 320
+	RESIZE_MIN_HEIGHT = 240
+	RESIZE_MAX_WIDTH  = 7680
+	RESIZE_MAX_HEIGHT = 4320
+	RESIZE_MAX_SCALE  = 4.0
+	// BASE_DPI 是 scale 为 1 时的 DPI
+	BASE_DPI = 96
+)
+
+// CanResize 判断会话能否在运行中调整分辨率：X11 需要 xrandr，Sway 使用自带的 swaymsg
+func (s *Session) CanResize() bool {
+	bin := "xrandr"
+	if s.sessionType == SESSION_TYPE_WAYLAND {
+		bin = "swaymsg"
+	}
+	_, err := exec.LookPath(bin)
+	return err == nil
+}
+
+// resizeDisplay 把显示器调整为 resolution（WxH）和 scale，为空的参数保持不变。
+// 调用方需持有 recordMutex，并在之后重启编码器，新的 SPS 会让 webscreen 更新 MediaMeta。
+func (s *Session) resizeDisplay(resolution string, scale string, frameRate int) error {
+	width, height := s.width, s.height
+	if resolution != "" {
+		var err error
+		width, height, err = parseResolution(resolution)
+		if err != nil {
+			return err
+		}
+	}
+	dpi := 0
+	if scale != "" {
+		f, err := strconv.ParseFloat(scale, 64)
+		if err != nil || f <= 0 || f > RESIZE_MAX_SCALE {
+			return fmt.Errorf("invalid scale: %s", scale)
+		}
+		dpi = int(math.Round(BASE_DPI * f))
+	}
+	log.Printf("Resize display: %dx%d -> %dx%d, scale %q", s.width, s.height, width, height, scale)
+
+	var err error
+	switch s.sessionType {
+	case SESSION_TYPE_WAYLAND:
+		err = s.resizeSway(width, height, scale, frameRate)
+	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
+		err = s.resizeX11(width, height, frameRate)
+	default:
+		err = fmt.Errorf("unsupported session type: %s", s.sessionType)
+	}
+	if err != nil {
+		return err
+	}
+	// window 模式没有窗口管理器，由我们把应用窗口调整为新的大小
+	if s.appWindow != nil {
+		if err := s.appWindow.Resize(width, height); err != nil {
+			s.Warnf("failed to resize app window: %v", err)
+		}
+	}
+	if dpi > 0 {
+		s.setXftDPI(dpi)
+	}
+
+	s.width, s.height = width, height
+	s.recordRes = fmt.Sprintf("%dx%d", width, height)
+	if s.controller != nil {
+		if err := s.controller.SetScreenSize(uint16(width), uint16(height)); err != nil {
+			s.Warnf("failed to resize input devices: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseResolution 解析 WxH 并检查范围
+func parseResolution(resolution string) (int, int, error) {
+	w, h, ok := strings.Cut(resolution, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("invalid resolution: %s", resolution)
+	}
+	if width < RESIZE_MIN_WIDTH || width > RESIZE_MAX_WIDTH || height < RESIZE_MIN_HEIGHT || height > RESIZE_MAX_HEIGHT {
+		return 0, 0, fmt.Errorf("resolution %s out of range %dx%d - %dx%d", resolution,
+			RESIZE_MIN_WIDTH, RESIZE_MIN_HEIGHT, RESIZE_MAX_WIDTH, RESIZE_MAX_HEIGHT)
+	}
+	if width%2 != 0 || height%2 != 0 {
+		return 0, 0, fmt.Errorf("resolution %s must have even width and height", resolution)
+	}
+	return width, height, nil
+}
+
+// resizeSway 通过 swaymsg 修改 HEADLESS-1，无头输出接受任意分辨率
+func (s *Session) resizeSway(width, height int, scale string, frameRate int) error {
+	args := []string{"output", "HEADLESS-1", "resolution", fmt.Sprintf("%dx%d@%dHz", width, height, frameRate)}
+	if scale != "" {
+		args = append(args, "scale", scale)
+	}
+	_, err := s.swaymsg(args...)
+	return err
+}
+
+// resizeX11 为新分辨率添加模式并切换到它，xrandr 会随之调整屏幕大小。
+// Xvfb 从 21.1 开始支持 RandR，更早的版本会失败。
+func (s *Session) resizeX11(width, height, frameRate int) error {
+	output, err := s.x11Output()
+	if err != nil {
+		return err
+	}
+	mode := fmt.Sprintf("webscreen-%dx%d", width, height)
+	if !s.x11Modes[mode] {
+		newMode := append([]string{"--newmode", mode}, modeline(width, height, frameRate)...)
+		if err := s.xrandr(newMode...); err != nil {
+			return err
+		}
+		if err := s.xrandr("--addmode", output, mode); err != nil {
+			return err
+		}
+		if s.x11Modes == nil {
+			s.x11Modes = map[string]bool{}
+		}
+		s.x11Modes[mode] = true
+	}
+	return s.xrandr("--output", output, "--mode", mode)
+}
+
+// x11Output 返回要调整的输出：优先已连接的，其次第一个（无显示器的 modesetting 都是 disconnected）
+func (s *Session) x11Output() (string, error) {
+	cmd := exec.CommandContext(s.ctx, "xrandr", "--query")
+	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("xrandr --query: %v", err)
+	}
+	first := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] == "Screen" || strings.HasPrefix(scanner.Text(), " ") {
+			continue
+		}
+		if fields[1] == "connected" {
+			return fields[0], nil
+		}
+		if first == "" && fields[1] == "disconnected" {
+			first = fields[0]
+		}
+	}
+	if first == "" {
+		return "", fmt.Errorf("no RandR output on %s", s.X11Display)
+	}
+	return first, nil
+}
+
+func (s *Session) xrandr(args ...string) error {
+	cmd := exec.CommandContext(s.ctx, "xrandr", args...)
+	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("xrandr %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// modeline 按 CVT reduced blanking 的消隐长度生成时序，虚拟显示器只需要格式合法
+func modeline(width, height, refresh int) []string {
+	if refresh <= 0 {
+		refresh = 60
+	}
+	hTotal, vTotal := width+160, height+31
+	clock := float64(hTotal*vTotal*refresh) / 1e6
+	return []string{
+		strconv.FormatFloat(clock, 'f', 2, 64),
+		strconv.Itoa(width), strconv.Itoa(width + 48), strconv.Itoa(width + 80), strconv.Itoa(hTotal),
+		strconv.Itoa(height), strconv.Itoa(height + 3), strconv.Itoa(height + 8), strconv.Itoa(vTotal),
+		"+hsync", "-vsync",
+	}
+}
+
+// setXftDPI 更新 X 应用（包括 XWayland）使用的 Xft.dpi，只影响之后新建的窗口，失败时只记录日志
+func (s *Session) setXftDPI(dpi int) {
+	if s.sessionType == SESSION_TYPE_WAYLAND {
+		s.WaylandRunCmd(fmt.Sprintf(`echo "Xft.dpi: %d" | xrdb -merge`, dpi))
+		return
+	}
+	if err := s.xrandr("--dpi", strconv.Itoa(dpi)); err != nil {
+		log.Printf("Failed to set DPI: %v", err)
+	}
+	cmd := exec.CommandContext(s.ctx, "xrdb", "-merge")
+	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("Xft.dpi: %d\n", dpi))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("Failed to set Xft.dpi: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+}
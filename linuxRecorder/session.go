@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
@@ -11,20 +10,30 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"webscreen/linuxRecorder/protocol"
+	"webscreen/linuxRecorder/slot"
+
+	"github.com/jezek/xgb/xproto"
 )
 
 type Session struct {
 	sessionType string
 	ctx         context.Context
+	// 本会话的所有临时文件都放在 runtimeDir 下，见 slot.Slot
+	runtimeDir string
 	// XVFB/Xorg
 	X11Display     string
 	xorgConfigPath string
 	xorgLogPath    string
+	// resizeX11 已经添加过的 RandR 模式
+	x11Modes map[string]bool
 
 	// Sway
 	displayName   string
@@ -34,24 +43,80 @@ type Session struct {
 
 	frameRate string // session or recorder
 
+	// CAPTURE_DESKTOP 或 CAPTURE_WINDOW，window 模式下 X11 跟随 appWindow，见 window.go
+	captureMode string
+	appWindow   *x11Window
+	// ffmpeg -window_id 当前采集的窗口和启动时的大小，由 recordMutex 保护
+	captureWindow               xproto.Window
+	captureWidth, captureHeight int
+	// 桌面、环境变量和工作目录，所有在会话里启动的程序都会用到
+	desktop DesktopOptions
+
 	// Input Event Controller
 	controller *InputController
 	// Connect to the webscreen server
 	conn net.Conn
+	// conn 上的帧收发，见 link.go
+	link *protocol.Conn
+	// 握手完成前只能发送 Hello，期间的警告暂存到 pendingWarnings
+	linkMu          sync.Mutex
+	linkReady       bool
+	pendingWarnings []string
+	// 待应用的 CONTROL_CONFIG，由 ServeLink 创建，serveConfigs 依次处理
+	configs     chan protocol.Config
+	stats       linkStats
+	audioPaused atomic.Bool
+	// 会话的剪贴板，见 clipboard.go；lastClipboard 是最近一次收发的内容，避免重复推送
+	clipboard     Clipboard
+	clipboardMu   sync.Mutex
+	lastClipboard []byte
 	// FFmpeg/wf-recorder process
 	// FFmpeg/wf-recorder output (for logging/debugging)
 	recorderOutput io.ReadCloser
+	recorderPid    int
+	// 每次（重新）启动编码器后把输出放进来，由 ServePushFrames 依次读取
+	recorderOutputs chan io.ReadCloser
+	// 当前编码参数，Reconfigure 在此基础上修改；recordMutex 保证同一时间只有一次重启
+	recordMutex     sync.Mutex
+	recordCodec     string
+	recordRes       string
+	recordBitRate   string
+	recordFrameRate int
+	recordPaused    bool
+	// 编码器最近一次启动的时间，刚启动的编码器正在输出 IDR，不必再重启
+	recordStartedAt time.Time
+	// 画面静止时的帧率，0 表示不降帧，见 idle.go
+	idleFrameRate int
+	idle          atomic.Bool
+	lastActivity  atomic.Int64
+	// 编码器的采集帧率，空闲时随 FRAME_STATS 上报的是 -idle_framerate，见 reportFrameRate
+	encodeRate atomic.Int32
 
 	// Lifecycle management
 	cleanupOnce  sync.Once
 	cleanupMutex sync.Mutex
-	cleanupFuncs []func()
+	cleanupFuncs []cleanupFunc
+	cleanupSeq   uint64
+}
+
+type cleanupFunc struct {
+	id uint64
+	f  func()
 }
 
-func (s *Session) PushCleanup(f func()) {
+// PushCleanup 注册一个在 CleanUp 时执行的函数。资源提前释放时调用返回的 remove 把它从列表中移除，
+// 否则反复重启的编码器会让列表一直增长。
+func (s *Session) PushCleanup(f func()) (remove func()) {
 	s.cleanupMutex.Lock()
 	defer s.cleanupMutex.Unlock()
-	s.cleanupFuncs = append(s.cleanupFuncs, f)
+	s.cleanupSeq++
+	id := s.cleanupSeq
+	s.cleanupFuncs = append(s.cleanupFuncs, cleanupFunc{id: id, f: f})
+	return func() {
+		s.cleanupMutex.Lock()
+		defer s.cleanupMutex.Unlock()
+		s.cleanupFuncs = slices.DeleteFunc(s.cleanupFuncs, func(c cleanupFunc) bool { return c.id == id })
+	}
 }
 
 func (s *Session) SpawnProcess(cmd *exec.Cmd, name string) error {
@@ -63,7 +128,12 @@ func (s *Session) SpawnProcess(cmd *exec.Cmd, name string) error {
 	pid := cmd.Process.Pid
 	log.Printf("Started %s with PID %d", name, pid)
 
-	s.PushCleanup(func() {
+	var exited atomic.Bool
+	remove := s.PushCleanup(func() {
+		// 已经退出的进程不再 kill，避免 PID 被复用后误杀
+		if exited.Load() {
+			return
+		}
 		log.Printf("Killing process %s (Group PID: %d)...", name, pid)
 		syscall.Kill(-pid, syscall.SIGKILL)
 		syscall.Kill(pid, syscall.SIGKILL) // 回退补刀
@@ -72,6 +142,8 @@ func (s *Session) SpawnProcess(cmd *exec.Cmd, name string) error {
 	// 后台等待进程，专门负责收尸
 	go func() {
 		err := cmd.Wait()
+		exited.Store(true)
+		remove()
 		if err != nil {
 			log.Printf("Process %s (PID: %d) exited with error: %v", name, pid, err)
 		} else {
@@ -82,10 +154,12 @@ func (s *Session) SpawnProcess(cmd *exec.Cmd, name string) error {
 	return nil
 }
 
-func NewSession(sessionType string, ctx context.Context) (*Session, error) {
+func NewSession(sessionType string, sessionSlot *slot.Slot, ctx context.Context) (*Session, error) {
 	s := &Session{
-		sessionType: sessionType,
-		ctx:         ctx,
+		sessionType:     sessionType,
+		ctx:             ctx,
+		runtimeDir:      sessionSlot.RuntimeDir,
+		recorderOutputs: make(chan io.ReadCloser, 1),
 	}
 	switch sessionType {
 	case SESSION_TYPE_WAYLAND:
@@ -94,7 +168,7 @@ func NewSession(sessionType string, ctx context.Context) (*Session, error) {
 			return nil, fmt.Errorf("初始化 Wayland 环境失败: %v", err)
 		}
 	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
-		s.X11Display = XORG_DISPLAY // 默认使用 :99 显示器
+		s.X11Display = sessionSlot.DisplayName()
 		// 不需要额外的环境准备
 
 	default:
@@ -126,8 +200,9 @@ func (s *Session) LaunchSession(width, height, frame_rate int) error {
 	}
 }
 
-func (s *Session) WaitSessionReady(tcpPort int) error {
-	err := s.WaitTCP(tcpPort)
+// WaitSessionReady 在 listenHost:tcpPort 等待 webscreen 连接，listenHost 为空时监听所有网卡
+func (s *Session) WaitSessionReady(listenHost string, tcpPort int) error {
+	err := s.WaitTCP(listenHost, tcpPort)
 	if err != nil {
 		return err
 	}
@@ -141,10 +216,10 @@ func (s *Session) WaitSessionReady(tcpPort int) error {
 	}
 }
 
-func (s *Session) WaitTCP(port int) error {
+func (s *Session) WaitTCP(host string, port int) error {
 	var err error
 	var conn net.Conn
-	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
 		return fmt.Errorf("Failed to start TCP listener on port %d: %v", port, err)
 	}
@@ -156,6 +231,7 @@ func (s *Session) WaitTCP(port int) error {
 	listener.Close()
 	log.Println("TCP connection established:", port)
 	s.conn = conn
+	s.link = protocol.NewConn(conn)
 	return nil
 }
 
@@ -166,40 +242,50 @@ func (s *Session) SetupController() error {
 		s.controller, err = NewInputController(CONTROLLER_TYPE_WAYLAND, "", uint16(s.width), uint16(s.height))
 		if err != nil {
 			return fmt.Errorf("创建 Wayland 虚拟外设失败, 请检查 /dev/uinput 权限: %v", err)
-		} else {
-			log.Println("成功创建 Wayland 虚拟 TouchPad / Keyboard!")
-			go func() {
-				if err := s.controller.ServeControlConn(s.conn); err != nil {
-					log.Println("控制连接关闭:", err)
-				}
-			}()
 		}
+		log.Println("成功创建 Wayland 虚拟 TouchPad / Keyboard!")
 	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
 		s.controller, err = NewInputController(CONTROLLER_TYPE_X11, s.X11Display, uint16(s.width), uint16(s.height))
 		if err != nil {
 			return fmt.Errorf("创建 X11 虚拟外设失败: %v", err)
-		} else {
-			log.Println("成功创建 X11 虚拟 TouchPad / Keyboard!")
-			go func() {
-				if err := s.controller.ServeControlConn(s.conn); err != nil {
-					log.Println("控制连接关闭:", err)
-				}
-			}()
 		}
+		log.Println("成功创建 X11 虚拟 TouchPad / Keyboard!")
 	}
 	return nil
 }
 
+// ServePushFrames 把编码器输出推给 webscreen，编码器因 Reconfigure 重启时会切换到新的输出继续推送。
+// 连接断开、编码器意外退出或 ctx 结束时返回。
 func (s *Session) ServePushFrames() {
-	if s.recorderOutput == nil {
-		log.Println("Recorder output is not initialized, cannot serve frames.")
+	var output io.ReadCloser
+	select {
+	case output = <-s.recorderOutputs:
+	case <-s.ctx.Done():
 		return
 	}
-	scanner := bufio.NewScanner(s.recorderOutput)
+	for {
+		if !s.pushFrames(output) {
+			return
+		}
+		// 输出结束：如果正在重启编码器，等重启完成后应当已有新的输出
+		s.recordMutex.Lock()
+		s.recordMutex.Unlock()
+		select {
+		case output = <-s.recorderOutputs:
+		default:
+			log.Println("Recorder exited, stop pushing frames.")
+			return
+		}
+	}
+}
+
+// pushFrames 读取一个编码器输出直到 EOF，返回 false 表示连接已断开
+func (s *Session) pushFrames(output io.ReadCloser) bool {
+	defer output.Close()
+	scanner := bufio.NewScanner(output)
 	buf := make([]byte, 1024*1024)
 	scanner.Buffer(buf, 10*1024*1024)
 	scanner.Split(SplitNALU)
-	header := make([]byte, 12)
 
 	for scanner.Scan() {
 		nalData := scanner.Bytes()
@@ -208,19 +294,15 @@ func (s *Session) ServePushFrames() {
 		}
 
 		pts := uint64(time.Now().UnixNano() / 1e3)
-		binary.BigEndian.PutUint64(header[0:8], pts)
-		binary.BigEndian.PutUint32(header[8:12], uint32(len(nalData)))
-
-		framePacket := append(header, nalData...)
-		_, err := s.conn.Write(framePacket)
-		if err != nil {
+		if err := s.writeMedia(protocol.FRAME_VIDEO, pts, nalData); err != nil {
 			log.Printf("Failed to send frame data: %v", err)
-			return
+			return false
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		log.Printf("Error reading recorder output: %v", err)
 	}
+	return true
 }
 
 func (s *Session) CleanUp() {
@@ -234,7 +316,7 @@ func (s *Session) CleanUp() {
 
 		// 后进先出 (LIFO)，先清理由于依赖而后启动的组件（比如录制），最后清理底座（Sway/Xorg）
 		for i := len(funcs) - 1; i >= 0; i-- {
-			funcs[i]()
+			funcs[i].f()
 		}
 
 		if s.conn != nil {
@@ -247,7 +329,7 @@ func (s *Session) CleanUp() {
 			s.recorderOutput.Close()
 		}
 		// sway Cleanup
-		xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
+		xdgRuntimeDir := s.xdgRuntimeDir
 		if xdgRuntimeDir != "" && s.swaySock != "" {
 			os.Remove(filepath.Join(xdgRuntimeDir, s.swaySock))
 		}
@@ -267,10 +349,7 @@ func (s *Session) CleanUp() {
 		if s.X11Display == "" {
 			return
 		}
-		tmpDir := os.Getenv("TMPDIR")
-		if tmpDir == "" {
-			tmpDir = "/tmp"
-		}
+		tmpDir := slot.TmpDir()
 
 		x11displayNo, err := strconv.Atoi(strings.TrimPrefix(s.X11Display, ":"))
 		if err != nil {
@@ -316,6 +395,7 @@ func (s *Session) StartRecord(codec string, resolution string, bitRate string, f
 			log.Printf("启动 wf-recorder 失败: %v\n", err)
 			return fmt.Errorf("启动 wf-recorder 失败: %v", err)
 		}
+		s.encodeRate.Store(int32(frameRate))
 	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
 		err := s.StartFFmpeg(codec, resolution, bitRate, frameRate)
 		log.Printf("Started FFmpeg with codec %s, resolution %s, bitrate %s, framerate %d\n", codec, resolution, bitRate, frameRate)
@@ -323,10 +403,110 @@ func (s *Session) StartRecord(codec string, resolution string, bitRate string, f
 			log.Printf("启动 FFmpeg 失败: %v\n", err)
 			return fmt.Errorf("启动 FFmpeg 失败: %v", err)
 		}
+		s.encodeRate.Store(int32(frameRate))
+	}
+	s.recordCodec, s.recordRes, s.recordBitRate, s.recordFrameRate = codec, resolution, bitRate, frameRate
+	s.recordStartedAt = time.Now()
+	// 还没被 ServePushFrames 取走的旧输出已经没用了，丢掉以免阻塞
+	select {
+	case stale := <-s.recorderOutputs:
+		stale.Close()
+	default:
 	}
+	s.recorderOutputs <- s.recorderOutput
 	return nil
 }
 
+// Reconfigure 用新的参数重启编码器，支持的键：video_bit_rate、frame_rate、resolution、scale。
+// resolution/scale 先调整显示器（见 resize.go）。会话（Xorg/Sway）和 TCP 连接保持不变，
+// webscreen 端只会看到一组新的 SPS/PPS 和 IDR。
+func (s *Session) Reconfigure(cfg map[string]string) error {
+	s.recordMutex.Lock()
+	defer s.recordMutex.Unlock()
+
+	bitRate, frameRate := s.recordBitRate, s.recordFrameRate
+	resolution, scale := "", ""
+	for k, v := range cfg {
+		switch k {
+		case "video_bit_rate":
+			bitRate = v
+		case "frame_rate":
+			fps, err := strconv.Atoi(v)
+			if err != nil || fps <= 0 {
+				return fmt.Errorf("invalid frame_rate: %s", v)
+			}
+			frameRate = fps
+		case "resolution":
+			resolution = v
+		case "scale":
+			scale = v
+		default:
+			return fmt.Errorf("unsupported config key: %s", k)
+		}
+	}
+	if resolution != "" || scale != "" {
+		if err := s.resizeDisplay(resolution, scale, frameRate); err != nil {
+			return fmt.Errorf("resize display: %v", err)
+		}
+	}
+	log.Printf("Reconfigure recorder: bitrate %s -> %s, framerate %d -> %d", s.recordBitRate, bitRate, s.recordFrameRate, frameRate)
+	return s.restartRecorder(bitRate, frameRate)
+}
+
+// restartRecorder 杀掉当前编码器并用给定参数重新启动，调用方需持有 recordMutex。
+// 新编码器从 IDR 开始输出；暂停状态下启动后立即挂起。
+func (s *Session) restartRecorder(bitRate string, frameRate int) error {
+	oldBitRate, oldFrameRate := s.recordBitRate, s.recordFrameRate
+	if s.recorderPid > 0 {
+		syscall.Kill(-s.recorderPid, syscall.SIGKILL)
+	}
+	err := s.StartRecord(s.recordCodec, s.recordRes, bitRate, frameRate)
+	if err != nil {
+		// 新参数启动失败时恢复旧参数，保证画面不中断
+		log.Printf("Restart recorder failed, rollback: %v", err)
+		if err2 := s.StartRecord(s.recordCodec, s.recordRes, oldBitRate, oldFrameRate); err2 != nil {
+			return fmt.Errorf("rollback failed: %v", err2)
+		}
+	}
+	if s.recordPaused && s.recorderPid > 0 {
+		syscall.Kill(-s.recorderPid, syscall.SIGSTOP)
+	}
+	return err
+}
+
+// SetPaused 暂停时挂起编码器（SIGSTOP），恢复时重启编码器以便立即得到 IDR，
+// 挂起期间控制连接照常工作。
+func (s *Session) SetPaused(paused bool) error {
+	s.recordMutex.Lock()
+	defer s.recordMutex.Unlock()
+	if s.recordPaused == paused {
+		return nil
+	}
+	s.recordPaused = paused
+	s.audioPaused.Store(paused)
+	if paused {
+		log.Println("Pause recorder")
+		if s.recorderPid > 0 {
+			return syscall.Kill(-s.recorderPid, syscall.SIGSTOP)
+		}
+		return nil
+	}
+	log.Println("Resume recorder")
+	return s.restartRecorder(s.recordBitRate, s.recordFrameRate)
+}
+
+// ForceKeyFrame 让编码器尽快输出 IDR。ffmpeg 和 wf-recorder 都不能在运行中强制关键帧，
+// 只能重启编码器；KEYFRAME_MIN_INTERVAL 内已经启动过的编码器不再重启。
+func (s *Session) ForceKeyFrame() error {
+	s.recordMutex.Lock()
+	defer s.recordMutex.Unlock()
+	if s.recordPaused || time.Since(s.recordStartedAt) < KEYFRAME_MIN_INTERVAL {
+		return nil
+	}
+	log.Println("Restart recorder for key frame")
+	return s.restartRecorder(s.recordBitRate, s.recordFrameRate)
+}
+
 func (s *Session) Stop() {
 	s.CleanUp()
 }
@@ -1,25 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 	"webscreen/linuxRecorder/config"
 )
 
+// initWaylandEnv 把会话的运行目录作为 XDG_RUNTIME_DIR，
+// 每个 Sway 的 Wayland socket 和 IPC socket 互相隔离
 func (s *Session) initWaylandEnv() error {
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
-	if xdgRuntimeDir == "" {
-		xdgRuntimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
-		err := os.MkdirAll(xdgRuntimeDir, 0700)
-		if err != nil {
-			return fmt.Errorf("Create XDG_RUNTIME_DIR Failed: %v", err)
-		}
-		os.Setenv("XDG_RUNTIME_DIR", xdgRuntimeDir)
+	xdgRuntimeDir := s.runtimeDir
+	if err := os.MkdirAll(xdgRuntimeDir, 0700); err != nil {
+		return fmt.Errorf("Create XDG_RUNTIME_DIR Failed: %v", err)
 	}
+	// recorder 进程只服务这一个会话，子进程直接继承
+	os.Setenv("XDG_RUNTIME_DIR", xdgRuntimeDir)
 
 	s.xdgRuntimeDir = xdgRuntimeDir
 
@@ -46,6 +47,7 @@ func (s *Session) launchWaylandSession(width int, height int, frameRate int) err
 	swayCmd := exec.CommandContext(s.ctx, "sway", "--unsupported-gpu", "-c", swayConfig)
 	// swayEnv := envWithoutKey(os.Environ(), "WLR_LIBINPUT_NO_DEVICES")
 	swayCmd.Env = append(os.Environ(),
+		"XDG_RUNTIME_DIR="+s.xdgRuntimeDir,
 		// 必须同时开启 headless 和 libinput
 		"WLR_BACKENDS=headless,libinput",
 		// 告诉 libseat 去找 seatd 代理，不要自己动 tty
@@ -65,11 +67,7 @@ func (s *Session) launchWaylandSession(width int, height int, frameRate int) err
 }
 
 func (s *Session) waitWaylandReady() error {
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
-	if xdgRuntimeDir == "" {
-		xdgRuntimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
-		log.Printf("Warn: XDG_RUNTIME_DIR not set, defaulting to %s\n", xdgRuntimeDir)
-	}
+	xdgRuntimeDir := s.xdgRuntimeDir
 	for i := 0; i < 50; i++ {
 		if s.displayName == "" {
 			files, _ := filepath.Glob(filepath.Join(xdgRuntimeDir, "wayland-[0-9]*"))
@@ -94,12 +92,9 @@ func (s *Session) waitWaylandReady() error {
 
 // 补充类似于 XvfbSession 的 RunCmd 命令
 func (s *Session) WaylandRunCmd(cmdStr string) int {
-	cmd := exec.CommandContext(s.ctx, "swaymsg", "exec", cmdStr)
+	cmd := exec.CommandContext(s.ctx, "swaymsg", "exec", s.waylandShellCommand(cmdStr))
 
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
-	if xdgRuntimeDir == "" {
-		xdgRuntimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
-	}
+	xdgRuntimeDir := s.xdgRuntimeDir
 
 	swaySock := s.swaySock
 	if swaySock != "" && !filepath.IsAbs(swaySock) {
@@ -124,6 +119,32 @@ func (s *Session) WaylandRunCmd(cmdStr string) int {
 	return 0
 }
 
+// swaymsgCommand 返回连接本会话 Sway IPC 的 swaymsg 命令
+func (s *Session) swaymsgCommand(args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(s.ctx, "swaymsg", args...)
+	cmd.Env = append(os.Environ(), "XDG_RUNTIME_DIR="+s.xdgRuntimeDir)
+	if swaySock := s.swaySock; swaySock != "" {
+		if !filepath.IsAbs(swaySock) {
+			swaySock = filepath.Join(s.xdgRuntimeDir, swaySock)
+		}
+		cmd.Env = append(cmd.Env, "SWAYSOCK="+swaySock)
+	}
+	return cmd
+}
+
+// swaymsg 执行一条 Sway 命令并等待结果
+func (s *Session) swaymsg(args ...string) ([]byte, error) {
+	cmd := s.swaymsgCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("swaymsg %s: %v: %s", strings.Join(args, " "), err,
+			strings.TrimSpace(stderr.String()+string(output)))
+	}
+	return output, nil
+}
+
 func (s *Session) StartWfRecorder(codec string, resolution string, bitRate string, frameRate int) error {
 	var encoder string
 	switch codec {
@@ -150,11 +171,15 @@ func (s *Session) StartWfRecorder(codec string, resolution string, bitRate strin
 		"--codec", encoder,
 		"--file", "/dev/fd/3",
 		"-x", "yuv420p",
-		"-D",
 		"-p", "preset=veryfast",
 		"-p", "tune=zerolatency",
 	}
 
+	// -D 让 wf-recorder 按固定帧率取帧；允许降帧时去掉，只在 Sway 重绘时取帧，见 idle.go
+	if s.idleFrameRate <= 0 {
+		args = append(args, "-D")
+	}
+
 	// 根据编码格式设置不同的参数
 	if codec == "h264" {
 		// H.264 特定参数
@@ -191,9 +216,8 @@ func (s *Session) StartWfRecorder(codec string, resolution string, bitRate strin
 	commandArgs := args
 	cmd := exec.CommandContext(s.ctx, commandName, commandArgs...)
 	// 3. 设置子进程环境
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
 	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("XDG_RUNTIME_DIR=%s", xdgRuntimeDir),
+		fmt.Sprintf("XDG_RUNTIME_DIR=%s", s.xdgRuntimeDir),
 		fmt.Sprintf("WAYLAND_DISPLAY=%s", s.displayName),
 	)
 
@@ -213,5 +237,6 @@ func (s *Session) StartWfRecorder(codec string, resolution string, bitRate strin
 	pw.Close()
 
 	s.recorderOutput = pr
+	s.recorderPid = cmd.Process.Pid
 	return nil
 }
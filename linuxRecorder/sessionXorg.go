@@ -11,10 +11,11 @@ import (
 	"syscall"
 	"time"
 	"webscreen/linuxRecorder/config"
+	"webscreen/linuxRecorder/slot"
 )
 
 func (s *Session) launchXorgSession(width int, height int, frameRate int) error {
-	configPath, logPath, err := writeXorgConfig(width, height, 24)
+	configPath, logPath, err := writeXorgConfig(s.runtimeDir, width, height, 24)
 	if err != nil {
 		return fmt.Errorf("failed to write Xorg config: %w", err)
 	}
@@ -23,7 +24,7 @@ func (s *Session) launchXorgSession(width int, height int, frameRate int) error
 
 	// 👇 将 "Xorg" 改为 "X" 或者是绝对路径 "/usr/bin/X"
 	xorgCmd := exec.Command("X",
-		s.X11Display, // 使用我们指定的显示器 :99
+		s.X11Display, // 使用分配到的显示器
 		"-config", configPath,
 		"-noreset",
 		"-nolisten", "tcp",
@@ -51,19 +52,15 @@ func (s *Session) launchXorgSession(width int, height int, frameRate int) error
 
 }
 
-func writeXorgConfig(width, height, depth int) (string, string, error) {
-	configFile, err := os.CreateTemp("", "webscreen-xorg-*.conf")
+// writeXorgConfig 在会话的运行目录下写入 xorg.conf，并返回配置和日志文件路径
+func writeXorgConfig(dir string, width, height, depth int) (string, string, error) {
+	configFile, err := os.OpenFile(filepath.Join(dir, "xorg.conf"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return "", "", err
 	}
 	defer configFile.Close()
 
-	logFile, err := os.CreateTemp("", "webscreen-xorg-*.log")
-	if err != nil {
-		os.Remove(configFile.Name())
-		return "", "", err
-	}
-	logFile.Close()
+	logPath := filepath.Join(dir, "xorg.log")
 
 	var driver string
 	if fileExists("/dev/dri/card0") {
@@ -75,11 +72,10 @@ func writeXorgConfig(width, height, depth int) (string, string, error) {
 
 	if _, err := configFile.WriteString(configContent); err != nil {
 		os.Remove(configFile.Name())
-		os.Remove(logFile.Name())
 		return "", "", fmt.Errorf("failed to write Xorg config: %w", err)
 	}
 
-	return configFile.Name(), logFile.Name(), nil
+	return configFile.Name(), logPath, nil
 }
 
 func (s *Session) StartFFmpeg(codec string, resolution string, bitRate string, frameRate int) error {
@@ -112,9 +108,35 @@ func (s *Session) StartFFmpeg(codec string, resolution string, bitRate string, f
 	cmdArgs := []string{
 		"-f", "x11grab",
 		"-framerate", strconv.Itoa(frameRate),
-		"-video_size", resolution, // 使用定义的变量
-		"-i", s.X11Display, // 连到我们刚创建的 :99
-
+	}
+	var filters []string
+	if s.captureMode == CAPTURE_WINDOW {
+		windowArgs, err := s.windowCaptureArgs()
+		if err != nil {
+			return err
+		}
+		cmdArgs = append(cmdArgs, windowArgs...)
+		// 窗口的宽高可能是奇数，yuv420p 要求偶数
+		filters = append(filters, "crop=trunc(iw/2)*2:trunc(ih/2)*2")
+	} else {
+		cmdArgs = append(cmdArgs,
+			"-video_size", resolution, // 使用定义的变量
+			"-i", s.X11Display, // 连到我们刚创建的显示器
+		)
+	}
+	// 静止的帧在编码前丢掉，见 idle.go
+	decimate := s.decimateFilter(frameRate)
+	if decimate != "" {
+		filters = append(filters, decimate)
+	}
+	if len(filters) > 0 {
+		cmdArgs = append(cmdArgs, "-vf", strings.Join(filters, ","))
+	}
+	if decimate != "" {
+		// 丢帧后不能再按固定帧率补帧
+		cmdArgs = append(cmdArgs, "-fps_mode", "vfr")
+	}
+	cmdArgs = append(cmdArgs,
 		// 编码参数
 		"-c:v", bestEncoder,
 		"-b:v", bitRate,
@@ -123,7 +145,7 @@ func (s *Session) StartFFmpeg(codec string, resolution string, bitRate string, f
 		"-bf", "0", // 禁用 B 帧
 		"-preset", _preset,
 		"-pix_fmt", "yuv420p", // 注意 FFmpeg 是 -pix_fmt 而不是 -x
-	}
+	)
 
 	if codec == "h264" {
 		cmdArgs = append(cmdArgs,
@@ -167,21 +189,20 @@ func (s *Session) StartFFmpeg(codec string, resolution string, bitRate string, f
 	pw.Close()
 
 	s.recorderOutput = pr
+	s.recorderPid = cmd.Process.Pid
 	return nil
 }
 
 func (s *Session) X11RunXfce4Session() {
 	// 等待 1 秒让 Xvfb 初始化完成
-	cmd := exec.CommandContext(s.ctx, "dbus-run-session", "xfce4-session")
-	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	cmd := s.x11Command("dbus-run-session", "xfce4-session")
 	if err := s.SpawnProcess(cmd, "xfce4-session"); err != nil {
 		log.Println("failed to start Xfce4 session:", err)
 	}
 }
 
 func (s *Session) X11RunCmd(cmdStr string) {
-	cmd := exec.CommandContext(s.ctx, "bash", "-c", cmdStr)
-	cmd.Env = append(os.Environ(), "DISPLAY="+s.X11Display)
+	cmd := s.x11Command("bash", "-c", cmdStr)
 
 	// 对于直接通过 runCmd 运行的随意短命令，我们也走统一后台防僵尸处理即可
 	if err := s.SpawnProcess(cmd, "x11-runcmd"); err != nil {
@@ -191,10 +212,7 @@ func (s *Session) X11RunCmd(cmdStr string) {
 
 func (s *Session) waitX11Ready() error {
 	// 等待 Xvfb 的 Socket 文件生成，最多等 5 秒
-	tmpDir := os.Getenv("TMPDIR")
-	if tmpDir == "" {
-		tmpDir = "/tmp"
-	}
+	tmpDir := slot.TmpDir()
 	socketFile := filepath.Join(tmpDir, ".X11-unix", fmt.Sprintf("X%s", strings.TrimPrefix(s.X11Display, ":")))
 	xvfbReady := false
 	for i := 0; i < 50; i++ { // 50 * 100ms = 5秒
@@ -208,7 +226,6 @@ func (s *Session) waitX11Ready() error {
 	if !xvfbReady {
 		return fmt.Errorf("Xvfb Timeout! Socket file not found: %s", socketFile)
 	}
-	s.X11RunXfce4Session()
 	return nil
 }
 
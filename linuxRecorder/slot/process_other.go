@@ -0,0 +1,8 @@
+//go:build !unix
+
+package slot
+
+// 非 Unix 系统上不运行本地 Linux 会话，保守地认为占用者还活着
+func processAlive(pid int) bool {
+	return true
+}
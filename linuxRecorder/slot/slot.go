@@ -0,0 +1,164 @@
+// Package slot 为 Linux 桌面会话分配 X display 号、TCP 端口和运行目录。
+// webscreen 的 LinuxDriver 和 recorder 都用它，同一台机器上的多个会话互不冲突。
+//
+// 第 i 个槽位对应 display DISPLAY_START+i 和端口 PORT_START+i，
+// 占用标记是 BaseDir() 下的 session-<display> 目录（os.Mkdir 是原子的），
+// 目录里的 owner.pid 记录占用者，进程已退出的槽位会被回收。
+package slot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DISPLAY_START = 100
+	PORT_START    = 27300
+	SLOT_COUNT    = 100
+)
+
+const ownerFile = "owner.pid"
+
+// ANNOUNCE_PREFIX 是 recorder 在 stdout 输出槽位时的前缀，格式见 Announce
+const ANNOUNCE_PREFIX = "WEBSCREEN_SLOT "
+
+var ErrNoFreeSlot = errors.New("no free linux session slot")
+
+// Slot 是一个 Linux 会话占用的资源
+type Slot struct {
+	Display int
+	Port    int
+	// RuntimeDir 存放该会话的所有临时文件：recorder 程序、Xorg 配置和日志、Sway 的 XDG_RUNTIME_DIR
+	RuntimeDir string
+}
+
+// DisplayName 返回 X11 的 DISPLAY，例如 ":100"
+func (s *Slot) DisplayName() string {
+	return fmt.Sprintf(":%d", s.Display)
+}
+
+// Announce 返回 recorder 输出到 stdout 的槽位信息 "WEBSCREEN_SLOT <display> <port>"，由 ParseAnnounce 解析
+func (s *Slot) Announce() string {
+	return fmt.Sprintf("%s%d %d", ANNOUNCE_PREFIX, s.Display, s.Port)
+}
+
+// ParseAnnounce 从 recorder 的一行输出中解析槽位，不是槽位信息时 ok 为 false。
+// 远端 recorder 的运行目录在远端，返回的 Slot 没有 RuntimeDir。
+func ParseAnnounce(line string) (s *Slot, ok bool) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(line), ANNOUNCE_PREFIX)
+	if !found {
+		return nil, false
+	}
+	var display, port int
+	if _, err := fmt.Sscanf(rest, "%d %d", &display, &port); err != nil {
+		return nil, false
+	}
+	return &Slot{Display: display, Port: port}, true
+}
+
+// Release 删除运行目录，释放槽位。调用前应确保 recorder 已经退出。
+func (s *Slot) Release() {
+	if err := os.RemoveAll(s.RuntimeDir); err != nil {
+		log.Printf("[slot] Release %s: %v", s.RuntimeDir, err)
+	}
+}
+
+// TmpDir 返回 X11 socket 和锁文件所在的目录，Termux 下由 TMPDIR 指定
+func TmpDir() string {
+	tmpDir := os.Getenv("TMPDIR")
+	if tmpDir == "" {
+		tmpDir = "/tmp"
+	}
+	return tmpDir
+}
+
+// BaseDir 返回所有会话运行目录的父目录，按用户区分
+func BaseDir() string {
+	return filepath.Join(TmpDir(), fmt.Sprintf("webscreen-%d", os.Getuid()))
+}
+
+// Allocate 找一个空闲的槽位并占用，owner 为当前进程
+func Allocate() (*Slot, error) {
+	base := BaseDir()
+	if err := os.MkdirAll(base, 0700); err != nil {
+		return nil, err
+	}
+	for i := 0; i < SLOT_COUNT; i++ {
+		s := &Slot{
+			Display:    DISPLAY_START + i,
+			Port:       PORT_START + i,
+			RuntimeDir: filepath.Join(base, fmt.Sprintf("session-%d", DISPLAY_START+i)),
+		}
+		if !s.reserve() {
+			continue
+		}
+		// 目录是我们的，但 display 或端口可能被其他程序占用了
+		if displayInUse(s.Display) || !portFree(s.Port) {
+			s.Release()
+			continue
+		}
+		log.Printf("[slot] Allocated display %s, port %d, runtime dir %s", s.DisplayName(), s.Port, s.RuntimeDir)
+		return s, nil
+	}
+	return nil, ErrNoFreeSlot
+}
+
+// reserve 创建运行目录并写入 owner.pid，目录已存在且占用者已退出时回收后重试一次
+func (s *Slot) reserve() bool {
+	err := os.Mkdir(s.RuntimeDir, 0700)
+	if errors.Is(err, os.ErrExist) && s.stale() {
+		log.Printf("[slot] Reclaim stale session dir %s", s.RuntimeDir)
+		os.RemoveAll(s.RuntimeDir)
+		err = os.Mkdir(s.RuntimeDir, 0700)
+	}
+	if err != nil {
+		return false
+	}
+	pid := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(filepath.Join(s.RuntimeDir, ownerFile), []byte(pid), 0600); err != nil {
+		s.Release()
+		return false
+	}
+	return true
+}
+
+// stale 判断运行目录的占用者是否已经退出。owner.pid 还没写入时视为正在分配。
+func (s *Slot) stale() bool {
+	data, err := os.ReadFile(filepath.Join(s.RuntimeDir, ownerFile))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return true
+	}
+	return !processAlive(pid)
+}
+
+func displayInUse(display int) bool {
+	tmpDir := TmpDir()
+	for _, path := range []string{
+		filepath.Join(tmpDir, fmt.Sprintf(".X%d-lock", display)),
+		filepath.Join(tmpDir, ".X11-unix", fmt.Sprintf("X%d", display)),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
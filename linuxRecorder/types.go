@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 const (
 	SESSION_TYPE_XVFB    = "xvfb"
 	SESSION_TYPE_XORG    = "xorg"
@@ -12,6 +14,32 @@ const (
 )
 
 const (
-	XORG_DISPLAY = ":99"
-	COLOR_DEPTH  = 24
+	COLOR_DEPTH = 24
+)
+
+// -capture 的取值：整个桌面，或只推送 -app 的窗口（见 window.go）
+const (
+	CAPTURE_DESKTOP = "desktop"
+	CAPTURE_WINDOW  = "window"
+)
+
+// -desktop 的取值，为空时 X11 启动 Xfce；Sway 本身就是桌面，只支持 custom（见 desktop.go）
+const (
+	DESKTOP_XFCE    = "xfce"
+	DESKTOP_OPENBOX = "openbox"
+	DESKTOP_NONE    = "none"
+	DESKTOP_CUSTOM  = "custom"
+)
+
+// GetClipboard 的 copyKey，与 scrcpy 相同
+const (
+	COPY_KEY_NONE = 0
+	COPY_KEY_COPY = 1
+	COPY_KEY_CUT  = 2
 )
+
+// MAX_CLIPBOARD_SIZE 是接受的剪贴板内容上限，更大的内容直接丢弃
+const MAX_CLIPBOARD_SIZE = 1 << 20
+
+// KEYFRAME_MIN_INTERVAL 是两次为关键帧重启编码器的最小间隔
+const KEYFRAME_MIN_INTERVAL = 2 * time.Second
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// window 模式下等待应用窗口出现的时间
+const WINDOW_WAIT_TIMEOUT = 15 * time.Second
+
+// 被跟随的窗口关闭后，等待应用打开新窗口（例如启动画面之后的主窗口）的时间，超时后结束会话
+const WINDOW_LOST_TIMEOUT = 3 * time.Second
+
+// StartWindowCapture 启动 app 并等待它的第一个顶层窗口，之后只推送这个窗口的画面：
+// X11 用 ffmpeg 的 -window_id 采集并把输入坐标换算到窗口内；Sway 把窗口全屏到 HEADLESS-1。
+// 窗口关闭后改为跟随应用的下一个窗口，应用没有窗口时结束会话。
+func (s *Session) StartWindowCapture(app string) error {
+	switch s.sessionType {
+	case SESSION_TYPE_XORG, SESSION_TYPE_XVFB:
+		w, err := NewX11Window(s.X11Display, s.followAppWindow, s.onAppClosed)
+		if err != nil {
+			return fmt.Errorf("track X11 windows: %v", err)
+		}
+		s.PushCleanup(w.Close)
+		s.appWindow = w
+		s.RunCmd(app)
+		return w.Wait(WINDOW_WAIT_TIMEOUT)
+	case SESSION_TYPE_WAYLAND:
+		w, err := NewSwayWindow(s, s.onAppClosed)
+		if err != nil {
+			return fmt.Errorf("track sway windows: %v", err)
+		}
+		s.PushCleanup(w.Close)
+		s.RunCmd(app)
+		return w.Wait(WINDOW_WAIT_TIMEOUT)
+	default:
+		return fmt.Errorf("unsupported session type: %s", s.sessionType)
+	}
+}
+
+// followAppWindow 在 X11 窗口改变大小或换成另一个窗口时重启编码器，移动窗口不需要重启
+func (s *Session) followAppWindow() {
+	s.recordMutex.Lock()
+	defer s.recordMutex.Unlock()
+	if s.appWindow == nil {
+		return
+	}
+	win := s.appWindow.Window()
+	if win == 0 || s.recorderPid == 0 {
+		return
+	}
+	width, height, err := s.appWindow.Size()
+	if err != nil {
+		return
+	}
+	if win == s.captureWindow && width == s.captureWidth && height == s.captureHeight {
+		return
+	}
+	log.Printf("App window 0x%x changed to %dx%d, restart recorder", win, width, height)
+	if err := s.restartRecorder(s.recordBitRate, s.recordFrameRate); err != nil {
+		s.Warnf("failed to follow app window: %v", err)
+	}
+}
+
+// windowCaptureArgs 返回采集当前应用窗口的 x11grab 输入参数，记录采集的窗口和大小，
+// 并让触摸坐标相对这个窗口。调用方需持有 recordMutex。
+func (s *Session) windowCaptureArgs() ([]string, error) {
+	if s.appWindow == nil {
+		return nil, fmt.Errorf("no app window to capture")
+	}
+	win := s.appWindow.Window()
+	width, height, err := s.appWindow.Size()
+	if err != nil {
+		return nil, err
+	}
+	s.captureWindow, s.captureWidth, s.captureHeight = win, width, height
+	if s.controller != nil {
+		s.controller.SetTargetWindow(win)
+	}
+	return []string{
+		"-window_id", fmt.Sprintf("0x%x", uint32(win)),
+		"-i", s.X11Display,
+	}, nil
+}
+
+func (s *Session) onAppClosed() {
+	s.Warnf("the application has no window left, ending session")
+	s.CleanUp()
+}
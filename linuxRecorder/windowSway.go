@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// swayNode 是 swaymsg -t get_tree 和窗口事件中的容器，只取用到的字段
+type swayNode struct {
+	ID            int64      `json:"id"`
+	Type          string     `json:"type"`
+	PID           int        `json:"pid"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+type swayWindowEvent struct {
+	Change    string   `json:"change"`
+	Container swayNode `json:"container"`
+}
+
+// swayWindow 通过 swaymsg -t subscribe 监听窗口事件，把跟随的容器全屏到 HEADLESS-1。
+// 全屏后输出的画面就是这个窗口，wf-recorder 和输入坐标都不需要换算，调整分辨率时窗口也会跟着变化。
+type swayWindow struct {
+	session *Session
+	watch   *exec.Cmd
+	onClose func()
+
+	// 保护 con/lostTimer
+	mu        sync.Mutex
+	con       int64
+	lostTimer *time.Timer
+	found     chan struct{}
+	foundOnce sync.Once
+}
+
+// NewSwayWindow 开始监听窗口事件，要在启动应用之前调用，避免错过第一个窗口
+func NewSwayWindow(s *Session, onClose func()) (*swayWindow, error) {
+	w := &swayWindow{
+		session: s,
+		onClose: onClose,
+		found:   make(chan struct{}),
+	}
+	w.watch = s.swaymsgCommand("-t", "subscribe", "-m", "-r", `["window"]`)
+	w.watch.Stderr = os.Stderr
+	output, err := w.watch.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.watch.Start(); err != nil {
+		return nil, fmt.Errorf("start swaymsg subscribe: %v", err)
+	}
+	go func() {
+		decoder := json.NewDecoder(output)
+		for {
+			var event swayWindowEvent
+			if err := decoder.Decode(&event); err != nil {
+				break
+			}
+			w.handle(event)
+		}
+		w.watch.Wait()
+	}()
+	return w, nil
+}
+
+// Wait 等待第一个应用窗口
+func (w *swayWindow) Wait(timeout time.Duration) error {
+	select {
+	case <-w.found:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("no application window appeared")
+	}
+}
+
+func (w *swayWindow) Close() {
+	w.mu.Lock()
+	if w.lostTimer != nil {
+		w.lostTimer.Stop()
+	}
+	w.mu.Unlock()
+	if w.watch.Process != nil {
+		w.watch.Process.Kill()
+	}
+}
+
+func (w *swayWindow) handle(event swayWindowEvent) {
+	w.mu.Lock()
+	current := w.con
+	w.mu.Unlock()
+	switch event.Change {
+	case "new":
+		if current == 0 {
+			w.follow(event.Container.ID)
+		}
+	case "close":
+		if event.Container.ID != current {
+			return
+		}
+		log.Printf("App container %d closed", current)
+		w.mu.Lock()
+		w.con = 0
+		w.mu.Unlock()
+		if id := w.findWindow(); id != 0 {
+			w.follow(id)
+			return
+		}
+		w.mu.Lock()
+		w.lostTimer = time.AfterFunc(WINDOW_LOST_TIMEOUT, func() {
+			w.mu.Lock()
+			con := w.con
+			w.mu.Unlock()
+			if con == 0 {
+				w.onClose()
+			}
+		})
+		w.mu.Unlock()
+	}
+}
+
+// follow 全屏容器 id 并跟随它
+func (w *swayWindow) follow(id int64) {
+	if _, err := w.session.swaymsg(fmt.Sprintf("[con_id=%d]", id), "fullscreen", "enable"); err != nil {
+		log.Printf("Failed to fullscreen container %d: %v", id, err)
+		return
+	}
+	w.mu.Lock()
+	w.con = id
+	if w.lostTimer != nil {
+		w.lostTimer.Stop()
+		w.lostTimer = nil
+	}
+	w.mu.Unlock()
+	log.Printf("Following app container %d", id)
+	w.foundOnce.Do(func() { close(w.found) })
+}
+
+// findWindow 返回树中的第一个应用窗口（有 pid 的容器），没有时返回 0
+func (w *swayWindow) findWindow() int64 {
+	output, err := w.session.swaymsg("-t", "get_tree", "-r")
+	if err != nil {
+		log.Printf("Failed to read sway tree: %v", err)
+		return 0
+	}
+	var root swayNode
+	if err := json.Unmarshal(output, &root); err != nil {
+		return 0
+	}
+	return firstWindow(root)
+}
+
+func firstWindow(node swayNode) int64 {
+	if node.PID > 0 && (node.Type == "con" || node.Type == "floating_con") {
+		return node.ID
+	}
+	for _, children := range [][]swayNode{node.Nodes, node.FloatingNodes} {
+		for _, child := range children {
+			if id := firstWindow(child); id != 0 {
+				return id
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// WINDOW_MIN_SIZE 以下的窗口（例如隐藏的辅助窗口）不作为应用窗口
+const WINDOW_MIN_SIZE = 16
+
+// x11Window 通过根窗口的 SubstructureNotify 发现应用映射的顶层窗口，并跟随其中一个。
+// window 模式不启动窗口管理器，映射出来的普通窗口就是应用自己的。
+type x11Window struct {
+	conn     *xgb.Conn
+	root     xproto.Window
+	onChange func()
+	onClose  func()
+
+	// 保护 win/lostTimer，事件循环和采集协程并发访问
+	mu        sync.Mutex
+	win       xproto.Window
+	lostTimer *time.Timer
+	found     chan struct{}
+	foundOnce sync.Once
+}
+
+// NewX11Window 连接 display 并开始监听窗口。跟随的窗口大小改变或换成另一个窗口时调用 onChange，
+// 窗口关闭且 WINDOW_LOST_TIMEOUT 内没有新窗口时调用 onClose。
+func NewX11Window(display string, onChange func(), onClose func()) (*x11Window, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	w := &x11Window{
+		conn:     conn,
+		root:     xproto.Setup(conn).DefaultScreen(conn).Root,
+		onChange: onChange,
+		onClose:  onClose,
+		found:    make(chan struct{}),
+	}
+	if err := xproto.ChangeWindowAttributesChecked(conn, w.root, xproto.CwEventMask,
+		[]uint32{xproto.EventMaskSubstructureNotify}).Check(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go w.serve()
+	return w, nil
+}
+
+// Wait 等待第一个应用窗口
+func (w *x11Window) Wait(timeout time.Duration) error {
+	select {
+	case <-w.found:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("no application window appeared")
+	}
+}
+
+// Window 返回当前跟随的窗口，没有时返回 0
+func (w *x11Window) Window() xproto.Window {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.win
+}
+
+// Size 从 X server 读取窗口当前的大小
+func (w *x11Window) Size() (int, int, error) {
+	win := w.Window()
+	if win == 0 {
+		return 0, 0, errors.New("no application window")
+	}
+	geo, err := xproto.GetGeometry(w.conn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(geo.Width), int(geo.Height), nil
+}
+
+// Resize 把窗口移到左上角并改成 width x height，返回时 X server 已经处理完请求
+func (w *x11Window) Resize(width, height int) error {
+	win := w.Window()
+	if win == 0 {
+		return errors.New("no application window")
+	}
+	return xproto.ConfigureWindowChecked(w.conn, win,
+		xproto.ConfigWindowX|xproto.ConfigWindowY|xproto.ConfigWindowWidth|xproto.ConfigWindowHeight,
+		[]uint32{0, 0, uint32(width), uint32(height)}).Check()
+}
+
+func (w *x11Window) Close() {
+	w.mu.Lock()
+	if w.lostTimer != nil {
+		w.lostTimer.Stop()
+	}
+	w.mu.Unlock()
+	w.conn.Close()
+}
+
+// serve 处理窗口事件，连接关闭后退出
+func (w *x11Window) serve() {
+	for {
+		ev, err := w.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		if err != nil {
+			continue // 窗口可能在查询属性前就销毁了
+		}
+		switch e := ev.(type) {
+		case xproto.MapNotifyEvent:
+			if w.Window() == 0 && w.isAppWindow(e.Window) {
+				w.follow(e.Window)
+			}
+		case xproto.ConfigureNotifyEvent:
+			if e.Window == w.Window() {
+				go w.onChange()
+			}
+		case xproto.UnmapNotifyEvent:
+			w.lost(e.Window)
+		case xproto.DestroyNotifyEvent:
+			w.lost(e.Window)
+		}
+	}
+}
+
+// isAppWindow 判断是否是可以采集的普通顶层窗口
+func (w *x11Window) isAppWindow(win xproto.Window) bool {
+	attrs, err := xproto.GetWindowAttributes(w.conn, win).Reply()
+	if err != nil || attrs.Class != xproto.WindowClassInputOutput || attrs.OverrideRedirect ||
+		attrs.MapState != xproto.MapStateViewable {
+		return false
+	}
+	geo, err := xproto.GetGeometry(w.conn, xproto.Drawable(win)).Reply()
+	return err == nil && geo.Width >= WINDOW_MIN_SIZE && geo.Height >= WINDOW_MIN_SIZE
+}
+
+// findWindow 在已经映射的顶层窗口中找一个来跟随，找到时返回 true
+func (w *x11Window) findWindow() bool {
+	tree, err := xproto.QueryTree(w.conn, w.root).Reply()
+	if err != nil {
+		return false
+	}
+	// 子窗口按从下到上排列，优先最上面的
+	for i := len(tree.Children) - 1; i >= 0; i-- {
+		if w.isAppWindow(tree.Children[i]) {
+			w.follow(tree.Children[i])
+			return true
+		}
+	}
+	return false
+}
+
+func (w *x11Window) follow(win xproto.Window) {
+	// 监听窗口自己的大小变化
+	xproto.ChangeWindowAttributes(w.conn, win, xproto.CwEventMask, []uint32{xproto.EventMaskStructureNotify})
+	w.mu.Lock()
+	w.win = win
+	if w.lostTimer != nil {
+		w.lostTimer.Stop()
+		w.lostTimer = nil
+	}
+	w.mu.Unlock()
+	log.Printf("Following app window 0x%x", win)
+	w.foundOnce.Do(func() { close(w.found) })
+	go w.onChange()
+}
+
+// lost 处理跟随的窗口被隐藏或销毁，换成其他窗口或等待应用打开新窗口
+func (w *x11Window) lost(win xproto.Window) {
+	w.mu.Lock()
+	if win != w.win {
+		w.mu.Unlock()
+		return
+	}
+	w.win = 0
+	w.mu.Unlock()
+	log.Printf("App window 0x%x closed", win)
+	if w.findWindow() {
+		return
+	}
+	w.mu.Lock()
+	w.lostTimer = time.AfterFunc(WINDOW_LOST_TIMEOUT, func() {
+		if w.Window() == 0 {
+			w.onClose()
+		}
+	})
+	w.mu.Unlock()
+}
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"webscreen/sdriver/dummy"
 	"webscreen/webservice"
 )
 
@@ -18,6 +20,9 @@ func main() {
 	host := flag.String("host", "0.0.0.0", "host to bind the server to")
 	port := flag.String("port", "8081", "server port")
 	pin := flag.String("pin", "123456", "initial PIN for web access")
+	codecPreference := flag.String("codec_preference", "h265,h264,av1", "video codec preference when video_codec is auto, comma separated")
+	enableLaunch := flag.Bool("enable_launch", false, "enable POST /api/session/:id/launch, which runs any command in a Linux session; needs a PIN")
+	mediaDir := flag.String("media_dir", "media", "directory the dummy driver's file_path and audio_file_path are resolved against")
 	flag.Parse()
 	// pin should be 6 digits and only digits
 	if *pin == "DISABLED" {
@@ -39,6 +44,9 @@ func main() {
 	pub, _ := fs.Sub(publicFS, "public")
 	webMaster := webservice.Default(pub)
 	webMaster.SetPIN(*pin)
+	webMaster.SetCodecPreference(strings.Split(*codecPreference, ","))
+	webMaster.SetLaunchEnabled(*enableLaunch)
+	dummy.SetMediaDir(*mediaDir)
 
 	go webMaster.Serve(*host, *port)
 
@@ -0,0 +1,27 @@
+(function() {
+// 与 linuxRecorder/resize.go 的范围一致
+const MIN_WIDTH = 320, MIN_HEIGHT = 240;
+const MAX_WIDTH = 7680, MAX_HEIGHT = 4320;
+
+function clampEven(value, min, max) {
+    value = Math.min(Math.max(value, min), max);
+    return Math.floor(value / 2) * 2; // 编码器要求宽高为偶数
+}
+
+// fitToWindow 按视频区域的物理像素请求桌面分辨率，scale 使用 devicePixelRatio，
+// 画面一比一显示，不再被浏览器缩放。生效后服务端推送 0x66 (TYPE_MEDIA_META)
+function fitToWindow() {
+    const rect = document.querySelector('.video-container').getBoundingClientRect();
+    const ratio = window.devicePixelRatio || 1;
+    const width = clampEven(Math.round(rect.width * ratio), MIN_WIDTH, MAX_WIDTH);
+    const height = clampEven(Math.round(rect.height * ratio), MIN_HEIGHT, MAX_HEIGHT);
+    sendDriverConfigUpdate({
+        resolution: `${width}x${height}`,
+        scale: String(Math.round(ratio * 100) / 100),
+    });
+    showToast(i18n.t('fit_to_window_requested', { width: width, height: height }), 2000);
+}
+
+window.document.querySelector('#fitWindowButton').addEventListener('click', fitToWindow);
+
+})();
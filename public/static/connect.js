@@ -120,6 +120,17 @@ async function start() {
                     console.log("Text message from agent:", textMsg);
                     showToast(textMsg, 3000);
                     break;
+                case 0x66: // TYPE_MEDIA_META
+                    const meta = JSON.parse(decoder.decode(view.slice(1)));
+                    console.log("Media meta updated:", meta);
+                    window.mediaMeta = meta;
+                    window.dispatchEvent(new CustomEvent('mediameta', { detail: meta }));
+                    showToast(i18n.t('media_meta_updated', { width: meta.width, height: meta.height, fps: meta.fps }), 3000);
+                    break;
+                case 0x67: // TYPE_PAUSE
+                    setPausedState(view[1] === 1);
+                    showToast(i18n.t(view[1] === 1 ? 'stream_paused' : 'stream_resumed'), 2000);
+                    break;
                 default:
                     console.warn("Unknown binary message type:", view[0]);
                 }
@@ -166,7 +177,13 @@ async function start() {
                     switch (message.stage) {
                         case 'webrtc_init':
                             let answerSdp = message.sdp;
-                            console.log("Received SDP Answer");
+                            console.log("Received SDP Answer, video codec:", message.video_codec);
+                            // 同一设备可能同时有多个编码组，会话 API 用它找到自己所在的组
+                            window.videoCodec = message.video_codec;
+                            // video_codec 为 auto 或浏览器不支持指定的编码时，服务端会自动选择
+                            if (message.video_codec && CONFIG.driver_config && message.video_codec !== CONFIG.driver_config.video_codec) {
+                                showToast(i18n.t('video_codec_selected', { codec: message.video_codec.toUpperCase() }), 3000);
+                            }
                             if (!answerSdp.length) {
                                 console.error("Empty SDP Answer received");
                                 showToast(i18n.t('error_empty_sdp_answer'), 2000);
@@ -196,6 +213,8 @@ async function start() {
                             const media_meta = message.media_meta;
                             console.log("Driver Capabilities:", capabilities);
                             console.log("Media Meta:", media_meta);
+                            window.mediaMeta = media_meta;
+                            setPausedState(message.paused === true);
                             // Update UI based on capabilities
                             await updateUIBasedOnCapabilities(capabilities);
                             setInterval(() => force_sync(pc), 1000);
@@ -241,6 +260,51 @@ function sendDataChannelMessage(channel, msg) {
     }
 }
 
+// sendDriverConfigUpdate 在不重连的情况下修改驱动参数，例如 { video_bit_rate: "8M", max_fps: 30 }
+// 生效后服务端会通过 0x66 (TYPE_MEDIA_META) 推送新的 MediaMeta
+function sendDriverConfigUpdate(cfg) {
+    const payload = new TextEncoder().encode(JSON.stringify(cfg));
+    const msg = new Uint8Array(1 + payload.length);
+    msg[0] = 0x65; // TYPE_UPDATE_CONFIG
+    msg.set(payload, 1);
+    sendDataChannelMessage(window.dataChannelOrdered, msg.buffer);
+}
+
+// togglePause 切换隐私模式：暂停后服务端停止推流但控制仍然可用，所有观看者都会收到 0x67 (TYPE_PAUSE)
+function togglePause() {
+    const msg = new Uint8Array([0x67, window.streamPaused ? 0 : 1]);
+    sendDataChannelMessage(window.dataChannelOrdered, msg.buffer);
+}
+
+function setPausedState(paused) {
+    window.streamPaused = paused;
+    const overlay = document.getElementById('pausedOverlay');
+    if (overlay) {
+        overlay.style.display = paused ? 'flex' : 'none';
+    }
+    const button = document.getElementById('pauseButton');
+    if (button) {
+        button.classList.toggle('active', paused);
+    }
+}
+
+// saveReplay 把服务端即时回放缓冲中最近的内容保存为 MP4，可在 /api/recording/list 中下载
+async function saveReplay() {
+    const id = `${CONFIG.device_type}_${CONFIG.device_id}_${CONFIG.device_ip}_${CONFIG.device_port}`;
+    const query = window.videoCodec ? `?codec=${encodeURIComponent(window.videoCodec)}` : '';
+    try {
+        const response = await fetch(`/api/session/${encodeURIComponent(id)}/replay/save${query}`, { method: 'POST' });
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || response.statusText);
+        }
+        showToast(i18n.t('replay_saved', { name: data.name }), 3000);
+    } catch (e) {
+        console.error('Failed to save replay:', e);
+        showToast(i18n.t('replay_save_failed', { msg: e.message }), 3000);
+    }
+}
+
 let lastJitterDelay = 0;
 let lastEmittedCount = 0;
 
@@ -355,6 +419,15 @@ async function updateUIBasedOnCapabilities(caps) {
                 console.error("Failed to load clipboard script", e);
             }
         }
+        // Handle Resize
+        if (caps.can_resize) {
+            try {
+                await loadScript('/static/capabilities/resize.js');
+                show('.feature-resize');
+            } catch (e) {
+                console.error("Failed to load resize script", e);
+            }
+        }
         // Handle UHID
         if (caps.can_uhid) {
             try {
@@ -228,6 +228,17 @@ function renderDeviceList() {
                 <span class="material-symbols-rounded">visibility_off</span>
             </button>`;
 
+        // 持久会话可以结束；脱离中的会话标出状态
+        let terminateBtnHtml = '';
+        if (typeof device !== 'string' && device.terminable) {
+            terminateBtnHtml = `<button onclick="terminateDevice('${serial}')" class="p-2 rounded-full hover:bg-white/10 text-red-400 transition-colors" title="${i18n.t('terminate_session')}">
+                <span class="material-symbols-rounded">power_settings_new</span>
+            </button>`;
+            if (device.status === 'detached') {
+                tagsHtml = `<span class="px-2 py-0.5 rounded-md bg-[#333] text-xs text-orange-300 font-mono">${i18n.t('session_detached')}</span>` + tagsHtml;
+            }
+        }
+
         card.innerHTML = `
                     <div>
                         <div class="flex justify-between items-start mb-4">
@@ -240,6 +251,7 @@ function renderDeviceList() {
                                 </div>
                             </div>
                             <div class="flex items-center">
+                                ${terminateBtnHtml}
                                 ${ignoreBtnHtml}
                                 <button onclick="showConfigModal('${serial}')" class="p-2 rounded-full hover:bg-white/10 text-gray-400 transition-colors" title="Settings">
                                     <span class="material-symbols-rounded">settings</span>
@@ -358,6 +370,30 @@ async function connectDevice() {
     }
 }
 
+async function terminateDevice(serial) {
+    const device = knownDevices.find(d => d.device_id === serial);
+    if (!device || !confirm(i18n.t('confirm_terminate_session'))) return;
+
+    try {
+        const response = await fetch('/api/device/terminate', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ device_type: device.device_type, device_id: serial })
+        });
+
+        if (response.ok) {
+            showToast(i18n.t('session_terminated'));
+            fetchDevices();
+        } else {
+            const data = await response.json();
+            throw new Error(data.error || i18n.t('call_api_failed'));
+        }
+    } catch (error) {
+        console.error(error);
+        showToast(i18n.t('call_api_failed'), 'error');
+    }
+}
+
 async function pairDevice() {
     const ip = document.getElementById('pairIP').value;
     const port = document.getElementById('pairPort').value;
@@ -407,6 +443,7 @@ function startStream(serial) {
         device_port: config.device_port || '0',
         av_sync: config.av_sync || false,
         use_local_timestamp: config.use_local_timestamp || false,
+        replay_seconds: config.replay_seconds !== undefined ? (parseInt(config.replay_seconds, 10) || 0) : 0,
         driver_config: drv
     };
     
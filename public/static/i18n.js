@@ -27,14 +27,22 @@ const translations = {
         no_video_codec_options: "Disable video codec options",
         av_sync: "AV Sync",
         use_local_timestamp: "Use Local Timestamp",
+        replay_seconds: "Instant Replay (seconds)",
+        save_replay: "Save last seconds as clip",
+        replay_saved: "Clip saved: {name}",
+        replay_save_failed: "Failed to save clip: {msg}",
         max_fps: "Max FPS",
         frame_rate: "Frame Rate",
+        persistent: "Persistent Session",
+        idle_timeout: "Idle Timeout (seconds)",
         resolution: "Resolution",
         max_size: "Max Size",
         bitrate: "Bitrate (Mbps)",
         video_codec: "Video Codec",
+        video_codec_selected: "Video codec: {codec}",
         h264: "H.264",
         h265: "H.265",
+        av1: "AV1",
         codec_options_placeholder: "e.g. i-frame-interval=10",
         audio_enable: "Enable Audio",
         new_display: "New Display",
@@ -52,6 +60,10 @@ const translations = {
         config_saved: "Configuration saved",
         default_config: "Default Config",
         start_stream: "Start Stream",
+        terminate_session: "Terminate session",
+        confirm_terminate_session: "Terminate this session? Apps running on the desktop will be closed.",
+        session_terminated: "Session terminated",
+        session_detached: "DETACHED",
         device_manager: "Device Manager",
         reconnect: "Connect (Reconnect)",
         fullscreen: "Fullscreen",
@@ -63,6 +75,8 @@ const translations = {
         menu: "Menu",
         rotate: "Rotate",
         set_clipboard: "Set Clipboard (Browser -> Device)",
+        fit_to_window: "Fit desktop to window",
+        fit_to_window_requested: "Resizing desktop to {width}x{height}",
         uhid_mouse: "UHID Mouse",
         uhid_keyboard: "UHID Keyboard",
         uhid_gamepad: "UHID Gamepad",
@@ -72,6 +86,10 @@ const translations = {
         video_codec_options: "video_codec_options",
         use_video_codec_options: "Send video_codec_options",
         error_from_server: "Error from server: {msg}",
+        media_meta_updated: "Stream updated: {width}x{height} @ {fps}fps",
+        pause_stream: "Pause / resume stream",
+        stream_paused: "Stream paused",
+        stream_resumed: "Stream resumed",
         call_api_failed: "API request failed",
 
         unlock_now_verifying: "Verifying...",
@@ -115,14 +133,22 @@ const translations = {
         control: "控制",
         av_sync: "音画同步",
         use_local_timestamp: "使用本地时间戳",
+        replay_seconds: "即时回放（秒）",
+        save_replay: "保存最近片段",
+        replay_saved: "片段已保存: {name}",
+        replay_save_failed: "保存片段失败: {msg}",
         max_fps: "最大 FPS",
         frame_rate: "帧率",
+        persistent: "持久会话",
+        idle_timeout: "空闲超时 (秒)",
         resolution: "分辨率",
         max_size: "最大尺寸",
         bitrate: "比特率 (Mbps)",
         video_codec: "视频编码",
+        video_codec_selected: "视频编码: {codec}",
         h264: "H.264",
         h265: "H.265",
+        av1: "AV1",
         codec_options_placeholder: "例如: profile=1",
         video_encoder: "视频编码器",
         video_bit_rate: "视频比特率",
@@ -142,6 +168,10 @@ const translations = {
         config_saved: "配置已保存",
         default_config: "默认配置",
         start_stream: "开始串流",
+        terminate_session: "结束会话",
+        confirm_terminate_session: "确定结束该会话？桌面上运行的应用将被关闭。",
+        session_terminated: "会话已结束",
+        session_detached: "已脱离",
         device_manager: "设备管理",
         reconnect: "连接(重新连接)",
         fullscreen: "全屏",
@@ -153,6 +183,8 @@ const translations = {
         menu: "菜单",
         rotate: "旋转",
         set_clipboard: "设置剪贴板 (Browser -> Device)",
+        fit_to_window: "桌面适应窗口大小",
+        fit_to_window_requested: "正在将桌面调整为 {width}x{height}",
         uhid_mouse: "UHID鼠标",
         uhid_keyboard: "UHID键盘",
         uhid_gamepad: "UHID手柄",
@@ -162,6 +194,10 @@ const translations = {
         video_codec_options: "video_codec_options",
         use_video_codec_options: "携带 video_codec_options 参数",
         error_from_server: "服务器错误: {msg}",
+        media_meta_updated: "视频参数已更新: {width}x{height} @ {fps}fps",
+        pause_stream: "暂停/恢复画面",
+        stream_paused: "画面已暂停",
+        stream_resumed: "画面已恢复",
         call_api_failed: "API请求失败",
 
         unlock_now_verifying: "正在验证...",
@@ -203,14 +239,22 @@ const translations = {
         configure_subtitle: "ストリーミングパラメータの設定",
         av_sync: "AV同期",
         use_local_timestamp: "ローカルタイムスタンプを使用",
+        replay_seconds: "インスタントリプレイ（秒）",
+        save_replay: "直近の映像をクリップ保存",
+        replay_saved: "クリップを保存しました: {name}",
+        replay_save_failed: "クリップの保存に失敗しました: {msg}",
         max_fps: "最大 FPS",
         frame_rate: "フレームレート",
+        persistent: "永続セッション",
+        idle_timeout: "アイドルタイムアウト (秒)",
         resolution: "解像度",
         max_size: "最大サイズ",
         bitrate: "ビットレート (Mbps)",
         video_codec: "ビデオコーデック",
+        video_codec_selected: "ビデオコーデック: {codec}",
         h264: "H.264",
         h265: "H.265",
+        av1: "AV1",
         codec_options_placeholder: "例: profile=1",
         audio_enable: "オーディオを有効化",
         video_encoder: "ビデオエンコーダ",
@@ -231,6 +275,10 @@ const translations = {
         config_saved: "設定を保存しました",
         default_config: "デフォルト設定",
         start_stream: "ストリーミング開始",
+        terminate_session: "セッションを終了",
+        confirm_terminate_session: "このセッションを終了しますか？デスクトップで実行中のアプリは終了します。",
+        session_terminated: "セッションを終了しました",
+        session_detached: "切断中",
         device_manager: "デバイス管理",
         reconnect: "接続 (再接続)",
         fullscreen: "全画面",
@@ -242,6 +290,8 @@ const translations = {
         menu: "メニュー",
         rotate: "回転",
         set_clipboard: "クリップボード設定 (Browser -> Device)",
+        fit_to_window: "デスクトップをウィンドウに合わせる",
+        fit_to_window_requested: "デスクトップを {width}x{height} に変更しています",
         uhid_mouse: "UHIDマウスモード",
         uhid_keyboard: "UHIDキーボードモード",
         uhid_gamepad: "UHIDゲームパッドモード",
@@ -251,6 +301,10 @@ const translations = {
         video_codec_options: "video_codec_options",
         use_video_codec_options: "video_codec_options を送信",
         error_from_server: "サーバーエラー: {msg}",
+        media_meta_updated: "映像設定を更新しました: {width}x{height} @ {fps}fps",
+        pause_stream: "映像の一時停止/再開",
+        stream_paused: "映像を一時停止しました",
+        stream_resumed: "映像を再開しました",
         call_api_failed: "APIリクエストに失敗しました",
 
         unlock_now_verifying: "検証中...",
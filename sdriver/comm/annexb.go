@@ -0,0 +1,81 @@
+package comm
+
+import "bytes"
+
+// SplitAnnexB 把 Annex B 字节流（H.264/H.265）拆成不带起始码的 NAL，起始码可以是 3 或 4 字节
+func SplitAnnexB(b []byte) [][]byte {
+	var out [][]byte
+	i := 0
+	for {
+		start, scLen := findStartCode(b, i)
+		if start < 0 {
+			break
+		}
+		next, _ := findStartCode(b, start+scLen)
+		if next < 0 {
+			nal := trimTrailingZeros(b[start+scLen:])
+			if len(nal) > 0 {
+				out = append(out, nal)
+			}
+			break
+		}
+		nal := trimTrailingZeros(b[start+scLen : next])
+		if len(nal) > 0 {
+			out = append(out, nal)
+		}
+		i = next
+	}
+	return out
+}
+
+func findStartCode(b []byte, from int) (int, int) {
+	n := len(b)
+	for i := from; i+3 < n; i++ {
+		// 4-byte start code 0x00000001
+		if i+3 < n && b[i] == 0x00 && b[i+1] == 0x00 && b[i+2] == 0x00 && b[i+3] == 0x01 {
+			return i, 4
+		}
+		// 3-byte start code 0x000001
+		if b[i] == 0x00 && b[i+1] == 0x00 && b[i+2] == 0x01 {
+			return i, 3
+		}
+	}
+	return -1, 0
+}
+
+func trimTrailingZeros(b []byte) []byte {
+	i := len(b)
+	for i > 0 && b[i-1] == 0x00 {
+		i--
+	}
+	return b[:i]
+}
+
+// IsKeyFrame 判断一段视频数据是否包含关键帧（H.264 IDR / H.265 IRAP / AV1 KEY_FRAME）。
+// H.264/H.265 数据可以带或不带起始码，AV1 数据为 Low Overhead 格式的 OBU 序列。
+func IsKeyFrame(codec string, data []byte) bool {
+	if codec == "av1" {
+		return isAV1KeyFrame(data)
+	}
+	nals := SplitAnnexB(data)
+	// 不带起始码时第一个 NAL 从数据开头开始
+	if len(data) > 0 && !bytes.HasPrefix(data, []byte{0, 0, 1}) && !bytes.HasPrefix(data, []byte{0, 0, 0, 1}) {
+		nals = append(nals, data)
+	}
+	for _, nal := range nals {
+		if len(nal) == 0 {
+			continue
+		}
+		switch codec {
+		case "h264":
+			if nal[0]&0x1F == 5 {
+				return true
+			}
+		case "h265":
+			if t := (nal[0] >> 1) & 0x3F; t >= 16 && t <= 21 {
+				return true
+			}
+		}
+	}
+	return false
+}
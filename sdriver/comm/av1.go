@@ -0,0 +1,276 @@
+package comm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// AV1 OBU 类型，见 AV1 规范 6.2.2
+const (
+	OBU_SEQUENCE_HEADER        = 1
+	OBU_TEMPORAL_DELIMITER     = 2
+	OBU_FRAME_HEADER           = 3
+	OBU_TILE_GROUP             = 4
+	OBU_METADATA               = 5
+	OBU_FRAME                  = 6
+	OBU_REDUNDANT_FRAME_HEADER = 7
+	OBU_TILE_LIST              = 8
+	OBU_PADDING                = 15
+)
+
+var ErrInvalidOBU = errors.New("invalid AV1 OBU")
+
+// OBU 是 Low Overhead Bitstream Format 中的一个 OBU
+type OBU struct {
+	Type    uint8
+	Raw     []byte // 完整的 OBU（头 + obu_size + 负载），按顺序拼接即为合法码流
+	Payload []byte
+}
+
+// SplitOBUs 拆分一个时间单元中的 OBU（不拷贝）。
+// 最后一个 OBU 可以不带 obu_size，此时一直延伸到数据末尾。
+func SplitOBUs(data []byte) ([]OBU, error) {
+	var obus []OBU
+	for pos := 0; pos < len(data); {
+		start := pos
+		header := data[pos]
+		if header&0x80 != 0 {
+			return obus, fmt.Errorf("%w: forbidden bit set", ErrInvalidOBU)
+		}
+		typ := (header >> 3) & 0x0F
+		hasExtension := header&0x04 != 0
+		hasSize := header&0x02 != 0
+		pos++
+		if hasExtension {
+			pos++
+		}
+		if pos > len(data) {
+			return obus, fmt.Errorf("%w: truncated header", ErrInvalidOBU)
+		}
+		size := uint64(len(data) - pos)
+		if hasSize {
+			v, n, err := ReadLeb128(data[pos:])
+			if err != nil {
+				return obus, err
+			}
+			pos += n
+			size = v
+		}
+		if size > uint64(len(data)-pos) {
+			return obus, fmt.Errorf("%w: obu_size %d exceeds data", ErrInvalidOBU, size)
+		}
+		end := pos + int(size)
+		obus = append(obus, OBU{Type: typ, Raw: data[start:end], Payload: data[pos:end]})
+		pos = end
+	}
+	return obus, nil
+}
+
+// ReadLeb128 读取 leb128() 编码的整数，返回值和占用的字节数
+func ReadLeb128(b []byte) (uint64, int, error) {
+	var value uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0, fmt.Errorf("%w: truncated leb128", ErrInvalidOBU)
+		}
+		value |= uint64(b[i]&0x7F) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: leb128 too long", ErrInvalidOBU)
+}
+
+// AV1ConfigOBUs 返回 AV1CodecConfigurationRecord（av1C）中的 configOBUs。
+// Android 编码器的 csd-0 一般是 av1C，也有直接输出序列头 OBU 的，此时原样返回。
+func AV1ConfigOBUs(data []byte) []byte {
+	// av1C 第一个字节是 marker(1) + version(7) = 0x81，OBU 头的最高位必须为 0
+	if len(data) >= 4 && data[0] == 0x81 {
+		return data[4:]
+	}
+	return data
+}
+
+// isAV1KeyFrame 判断时间单元中是否有 frame_type 为 KEY_FRAME 的帧。
+// 视频流的 reduced_still_picture_header 总为 0，帧头以 show_existing_frame(1) + frame_type(2) 开始。
+func isAV1KeyFrame(data []byte) bool {
+	obus, _ := SplitOBUs(data)
+	for _, obu := range obus {
+		if obu.Type != OBU_FRAME && obu.Type != OBU_FRAME_HEADER {
+			continue
+		}
+		if len(obu.Payload) > 0 && obu.Payload[0]&0x80 == 0 && (obu.Payload[0]>>5)&0x03 == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSequenceHeader_AV1 解析序列头 OBU（包含 OBU 头），见 AV1 规范 5.5
+func ParseSequenceHeader_AV1(obu []byte) (SPSInfo, error) {
+	info := SPSInfo{}
+	obus, err := SplitOBUs(obu)
+	if err != nil {
+		return info, err
+	}
+	if len(obus) == 0 || obus[0].Type != OBU_SEQUENCE_HEADER {
+		return info, fmt.Errorf("not an AV1 sequence header OBU")
+	}
+
+	br := &BitReader{Reader: bytes.NewReader(obus[0].Payload)}
+	var readErr error
+	f := func(n uint) uint32 {
+		v, err := br.ReadBits(n)
+		if err != nil && readErr == nil {
+			readErr = err
+		}
+		return v
+	}
+
+	seqProfile := f(3)
+	f(1) // still_picture
+	reduced := f(1) == 1
+	var seqLevelIdx, seqTier uint32
+	if reduced {
+		seqLevelIdx = f(5)
+	} else {
+		decoderModelInfoPresent := false
+		bufferDelayLength := uint(0)
+		if f(1) == 1 { // timing_info_present_flag
+			numUnitsInDisplayTick := f(32)
+			timeScale := f(32)
+			if f(1) == 1 { // equal_picture_interval
+				br.ReadExpGolomb() // num_ticks_per_picture_minus_1, uvlc
+			}
+			if numUnitsInDisplayTick > 0 {
+				info.FrameRate = float64(timeScale) / float64(numUnitsInDisplayTick)
+			}
+			decoderModelInfoPresent = f(1) == 1
+			if decoderModelInfoPresent {
+				bufferDelayLength = uint(f(5)) + 1
+				f(32) // num_units_in_decoding_tick
+				f(5)  // buffer_removal_time_length_minus_1
+				f(5)  // frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelayPresent := f(1) == 1
+		operatingPoints := f(5) + 1
+		for i := uint32(0); i < operatingPoints; i++ {
+			f(12) // operating_point_idc
+			levelIdx := f(5)
+			tier := uint32(0)
+			if levelIdx > 7 {
+				tier = f(1)
+			}
+			// 只关心第一个 operating point
+			if i == 0 {
+				seqLevelIdx, seqTier = levelIdx, tier
+			}
+			if decoderModelInfoPresent && f(1) == 1 {
+				f(bufferDelayLength) // decoder_buffer_delay
+				f(bufferDelayLength) // encoder_buffer_delay
+				f(1)                 // low_delay_mode_flag
+			}
+			if initialDisplayDelayPresent && f(1) == 1 {
+				f(4) // initial_display_delay_minus_1
+			}
+		}
+	}
+	widthBits := uint(f(4)) + 1
+	heightBits := uint(f(4)) + 1
+	info.Width = f(widthBits) + 1
+	info.Height = f(heightBits) + 1
+
+	// 跳过编码工具开关，读到 color_config 取色度格式
+	if !reduced && f(1) == 1 { // frame_id_numbers_present_flag
+		f(4) // delta_frame_id_length_minus_2
+		f(3) // additional_frame_id_length_minus_1
+	}
+	f(1) // use_128x128_superblock
+	f(1) // enable_filter_intra
+	f(1) // enable_intra_edge_filter
+	if !reduced {
+		f(1) // enable_interintra_compound
+		f(1) // enable_masked_compound
+		f(1) // enable_warped_motion
+		f(1) // enable_dual_filter
+		enableOrderHint := f(1) == 1
+		if enableOrderHint {
+			f(1) // enable_jnt_comp
+			f(1) // enable_ref_frame_mvs
+		}
+		// seq_choose_screen_content_tools 为 1 时是 SELECT_SCREEN_CONTENT_TOOLS (2)
+		forceScreenContentTools := uint32(2)
+		if f(1) == 0 {
+			forceScreenContentTools = f(1)
+		}
+		if forceScreenContentTools > 0 && f(1) == 0 { // seq_choose_integer_mv
+			f(1) // seq_force_integer_mv
+		}
+		if enableOrderHint {
+			f(3) // order_hint_bits_minus_1
+		}
+	}
+	f(1) // enable_superres
+	f(1) // enable_cdef
+	f(1) // enable_restoration
+
+	// color_config
+	highBitdepth := f(1) == 1
+	twelveBit := false
+	if seqProfile == 2 && highBitdepth {
+		twelveBit = f(1) == 1
+	}
+	monochrome := false
+	if seqProfile != 1 {
+		monochrome = f(1) == 1
+	}
+	// 默认 CP/TC/MC_UNSPECIFIED
+	colorPrimaries, transfer, matrix := uint32(2), uint32(2), uint32(2)
+	if f(1) == 1 { // color_description_present_flag
+		colorPrimaries = f(8)
+		transfer = f(8)
+		matrix = f(8)
+	}
+	switch {
+	case monochrome:
+		info.ChromaFormat = 0
+	case colorPrimaries == 1 && transfer == 13 && matrix == 0: // BT.709 + sRGB + Identity
+		info.ChromaFormat = 3
+	default:
+		f(1) // color_range
+		switch seqProfile {
+		case 0:
+			info.ChromaFormat = 1
+		case 1:
+			info.ChromaFormat = 3
+		default:
+			subsamplingX := uint32(1)
+			if twelveBit {
+				subsamplingX = f(1)
+			}
+			switch {
+			case subsamplingX == 0:
+				info.ChromaFormat = 3
+			case twelveBit && f(1) == 1: // subsampling_y
+				info.ChromaFormat = 1
+			default:
+				info.ChromaFormat = 2
+			}
+		}
+	}
+	if readErr != nil {
+		return info, fmt.Errorf("AV1 sequence header truncated: %w", readErr)
+	}
+
+	info.Profile = uint8(seqProfile)
+	// seq_level_idx = (X - 2) * 4 + Y
+	info.Level = fmt.Sprintf("%d.%d", 2+seqLevelIdx>>2, seqLevelIdx&3)
+	if seqTier == 1 {
+		info.Tier = "High"
+	} else {
+		info.Tier = "Main"
+	}
+	return info, nil
+}
@@ -10,7 +10,8 @@ func ParseSPS_H264(sps []byte, readCroppingFlag bool) (SPSInfo, error) {
 	info := SPSInfo{Width: 0, Height: 0}
 
 	// 验证基本SPS格式
-	if len(sps) < 8 || (sps[0] != 0x67 && sps[0] != 0x27) {
+	// 只检查 nal_unit_type，nal_ref_idc 可以是 1~3
+	if len(sps) < 8 || sps[0]&0x80 != 0 || sps[0]&0x1F != 7 {
 		return info, fmt.Errorf("无效的SPS数据")
 	}
 
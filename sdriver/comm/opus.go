@@ -0,0 +1,29 @@
+package comm
+
+// OpusPacketSamples 根据 TOC 计算包时长（48kHz 采样数），RFC 6716 3.1
+func OpusPacketSamples(pkt []byte) int {
+	if len(pkt) == 0 {
+		return 0
+	}
+	config := pkt[0] >> 3
+	var frame int
+	switch {
+	case config < 12:
+		frame = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16:
+		frame = []int{480, 960}[config%2]
+	default:
+		frame = []int{120, 240, 480, 960}[config%4]
+	}
+	switch pkt[0] & 0x03 {
+	case 0:
+		return frame
+	case 1, 2:
+		return frame * 2
+	default:
+		if len(pkt) < 2 {
+			return 0
+		}
+		return frame * int(pkt[1]&0x3F)
+	}
+}
@@ -0,0 +1,44 @@
+package dummy
+
+import "webscreen/sdriver"
+
+// ConfigDescription 返回 New 接受的配置项，file_path 和 audio_file_path 相对于 -media_dir
+func ConfigDescription() []sdriver.ConfigParamDescription {
+	return []sdriver.ConfigParamDescription{
+		{
+			Name:        "file_path",
+			Type:        "string",
+			Required:    true,
+			Badge:       true,
+			Description: "path of the Annex B H.264/H.265 file to stream, relative to the server's -media_dir",
+		},
+		{
+			Name:        "video_codec",
+			Type:        "string",
+			Required:    true,
+			Default:     "h264",
+			Options:     []string{"h264", "h265"},
+			Badge:       true,
+			Description: "codec of the file, must match the SPS found in the file",
+		},
+		{
+			Name:        "fps",
+			Type:        "integer",
+			Required:    false,
+			Description: "playback frame rate, defaults to the SPS timing info or 30",
+		},
+		{
+			Name:        "audio_file_path",
+			Type:        "string",
+			Required:    false,
+			Description: "optional Ogg/Opus file played as the audio track, relative to the server's -media_dir",
+		},
+		{
+			Name:        "loop",
+			Type:        "boolean",
+			Required:    false,
+			Default:     true,
+			Description: "restart from the beginning when the file ends",
+		},
+	}
+}
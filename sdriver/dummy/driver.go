@@ -6,7 +6,10 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"webscreen/sdriver"
@@ -16,48 +19,124 @@ import (
 	"github.com/pion/webrtc/v4/pkg/media/h265reader"
 )
 
-// DummyDriver implements sdriver.SDriver by reading from a local H.264 Annex B file.
+// DummyDriver implements sdriver.SDriver by replaying a local Annex B H.264/H.265 file,
+// optionally together with an Ogg/Opus audio file. It needs no device and is used
+// by QA and frontend development as a stand-in for a real stream.
 type DummyDriver struct {
-	filePath string
+	filePath  string
+	audioPath string
+	loop      bool
+	fps       uint32
+	// 由 UpdateDriverConfig 设置，videoLoop 在下一帧开始时生效
+	pendingFPS uint32
+	// RequestIDR 和 Resume 置位，videoLoop 在帧边界跳到下一个关键帧
+	keyframeRequest atomic.Bool
 
 	mediaMeta sdriver.MediaMeta
 
 	mu       sync.RWMutex
 	running  bool
+	paused   bool
+	resumeCh chan struct{}
 	stopOnce sync.Once
 	stopCh   chan struct{}
+	wg       sync.WaitGroup
 
 	videoCh   chan sdriver.AVBox
 	audioCh   chan sdriver.AVBox
 	controlCh chan sdriver.Event
 
+	lastVPS []byte
 	lastSPS []byte
 	lastPPS []byte
 }
 
-// New creates a dummy driver to stream from a local H.264 file.
-// fps defines the nominal frame rate used to compute timestamps for VCL NALs.
+// 探测 SPS 时最多读取的字节数
+const probeSize = 1 << 20
+
+// file_path/audio_file_path 来自观看者，只能指向 mediaDir 下的文件
+var mediaDir = "media"
+
+// SetMediaDir sets the directory that file_path and audio_file_path are resolved against.
+func SetMediaDir(dir string) {
+	mediaDir = dir
+}
+
+// resolveMediaPath 拒绝绝对路径和含 .. 的路径，返回 mediaDir 下的实际路径
+func resolveMediaPath(key, p string) (string, error) {
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("dummy: %s %q must be a relative path inside the media directory", key, p)
+	}
+	return filepath.Join(mediaDir, p), nil
+}
+
+// New creates a dummy driver to stream from a local H.264/H.265 file.
+// The media meta is taken from the first SPS in the file; the fps option overrides
+// the SPS timing info and defines the pace at which access units are emitted.
 func New(c map[string]string) (*DummyDriver, error) {
 	d := &DummyDriver{
-		// filePath:  c.OtherOpts["file"],
-		// fps:       c.OtherOpts["fps"],
 		stopCh:    make(chan struct{}),
+		resumeCh:  make(chan struct{}),
 		videoCh:   make(chan sdriver.AVBox, 64),
-		audioCh:   make(chan sdriver.AVBox, 1),
-		controlCh: make(chan sdriver.Event, 1),
+		audioCh:   make(chan sdriver.AVBox, 16),
+		controlCh: make(chan sdriver.Event, 4),
+		loop:      true,
 	}
-	d.filePath = c["file_path"]
-	if d.filePath == "" {
+	if c["file_path"] == "" {
 		return nil, errors.New("dummy: file path is empty")
 	}
+	filePath, err := resolveMediaPath("file_path", c["file_path"])
+	if err != nil {
+		return nil, err
+	}
+	d.filePath = filePath
+	codec := c["video_codec"]
+	if codec == "" {
+		codec = "h264"
+	}
+	if codec != "h264" && codec != "h265" {
+		return nil, fmt.Errorf("dummy: unsupported video codec %q", codec)
+	}
+	if v := c["loop"]; v != "" {
+		loop, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("dummy: invalid loop value %q", v)
+		}
+		d.loop = loop
+	}
+	if v := c["fps"]; v != "" {
+		fps, err := parseFPS(v)
+		if err != nil {
+			return nil, err
+		}
+		d.fps = fps
+	}
+	if v := c["audio_file_path"]; v != "" {
+		p, err := resolveMediaPath("audio_file_path", v)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(p); err != nil {
+			return nil, fmt.Errorf("dummy: audio file: %w", err)
+		}
+		d.audioPath = p
+	}
 
-	// d.fetchMediaMeta()
-	d.mediaMeta = sdriver.MediaMeta{
-		Width:      1920,
-		Height:     1080,
-		VideoCodec: "h265",
-		FPS:        30,
+	meta, err := probeMediaMeta(d.filePath, codec)
+	if err != nil {
+		return nil, err
+	}
+	if d.fps > 0 {
+		meta.FPS = d.fps
+	}
+	if meta.FPS == 0 {
+		meta.FPS = 30
+	}
+	d.fps = meta.FPS
+	if d.audioPath != "" {
+		meta.AudioCodec = "opus"
 	}
+	d.mediaMeta = meta
 	log.Printf("Dummy driver media meta: %+v", d.mediaMeta)
 
 	return d, nil
@@ -68,15 +147,59 @@ func (d *DummyDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVBox
 	return d.videoCh, d.audioCh, d.controlCh
 }
 
+// UpdateDriverConfig 支持在播放中修改 fps
 func (d *DummyDriver) UpdateDriverConfig(config map[string]string) error {
+	for k, v := range config {
+		if k != "fps" {
+			return fmt.Errorf("dummy: %s cannot be changed while running: %w", k, sdriver.ErrNotSupported)
+		}
+		fps, err := parseFPS(v)
+		if err != nil {
+			return err
+		}
+		d.mu.Lock()
+		d.pendingFPS = fps
+		d.mu.Unlock()
+	}
 	return nil
 }
 
-// StartStream starts reading the H.264 file and produces AVBox packets.
+func parseFPS(v string) (uint32, error) {
+	fps, err := strconv.Atoi(v)
+	if err != nil || fps <= 0 || fps > 240 {
+		return 0, fmt.Errorf("dummy: invalid fps %q", v)
+	}
+	return uint32(fps), nil
+}
+
+// applyPendingFPS 在视频协程中应用新的帧率并通知前端
+func (d *DummyDriver) applyPendingFPS() {
+	d.mu.Lock()
+	fps := d.pendingFPS
+	d.pendingFPS = 0
+	if fps == 0 || fps == d.fps {
+		d.mu.Unlock()
+		return
+	}
+	d.fps = fps
+	d.mediaMeta.FPS = fps
+	meta := d.mediaMeta
+	d.mu.Unlock()
+
+	log.Printf("[dummy] fps changed to %d", fps)
+	select {
+	case d.controlCh <- sdriver.MediaMetaEvent{Meta: meta}:
+	default:
+	}
+}
+
+// Start starts reading the file and produces AVBox packets. Calling Start on a
+// paused driver resumes playback.
 func (d *DummyDriver) Start() {
 	d.mu.Lock()
 	if d.running {
 		d.mu.Unlock()
+		d.Resume()
 		return
 	}
 	select {
@@ -87,189 +210,388 @@ func (d *DummyDriver) Start() {
 	}
 	d.running = true
 	d.mu.Unlock()
-	go d.loop()
+
+	d.wg.Add(1)
+	go d.videoLoop()
+	if d.audioPath != "" {
+		d.wg.Add(1)
+		go d.audioLoop()
+	}
+	go func() {
+		d.wg.Wait()
+		d.mu.Lock()
+		d.running = false
+		d.mu.Unlock()
+		close(d.videoCh)
+		close(d.audioCh)
+		close(d.controlCh)
+	}()
 }
 
+// Pause holds playback at the current position until Start is called again.
+// A driver paused before Start starts paused and sends nothing until Resume.
 func (d *DummyDriver) Pause() {
-	log.Println("DummyDriver: Pause called")
-	d.Stop()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused {
+		return
+	}
+	log.Println("DummyDriver: paused")
+	d.paused = true
+	d.resumeCh = make(chan struct{})
+}
+
+// Resume 恢复播放。文件无法按需生成 IDR，所以恢复后跳到下一个关键帧，
+// 暂停期间加入的观看者也能正常解码。
+func (d *DummyDriver) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused {
+		return
+	}
+	log.Println("DummyDriver: resumed")
+	d.paused = false
+	d.keyframeRequest.Store(true)
+	close(d.resumeCh)
 }
 
 // SendEvent is a no-op for dummy driver.
 func (d *DummyDriver) SendEvent(event sdriver.Event) error { return nil }
 
-// RequestIDR attempts to resend cached SPS/PPS instantly (if available).
+// RequestIDR makes the video loop skip ahead to the next keyframe at the next frame
+// boundary. A file cannot produce an IDR on demand, and resending an old one in the
+// middle of the stream would leave the following P-frames without their reference.
 func (d *DummyDriver) RequestIDR(firstFrame bool) {
-	d.mu.RLock()
-	sps := append([]byte(nil), d.lastSPS...)
-	pps := append([]byte(nil), d.lastPPS...)
-	d.mu.RUnlock()
-
-	if len(sps) > 0 {
-		select {
-		case d.videoCh <- sdriver.AVBox{Data: sps, PTS: 0, NoDuration: true}:
-		default:
-		}
-	}
-	if len(pps) > 0 {
-		select {
-		case d.videoCh <- sdriver.AVBox{Data: pps, PTS: 0, NoDuration: true}:
-		default:
-		}
-	}
+	d.keyframeRequest.Store(true)
 }
 
 // Capabilities reports what this driver supports.
 func (d *DummyDriver) Capabilities() sdriver.DriverCaps {
-	return sdriver.DriverCaps{CanClipboard: false, CanUHID: false, CanVideo: true, CanAudio: false, CanControl: false}
+	return sdriver.DriverCaps{CanClipboard: false, CanUHID: false, CanVideo: true, CanAudio: d.audioPath != "", CanControl: false}
 }
 
 func (d *DummyDriver) MediaMeta() sdriver.MediaMeta {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	return d.mediaMeta
 }
 
-// Stop stops the streaming loop and closes channels.
+func (d *DummyDriver) ConfigDescription() []sdriver.ConfigParamDescription {
+	return ConfigDescription()
+}
+
+// Stop stops the streaming loops; the channels are closed once both loops exit.
 func (d *DummyDriver) Stop() {
 	d.stopOnce.Do(func() {
 		close(d.stopCh)
-		// Allow the loop to close the output channels
 	})
 }
 
-func (d *DummyDriver) loop() {
-	defer func() {
-		d.mu.Lock()
-		d.running = false
-		d.mu.Unlock()
-		close(d.videoCh)
-		close(d.audioCh)
-		close(d.controlCh)
-	}()
+// waitResume 在暂停时阻塞，返回暂停了多久；驱动被停止时返回 false
+func (d *DummyDriver) waitResume() (time.Duration, bool) {
+	d.mu.RLock()
+	paused, ch := d.paused, d.resumeCh
+	d.mu.RUnlock()
+	if !paused {
+		return 0, true
+	}
+	begin := time.Now()
+	select {
+	case <-ch:
+		return time.Since(begin), true
+	case <-d.stopCh:
+		return 0, false
+	}
+}
 
-	// 设定固定的帧间隔，例如 30fps = 33.3ms
-	ticker := time.NewTicker(33 * time.Millisecond)
-	defer ticker.Stop()
+// sleepUntil 等待到指定时刻，驱动被停止时返回 false
+func (d *DummyDriver) sleepUntil(t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-d.stopCh:
+		return false
+	}
+}
 
-	for {
-		// 1. 打开文件
-		f, err := os.Open(d.filePath)
+// finished 文件播放完且不循环时通知前端，然后等待 Stop
+func (d *DummyDriver) finished(what string) {
+	select {
+	case d.controlCh <- sdriver.TextMsgEvent{Msg: "[dummy] " + what + " playback finished"}:
+	default:
+	}
+	<-d.stopCh
+}
+
+type nalReader interface {
+	NextNAL() ([]byte, error)
+}
+
+func (d *DummyDriver) openVideo() (*os.File, nalReader, error) {
+	f, err := os.Open(d.filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.mediaMeta.VideoCodec == "h265" {
+		r, err := h265reader.NewReader(f)
 		if err != nil {
-			fmt.Println("File open error:", err)
-			return
+			f.Close()
+			return nil, nil, err
 		}
+		return f, &h265ReaderWrapper{r}, nil
+	}
+	r, err := h264reader.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, &h264ReaderWrapper{r}, nil
+}
 
-		var nalReader interface {
-			NextNAL() ([]byte, error)
-		}
+func (d *DummyDriver) videoLoop() {
+	defer d.wg.Done()
 
-		if d.mediaMeta.VideoCodec == "h265" {
-			h265, err := h265reader.NewReader(f)
-			if err != nil {
-				log.Printf("Failed to create H.265 reader: %v", err)
-				f.Close()
-				return
-			}
-			nalReader = &h265ReaderWrapper{h265}
-		} else {
-			h264, err := h264reader.NewReader(f)
-			if err != nil {
-				f.Close()
-				return
-			}
-			nalReader = &h264ReaderWrapper{h264}
+	// 在 Start 之前暂停时第一帧也要等到恢复
+	if _, ok := d.waitResume(); !ok {
+		return
+	}
+	// next 为下一帧的发送时刻，pts 按当前帧率累加，帧率可以在播放中改变
+	next := time.Now()
+	var pts uint64
+	// inPicture 表示当前访问单元已经发出过 slice，遇到下一个访问单元的开头时才推进时间轴
+	inPicture := false
+	// seeking 表示正在跳到下一个关键帧，跳过的帧不占用时间轴
+	seeking := false
+	isH265 := d.mediaMeta.VideoCodec == "h265"
+
+	for {
+		f, reader, err := d.openVideo()
+		if err != nil {
+			log.Printf("[dummy] open %s failed: %v", d.filePath, err)
+			return
 		}
 
-		// 3. 读取 NAL 循环
 		for {
-			// 这一步会自动处理 Annex-B 的分割
-			nalData, err := nalReader.NextNAL()
-			if err == io.EOF {
-				break // 文件读完了，跳出内层循环，重新开始外层循环（Loop）
-			}
+			nalData, err := reader.NextNAL()
 			if err != nil {
+				if err != io.EOF {
+					log.Printf("[dummy] read %s failed: %v", d.filePath, err)
+				}
 				break
 			}
-
-			// 检查外部停止信号
-			select {
-			case <-d.stopCh:
-				f.Close()
-				return
-			default:
+			if len(nalData) == 0 {
+				continue
 			}
 
-			var isIDR, isConfig, isVCL bool
-
-			if d.mediaMeta.VideoCodec == "h265" {
-				// H.265 NAL header parsing
-				// Forbidden_zero_bit (1) + Nal_unit_type (6) + Nuh_layer_id (6) + Nuh_temporal_id_plus1 (3)
-				// nal_unit_type is bits 1-6 of the first byte
-				nalType := (nalData[0] >> 1) & 0x3F
-
-				// VPS(32), SPS(33), PPS(34)
-				isConfig = nalType >= 32 && nalType <= 34
-				// IDR_W_RADL(19), IDR_N_LP(20), CRA_NUT(21)
-				isIDR = nalType >= 19 && nalType <= 21
-				// VCL NAL units are 0-31
-				isVCL = nalType < 32
-			} else {
-				// H.264 NAL header parsing
-				nalType := nalData[0] & 0x1F
-				isIDR = nalType == 5
-				isConfig = nalType == 7 || nalType == 8
-				isVCL = !isConfig && nalType != 6 // Exclude SEI
+			info := classifyNAL(nalData, isH265)
+			if inPicture && info.startsAccessUnit {
+				inPicture = false
+				d.applyPendingFPS()
+				d.mu.RLock()
+				fps := d.fps
+				d.mu.RUnlock()
+				pts += 1000000 / uint64(fps)
+				paused, ok := d.waitResume()
+				if !ok {
+					f.Close()
+					return
+				}
+				next = next.Add(paused + time.Second/time.Duration(fps))
+				if !d.sleepUntil(next) {
+					f.Close()
+					return
+				}
+				// 只在帧边界开始跳转，当前帧的 slice 不会被截断
+				if d.keyframeRequest.Load() && !info.isConfig && !(info.isVCL && info.isKeyframe) {
+					seeking = true
+				}
+			}
+			if seeking {
+				if !info.isConfig && !(info.isVCL && info.isKeyframe && info.startsAccessUnit) {
+					continue
+				}
+				if info.isVCL {
+					// 文件不一定在每个关键帧前重复参数集，先补发缓存的
+					seeking = false
+					if !d.sendParameterSets(pts) {
+						f.Close()
+						return
+					}
+				}
 			}
-			if false {
-				fmt.Println(isIDR)
+			if info.isVCL {
+				inPicture = true
+				if info.isKeyframe {
+					d.keyframeRequest.Store(false)
+				}
 			}
 
-			// 你的业务逻辑：存储 SPS/PPS
-			if isConfig {
+			if info.isConfig {
 				d.mu.Lock()
-				// For simplicity, we just store the last config frame as SPS/PPS equivalent
-				// In a real H.265 implementation, you'd want to store VPS/SPS/PPS separately
-				if d.mediaMeta.VideoCodec == "h265" {
-					// Simple storage for H.265 config frames
-					d.lastSPS = nalData // Just store as lastSPS for now to satisfy RequestIDR
-				} else {
-					if (nalData[0] & 0x1F) == 7 {
-						d.lastSPS = nalData
-					} else {
-						d.lastPPS = nalData
-					}
+				switch info.configKind {
+				case "vps":
+					d.lastVPS = nalData
+				case "sps":
+					d.lastSPS = nalData
+				case "pps":
+					d.lastPPS = nalData
 				}
 				d.mu.Unlock()
 			}
 
-			// 发送数据
-			// 这里我们先不计算 PTS，交给 Agent 去累加，或者在这里简单处理
 			box := sdriver.AVBox{
 				Data:       nalData,
-				PTS:        0,        // 这里填 0，由 Agent 根据接收频率或固定帧率计算
-				NoDuration: isConfig, // 配置帧不占用时间轴
+				PTS:        pts,
+				NoDuration: !info.isVCL,
 			}
-
 			select {
 			case d.videoCh <- box:
 			case <-d.stopCh:
 				f.Close()
 				return
 			}
+		}
+
+		f.Close()
+		if !d.loop {
+			d.finished("video")
+			return
+		}
+		log.Println("[dummy] looping video...")
+	}
+}
+
+// sendParameterSets 发送缓存的 VPS/SPS/PPS，驱动被停止时返回 false
+func (d *DummyDriver) sendParameterSets(pts uint64) bool {
+	d.mu.RLock()
+	nals := [][]byte{d.lastVPS, d.lastSPS, d.lastPPS}
+	d.mu.RUnlock()
+	for _, nal := range nals {
+		if len(nal) == 0 {
+			continue
+		}
+		select {
+		case d.videoCh <- sdriver.AVBox{Data: nal, PTS: pts, NoDuration: true}:
+		case <-d.stopCh:
+			return false
+		}
+	}
+	return true
+}
+
+func (d *DummyDriver) audioLoop() {
+	defer d.wg.Done()
 
-			// --- 核心节奏控制 ---
-			if isVCL {
-				<-ticker.C
-				// ⚠️ 注意：如果你的文件是多 Slice (一个帧由多个 NAL 组成)
-				// 这里会导致严重的慢动作和抖动！
-				// 必须配合我上一条回答里的 ffmpeg -slices 1 命令使用
+	base := time.Now()
+	var samples uint64
+	for {
+		f, err := os.Open(d.audioPath)
+		if err != nil {
+			log.Printf("[dummy] open %s failed: %v", d.audioPath, err)
+			return
+		}
+		reader := newOggOpusReader(f)
+
+		for {
+			pkt, err := reader.NextPacket()
+			if err != nil {
+				if err != io.EOF && err != io.ErrUnexpectedEOF {
+					log.Printf("[dummy] read %s failed: %v", d.audioPath, err)
+				}
+				break
 			}
+			paused, ok := d.waitResume()
+			if !ok {
+				f.Close()
+				return
+			}
+			base = base.Add(paused)
+			if !d.sleepUntil(base.Add(time.Duration(samples) * time.Second / 48000)) {
+				f.Close()
+				return
+			}
+
+			box := sdriver.AVBox{Data: pkt, PTS: samples * 1000000 / 48000}
+			select {
+			case d.audioCh <- box:
+			case <-d.stopCh:
+				f.Close()
+				return
+			}
+			samples += uint64(comm.OpusPacketSamples(pkt))
 		}
 
 		f.Close()
-		fmt.Println("Looping video...")
+		if !d.loop {
+			d.finished("audio")
+			return
+		}
 	}
 }
 
+type nalInfo struct {
+	isVCL            bool
+	isKeyframe       bool
+	isConfig         bool
+	configKind       string
+	startsAccessUnit bool
+}
+
+// classifyNAL 判断 NAL 类型以及它是否是一个新访问单元的开头。
+// 一帧可能由多个 slice 组成，只有 first_mb_in_slice == 0 / first_slice_segment_in_pic_flag
+// 的 slice 或 AUD/SEI/参数集才意味着上一帧结束。
+func classifyNAL(nal []byte, isH265 bool) nalInfo {
+	var info nalInfo
+	if isH265 {
+		nalType := (nal[0] >> 1) & 0x3F
+		switch nalType {
+		case 32:
+			info.configKind = "vps"
+		case 33:
+			info.configKind = "sps"
+		case 34:
+			info.configKind = "pps"
+		}
+		info.isConfig = info.configKind != ""
+		// VCL NAL units are 0-31
+		info.isVCL = nalType < 32
+		// IRAP: BLA/IDR/CRA
+		info.isKeyframe = nalType >= 16 && nalType <= 21
+		if info.isVCL {
+			info.startsAccessUnit = len(nal) > 2 && nal[2]&0x80 != 0
+		} else {
+			// VPS/SPS/PPS/AUD/prefix SEI
+			info.startsAccessUnit = nalType >= 32 && nalType <= 39
+		}
+		return info
+	}
+
+	nalType := nal[0] & 0x1F
+	switch nalType {
+	case 7:
+		info.configKind = "sps"
+	case 8:
+		info.configKind = "pps"
+	}
+	info.isConfig = info.configKind != ""
+	info.isVCL = nalType >= 1 && nalType <= 5
+	info.isKeyframe = nalType == 5
+	if info.isVCL {
+		// first_mb_in_slice 为 ue(v)，值为 0 时第一位是 1
+		info.startsAccessUnit = len(nal) > 1 && nal[1]&0x80 != 0
+	} else {
+		// SEI/SPS/PPS/AUD
+		info.startsAccessUnit = nalType >= 6 && nalType <= 9
+	}
+	return info
+}
+
 type h264ReaderWrapper struct {
 	*h264reader.H264Reader
 }
@@ -294,84 +616,52 @@ func (r *h265ReaderWrapper) NextNAL() ([]byte, error) {
 	return nal.Data, nil
 }
 
-func (d *DummyDriver) fetchMediaMeta() {
-	// Try to parse SPS to get resolution
-	if f, err := os.Open(d.filePath); err == nil {
-		// Read first 4KB, should be enough for SPS
-		buf := make([]byte, 4096)
-		n, _ := f.Read(buf)
-		f.Close()
+// probeMediaMeta 读取文件开头找到 SPS，解析出宽高和帧率。
+// 文件里找到的是另一种编码的 SPS 时报错，避免和 WebRTC 协商出的编码不一致。
+func probeMediaMeta(path, codec string) (sdriver.MediaMeta, error) {
+	meta := sdriver.MediaMeta{VideoCodec: codec}
 
-		if n > 0 {
-			nals := splitAnnexB(buf[:n])
-			for _, nal := range nals {
-				if len(nal) > 0 && (nal[0]&0x1F) == 7 {
-					// Found SPS
-					// Remove emulation prevention bytes
-					rbsp := comm.RemoveEmulationPreventionBytes(nal)
-					spsInfo, err := comm.ParseSPS_H264(rbsp, false)
-					if err == nil {
-						d.mediaMeta.Width = spsInfo.Width
-						d.mediaMeta.Height = spsInfo.Height
-						d.mediaMeta.VideoCodec = "h264"
-						if spsInfo.FrameRate > 0 {
-							d.mediaMeta.FPS = uint32(spsInfo.FrameRate + 0.5)
-						}
-					}
-					break
-				}
-			}
-		}
+	f, err := os.Open(path)
+	if err != nil {
+		return meta, fmt.Errorf("dummy: %w", err)
+	}
+	defer f.Close()
+	buf := make([]byte, probeSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return meta, fmt.Errorf("dummy: read %s: %w", path, err)
 	}
-}
 
-// splitAnnexB splits an Annex B H.264 byte stream into NAL units (without start codes).
-func splitAnnexB(b []byte) [][]byte {
-	var out [][]byte
-	i := 0
-	for {
-		start, scLen := findStartCode(b, i)
-		if start < 0 {
-			break
+	for _, nal := range comm.SplitAnnexB(buf[:n]) {
+		if len(nal) < 2 {
+			continue
 		}
-		next, _ := findStartCode(b, start+scLen)
-		if next < 0 {
-			nal := trimTrailingZeros(b[start+scLen:])
-			if len(nal) > 0 {
-				out = append(out, nal)
-			}
-			break
-		}
-		nal := trimTrailingZeros(b[start+scLen : next])
-		if len(nal) > 0 {
-			out = append(out, nal)
+		// 按 nal_unit_type 判断，nal_ref_idc 可以是任意非零值（0x67/0x47/0x27）。
+		// H.265 第 0 层的 NAL 头第一个字节是偶数，不会被当成 H.264 的 SPS
+		h264SPS := nal[0]&0x80 == 0 && nal[0]&0x1F == 7
+		h265SPS := (nal[0]>>1)&0x3F == 33
+		var spsInfo comm.SPSInfo
+		switch {
+		case codec == "h264" && h264SPS:
+			spsInfo, err = comm.ParseSPS_H264(comm.RemoveEmulationPreventionBytes(nal), true)
+		case codec == "h265" && h265SPS:
+			spsInfo, err = comm.ParseSPS_H265(nal)
+		case h264SPS, h265SPS && nal[1] == 0x01:
+			return meta, fmt.Errorf("dummy: %s does not look like a %s stream", path, codec)
+		default:
+			continue
 		}
-		i = next
-	}
-	return out
-}
-
-func findStartCode(b []byte, from int) (int, int) {
-	n := len(b)
-	for i := from; i+3 < n; i++ {
-		// 4-byte start code 0x00000001
-		if i+3 < n && b[i] == 0x00 && b[i+1] == 0x00 && b[i+2] == 0x00 && b[i+3] == 0x01 {
-			return i, 4
+		if err != nil {
+			return meta, fmt.Errorf("dummy: parse SPS: %w", err)
 		}
-		// 3-byte start code 0x000001
-		if b[i] == 0x00 && b[i+1] == 0x00 && b[i+2] == 0x01 {
-			return i, 3
+		meta.Width = spsInfo.Width
+		meta.Height = spsInfo.Height
+		if spsInfo.FrameRate > 0 {
+			meta.FPS = uint32(spsInfo.FrameRate + 0.5)
 		}
+		return meta, nil
 	}
-	return -1, 0
-}
-
-func trimTrailingZeros(b []byte) []byte {
-	i := len(b)
-	for i > 0 && b[i-1] == 0x00 {
-		i--
-	}
-	return b[:i]
+	return meta, fmt.Errorf("dummy: no %s SPS found in the first %d bytes of %s", codec, probeSize, path)
 }
 
 // func addStartCode(nal []byte) []byte {
@@ -0,0 +1,87 @@
+package dummy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// oggOpusReader 从 Ogg 容器中按 lacing 表拆出完整的 Opus 包。
+// pion 的 oggreader 只返回整页 payload，一页里往往有多个 20ms 的包，直接发送会导致 RTP 时间戳错乱。
+type oggOpusReader struct {
+	r       io.Reader
+	pending []byte   // 跨页未结束的包
+	queue   [][]byte // 当前页已拆出、尚未取走的包
+	serial  uint32
+	started bool
+}
+
+func newOggOpusReader(r io.Reader) *oggOpusReader {
+	return &oggOpusReader{r: r}
+}
+
+// NextPacket 返回下一个 Opus 音频包，OpusHead/OpusTags 头会被跳过
+func (o *oggOpusReader) NextPacket() ([]byte, error) {
+	for {
+		for len(o.queue) > 0 {
+			pkt := o.queue[0]
+			o.queue = o.queue[1:]
+			if bytes.HasPrefix(pkt, []byte("OpusHead")) || bytes.HasPrefix(pkt, []byte("OpusTags")) {
+				continue
+			}
+			return pkt, nil
+		}
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (o *oggOpusReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[0:4], []byte("OggS")) {
+		return errors.New("dummy: bad ogg page signature")
+	}
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	// 只取第一个逻辑流
+	if !o.started {
+		o.serial = serial
+		o.started = true
+	}
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return err
+	}
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(o.r, payload); err != nil {
+		return err
+	}
+	if serial != o.serial {
+		return nil
+	}
+
+	// header_type bit0: 本页以上一页未完成的包开头
+	if header[5]&0x01 == 0 {
+		o.pending = nil
+	}
+	offset := 0
+	for _, s := range segments {
+		o.pending = append(o.pending, payload[offset:offset+int(s)]...)
+		offset += int(s)
+		// lacing 值小于 255 表示包结束
+		if s < 255 {
+			o.queue = append(o.queue, o.pending)
+			o.pending = nil
+		}
+	}
+	return nil
+}
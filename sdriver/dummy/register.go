@@ -0,0 +1,29 @@
+package dummy
+
+import "webscreen/sdriver"
+
+func init() {
+	sdriver.Register(sdriver.Registration{
+		Name: sdriver.DEVICE_TYPE_DUMMY,
+		New: func(config map[string]string) (sdriver.SDriver, error) {
+			return New(config)
+		},
+		ConfigDescription: func(string) []sdriver.ConfigParamDescription {
+			return ConfigDescription()
+		},
+		Devices: ListDevices,
+	})
+}
+
+// ListDevices 文件回放不依赖真实设备，始终提供一个入口，文件路径在配置里填写
+func ListDevices() ([]sdriver.DeviceInfo, error) {
+	return []sdriver.DeviceInfo{
+		{
+			Type:     sdriver.DEVICE_TYPE_DUMMY,
+			DeviceID: "File Replay",
+			IP:       "127.0.0.1",
+			Port:     0,
+			Status:   "active",
+		},
+	}, nil
+}
@@ -36,6 +36,14 @@ const (
 	EVENT_TYPE_REQ_IDR EventType = 0x63
 	// -> Web Toast Message
 	EVENT_TYPE_TEXT_MSG EventType = 0x64
+	// Web -> Agent, payload 为 JSON 对象，见 UpdateConfigEvent
+	EVENT_TYPE_UPDATE_CONFIG EventType = 0x65
+	// Driver -> Agent -> Web, payload 为 MediaMeta 的 JSON
+	EVENT_TYPE_MEDIA_META EventType = 0x66
+	// Web -> Agent 请求暂停/恢复；Agent -> Web 广播当前状态。payload 1 字节：1 暂停，0 恢复
+	EVENT_TYPE_PAUSE EventType = 0x67
+	// API -> Driver 在会话中启动应用，不经过 DataChannel，见 LaunchAppEvent
+	EVENT_TYPE_LAUNCH_APP EventType = 0x68
 )
 
 // 鼠标动作枚举
@@ -190,3 +198,39 @@ type TextMsgEvent struct {
 func (e TextMsgEvent) Type() EventType {
 	return EVENT_TYPE_TEXT_MSG
 }
+
+// UpdateConfigEvent 由 Agent 解析后转为 SDriver.UpdateDriverConfig 调用，不会经过 SendEvent
+type UpdateConfigEvent struct {
+	Config map[string]string
+}
+
+func (e UpdateConfigEvent) Type() EventType {
+	return EVENT_TYPE_UPDATE_CONFIG
+}
+
+// MediaMetaEvent 驱动的分辨率/帧率/码率等发生变化时发出
+type MediaMetaEvent struct {
+	Meta MediaMeta
+}
+
+func (e MediaMetaEvent) Type() EventType {
+	return EVENT_TYPE_MEDIA_META
+}
+
+// PauseEvent 暂停状态
+type PauseEvent struct {
+	Paused bool
+}
+
+func (e PauseEvent) Type() EventType {
+	return EVENT_TYPE_PAUSE
+}
+
+// LaunchAppEvent 在驱动的会话中启动一个应用，只有 DriverCaps.CanLaunch 的驱动支持
+type LaunchAppEvent struct {
+	Command string
+}
+
+func (e LaunchAppEvent) Type() EventType {
+	return EVENT_TYPE_LAUNCH_APP
+}
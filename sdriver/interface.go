@@ -1,11 +1,15 @@
 package sdriver
 
+import "errors"
+
 type SDriver interface {
 	GetReceivers() (<-chan AVBox, <-chan AVBox, chan Event)
 	SendEvent(event Event) error
 
 	Start()
+	// Pause 停止转发音视频（隐私模式），控制通道保持可用；Resume 恢复并保证下一帧是关键帧
 	Pause()
+	Resume()
 
 	RequestIDR(firstFrame bool)
 	Capabilities() DriverCaps
@@ -13,5 +17,14 @@ type SDriver interface {
 	MediaMeta() MediaMeta
 	Stop()
 
-	// ConfigDescription() map[string]string
+	ConfigDescription() []ConfigParamDescription
+	// UpdateDriverConfig 在不断开 WebRTC 的情况下修改正在运行的驱动参数（码率、帧率等），
+	// 只需传入要修改的键。不支持的键或驱动应返回错误，媒体参数变化后驱动通过 MediaMetaEvent 通知前端。
+	UpdateDriverConfig(config map[string]string) error
 }
+
+// ErrNotSupported 驱动不支持某项操作时返回
+var ErrNotSupported = errors.New("operation not supported by this driver")
+
+// ErrDeviceNotFound 指定的设备（或设备的后台会话）不存在时返回
+var ErrDeviceNotFound = errors.New("device not found")
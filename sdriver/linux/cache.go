@@ -0,0 +1,65 @@
+package linuxDriver
+
+import (
+	"log"
+	"time"
+	"webscreen/linuxRecorder/protocol"
+	"webscreen/sdriver"
+)
+
+// IDR_REQUEST_INTERVAL 是两次向 recorder 请求关键帧的最小间隔，与 scrcpy driver 相同
+const IDR_REQUEST_INTERVAL = 2 * time.Second
+
+// cacheNALU 保存参数集或关键帧的副本，nalData 所在的缓冲区随后会被复用
+func (d *LinuxDriver) cacheNALU(dst *[]byte, nalData []byte) {
+	cached := make([]byte, len(nalData))
+	copy(cached, nalData)
+	d.cacheMutex.Lock()
+	*dst = cached
+	d.cacheMutex.Unlock()
+}
+
+func (d *LinuxDriver) hasCachedKeyFrame() bool {
+	d.cacheMutex.RLock()
+	defer d.cacheMutex.RUnlock()
+	return len(d.lastSPS) > 0 && len(d.lastPPS) > 0 && len(d.lastIDR) > 0
+}
+
+// sendCachedKeyFrame 把缓存的 VPS/SPS/PPS 和 IDR 合成一帧发送。
+// 使用最近一帧的 PTS 并标记 NoDuration，不影响后续帧的时间线。
+func (d *LinuxDriver) sendCachedKeyFrame() {
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	d.cacheMutex.RLock()
+	data := make([]byte, 0, len(d.lastVPS)+len(d.lastSPS)+len(d.lastPPS)+len(d.lastIDR)+16)
+	for _, nal := range [][]byte{d.lastVPS, d.lastSPS, d.lastPPS, d.lastIDR} {
+		if len(nal) > 0 {
+			data = append(data, startCode...)
+			data = append(data, nal...)
+		}
+	}
+	pts := d.lastPTS
+	d.cacheMutex.RUnlock()
+
+	log.Println("[linux driver] Sending cached key frame")
+	d.att.Load().sendVideo(sdriver.AVBox{Data: data, PTS: pts, NoDuration: true})
+}
+
+// requestKeyFrame 请 recorder 输出新的关键帧，IDR_REQUEST_INTERVAL 内只发一次，返回是否发送
+func (d *LinuxDriver) requestKeyFrame() bool {
+	if !d.hello.Has(protocol.CAP_IDR) {
+		return false
+	}
+	d.idrMutex.Lock()
+	if time.Since(d.lastIDRRequest) < IDR_REQUEST_INTERVAL {
+		d.idrMutex.Unlock()
+		return false
+	}
+	d.lastIDRRequest = time.Now()
+	d.idrMutex.Unlock()
+
+	if err := d.link.WriteControl(protocol.CONTROL_IDR, nil); err != nil {
+		log.Printf("[linux driver] request key frame failed: %v", err)
+		return false
+	}
+	return true
+}
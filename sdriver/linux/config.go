@@ -1,6 +1,9 @@
 package linuxDriver
 
-import "webscreen/sdriver"
+import (
+	"time"
+	"webscreen/sdriver"
+)
 
 func ConfigDescription() []sdriver.ConfigParamDescription {
 	return []sdriver.ConfigParamDescription{
@@ -18,10 +21,10 @@ func ConfigDescription() []sdriver.ConfigParamDescription {
 			Name:        "video_codec",
 			Type:        "string",
 			Required:    true,
-			Default:     "h265",
-			Options:     []string{"h264", "h265"},
+			Default:     sdriver.VIDEO_CODEC_AUTO,
+			Options:     []string{sdriver.VIDEO_CODEC_AUTO, "h264", "h265"},
 			Badge:       true,
-			Description: "video codec to use",
+			Description: "video codec to use, auto picks the best codec supported by the browser",
 		},
 
 		{
@@ -41,6 +44,14 @@ func ConfigDescription() []sdriver.ConfigParamDescription {
 			Description: "maximum video frames per second, e.g. 60",
 		},
 
+		{
+			Name:        "idle_frame_rate",
+			Type:        "integer",
+			Required:    false,
+			Default:     5,
+			Description: "minimum frames per second while the desktop is static, changed frames are always sent at frame_rate; 0 always encodes at frame_rate",
+		},
+
 		{
 			Name:        "resolution",
 			Type:        "string",
@@ -49,5 +60,126 @@ func ConfigDescription() []sdriver.ConfigParamDescription {
 			Badge:       true,
 			Description: "video resolution, e.g. 1920x1080",
 		},
+
+		{
+			Name:        "audio",
+			Type:        "boolean",
+			Required:    false,
+			Default:     true,
+			Badge:       true,
+			Description: "capture desktop audio through a per-session PulseAudio/PipeWire null sink, needs pactl on the host",
+		},
+
+		{
+			Name:        "capture",
+			Type:        "string",
+			Required:    false,
+			Default:     "desktop",
+			Options:     []string{"desktop", "window"},
+			Badge:       true,
+			Description: "stream the whole desktop, or only the window of app, following it as it resizes or opens new windows",
+		},
+
+		{
+			Name:     "app",
+			Type:     "string",
+			Required: false,
+			Default:  "",
+			Description: "command started in the session, e.g. 'firefox'; empty for xterm. " +
+				"With capture 'window' the session ends when the app closes its last window",
+		},
+
+		{
+			Name:        "desktop",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Options:     DESKTOP_OPTIONS,
+			Description: "desktop started on xorg/xvfb, empty for xfce; custom runs desktop_command. sway is its own desktop and only runs custom",
+		},
+
+		{
+			Name:        "desktop_command",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: "command that starts the desktop when desktop is custom, e.g. 'dbus-run-session startplasma-x11'",
+		},
+
+		{
+			Name:        "startup",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: `extra commands started after app, as a JSON array, e.g. ["firefox", "thunar"]`,
+		},
+
+		{
+			Name:        "env",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: `environment variables of the desktop and apps, as a JSON object, e.g. {"LANG": "zh_CN.UTF-8"}`,
+		},
+
+		{
+			Name:        "workdir",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: "absolute working directory of the desktop and apps on the desktop host",
+		},
+
+		{
+			Name:     "persistent",
+			Type:     "boolean",
+			Required: false,
+			Default:  false,
+			Badge:    true,
+			Description: "keep the desktop running after the last viewer leaves, " +
+				"reconnect by selecting the session in the device list",
+		},
+
+		{
+			Name:        "idle_timeout",
+			Type:        "integer",
+			Required:    false,
+			Default:     int(DEFAULT_IDLE_TIMEOUT / time.Second),
+			Description: "seconds a detached persistent session is kept before it is terminated, 0 keeps it until terminated manually",
+		},
+
+		{
+			Name:     "ssh_host",
+			Type:     "string",
+			Required: false,
+			Default:  "",
+			Badge:    true,
+			Description: "run the desktop on a remote host over SSH, [user@]host[:port]; " +
+				"empty for this machine. The stream is forwarded through SSH, no extra port is needed",
+		},
+
+		{
+			Name:        "ssh_password",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: "SSH password, or the passphrase of the private key. ssh-agent and keys in ~/.ssh are tried first",
+		},
+
+		{
+			Name:        "ssh_key_file",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: "path of the SSH private key, empty to try ~/.ssh/id_ed25519, id_ecdsa and id_rsa",
+		},
+
+		{
+			Name:        "ssh_known_hosts",
+			Type:        "string",
+			Required:    false,
+			Default:     "",
+			Description: "known_hosts file used to verify the host key, empty for ~/.ssh/known_hosts",
+		},
 	}
 }
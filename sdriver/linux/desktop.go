@@ -0,0 +1,65 @@
+package linuxDriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"webscreen/linuxRecorder/protocol"
+)
+
+// DESKTOP_OPTIONS 是 desktop 参数的取值，与 recorder 的 -desktop 相同，为空时 X11 启动 Xfce
+var DESKTOP_OPTIONS = []string{"xfce", "openbox", "none", "custom"}
+
+// desktopArgs 校验 desktop、desktop_command、startup、env 和 workdir，返回对应的 recorder 参数。
+// workdir 是否存在由 recorder 在目标机器上检查。
+func desktopArgs(cfg map[string]string) ([]string, error) {
+	var args []string
+	desktop := cfg["desktop"]
+	if desktop != "" {
+		valid := false
+		for _, o := range DESKTOP_OPTIONS {
+			valid = valid || desktop == o
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid desktop: %s, expected one of %v", desktop, DESKTOP_OPTIONS)
+		}
+		args = append(args, "-desktop", desktop)
+	}
+	if desktop == "custom" {
+		if strings.TrimSpace(cfg["desktop_command"]) == "" {
+			return nil, fmt.Errorf("desktop custom needs desktop_command")
+		}
+		args = append(args, "-desktop_cmd", cfg["desktop_command"])
+	}
+
+	if startup := strings.TrimSpace(cfg["startup"]); startup != "" {
+		var commands []string
+		if err := json.Unmarshal([]byte(startup), &commands); err != nil {
+			return nil, fmt.Errorf("invalid startup: %v, expected a JSON array of commands", err)
+		}
+		for _, c := range commands {
+			if strings.TrimSpace(c) == "" {
+				return nil, fmt.Errorf("invalid startup: empty command")
+			}
+		}
+		args = append(args, "-startup", startup)
+	}
+
+	if env := strings.TrimSpace(cfg["env"]); env != "" {
+		// 与 recorder 的 -env 使用同一份校验，出错时不必等到 recorder 启动
+		if _, err := protocol.ParseEnv(env); err != nil {
+			return nil, err
+		}
+		args = append(args, "-env", env)
+	}
+
+	// 桌面可能在远程的 Linux 上，按 / 分隔的路径检查
+	if workDir := cfg["workdir"]; workDir != "" {
+		if !path.IsAbs(workDir) {
+			return nil, fmt.Errorf("workdir must be an absolute path: %s", workDir)
+		}
+		args = append(args, "-workdir", workDir)
+	}
+	return args, nil
+}
@@ -1,49 +1,133 @@
 package linuxDriver
 
 import (
-	"embed"
-	"encoding/binary"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"webscreen/linuxRecorder/protocol"
+	"webscreen/linuxRecorder/slot"
 	"webscreen/sdriver"
 	"webscreen/sdriver/comm"
+	"webscreen/utils"
 )
 
-//go:embed bin/recorder
-var recorderExec embed.FS
-
 // sudo killall Xvfb
 type LinuxDriver struct {
-	videoChan   chan sdriver.AVBox
+	// 当前接回的通道，持久会话每次接回都换一组，见 session.go
+	att         atomic.Pointer[attachment]
 	videoBuffer *comm.LinearBuffer
+	audioBuffer *comm.LinearBuffer
 	conn        net.Conn
+	// conn 上的帧收发，见 linuxRecorder/protocol
+	link *protocol.Conn
+	// recorder 握手时报告的会话参数和能力
+	hello *protocol.Hello
+	// recorder 最近一次报告的统计
+	stats atomic.Pointer[protocol.Stats]
+	// 本会话占用的 display、端口和运行目录，recorder 退出后释放
+	slot         *slot.Slot
+	recorder     *exec.Cmd
+	recorderDone <-chan struct{}
+	// 通过 SSH 启动的远端 recorder，见 ssh.go
+	remote    *RemoteRecorder
+	startOnce sync.Once
+	stopOnce  sync.Once
+	// 持久会话，attached/detachedAt/idleTimer 由 sessionsMu 保护
+	persistent  bool
+	idleTimeout time.Duration
+	sessionID   string
+	attached    bool
+	detachedAt  time.Time
+	idleTimer   *time.Timer
+	// 保护 bitRate/frameRate/width/height/spsFrameRate，UpdateDriverConfig 和 SPS 解析可能和 MediaMeta 并发
+	configMutex sync.Mutex
+	// 视频的实际分辨率，握手时取 Hello 中的值，之后以 SPS 为准
+	width  uint32
+	height uint32
+	// SPS 中的帧率，没有配置 frame_rate 时使用
+	spsFrameRate float64
+	// 暂停时 recorder 挂起编码器，这里同时丢弃残留的帧；resumed 通知 handleConnection 重新等待关键帧
+	paused  atomic.Bool
+	resumed atomic.Bool
 
 	backend     string
-	ip          string
-	user        string
-	password    string
 	resolution  string
 	frameRate   string
 	bitRate     string
 	video_codec string
-
-	lastSPS []byte
-	lastPPS []byte
-	lastVPS []byte // 新增 HEVC 的 VPS 存储
-	lastIDR []byte
+	// 画面静止时的帧率（idle_frame_rate），空表示使用 recorder 的默认值
+	idleRate string
+	// recorder 采集会话的声音并编码为 Opus
+	audio bool
+	// capture 为 desktop 或 window，window 时只推送 app 的窗口
+	capture string
+	app     string
+	// desktop/startup/env/workdir 对应的 recorder 参数，见 desktop.go
+	desktopArgs []string
+	// 本地为 127.0.0.1，远程为 ssh_host
+	ip string
+
+	// 最近的参数集和关键帧，RequestIDR 补发给新的观看者，见 cache.go。
+	// 只有 handleConnection 写入，写入时持有 cacheMutex
+	cacheMutex sync.RWMutex
+	lastSPS    []byte
+	lastPPS    []byte
+	lastVPS    []byte // 新增 HEVC 的 VPS 存储
+	lastIDR    []byte
+	lastPTS    uint64
+	// 上次向 recorder 请求关键帧的时间，由 idrMutex 保护
+	idrMutex       sync.Mutex
+	lastIDRRequest time.Time
+
+	// reconfigMutex 保证同一时间只有一个 CONTROL_CONFIG 在等待回执，configSeq 由它保护
+	reconfigMutex sync.Mutex
+	configSeq     uint64
+	// configWait 是正在等待的回执，handleConnection 收到 FRAME_CONFIG_RESULT 后交给它
+	configWait atomic.Pointer[configWaiter]
+	// closed 在会话结束时关闭，等待回执的 UpdateDriverConfig 随之返回
+	closed chan struct{}
 }
 
-// 简单的 Header 定义，对应发送端的结构
-type Header struct {
-	PTS  uint64
-	Size uint32
+type configWaiter struct {
+	seq    uint64
+	result chan protocol.ConfigResult
 }
 
+// CONFIG_TIMEOUT 是等待 recorder 应用配置的时间，调整分辨率和重启编码器都算在内
+const CONFIG_TIMEOUT = 30 * time.Second
+
+// HANDSHAKE_TIMEOUT 是连接 recorder 后等待 Hello 的时间
+const HANDSHAKE_TIMEOUT = 10 * time.Second
+
 func New(cfg map[string]string) (*LinuxDriver, error) {
+	if d, err := attachSession(cfg); d != nil || err != nil {
+		return d, err
+	}
+	idleTimeout, err := parseIdleTimeout(cfg["idle_timeout"])
+	if err != nil {
+		return nil, err
+	}
+	desktopFlags, err := desktopArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if v := cfg["idle_frame_rate"]; v != "" {
+		if fps, err := strconv.Atoi(v); err != nil || fps < 0 {
+			return nil, fmt.Errorf("invalid idle_frame_rate: %s", v)
+		}
+	}
 	video_bit_rate_str, ok := cfg["video_bit_rate"]
 	if !ok || video_bit_rate_str == "" {
 		video_bit_rate_str = "4M" // 默认 4 Mbps
@@ -54,95 +138,275 @@ func New(cfg map[string]string) (*LinuxDriver, error) {
 	// }
 	log.Printf("Parsed video bit rate: %s\n", video_bit_rate_str)
 	d := &LinuxDriver{
-		videoChan: make(chan sdriver.AVBox, 10), // 适当增大缓冲防止阻塞
-		// ip:          cfg["ip"],
-		// user:        cfg["user"],
+		persistent:  cfg["persistent"] == "true",
+		idleTimeout: idleTimeout,
 		backend:     cfg["backend"],
 		resolution:  cfg["resolution"],
 		frameRate:   cfg["frame_rate"],
+		idleRate:    cfg["idle_frame_rate"],
 		bitRate:     video_bit_rate_str,
 		video_codec: cfg["video_codec"],
-
-		videoBuffer: comm.NewLinearBuffer(16 * 1024 * 1024),
-	}
-	log.Println("Initializing LinuxDriver with config:", cfg)
-
-	execFile, err := recorderExec.ReadFile("bin/recorder")
-
-	if err != nil {
-		log.Printf("[linux driver] 读取 recorder 失败: %v", err)
-		return nil, err
+		audio:       cfg["audio"] != "false",
+		capture:     cfg["capture"],
+		app:         cfg["app"],
+		desktopArgs: desktopFlags,
+
+		// 单帧不超过协议的上限，ReadFrame 已经拒绝了更大的帧
+		videoBuffer: comm.NewLinearBuffer(protocol.MAX_FRAME_SIZE),
+		audioBuffer: comm.NewLinearBuffer(4 * protocol.MAX_AUDIO_FRAME_SIZE),
+		closed:      make(chan struct{}),
 	}
-	err = os.WriteFile("recorder", execFile, 0755)
-	if err != nil {
-		log.Printf("[linux driver] 写入本地文件失败: %v", err)
-		os.Remove("recorder")
-		return nil, err
-	}
-	if d.ip == "127.0.0.1" || d.ip == "localhost" || d.ip == "" {
-		d.ip = "127.0.0.1"
-		log.Printf("[linux driver] 使用 backend=%s 启动本地 recorder", d.backend)
-		err = LocalStartRecorder("27184", d.resolution, d.bitRate, d.frameRate, d.video_codec, d.backend)
+	d.att.Store(newAttachment())
+	log.Println("Initializing LinuxDriver with config:", sdriver.RedactConfig(cfg))
+
+	var dial func() (net.Conn, error)
+	if sshConfig := sshConfigFromDriverConfig(cfg); sshConfig.Host != "" {
+		// 远程桌面：recorder 在远端分配槽位，连接经 SSH 转发
+		log.Printf("[linux driver] 使用 backend=%s 在 %s 启动远程 recorder", d.backend, sshConfig.Host)
+		d.remote, err = StartRemoteRecorder(sshConfig, d.recorderArgs())
+		if err != nil {
+			log.Printf("[linux driver] 启动远程 recorder 失败: %v", err)
+			return nil, err
+		}
+		d.ip = sshConfig.Host
+		d.slot = d.remote.Slot
+		dial = d.remote.Dial
 	} else {
-		err = PushAndStartRecorder(d.user, d.ip, "27184", d.resolution, d.bitRate, d.frameRate, d.video_codec, d.backend)
-	}
-	if err != nil {
-		log.Printf("[linux driver] 启动远程 recorder 失败: %v", err)
-		os.Remove("recorder")
-		return nil, err
+		var execFile []byte
+		execFile, err = localRecorderBinary()
+		if err != nil {
+			log.Printf("[linux driver] 读取 recorder 失败: %v", err)
+			return nil, err
+		}
+		// 每个会话一个槽位，多个用户可以同时各开一个桌面
+		d.slot, err = slot.Allocate()
+		if err != nil {
+			log.Printf("[linux driver] 分配会话资源失败: %v", err)
+			return nil, err
+		}
+		recorderPath := filepath.Join(d.slot.RuntimeDir, "recorder")
+		err = os.WriteFile(recorderPath, execFile, 0755)
+		if err != nil {
+			log.Printf("[linux driver] 写入本地文件失败: %v", err)
+			d.Stop()
+			return nil, err
+		}
+		d.ip = "127.0.0.1"
+		log.Printf("[linux driver] 使用 backend=%s 在 %s 启动本地 recorder", d.backend, d.slot.DisplayName())
+		d.recorder, d.recorderDone, err = LocalStartRecorder(recorderPath, d.slot, d.recorderArgs())
+		if err != nil {
+			log.Printf("[linux driver] 启动本地 recorder 失败: %v", err)
+			d.Stop()
+			return nil, err
+		}
+		address := net.JoinHostPort(d.ip, strconv.Itoa(d.slot.Port))
+		dial = func() (net.Conn, error) { return net.Dial("tcp", address) }
 	}
 
 	var conn net.Conn
 	startTime := time.Now()
 	for {
-		conn, err = net.Dial("tcp", d.ip+":27184")
+		conn, err = dial()
 		if err == nil {
 			break
 		}
 		time.Sleep(time.Second)
 		if time.Since(startTime) > 5*time.Second {
-			os.Remove("recorder")
+			d.Stop()
 			return nil, fmt.Errorf("Failed to connect to recorder after 5 seconds: %v", err)
 		}
 	}
 	d.conn = conn
+	d.link = protocol.NewConn(conn)
+	d.hello, err = handshake(d.link, conn)
+	if err != nil {
+		d.Stop()
+		return nil, fmt.Errorf("handshake with recorder failed: %v", err)
+	}
+	log.Printf("[linux driver] recorder %dx%d %s on display %d, capabilities %v",
+		d.hello.Width, d.hello.Height, d.hello.Codec, d.hello.Display, d.hello.Capabilities)
+	d.width, d.height = uint32(d.hello.Width), uint32(d.hello.Height)
+	// recorder 没能创建声音设备时不再提供音频
+	d.audio = d.audio && d.hello.Has(protocol.CAP_AUDIO)
+	if d.persistent {
+		registerSession(d)
+		d.att.Load().emit(sdriver.TextMsgEvent{Msg: "Persistent session " + d.sessionID + ", reconnect from the device list"})
+	}
 	return d, nil
 }
 
+// recorderArgs 返回本地和远程 recorder 共用的参数，槽位相关的参数由启动方补充
+func (d *LinuxDriver) recorderArgs() []string {
+	args := []string{
+		"-resolution", d.resolution,
+		"-bitrate", d.bitRate,
+		"-framerate", d.frameRate,
+		"-codec", d.video_codec,
+		"-backend", d.backend,
+		"-audio=" + strconv.FormatBool(d.audio),
+	}
+	if d.idleRate != "" {
+		args = append(args, "-idle_framerate", d.idleRate)
+	}
+	if d.capture != "" {
+		args = append(args, "-capture", d.capture)
+	}
+	if d.app != "" {
+		args = append(args, "-app", d.app)
+	}
+	return append(args, d.desktopArgs...)
+}
+
+// handshake 先读 recorder 的 Hello 再回复自己的。SSH 转发的连接不支持 deadline，超时后直接关闭连接。
+func handshake(link *protocol.Conn, conn net.Conn) (*protocol.Hello, error) {
+	timer := time.AfterFunc(HANDSHAKE_TIMEOUT, func() { conn.Close() })
+	defer timer.Stop()
+	hello, err := link.ReadHello()
+	if err != nil {
+		return nil, err
+	}
+	if err := link.WriteHello(protocol.Hello{Version: protocol.VERSION}); err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// Start 启动视频监听，持久会话接回时 Agent 会再次调用，监听只启动一次
 func (d *LinuxDriver) Start() {
-	// 启动视频监听
-	go d.handleConnection()
-	log.Println("LinuxDriver started, listening for connections...")
+	d.startOnce.Do(func() {
+		go d.handleConnection()
+		log.Println("LinuxDriver started, listening for connections...")
+	})
 }
 
+// UpdateDriverConfig 通知 recorder 用新的码率/帧率重启 ffmpeg 或 wf-recorder，TCP 连接保持不变。
+// 配置以 JSON 放在 CONTROL_CONFIG 中，等 recorder 回复 FRAME_CONFIG_RESULT 之后才更新参数并通知观看者，
+// recorder 拒绝或回滚时返回它的错误
 func (d *LinuxDriver) UpdateDriverConfig(config map[string]string) error {
+	if !d.hello.Has(protocol.CAP_CONFIG) {
+		return fmt.Errorf("linux: recorder cannot be reconfigured: %w", sdriver.ErrNotSupported)
+	}
+	for k, v := range config {
+		switch k {
+		case "video_bit_rate":
+			if bps, err := utils.ParseBitrate(v); err != nil || bps <= 0 {
+				return fmt.Errorf("invalid video bit rate: %s", v)
+			}
+		case "frame_rate":
+			if fps, err := strconv.Atoi(v); err != nil || fps <= 0 {
+				return fmt.Errorf("invalid frame rate: %s", v)
+			}
+		case "resolution", "scale":
+			// 范围由 recorder 检查，不支持时它会通过 FRAME_LOG 报告
+			if !d.hello.Has(protocol.CAP_RESIZE) {
+				return fmt.Errorf("linux: recorder cannot resize the desktop: %w", sdriver.ErrNotSupported)
+			}
+			if err := validateResize(k, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("linux: %s cannot be changed while running: %w", k, sdriver.ErrNotSupported)
+		}
+	}
+	if err := d.sendConfig(config); err != nil {
+		return err
+	}
+
+	d.configMutex.Lock()
+	if v, ok := config["video_bit_rate"]; ok {
+		d.bitRate = v
+	}
+	if v, ok := config["frame_rate"]; ok {
+		d.frameRate = v
+	}
+	if v, ok := config["resolution"]; ok {
+		d.resolution = v
+	}
+	d.configMutex.Unlock()
+
+	d.att.Load().emit(sdriver.MediaMetaEvent{Meta: d.MediaMeta()})
 	return nil
 }
 
-// Start, GetReceivers 等方法保持不变...
-// 仅重写 handleConnection
+// sendConfig 发送 CONTROL_CONFIG 并等待对应的回执。回执由 handleConnection 读取，驱动需要已经 Start
+func (d *LinuxDriver) sendConfig(config map[string]string) error {
+	d.reconfigMutex.Lock()
+	defer d.reconfigMutex.Unlock()
+	d.configSeq++
+	w := &configWaiter{seq: d.configSeq, result: make(chan protocol.ConfigResult, 1)}
+	d.configWait.Store(w)
+	defer d.configWait.CompareAndSwap(w, nil)
+
+	if err := d.link.WriteConfig(protocol.Config{Seq: w.seq, Values: config}); err != nil {
+		return fmt.Errorf("send config to recorder failed: %v", err)
+	}
+	select {
+	case result := <-w.result:
+		if result.Error != "" {
+			return fmt.Errorf("linux: recorder failed to apply config: %s", result.Error)
+		}
+		return nil
+	case <-d.closed:
+		return errors.New("linux: recorder connection closed")
+	case <-time.After(CONFIG_TIMEOUT):
+		return fmt.Errorf("linux: recorder did not apply config within %v", CONFIG_TIMEOUT)
+	}
+}
+
+// validateResize 检查 resolution（WxH，宽高为偶数）和 scale 的格式
+func validateResize(key, value string) error {
+	if key == "scale" {
+		if f, err := strconv.ParseFloat(value, 64); err != nil || f <= 0 {
+			return fmt.Errorf("invalid scale: %s", value)
+		}
+		return nil
+	}
+	w, h, ok := strings.Cut(value, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return fmt.Errorf("invalid resolution: %s, expected WxH with even width and height", value)
+	}
+	return nil
+}
 
+// handleConnection 读取 recorder 发来的帧，连接断开（recorder 退出或会话结束）后结束会话
 func (d *LinuxDriver) handleConnection() {
-	headerBuf := make([]byte, 12)
+	defer d.terminate()
+	alloc := func(t protocol.FrameType, size int) []byte {
+		switch t {
+		case protocol.FRAME_VIDEO:
+			return d.videoBuffer.Get(size)
+		case protocol.FRAME_AUDIO:
+			return d.audioBuffer.Get(size)
+		}
+		return make([]byte, size)
+	}
 	waitForKeyFrame := true
 	for {
-		// 1. 读取固定长度的 Header (12 bytes)
-		if _, err := io.ReadFull(d.conn, headerBuf); err != nil {
-			log.Println("Failed to read header:", err)
+		if d.resumed.Swap(false) {
+			waitForKeyFrame = true
+		}
+		frameType, payload, err := d.link.ReadFrame(alloc)
+		if err != nil {
+			log.Println("Failed to read frame:", err)
 			return
 		}
 
-		pts := binary.BigEndian.Uint64(headerBuf[0:8])
-		size := binary.BigEndian.Uint32(headerBuf[8:12])
+		if frameType != protocol.FRAME_VIDEO {
+			d.handleFrame(frameType, payload)
+			continue
+		}
 
-		// 2. 准备 payload 缓冲区
-		// 确保缓冲区够大
-		payloadBuf := d.videoBuffer.Get(int(size))
+		pts, payloadBuf, err := protocol.ParseMedia(payload)
+		if err != nil {
+			log.Println("Invalid video frame:", err)
+			continue
+		}
+		size := len(payloadBuf)
 
-		// 3. 读取完整的 NALU Payload
-		if _, err := io.ReadFull(d.conn, payloadBuf); err != nil {
-			log.Println("Failed to read payload:", err)
-			return
+		if d.paused.Load() {
+			continue
 		}
 
 		// 此时 payloadBuf 包含 Annex B 格式数据 (00 00 00 01 XX XX ...)
@@ -191,22 +455,19 @@ func (d *LinuxDriver) handleConnection() {
 		if d.video_codec == "h265" || d.video_codec == "hevc" {
 			switch nalType {
 			case 32: // VPS
-				d.lastVPS = make([]byte, len(nalData))
-				copy(d.lastVPS, nalData)
+				d.cacheNALU(&d.lastVPS, nalData)
 				continue
 			case 33: // SPS
-				d.lastSPS = make([]byte, len(nalData))
-				copy(d.lastSPS, nalData)
+				d.updateVideoMetaFromSPS(nalData)
+				d.cacheNALU(&d.lastSPS, nalData)
 				continue
 			case 34: // PPS
-				d.lastPPS = make([]byte, len(nalData))
-				copy(d.lastPPS, nalData)
+				d.cacheNALU(&d.lastPPS, nalData)
 				continue
 			case 39, 40: // SEI
 				continue
 			case 19, 20, 21: // IDR_W_RADL, IDR_N_LP, CRA_NUT (各种关键帧)
-				d.lastIDR = make([]byte, len(nalData))
-				copy(d.lastIDR, nalData)
+				d.cacheNALU(&d.lastIDR, nalData)
 				isKeyFrame = true
 				waitForKeyFrame = false
 			}
@@ -218,19 +479,17 @@ func (d *LinuxDriver) handleConnection() {
 				continue
 			case 7: // SPS
 				// log.Printf("Received SPS, PTS=%d, Size=%d bytes", pts, len(nalData))
-				d.lastSPS = make([]byte, len(nalData))
-				copy(d.lastSPS, nalData)
+				d.updateVideoMetaFromSPS(nalData)
+				d.cacheNALU(&d.lastSPS, nalData)
 				continue
 			case 8: // PPS
 				// log.Printf("Received PPS, PTS=%d, Size=%d bytes", pts, len(nalData))
-				d.lastPPS = make([]byte, len(nalData))
-				copy(d.lastPPS, nalData)
+				d.cacheNALU(&d.lastPPS, nalData)
 				// log.Println("PPS Data:", nalData)
 				continue
 			case 5: // IDR (关键帧)
 				// log.Printf("Received IDR frame, PTS=%d, Size=%d bytes", pts, len(nalData))
-				d.lastIDR = make([]byte, len(nalData))
-				copy(d.lastIDR, nalData)
+				d.cacheNALU(&d.lastIDR, nalData)
 				isKeyFrame = true
 				waitForKeyFrame = false // 【重点新增】成功捕获首个关键帧，解除拦截状态！
 			default:
@@ -267,80 +526,281 @@ func (d *LinuxDriver) handleConnection() {
 			sendData = payloadBuf
 		}
 
+		d.cacheMutex.Lock()
+		d.lastPTS = pts
+		d.cacheMutex.Unlock()
+
 		// 4. 发送 AVBox
-		d.videoChan <- sdriver.AVBox{
+		d.att.Load().sendVideo(sdriver.AVBox{
 			Data:       sendData,
 			PTS:        pts,
 			NoDuration: false,
-		}
+		})
 		// naltype := nalData[0] & 0x1F
 		// log.Printf("Sent AVBox: NALU Type=%d, PTS=%d, Size=%d bytes, IsKeyFrame=%v\n", naltype, pts, len(sendData), isKeyFrame)
 		// log.Println(nalData)
 	}
 }
 
+// handleFrame 处理视频以外的帧，不认识的类型直接忽略
+func (d *LinuxDriver) handleFrame(frameType protocol.FrameType, payload []byte) {
+	switch frameType {
+	case protocol.FRAME_AUDIO:
+		pts, data, err := protocol.ParseMedia(payload)
+		if err != nil {
+			log.Println("Invalid audio frame:", err)
+			return
+		}
+		if d.audio && !d.paused.Load() {
+			d.att.Load().sendAudio(sdriver.AVBox{Data: data, PTS: pts})
+		}
+	case protocol.FRAME_CLIPBOARD:
+		// 会话中的剪贴板变化或 GetClipboard 的结果
+		if op, content, err := protocol.SplitTyped(payload); err == nil && op == protocol.CLIPBOARD_DATA {
+			d.att.Load().emit(sdriver.ReceiveClipboardEvent{Content: content})
+		}
+	case protocol.FRAME_LOG:
+		d.handleRecorderLog(payload)
+	case protocol.FRAME_STATS:
+		stats := &protocol.Stats{}
+		if err := json.Unmarshal(payload, stats); err == nil {
+			d.handleStats(stats)
+		}
+	case protocol.FRAME_CONFIG_RESULT:
+		var result protocol.ConfigResult
+		if err := json.Unmarshal(payload, &result); err != nil {
+			log.Println("Invalid config result:", err)
+			return
+		}
+		// 超时后才到的回执不能交给下一次 UpdateDriverConfig
+		if w := d.configWait.Load(); w != nil && w.seq == result.Seq {
+			select {
+			case w.result <- result:
+			default:
+			}
+		} else {
+			log.Printf("[linux driver] ignore config result %d, no longer waiting", result.Seq)
+		}
+	}
+}
+
+// handleStats 保存最新的统计，桌面进入或离开空闲降帧时记录实际帧率
+func (d *LinuxDriver) handleStats(stats *protocol.Stats) {
+	last := d.stats.Swap(stats)
+	if last == nil || last.Idle == stats.Idle {
+		return
+	}
+	fps := 0.0
+	if stats.IntervalMs > 0 {
+		fps = float64(stats.VideoPackets) * 1000 / float64(stats.IntervalMs)
+	}
+	if stats.Idle {
+		log.Printf("[linux driver] desktop idle, recorder encodes at %d fps (%.1f fps sent)", stats.FrameRate, fps)
+	} else {
+		log.Printf("[linux driver] desktop active, recorder encodes at %d fps (%.1f fps sent)", stats.FrameRate, fps)
+	}
+}
+
+// handleRecorderLog 记录 recorder 的日志，警告和错误同时提示给观看者
+func (d *LinuxDriver) handleRecorderLog(payload []byte) {
+	level, msg, err := protocol.SplitTyped(payload)
+	if err != nil {
+		return
+	}
+	log.Printf("[linux recorder] %s", msg)
+	if level >= protocol.LOG_WARN {
+		d.att.Load().emit(sdriver.TextMsgEvent{Msg: "Linux recorder: " + string(msg)})
+	}
+}
+
 // ... 其他方法保持不变
 
 // 实现 sdriver.SDriver 接口的其他方法
 func (d *LinuxDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVBox, chan sdriver.Event) {
-	return d.videoChan, nil, nil
+	att := d.att.Load()
+	if !d.audio {
+		return att.videoChan, nil, att.controlChan
+	}
+	return att.videoChan, att.audioChan, att.controlChan
 }
 
-func (d *LinuxDriver) Pause() {}
+// Pause 让 recorder 挂起编码器，控制连接保持可用
+func (d *LinuxDriver) Pause() {
+	if d.paused.Swap(true) {
+		return
+	}
+	d.sendPauseState(true)
+}
+
+// Resume 让 recorder 重启编码器，新编码器从 IDR 开始输出
+func (d *LinuxDriver) Resume() {
+	if !d.paused.Load() {
+		return
+	}
+	d.resumed.Store(true)
+	d.paused.Store(false)
+	d.sendPauseState(false)
+}
+
+func (d *LinuxDriver) sendPauseState(paused bool) {
+	if !d.hello.Has(protocol.CAP_PAUSE) {
+		return
+	}
+	args := []byte{0}
+	if paused {
+		args[0] = 1
+	}
+	if err := d.link.WriteControl(protocol.CONTROL_PAUSE, args); err != nil {
+		log.Printf("[linux driver] send pause state failed: %v", err)
+	}
+}
 
+// RequestIDR 先补发缓存的关键帧让新的观看者立即看到画面，再请 recorder 输出新的关键帧。
+// recorder 要重启编码器，所以 IDR_REQUEST_INTERVAL 内的重复请求只补发缓存。
 func (d *LinuxDriver) RequestIDR(firstFrame bool) {
-	// send cache key frame if available
-	// if len(d.lastSPS) > 0 && len(d.lastPPS) > 0 {
-	// 	startCode := []byte{0x00, 0x00, 0x00, 0x01}
-	// 	keyFrameData := make([]byte, 0, len(d.lastSPS)+len(d.lastPPS)+8)
-	// 	keyFrameData = append(keyFrameData, startCode...)
-	// 	keyFrameData = append(keyFrameData, d.lastSPS...)
-	// 	keyFrameData = append(keyFrameData, startCode...)
-	// 	keyFrameData = append(keyFrameData, d.lastPPS...)
-
-	// 	keyFrameData = append(keyFrameData, startCode...)
-	// 	if len(d.lastIDR) > 0 {
-	// 		keyFrameData = append(keyFrameData, d.lastIDR...)
-	// 	} else {
-	// 		log.Println("Warning: No cached IDR frame available, sending SPS/PPS only")
-	// 	}
-
-	// 	d.videoChan <- sdriver.AVBox{
-	// 		Data:       keyFrameData,
-	// 		PTS:        time.Now().Sub(time.Unix(0, 0)),
-	// 		IsKeyFrame: true,
-	// 		IsConfig:   false,
-	// 	}
-	// 	log.Println("Sent cached key frame (SPS+PPS) in response to IDR request")
-	// } else {
-	// 	log.Println("No cached SPS/PPS available to send for IDR request")
-	// }
+	// 暂停时不发送缓存的关键帧
+	if d.paused.Load() {
+		return
+	}
+	if !d.hasCachedKeyFrame() {
+		d.requestKeyFrame()
+		return
+	}
+	if firstFrame {
+		d.sendCachedKeyFrame()
+		d.requestKeyFrame()
+		return
+	}
+	if !d.requestKeyFrame() {
+		d.sendCachedKeyFrame()
+	}
 }
 
 func (d *LinuxDriver) Capabilities() sdriver.DriverCaps {
 	return sdriver.DriverCaps{
-		CanAudio:     false,
+		CanAudio:     d.audio,
 		CanVideo:     true,
 		CanControl:   true,
-		CanClipboard: false,
+		CanClipboard: d.hello.Has(protocol.CAP_CLIPBOARD),
 		CanUHID:      false,
+		CanResize:    d.hello.Has(protocol.CAP_RESIZE),
+		CanLaunch:    d.hello.Has(protocol.CAP_LAUNCH),
 		IsLinux:      true,
 	}
 }
 
 // CodecInfo() (videoCodec string, audioCodec string)
 func (d *LinuxDriver) MediaMeta() sdriver.MediaMeta {
+	d.configMutex.Lock()
+	defer d.configMutex.Unlock()
+	fps, err := strconv.Atoi(d.frameRate)
+	if err != nil || fps <= 0 {
+		fps = int(d.spsFrameRate + 0.5)
+	}
+	bps, _ := utils.ParseBitrate(d.bitRate)
+	audioCodec := ""
+	if d.audio {
+		audioCodec = "opus"
+	}
 	return sdriver.MediaMeta{
-		Width:      1920,
-		Height:     1080,
+		Width:      d.width,
+		Height:     d.height,
+		FPS:        uint32(fps),
+		BitRate:    uint32(bps),
 		VideoCodec: d.video_codec,
-		AudioCodec: "",
+		AudioCodec: audioCodec,
+	}
+}
+
+// updateVideoMetaFromSPS 从新的 SPS 解析分辨率和帧率，分辨率变化时通知所有观看者。
+// 触摸和滚轮事件按 MediaMeta 的分辨率换算坐标，所以必须和实际画面一致。
+func (d *LinuxDriver) updateVideoMetaFromSPS(sps []byte) {
+	if bytes.Equal(d.lastSPS, sps) {
+		return
+	}
+	var spsInfo comm.SPSInfo
+	var err error
+	switch d.video_codec {
+	case "h264":
+		spsInfo, err = comm.ParseSPS_H264(sps, true)
+	case "h265", "hevc":
+		spsInfo, err = comm.ParseSPS_H265(sps)
+	default:
+		return
+	}
+	if err != nil || spsInfo.Width == 0 || spsInfo.Height == 0 {
+		log.Printf("[linux driver] Failed to parse SPS for video meta update: %v", err)
+		return
+	}
+	d.configMutex.Lock()
+	changed := d.width != spsInfo.Width || d.height != spsInfo.Height
+	d.width, d.height = spsInfo.Width, spsInfo.Height
+	// 编码器按可变帧率写入的时间信息不代表真实帧率，超出范围时忽略
+	if spsInfo.FrameRate > 0 && spsInfo.FrameRate <= 240 {
+		d.spsFrameRate = spsInfo.FrameRate
+	}
+	d.configMutex.Unlock()
+	if changed {
+		log.Printf("[linux driver] Video resolution changed to %dx%d", spsInfo.Width, spsInfo.Height)
+		d.att.Load().emit(sdriver.MediaMetaEvent{Meta: d.MediaMeta()})
 	}
 }
 
+func (d *LinuxDriver) ConfigDescription() []sdriver.ConfigParamDescription {
+	return ConfigDescription()
+}
+
+// Stop 在最后一个观看者离开时由 Agent 调用。持久会话只是脱离，桌面继续运行；
+// 其他情况结束会话，并关闭通道让 Agent 的协程退出。
 func (d *LinuxDriver) Stop() {
-	if d.conn != nil {
-		d.conn.Close()
+	if d.persistent && d.detach() {
+		return
+	}
+	d.terminate()
+	d.att.Load().close()
+}
+
+// terminate 断开与 recorder 的连接，recorder 随之清理会话并退出，之后释放槽位。
+// 通道由 Stop 关闭，Agent 关闭前仍可能向 controlChan 写入。
+func (d *LinuxDriver) terminate() {
+	d.stopOnce.Do(func() {
+		sessionsMu.Lock()
+		if d.sessionID != "" && sessions[d.sessionID] == d {
+			delete(sessions, d.sessionID)
+			log.Printf("[linux session] Session %s ended", d.sessionID)
+		}
+		if d.idleTimer != nil {
+			d.idleTimer.Stop()
+		}
+		sessionsMu.Unlock()
+		close(d.closed)
+		if d.conn != nil {
+			d.conn.Close()
+		}
+		switch {
+		case d.remote != nil:
+			go d.remote.Close()
+		case d.slot != nil:
+			go d.releaseSlot()
+		}
+	})
+}
+
+// releaseSlot 等本地 recorder 退出后删除运行目录，recorder 没有按时退出时先 SIGTERM 再强制结束
+func (d *LinuxDriver) releaseSlot() {
+	if d.recorderDone != nil {
+		select {
+		case <-d.recorderDone:
+		case <-time.After(5 * time.Second):
+			log.Printf("[linux driver] recorder on %s did not exit, terminating", d.slot.DisplayName())
+			d.recorder.Process.Signal(syscall.SIGTERM)
+			select {
+			case <-d.recorderDone:
+			case <-time.After(5 * time.Second):
+				d.recorder.Process.Kill()
+				<-d.recorderDone
+			}
+		}
 	}
-	os.Remove("recorder")
+	d.slot.Release()
 }
@@ -0,0 +1,124 @@
+package linuxDriver
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+	"webscreen/linuxRecorder/protocol"
+	"webscreen/sdriver"
+)
+
+// newPipeDriver 返回通过 net.Pipe 连到假 recorder 的驱动，driver 一侧的帧交给 handleFrame 处理
+func newPipeDriver(t *testing.T) (*LinuxDriver, *protocol.Conn) {
+	t.Helper()
+	driverConn, recorderConn := net.Pipe()
+	t.Cleanup(func() {
+		driverConn.Close()
+		recorderConn.Close()
+	})
+	d := &LinuxDriver{
+		link:      protocol.NewConn(driverConn),
+		hello:     &protocol.Hello{Version: protocol.VERSION, Capabilities: []string{protocol.CAP_CONFIG}},
+		bitRate:   "4M",
+		frameRate: "30",
+		closed:    make(chan struct{}),
+	}
+	d.att.Store(newAttachment())
+	go func() {
+		for {
+			frameType, payload, err := d.link.ReadFrame(nil)
+			if err != nil {
+				return
+			}
+			d.handleFrame(frameType, payload)
+		}
+	}()
+	return d, protocol.NewConn(recorderConn)
+}
+
+// answerConfig 读取一个 CONTROL_CONFIG，按 reply 的返回值回复
+func answerConfig(t *testing.T, recorder *protocol.Conn, reply func(protocol.Config) string) {
+	frameType, payload, err := recorder.ReadFrame(nil)
+	if err != nil {
+		t.Errorf("read config: %v", err)
+		return
+	}
+	controlType, args, err := protocol.SplitTyped(payload)
+	if frameType != protocol.FRAME_CONTROL || err != nil || controlType != protocol.CONTROL_CONFIG {
+		t.Errorf("got frame 0x%02x, want CONTROL_CONFIG", byte(frameType))
+		return
+	}
+	var cfg protocol.Config
+	if err := json.Unmarshal(args, &cfg); err != nil {
+		t.Errorf("invalid config: %v", err)
+		return
+	}
+	recorder.WriteConfigResult(protocol.ConfigResult{Seq: cfg.Seq, Error: reply(cfg)})
+}
+
+func TestUpdateDriverConfigWaitsForRecorder(t *testing.T) {
+	d, recorder := newPipeDriver(t)
+	controlCh := d.att.Load().controlChan
+
+	// recorder 回滚：驱动返回错误，参数不变，也不通知观看者
+	go answerConfig(t, recorder, func(protocol.Config) string { return "rollback: encoder failed to start" })
+	if err := d.UpdateDriverConfig(map[string]string{"frame_rate": "60"}); err == nil {
+		t.Fatal("UpdateDriverConfig succeeded although the recorder rejected the config")
+	}
+	if meta := d.MediaMeta(); meta.FPS != 30 {
+		t.Errorf("FPS = %d after a rejected config, want 30", meta.FPS)
+	}
+	select {
+	case e := <-controlCh:
+		t.Errorf("unexpected event after a rejected config: %#v", e)
+	default:
+	}
+
+	// 回执到达之前参数保持不变
+	applied := make(chan struct{})
+	go answerConfig(t, recorder, func(cfg protocol.Config) string {
+		if cfg.Values["frame_rate"] != "60" {
+			t.Errorf("recorder got %v", cfg.Values)
+		}
+		if fps := d.MediaMeta().FPS; fps != 30 {
+			t.Errorf("FPS = %d before the recorder answered, want 30", fps)
+		}
+		close(applied)
+		return ""
+	})
+	if err := d.UpdateDriverConfig(map[string]string{"frame_rate": "60"}); err != nil {
+		t.Fatal(err)
+	}
+	<-applied
+	if meta := d.MediaMeta(); meta.FPS != 60 {
+		t.Errorf("FPS = %d, want 60", meta.FPS)
+	}
+	select {
+	case e := <-controlCh:
+		if meta, ok := e.(sdriver.MediaMetaEvent); !ok || meta.Meta.FPS != 60 {
+			t.Errorf("event = %#v, want MediaMetaEvent with FPS 60", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("no MediaMetaEvent after the config was applied")
+	}
+}
+
+func TestUpdateDriverConfigConnectionClosed(t *testing.T) {
+	d, recorder := newPipeDriver(t)
+	go func() {
+		// 读走配置后会话结束，不回复
+		recorder.ReadFrame(nil)
+		close(d.closed)
+	}()
+	done := make(chan error, 1)
+	go func() { done <- d.UpdateDriverConfig(map[string]string{"video_bit_rate": "8M"}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("UpdateDriverConfig succeeded without a result")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("UpdateDriverConfig did not return after the session ended")
+	}
+}
@@ -0,0 +1,68 @@
+package linuxDriver
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"runtime"
+	"strings"
+)
+
+// 每个架构一个 recorder-linux-<arch>，由 make build-LinuxRecorder 生成
+//
+//go:embed bin
+var recorderExec embed.FS
+
+const RECORDER_PREFIX = "recorder-linux-"
+
+// unameArchs 把 uname -m 的输出对应到 recorder 的架构名
+var unameArchs = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv7l":  "armv7",
+	"armv8l":  "armv7", // 64 位内核上的 32 位用户空间
+}
+
+// embeddedRecorderArchs 返回本次构建嵌入了哪些架构的 recorder
+func embeddedRecorderArchs() []string {
+	entries, _ := fs.ReadDir(recorderExec, "bin")
+	var archs []string
+	for _, entry := range entries {
+		if arch, ok := strings.CutPrefix(entry.Name(), RECORDER_PREFIX); ok {
+			archs = append(archs, arch)
+		}
+	}
+	return archs
+}
+
+// recorderBinary 返回指定架构的 recorder
+func recorderBinary(arch string) ([]byte, error) {
+	data, err := recorderExec.ReadFile("bin/" + RECORDER_PREFIX + arch)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("recorder for linux/%s is not embedded in this build (embedded: %v), run make build-LinuxRecorder",
+			arch, embeddedRecorderArchs())
+	}
+	return data, err
+}
+
+// localRecorderBinary 返回与本机架构相同的 recorder
+func localRecorderBinary() ([]byte, error) {
+	arch := runtime.GOARCH
+	if arch == "arm" {
+		arch = "armv7"
+	}
+	return recorderBinary(arch)
+}
+
+// remoteRecorderBinary 按远端 uname -m 的输出选择 recorder
+func remoteRecorderBinary(machine string) ([]byte, error) {
+	machine = strings.TrimSpace(machine)
+	arch, ok := unameArchs[machine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported remote architecture %q, recorder is available for x86_64, aarch64 and armv7l", machine)
+	}
+	return recorderBinary(arch)
+}
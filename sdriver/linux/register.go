@@ -0,0 +1,37 @@
+package linuxDriver
+
+import (
+	"os/exec"
+	"webscreen/sdriver"
+)
+
+func init() {
+	sdriver.Register(sdriver.Registration{
+		Name:    sdriver.DEVICE_TYPE_LINUX,
+		Aliases: []string{"xvfb"},
+		New: func(config map[string]string) (sdriver.SDriver, error) {
+			return New(config)
+		},
+		ConfigDescription: sessionConfigDescription,
+		Devices:           ListDevices,
+		Terminate:         TerminateSession,
+		// 每个驱动实例都会新建或独占一个桌面会话，第二路编码会连到另一个桌面
+		SingleEncoder: true,
+	})
+}
+
+// ListDevices 本机装有 ffmpeg 时提供一个新建本地桌面的设备，后面是正在运行的持久会话
+func ListDevices() ([]sdriver.DeviceInfo, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, nil
+	}
+	return append([]sdriver.DeviceInfo{
+		{
+			Type:     sdriver.DEVICE_TYPE_LINUX,
+			DeviceID: NEW_SESSION_DEVICE_ID,
+			IP:       "127.0.0.1",
+			Port:     0,
+			Status:   "active",
+		},
+	}, ListSessions()...), nil
+}
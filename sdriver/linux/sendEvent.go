@@ -3,6 +3,8 @@ package linuxDriver
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"webscreen/linuxRecorder/protocol"
 	"webscreen/sdriver"
 )
 
@@ -10,19 +12,14 @@ func (d *LinuxDriver) SendEvent(event sdriver.Event) error {
 	// log.Printf("X11Driver: Sending event type %T", event)
 	buf := new(bytes.Buffer)
 
-	// 协议常量（与 linuxRecorder/inputController.go 对齐）
-	const (
-		PacketTypeKey   = 0x00
-		PacketTypeMouse = 0x01
-		PacketTypeTouch = 0x02
-
-		mouseActionMove = 2
-	)
+	// 输入事件放在 FRAME_CONTROL 中，参数格式与 linuxRecorder/inputController.go 对齐
+	const mouseActionMove = 2
 
+	var controlType byte
 	switch v := event.(type) {
 
 	case *sdriver.MouseEvent:
-		buf.WriteByte(PacketTypeMouse) // Header: 0x01
+		controlType = protocol.CONTROL_MOUSE
 
 		// Payload
 		buf.WriteByte(v.Action)                        // [0] Action
@@ -37,7 +34,7 @@ func (d *LinuxDriver) SendEvent(event sdriver.Event) error {
 
 	// Touch payload: [Action 1][PtrID 1][X 2][Y 2][Pressure 2][Buttons 1] => 9 bytes
 	case *sdriver.TouchEvent:
-		buf.WriteByte(PacketTypeTouch) // Header: 0x02
+		controlType = protocol.CONTROL_TOUCH
 		buf.WriteByte(v.Action)
 		buf.WriteByte(byte(v.PointerID & 0xFF))
 		binary.Write(buf, binary.BigEndian, uint16(v.PosX&0xFFFF))
@@ -47,7 +44,7 @@ func (d *LinuxDriver) SendEvent(event sdriver.Event) error {
 
 	// Scroll 映射为 Mouse Move + Wheel
 	case *sdriver.ScrollEvent:
-		buf.WriteByte(PacketTypeMouse) // Header: 0x01
+		controlType = protocol.CONTROL_MOUSE
 
 		// Payload (17 bytes)
 		buf.WriteByte(mouseActionMove)                 // [0] Action (滚动视为 Move)
@@ -60,12 +57,38 @@ func (d *LinuxDriver) SendEvent(event sdriver.Event) error {
 		binary.Write(buf, binary.BigEndian, int16(v.VScroll))
 
 	case *sdriver.KeyEvent:
-		buf.WriteByte(PacketTypeKey) // Header: 0x00
+		controlType = protocol.CONTROL_KEY
 
 		// Payload (5 bytes)
 		buf.WriteByte(v.Action)                        // [0] Action
 		binary.Write(buf, binary.BigEndian, v.KeyCode) // [1-4] KeyCode
 
+	// 剪贴板走 FRAME_CLIPBOARD，Payload: [CopyKey 1]
+	case *sdriver.GetClipboardEvent:
+		return d.link.WriteClipboard(protocol.CLIPBOARD_GET, []byte{v.CopyKey})
+
+	// Payload: [Sequence 8][Paste 1][Content N]
+	case *sdriver.SetClipboardEvent:
+		binary.Write(buf, binary.BigEndian, v.Sequence)
+		if v.Paste {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.Write(v.Content)
+		return d.link.WriteClipboard(protocol.CLIPBOARD_SET, buf.Bytes())
+
+	// 在会话中启动应用，Payload 为 protocol.Launch 的 JSON
+	case *sdriver.LaunchAppEvent:
+		if !d.hello.Has(protocol.CAP_LAUNCH) {
+			return sdriver.ErrNotSupported
+		}
+		payload, err := json.Marshal(protocol.Launch{Command: v.Command})
+		if err != nil {
+			return err
+		}
+		return d.link.WriteControl(protocol.CONTROL_LAUNCH, payload)
+
 	// 其他事件直接忽略
 	default:
 
@@ -73,11 +96,7 @@ func (d *LinuxDriver) SendEvent(event sdriver.Event) error {
 	}
 
 	// 发送数据
-	if buf.Len() > 0 {
-		_, err := d.conn.Write(buf.Bytes())
-		return err
-	}
-	return nil
+	return d.link.WriteControl(controlType, buf.Bytes())
 }
 
 // AndroidKeyCodeToX11 将 Android 标准 KeyCode 映射为 X11 Keycode
@@ -0,0 +1,279 @@
+package linuxDriver
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"webscreen/sdriver"
+)
+
+// 持久会话：persistent=true 的桌面在最后一个观看者离开后不退出，recorder 暂停编码，
+// X/Sway 和其中的应用继续运行。会话作为单独的设备出现在设备列表中，DeviceID 即会话 ID，
+// 连接该设备会接回同一个 display；脱离超过 idle_timeout 或调用 TerminateSession 后才真正结束。
+
+// NEW_SESSION_DEVICE_ID 是"新建桌面"对应的设备 ID
+const NEW_SESSION_DEVICE_ID = "Linux Desktop"
+
+const (
+	SESSION_ID_PREFIX    = "session-"
+	DEFAULT_IDLE_TIMEOUT = time.Hour
+)
+
+var (
+	// sessionsMu 同时保护 LinuxDriver 的 attached/detachedAt/idleTimer
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*LinuxDriver)
+)
+
+// attachment 是一次接回对应的一组通道。Agent 的循环 range 这些通道，
+// 会话脱离时关闭它们，旧 Agent 的协程随之退出，下一次接回换一组新的。
+type attachment struct {
+	videoChan   chan sdriver.AVBox
+	audioChan   chan sdriver.AVBox
+	controlChan chan sdriver.Event
+	done        chan struct{}
+	closeOnce   sync.Once
+	// 发送和关闭互斥，避免向已关闭的通道写入
+	mu sync.Mutex
+}
+
+func newAttachment() *attachment {
+	return &attachment{
+		videoChan:   make(chan sdriver.AVBox, 10), // 适当增大缓冲防止阻塞
+		audioChan:   make(chan sdriver.AVBox, 10),
+		controlChan: make(chan sdriver.Event, 10),
+		done:        make(chan struct{}),
+	}
+}
+
+// sendVideo 阻塞地投递视频帧，通道关闭后直接丢弃
+func (a *attachment) sendVideo(box sdriver.AVBox) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.done:
+		return
+	default:
+	}
+	select {
+	case a.videoChan <- box:
+	case <-a.done:
+	}
+}
+
+// sendAudio 非阻塞地投递音频包，Agent 来不及处理时丢弃，不能因为音频卡住视频
+func (a *attachment) sendAudio(box sdriver.AVBox) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.done:
+		return
+	default:
+	}
+	select {
+	case a.audioChan <- box:
+	default:
+	}
+}
+
+// emit 非阻塞地投递控制事件
+func (a *attachment) emit(event sdriver.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.done:
+		return
+	default:
+	}
+	select {
+	case a.controlChan <- event:
+	default:
+	}
+}
+
+func (a *attachment) close() {
+	a.closeOnce.Do(func() {
+		// 先唤醒阻塞在 sendVideo 的协程，再拿锁关闭通道
+		close(a.done)
+		a.mu.Lock()
+		close(a.videoChan)
+		close(a.audioChan)
+		close(a.controlChan)
+		a.mu.Unlock()
+	})
+}
+
+// parseIdleTimeout 解析 idle_timeout（秒），0 表示脱离后一直保留
+func parseIdleTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return DEFAULT_IDLE_TIMEOUT, nil
+	}
+	sec, err := strconv.Atoi(v)
+	if err != nil || sec < 0 {
+		return 0, fmt.Errorf("invalid idle timeout: %s", v)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
+
+// registerSession 为刚启动的持久桌面分配会话 ID 并登记
+func registerSession(d *LinuxDriver) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for {
+		id := fmt.Sprintf("%s%d-%04x", SESSION_ID_PREFIX, d.slot.Display, rand.Uint32()&0xFFFF)
+		if _, dup := sessions[id]; !dup {
+			d.sessionID = id
+			break
+		}
+	}
+	d.attached = true
+	sessions[d.sessionID] = d
+	log.Printf("[linux session] Persistent session %s on %s, idle timeout %v", d.sessionID, d.slot.DisplayName(), d.idleTimeout)
+}
+
+// attachSession 接回 cfg["deviceID"] 指定的持久会话。deviceID 不是会话 ID 时返回 nil, nil，由调用者新建桌面。
+func attachSession(cfg map[string]string) (*LinuxDriver, error) {
+	id := cfg["deviceID"]
+	if !strings.HasPrefix(id, SESSION_ID_PREFIX) {
+		return nil, nil
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	d, ok := sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("linux session %s: %w", id, sdriver.ErrDeviceNotFound)
+	}
+	if d.attached {
+		// 同一会话只能有一路编码，其他观看者应加入已有的 Agent
+		return nil, fmt.Errorf("linux session %s is already streaming %s", id, d.video_codec)
+	}
+	if codec := cfg["video_codec"]; codec != "" && codec != d.video_codec {
+		return nil, fmt.Errorf("linux session %s streams %s, cannot switch to %s", id, d.video_codec, codec)
+	}
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+		d.idleTimer = nil
+	}
+	d.attached = true
+	d.att.Store(newAttachment())
+	d.Resume()
+	log.Printf("[linux session] Reattach session %s on %s after %v", id, d.slot.DisplayName(), time.Since(d.detachedAt).Round(time.Second))
+
+	// 码率、帧率可以跟随新的配置，分辨率和后端由会话决定
+	update := make(map[string]string)
+	d.configMutex.Lock()
+	if v := cfg["video_bit_rate"]; v != "" && v != d.bitRate {
+		update["video_bit_rate"] = v
+	}
+	if v := cfg["frame_rate"]; v != "" && v != d.frameRate {
+		update["frame_rate"] = v
+	}
+	d.configMutex.Unlock()
+	if len(update) > 0 {
+		if err := d.UpdateDriverConfig(update); err != nil {
+			log.Printf("[linux session] Apply %v to session %s: %v", update, id, err)
+		}
+	}
+	return d, nil
+}
+
+// detach 让持久会话脱离观看者：recorder 暂停编码，关闭本次接回的通道并开始空闲计时。
+// 会话已经结束时返回 false。
+func (d *LinuxDriver) detach() bool {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if sessions[d.sessionID] != d || !d.attached {
+		return false
+	}
+	d.Pause()
+	d.att.Load().close()
+	d.attached = false
+	d.detachedAt = time.Now()
+	if d.idleTimeout > 0 {
+		d.idleTimer = time.AfterFunc(d.idleTimeout, d.expire)
+	}
+	log.Printf("[linux session] Session %s detached, desktop %s keeps running", d.sessionID, d.slot.DisplayName())
+	return true
+}
+
+// expire 在空闲超时后结束会话，期间被接回则什么也不做
+func (d *LinuxDriver) expire() {
+	sessionsMu.Lock()
+	idle := !d.attached && sessions[d.sessionID] == d
+	sessionsMu.Unlock()
+	if !idle {
+		return
+	}
+	log.Printf("[linux session] Session %s idle for %v, terminating", d.sessionID, d.idleTimeout)
+	d.terminate()
+}
+
+// TerminateSession 结束持久会话，正在观看的 Agent 会失去视频，由调用者断开观看者
+func TerminateSession(id string) error {
+	sessionsMu.Lock()
+	d, ok := sessions[id]
+	sessionsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("linux session %s: %w", id, sdriver.ErrDeviceNotFound)
+	}
+	log.Printf("[linux session] Terminate session %s", id)
+	d.terminate()
+	return nil
+}
+
+// ListSessions 以设备的形式返回所有持久会话，按 display 排序
+func ListSessions() []sdriver.DeviceInfo {
+	sessionsMu.Lock()
+	drivers := slices.Collect(maps.Values(sessions))
+	status := make(map[*LinuxDriver]string, len(drivers))
+	for _, d := range drivers {
+		status[d] = "detached"
+		if d.attached {
+			status[d] = "active"
+		}
+	}
+	sessionsMu.Unlock()
+
+	slices.SortFunc(drivers, func(a, b *LinuxDriver) int { return a.slot.Display - b.slot.Display })
+	devices := make([]sdriver.DeviceInfo, 0, len(drivers))
+	for _, d := range drivers {
+		devices = append(devices, sdriver.DeviceInfo{
+			Type:       sdriver.DEVICE_TYPE_LINUX,
+			DeviceID:   d.sessionID,
+			IP:         d.ip,
+			Port:       d.slot.Port,
+			Status:     status[d],
+			Terminable: true,
+		})
+	}
+	return devices
+}
+
+// sessionConfigDescription 返回设备的配置项。会话设备的编码、后端和分辨率已经固定，默认值取会话的实际值。
+func sessionConfigDescription(deviceID string) []sdriver.ConfigParamDescription {
+	params := ConfigDescription()
+	sessionsMu.Lock()
+	d, ok := sessions[deviceID]
+	sessionsMu.Unlock()
+	if !ok {
+		return params
+	}
+	for i := range params {
+		switch params[i].Name {
+		case "video_codec":
+			params[i].Default = d.video_codec
+			params[i].Options = []string{sdriver.VIDEO_CODEC_AUTO, d.video_codec}
+		case "backend":
+			params[i].Default = d.backend
+		case "resolution":
+			params[i].Default = d.resolution
+		}
+	}
+	return params
+}
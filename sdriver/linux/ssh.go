@@ -1,50 +1,365 @@
 package linuxDriver
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"webscreen/linuxRecorder/slot"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
-// scp and execute recorder binary
-func PushAndStartRecorder(user, ip, tcpPort, resolution, bitrate, frameRate, codec, backend string) error {
+const (
+	SSH_DEFAULT_PORT     = "22"
+	SSH_DIAL_TIMEOUT     = 10 * time.Second
+	SSH_ANNOUNCE_TIMEOUT = 60 * time.Second
+)
 
-	execCmd := exec.Command("bash", "-c",
-		"scp ./recorder "+user+"@"+ip+":/tmp/recorder && "+
-			"ssh "+user+"@"+ip+" 'chmod +x /tmp/recorder && "+
-			"/tmp/recorder -resolution "+resolution+" -tcp_port "+tcpPort+
-			" -bitrate "+bitrate+" -framerate "+frameRate+" -codec "+codec+" -backend "+backend+"'")
+// SSHConfig 描述如何登录远程 Linux 主机，对应 ssh_* 配置项
+type SSHConfig struct {
+	// Host 为 [user@]host[:port]，user 默认为本地用户名
+	Host     string
+	Password string
+	// KeyFile 为空时依次尝试 ~/.ssh/id_ed25519、id_ecdsa、id_rsa
+	KeyFile string
+	// KnownHosts 为空时使用 ~/.ssh/known_hosts，未登记或不匹配的主机密钥会被拒绝
+	KnownHosts string
+}
 
-	execCmd.Stdout = os.Stdout
-	execCmd.Stderr = os.Stderr
-	return execCmd.Run()
+func sshConfigFromDriverConfig(cfg map[string]string) SSHConfig {
+	return SSHConfig{
+		Host:       cfg["ssh_host"],
+		Password:   cfg["ssh_password"],
+		KeyFile:    cfg["ssh_key_file"],
+		KnownHosts: cfg["ssh_known_hosts"],
+	}
+}
+
+// splitSSHHost 把 [user@]host[:port] 拆成用户名和 host:port
+func splitSSHHost(target string) (username, address string, err error) {
+	username, hostPort, found := strings.Cut(target, "@")
+	if !found {
+		hostPort = username
+		username = ""
+	}
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("ssh: no user in %q: %v", target, err)
+		}
+		username = u.Username
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = strings.Trim(hostPort, "[]"), SSH_DEFAULT_PORT
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("ssh: invalid host %q", target)
+	}
+	return username, net.JoinHostPort(host, port), nil
+}
+
+// authMethods 按 ssh-agent、私钥、密码的顺序尝试认证，agentConn 在登录后由调用者关闭
+func (c SSHConfig) authMethods() (methods []ssh.AuthMethod, agentConn net.Conn, err error) {
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err = net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		} else {
+			log.Printf("[ssh] ssh-agent unavailable: %v", err)
+		}
+	}
+
+	keyFiles := []string{c.KeyFile}
+	if c.KeyFile == "" {
+		home, _ := os.UserHomeDir()
+		keyFiles = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	var signers []ssh.Signer
+	for _, path := range keyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if c.KeyFile != "" {
+				return nil, agentConn, fmt.Errorf("ssh: read key %s: %v", path, err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && c.Password != "" {
+			// 有口令的私钥用 ssh_password 解密
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(c.Password))
+		}
+		if err != nil {
+			if c.KeyFile != "" {
+				return nil, agentConn, fmt.Errorf("ssh: parse key %s: %v", path, err)
+			}
+			log.Printf("[ssh] Skip key %s: %v", path, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if c.Password != "" {
+		methods = append(methods, ssh.Password(c.Password))
+	}
+	if len(methods) == 0 {
+		return nil, agentConn, fmt.Errorf("ssh: no authentication method, set ssh_password or ssh_key_file, or run ssh-agent")
+	}
+	return methods, agentConn, nil
+}
+
+// hostKeyCallback 用 known_hosts 校验主机密钥，出错时给出指纹方便用户确认后登记
+func (c SSHConfig) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := c.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: load known hosts: %v", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("ssh: host %s (%s %s) is not in %s, verify it and add it, e.g. with ssh-keyscan",
+					hostname, key.Type(), fingerprint, path)
+			}
+			return fmt.Errorf("ssh: host key of %s changed (%s %s), refusing to connect", hostname, key.Type(), fingerprint)
+		}
+		return err
+	}, nil
+}
+
+// DialSSH 登录远程主机
+func DialSSH(c SSHConfig) (*ssh.Client, error) {
+	username, address, err := splitSSHHost(c.Host)
+	if err != nil {
+		return nil, err
+	}
+	auth, agentConn, err := c.authMethods()
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         SSH_DIAL_TIMEOUT,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s@%s: %w", username, address, err)
+	}
+	return client, nil
+}
+
+// shellQuote 用单引号包裹参数，供远端 shell 解析
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// RemoteRecorder 是通过 SSH 启动的 recorder。recorder 只监听远端的 127.0.0.1，
+// 视频和控制流经 SSH 的 direct-tcpip 通道转发，远端不需要开放额外端口。
+type RemoteRecorder struct {
+	client  *ssh.Client
+	session *ssh.Session
+	// 远端 recorder 自己分配的槽位，没有 RuntimeDir
+	Slot *slot.Slot
+	done chan struct{}
+
+	closeOnce sync.Once
+}
+
+// StartRemoteRecorder 登录远程主机，按远端架构上传 recorder 并启动，等 recorder 报告槽位后返回。
+// 上传的文件在 recorder 退出后由远端 shell 删除。
+// recorderArgs 为编码和会话参数，见 LinuxDriver.recorderArgs。
+func StartRemoteRecorder(c SSHConfig, recorderArgs []string) (*RemoteRecorder, error) {
+	client, err := DialSSH(c)
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := remoteRecorder(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	remotePath, err := uploadRecorder(client, recorder)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	session.Stderr = os.Stderr
+	args := append([]string{remotePath, "-listen", "127.0.0.1"}, recorderArgs...)
+	for i := range args {
+		args[i] = shellQuote(args[i])
+	}
+	cmd := strings.Join(args, " ") + "; rm -f " + shellQuote(remotePath)
+	if err := session.Start(cmd); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("ssh: start recorder: %v", err)
+	}
+	r := &RemoteRecorder{
+		client:  client,
+		session: session,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		session.Wait()
+		log.Printf("Remote recorder on %s exited.", c.Host)
+		close(r.done)
+	}()
+
+	// recorder 分配好槽位后在 stdout 输出一行 WEBSCREEN_SLOT，其余输出转到日志
+	announced := make(chan *slot.Slot, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if s, ok := slot.ParseAnnounce(scanner.Text()); ok {
+				announced <- s
+				continue
+			}
+			log.Printf("[remote recorder] %s", scanner.Text())
+		}
+	}()
+	select {
+	case r.Slot = <-announced:
+		log.Printf("[ssh] Remote recorder on %s uses %s, port %d", c.Host, r.Slot.DisplayName(), r.Slot.Port)
+		return r, nil
+	case <-r.done:
+		r.Close()
+		return nil, fmt.Errorf("ssh: remote recorder exited before allocating a session")
+	case <-time.After(SSH_ANNOUNCE_TIMEOUT):
+		r.Close()
+		return nil, fmt.Errorf("ssh: remote recorder did not allocate a session within %v", SSH_ANNOUNCE_TIMEOUT)
+	}
 }
 
-func LocalStartRecorder(tcpPort, resolution, bitrate, frameRate, codec, backend string) error {
-	// 确保文件有执行权限（建议在部署阶段做好，而不是在代码里每次都 chmod）
-	os.Chmod("./recorder", 0755)
+// remoteRecorder 用 uname 检查远端系统和架构，返回对应的 recorder
+func remoteRecorder(client *ssh.Client) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	out, err := session.Output("uname -sm")
+	if err != nil {
+		return nil, fmt.Errorf("ssh: detect remote architecture: %v", err)
+	}
+	system, machine, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if system != "Linux" {
+		return nil, fmt.Errorf("unsupported remote system %q, recorder only runs on Linux", system)
+	}
+	log.Printf("[ssh] Remote architecture: %s", machine)
+	return remoteRecorderBinary(machine)
+}
 
-	// 直接执行二进制，不要通过 bash -c 拼接字符串
-	execCmd := exec.Command("./recorder",
-		"-resolution", resolution,
-		"-tcp_port", tcpPort,
-		"-bitrate", bitrate,
-		"-framerate", frameRate,
-		"-codec", codec,
-		"-backend", backend,
-	)
+// uploadRecorder 把 recorder 写到远端的临时文件，返回路径
+func uploadRecorder(client *ssh.Client, recorder []byte) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(recorder)
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	const cmd = `f=$(mktemp "${TMPDIR:-/tmp}/webscreen-recorder.XXXXXX") && cat > "$f" && chmod 700 "$f" && echo "$f"`
+	if err := session.Run(cmd); err != nil {
+		return "", fmt.Errorf("ssh: upload recorder: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Dial 经 SSH 连接远端 recorder 的 127.0.0.1:<port>
+func (r *RemoteRecorder) Dial() (net.Conn, error) {
+	return r.client.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(r.Slot.Port)))
+}
+
+// Close 等 recorder 在连接断开后自行退出，超时则发送 SIGTERM，最后断开 SSH
+func (r *RemoteRecorder) Close() {
+	r.closeOnce.Do(func() {
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+			log.Printf("[ssh] remote recorder did not exit, terminating")
+			r.session.Signal(ssh.SIGTERM)
+			select {
+			case <-r.done:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		r.client.Close()
+	})
+}
+
+// LocalStartRecorder 在槽位 s 上启动本地 recorder，返回的 channel 在 recorder 退出后关闭
+func LocalStartRecorder(recorderPath string, s *slot.Slot, recorderArgs []string) (*exec.Cmd, <-chan struct{}, error) {
+	// 直接执行二进制，不要通过 bash -c 拼接字符串。
+	// 驱动连接 127.0.0.1，recorder 只监听回环地址，控制通道不暴露给局域网
+	execCmd := exec.Command(recorderPath, append([]string{
+		"-display", strconv.Itoa(s.Display),
+		"-tcp_port", strconv.Itoa(s.Port),
+		"-runtime_dir", s.RuntimeDir,
+		"-listen", "127.0.0.1",
+	}, recorderArgs...)...)
 
 	execCmd.Stdout = os.Stdout
 	execCmd.Stderr = os.Stderr
 
 	log.Printf("Starting local recorder...")
 	if err := execCmd.Start(); err != nil {
-		return err
+		return nil, nil, err
 	}
 	// 在后台 Wait，防止自身变成僵尸进程
+	done := make(chan struct{})
 	go func() {
 		execCmd.Wait()
-		log.Println("Local recorder exited.")
+		log.Printf("Local recorder on %s exited.", s.DisplayName())
+		close(done)
 	}()
-	return nil
+	return execCmd, done, nil
 }
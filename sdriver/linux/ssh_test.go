@@ -0,0 +1,332 @@
+package linuxDriver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"webscreen/linuxRecorder/slot"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const testRemotePath = "/tmp/webscreen-recorder.test"
+
+// testSSHServer 是进程内的 SSH 服务器，只实现 StartRemoteRecorder 用到的三条命令：
+// uname -sm、上传 recorder 和启动 recorder
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+	slot    slot.Slot
+
+	mu       sync.Mutex
+	uname    string
+	uploaded []byte
+	started  chan string
+}
+
+// newTestSSHServer 启动服务器。password 为空时不接受密码，authorized 为 nil 时不接受公钥
+func newTestSSHServer(t *testing.T, password string, authorized ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if password != "" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorized != nil && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testSSHServer{
+		addr:    ln.Addr().String(),
+		hostKey: hostSigner.PublicKey(),
+		uname:   "Linux x86_64",
+		slot:    slot.Slot{Display: 105, Port: 27305},
+		started: make(chan string, 1),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				var exec struct{ Command string }
+				if req.Type != "exec" || ssh.Unmarshal(req.Payload, &exec) != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				go s.exec(ch, exec.Command)
+			}
+		}()
+	}
+}
+
+func (s *testSSHServer) exec(ch ssh.Channel, cmd string) {
+	switch {
+	case cmd == "uname -sm":
+		s.mu.Lock()
+		uname := s.uname
+		s.mu.Unlock()
+		io.WriteString(ch, uname+"\n")
+	case strings.Contains(cmd, "mktemp"):
+		data, _ := io.ReadAll(ch)
+		s.mu.Lock()
+		s.uploaded = data
+		s.mu.Unlock()
+		io.WriteString(ch, testRemotePath+"\n")
+	case strings.HasPrefix(cmd, shellQuote(testRemotePath)):
+		// recorder 一直运行到连接断开
+		s.started <- cmd
+		io.WriteString(ch, "starting\n"+s.slot.Announce()+"\n")
+		return
+	default:
+		io.WriteString(ch.Stderr(), "unknown command\n")
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{127}))
+		ch.Close()
+		return
+	}
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+	ch.Close()
+}
+
+// isolateSSH 去掉 ssh-agent 和 ~/.ssh 里的私钥，只使用测试给出的认证方式
+func isolateSSH(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+}
+
+// writeKnownHosts 写入登记了 keys 的 known_hosts，返回路径
+func writeKnownHosts(t *testing.T, addr string, keys ...ssh.PublicKey) string {
+	t.Helper()
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key))
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeKey 生成 ed25519 私钥并写入文件，passphrase 非空时加密
+func writeKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, sshPub
+}
+
+func TestDialSSHHostKey(t *testing.T) {
+	isolateSSH(t)
+	s := newTestSSHServer(t, "secret", nil)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherPriv)
+
+	tests := []struct {
+		name    string
+		known   []ssh.PublicKey
+		wantErr string
+	}{
+		{"unknown", nil, "is not in"},
+		{"changed", []ssh.PublicKey{otherSigner.PublicKey()}, "changed"},
+		{"known", []ssh.PublicKey{s.hostKey}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := DialSSH(SSHConfig{
+				Host:       "tester@" + s.addr,
+				Password:   "secret",
+				KnownHosts: writeKnownHosts(t, s.addr, tt.known...),
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("DialSSH: %v", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil {
+				client.Close()
+				t.Fatal("DialSSH accepted an unverified host key")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), ssh.FingerprintSHA256(s.hostKey)) {
+				t.Fatalf("DialSSH error %q, want %q and the host key fingerprint", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialSSHPassword(t *testing.T) {
+	isolateSSH(t)
+	s := newTestSSHServer(t, "secret", nil)
+	knownHosts := writeKnownHosts(t, s.addr, s.hostKey)
+
+	client, err := DialSSH(SSHConfig{Host: "tester@" + s.addr, Password: "secret", KnownHosts: knownHosts})
+	if err != nil {
+		t.Fatalf("DialSSH: %v", err)
+	}
+	client.Close()
+
+	if client, err := DialSSH(SSHConfig{Host: "tester@" + s.addr, Password: "wrong", KnownHosts: knownHosts}); err == nil {
+		client.Close()
+		t.Fatal("DialSSH succeeded with a wrong password")
+	}
+	if _, err := DialSSH(SSHConfig{Host: "tester@" + s.addr, KnownHosts: knownHosts}); err == nil || !strings.Contains(err.Error(), "no authentication method") {
+		t.Fatalf("DialSSH without credentials: %v, want no authentication method", err)
+	}
+}
+
+func TestDialSSHKey(t *testing.T) {
+	isolateSSH(t)
+	for _, passphrase := range []string{"", "key passphrase"} {
+		keyFile, pub := writeKey(t, passphrase)
+		// 服务器不接受密码，登录成功说明用的是私钥
+		s := newTestSSHServer(t, "", pub)
+		client, err := DialSSH(SSHConfig{
+			Host:       "tester@" + s.addr,
+			Password:   passphrase,
+			KeyFile:    keyFile,
+			KnownHosts: writeKnownHosts(t, s.addr, s.hostKey),
+		})
+		if err != nil {
+			t.Fatalf("DialSSH with key (passphrase %q): %v", passphrase, err)
+		}
+		client.Close()
+	}
+
+	keyFile, _ := writeKey(t, "")
+	if _, err := DialSSH(SSHConfig{Host: "tester@127.0.0.1:1", KeyFile: keyFile + ".missing"}); err == nil {
+		t.Fatal("DialSSH ignored a missing ssh_key_file")
+	}
+}
+
+func TestStartRemoteRecorder(t *testing.T) {
+	isolateSSH(t)
+	recorder, err := remoteRecorderBinary("x86_64")
+	if err != nil {
+		t.Skipf("recorder not embedded: %v", err)
+	}
+	s := newTestSSHServer(t, "secret", nil)
+	r, err := StartRemoteRecorder(SSHConfig{
+		Host:       "tester@" + s.addr,
+		Password:   "secret",
+		KnownHosts: writeKnownHosts(t, s.addr, s.hostKey),
+	}, []string{"-backend", "xvfb", "-app", "xterm -e 'top'"})
+	if err != nil {
+		t.Fatalf("StartRemoteRecorder: %v", err)
+	}
+	defer func() {
+		// 测试服务器上的 recorder 不会自己退出，直接断开连接
+		r.client.Close()
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+			t.Error("remote recorder session did not end after the connection closed")
+		}
+	}()
+
+	if r.Slot.Display != s.slot.Display || r.Slot.Port != s.slot.Port {
+		t.Errorf("slot = %+v, want %+v", *r.Slot, s.slot)
+	}
+	s.mu.Lock()
+	uploaded := s.uploaded
+	s.mu.Unlock()
+	if !bytes.Equal(uploaded, recorder) {
+		t.Errorf("uploaded %d bytes, want the %d byte x86_64 recorder", len(uploaded), len(recorder))
+	}
+	want := `'/tmp/webscreen-recorder.test' '-listen' '127.0.0.1' '-backend' 'xvfb' '-app' 'xterm -e '\''top'\'''` +
+		`; rm -f '/tmp/webscreen-recorder.test'`
+	if cmd := <-s.started; cmd != want {
+		t.Errorf("start command\n got %s\nwant %s", cmd, want)
+	}
+}
+
+func TestStartRemoteRecorderUnsupportedSystem(t *testing.T) {
+	isolateSSH(t)
+	s := newTestSSHServer(t, "secret", nil)
+	s.mu.Lock()
+	s.uname = "Darwin arm64"
+	s.mu.Unlock()
+	_, err := StartRemoteRecorder(SSHConfig{
+		Host:       "tester@" + s.addr,
+		Password:   "secret",
+		KnownHosts: writeKnownHosts(t, s.addr, s.hostKey),
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Darwin") {
+		t.Fatalf("StartRemoteRecorder on Darwin: %v, want unsupported system", err)
+	}
+}
@@ -0,0 +1,161 @@
+package sdriver
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Factory 根据前端下发的 driver_config 创建一个驱动实例
+type Factory func(config map[string]string) (SDriver, error)
+
+// DeviceInfo 描述一个可被连接的设备，由各驱动的设备枚举器返回
+type DeviceInfo struct {
+	Type     string `json:"device_type"`
+	DeviceID string `json:"device_id"`
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Status   string `json:"status"`
+	// Terminable 表示设备是一个可以通过 TerminateDevice 结束的后台会话，例如 Linux 持久桌面
+	Terminable bool `json:"terminable,omitempty"`
+}
+
+// Registration 描述一个驱动：如何创建、有哪些配置项、能连接哪些设备。
+// 驱动包在 init() 中调用 Register 完成注册，Agent 和 WebService 只通过注册表访问驱动。
+type Registration struct {
+	// Name 即前端使用的 device_type
+	Name string
+	// Aliases 兼容旧的 device_type 写法，例如 "xvfb" -> "linux"
+	Aliases []string
+
+	New Factory
+	// ConfigDescription 返回该驱动的配置项描述，deviceID 可能为空
+	ConfigDescription func(deviceID string) []ConfigParamDescription
+	// Devices 枚举当前可用的设备，为 nil 表示该驱动不提供设备列表
+	Devices func() ([]DeviceInfo, error)
+	// Terminate 结束设备在后台保持的会话，为 nil 表示该驱动没有后台会话
+	Terminate func(deviceID string) error
+	// SingleEncoder 表示一个设备同时只能有一路编码，例如 Linux 每个驱动实例独占一个桌面。
+	// 设备已经在推流时，新的观看者只能加入正在运行的编码组。
+	SingleEncoder bool
+}
+
+var (
+	registryMu    sync.RWMutex
+	registry      = make(map[string]*Registration)
+	registryOrder []string
+)
+
+// Register 注册一个驱动。重复注册同名驱动会 panic，与 database/sql 的行为一致。
+func Register(reg Registration) {
+	if reg.Name == "" {
+		panic("sdriver: Register with empty driver name")
+	}
+	if reg.New == nil {
+		panic("sdriver: Register driver " + reg.Name + " with nil factory")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	r := &reg
+	for _, name := range append([]string{reg.Name}, reg.Aliases...) {
+		if _, dup := registry[name]; dup {
+			panic("sdriver: Register called twice for driver " + name)
+		}
+		registry[name] = r
+	}
+	registryOrder = append(registryOrder, reg.Name)
+}
+
+// Lookup 按 device_type（或其别名）查找驱动
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	if !ok {
+		return Registration{}, false
+	}
+	return *r, true
+}
+
+// Registrations 按注册顺序返回所有驱动
+func Registrations() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	regs := make([]Registration, 0, len(registryOrder))
+	for _, name := range registryOrder {
+		regs = append(regs, *registry[name])
+	}
+	return regs
+}
+
+// VIDEO_CODEC_AUTO 作为 video_codec 的值时，由 WebService 根据浏览器 offer 选择编码，驱动收到的总是具体的编码。
+// 驱动在 video_codec 的 Options 中列出 auto 表示编码可以按会话选择；
+// dummy 这类编码由输入文件决定的驱动不应列出。
+const VIDEO_CODEC_AUTO = "auto"
+
+// VideoCodecs 返回驱动（对指定设备）能输出的视频编码，取自 video_codec 配置项的 Options。
+// auto 为 true 表示驱动允许自动选择编码。
+func VideoCodecs(deviceType, deviceID string) (codecs []string, auto bool) {
+	reg, ok := Lookup(deviceType)
+	if !ok || reg.ConfigDescription == nil {
+		return nil, false
+	}
+	for _, param := range reg.ConfigDescription(deviceID) {
+		if param.Name != "video_codec" {
+			continue
+		}
+		for _, opt := range param.Options {
+			if opt == VIDEO_CODEC_AUTO {
+				auto = true
+				continue
+			}
+			codecs = append(codecs, opt)
+		}
+	}
+	return codecs, auto
+}
+
+// SingleEncoder 返回该驱动的设备是否只能同时运行一路编码
+func SingleEncoder(deviceType string) bool {
+	reg, ok := Lookup(deviceType)
+	return ok && reg.SingleEncoder
+}
+
+// NewDriver 通过注册表创建驱动实例
+func NewDriver(deviceType string, config map[string]string) (SDriver, error) {
+	reg, ok := Lookup(deviceType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported device type: %s", deviceType)
+	}
+	return reg.New(config)
+}
+
+// ListDevices 汇总所有驱动枚举到的设备。单个驱动枚举失败只记录日志，不影响其他驱动。
+func ListDevices() []DeviceInfo {
+	var devices []DeviceInfo
+	for _, reg := range Registrations() {
+		if reg.Devices == nil {
+			continue
+		}
+		found, err := reg.Devices()
+		if err != nil {
+			log.Printf("[sdriver] list devices for %s failed: %v", reg.Name, err)
+			continue
+		}
+		devices = append(devices, found...)
+	}
+	return devices
+}
+
+// TerminateDevice 结束设备的后台会话。驱动不支持时返回 ErrNotSupported，会话不存在时返回 ErrDeviceNotFound。
+func TerminateDevice(deviceType, deviceID string) error {
+	reg, ok := Lookup(deviceType)
+	if !ok {
+		return fmt.Errorf("unsupported device type %s: %w", deviceType, ErrNotSupported)
+	}
+	if reg.Terminate == nil {
+		return fmt.Errorf("%s: terminate: %w", deviceType, ErrNotSupported)
+	}
+	return reg.Terminate(deviceID)
+}
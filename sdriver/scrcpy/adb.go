@@ -19,25 +19,30 @@ type ADBClient struct {
 
 // NewClient 创建一个新的 ADB 客户端结构体.
 // 如果 address 为空字符串，则表示使用默认设备.
+// scid 不为空时，设备上的 scrcpy-server 路径带上 scid，同一设备上的多个实例互不覆盖
 func NewADBClient(deviceSerial string, scid string, parentCtx context.Context) *ADBClient {
 	ctx, cancel := context.WithCancel(parentCtx)
-	return &ADBClient{deviceSerial: deviceSerial, scid: scid, ctx: ctx, cancel: cancel}
+	remotePath := SCRCPY_SERVER_ANDROID_DST
+	if scid != "" {
+		remotePath += "-" + scid
+	}
+	return &ADBClient{deviceSerial: deviceSerial, scid: scid, remotePath: remotePath, ctx: ctx, cancel: cancel}
 }
 
 // 显式停止服务的方法
 func (c *ADBClient) Stop() {
 	if c.scid != "" {
-		c.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", c.scid))
+		c.ReverseRemove(scrcpySocketName(c.scid))
 	}
 	c.cancel() // 这会触发所有绑定了该 ctx 的命令被 Kill
 }
 
 // Push 将本地文件推送到设备上
 func (c *ADBClient) PushScrcpyServer(localPath string, remotePath string) error {
-	if c.remotePath == "" {
-		c.remotePath = "/data/local/tmp/scrcpy-server"
+	if remotePath == "" {
+		remotePath = c.remotePath
 	}
-	err := c.adb("push", localPath, c.remotePath)
+	err := c.adb("push", localPath, remotePath)
 	if err != nil {
 		return fmt.Errorf("ADB Push failed: %v", err)
 	}
@@ -45,6 +50,12 @@ func (c *ADBClient) PushScrcpyServer(localPath string, remotePath string) error
 	return nil
 }
 
+// RemoveScrcpyServer 删除推送到设备上的 scrcpy-server。
+// 正常启动时 scrcpy-server 会自己删除（cleanup=true），只有启动失败时需要调用。
+func (c *ADBClient) RemoveScrcpyServer() {
+	c.adb("shell", "rm", "-f", c.remotePath)
+}
+
 func (c *ADBClient) Reverse(local, remote string) error {
 	// c.ReverseRemove(local)
 	err := c.adb("reverse", local, remote)
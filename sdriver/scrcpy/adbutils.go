@@ -6,9 +6,9 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"time"
+	"webscreen/sdriver"
 	"webscreen/utils"
 )
 
@@ -24,11 +24,12 @@ func ExecADB(ctx context.Context, args ...string) error {
 	return err
 }
 
+// GenerateSCID 生成 31 位随机 scid，格式与 scrcpy-server 的 socket 名 "scrcpy_%08x" 一致
 func GenerateSCID() string {
 	seed := time.Now().UnixNano() + rand.Int63()
 	r := rand.New(rand.NewSource(seed))
 	// 生成31位随机整数
-	return strconv.FormatInt(int64(r.Uint32()&0x7FFFFFFF), 16)
+	return fmt.Sprintf("%08x", r.Uint32()&0x7FFFFFFF)
 }
 
 // 将ScrcpyParams转为 key=value 格式的参数列表
@@ -96,6 +97,47 @@ func GetConnectedDevices() ([]string, error) {
 	return devices, nil
 }
 
+// ListDevices returns all devices known to adb, including offline and unauthorized ones
+func ListDevices() ([]sdriver.DeviceInfo, error) {
+	adbPath, err := utils.GetADBPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(adbPath, "devices")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []sdriver.DeviceInfo
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "List of devices attached") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			continue
+		}
+		var status string
+		switch parts[1] {
+		case "device":
+			status = "connected"
+		case "offline", "unauthorized":
+			status = parts[1]
+		default:
+			continue
+		}
+		devices = append(devices, sdriver.DeviceInfo{
+			Type:     sdriver.DEVICE_TYPE_ANDROID,
+			DeviceID: parts[0],
+			Status:   status,
+		})
+	}
+	forgetEncoders(devices)
+	return devices, nil
+}
+
 // ConnectDevice connects to a device via TCP/IP
 func ConnectDevice(address string) error {
 	adbPath, err := utils.GetADBPath()
@@ -0,0 +1,65 @@
+package scrcpy
+
+import (
+	"log"
+	"webscreen/sdriver"
+	"webscreen/sdriver/comm"
+)
+
+// convertAV1Frame 处理一个 AV1 包。AV1 没有起始码和 NAL：config 包是编码器的 csd-0
+// （av1C 或序列头 OBU），之后每个包是一个 Low Overhead 格式的时间单元。
+// 关键帧缺少序列头时补上缓存的序列头，新加入的观众可以直接从这一帧开始解码。
+func (da *ScrcpyDriver) convertAV1Frame(header ScrcpyFrameHeader, payload []byte) {
+	if header.IsConfig {
+		da.updateAV1Cache(comm.AV1ConfigOBUs(payload))
+		return
+	}
+	if da.paused.Load() {
+		// 暂停期间只更新序列头缓存
+		if header.IsKeyFrame {
+			da.updateAV1Cache(payload)
+		}
+		return
+	}
+	if da.waitKeyFrame.Load() {
+		if !header.IsKeyFrame {
+			return
+		}
+		da.waitKeyFrame.Store(false)
+	}
+	if !header.IsKeyFrame {
+		da.VideoChan <- sdriver.AVBox{Data: payload, PTS: header.PTS}
+		return
+	}
+
+	data := payload
+	if !da.updateAV1Cache(payload) {
+		da.cacheMutex.RLock()
+		data = append(createCopy(da.LastSPS), payload...)
+		da.cacheMutex.RUnlock()
+	}
+	da.cacheMutex.Lock()
+	// AV1 的 LastIDR 保存带序列头的完整时间单元
+	da.LastIDR = createCopy(data)
+	da.cacheMutex.Unlock()
+	da.VideoChan <- sdriver.AVBox{Data: data, PTS: header.PTS}
+}
+
+// updateAV1Cache 缓存时间单元中的序列头 OBU，返回是否找到了序列头
+func (da *ScrcpyDriver) updateAV1Cache(tu []byte) bool {
+	obus, err := comm.SplitOBUs(tu)
+	if err != nil {
+		log.Println("[scrcpy] Failed to parse AV1 OBUs:", err)
+	}
+	for _, obu := range obus {
+		if obu.Type != comm.OBU_SEQUENCE_HEADER {
+			continue
+		}
+		da.cacheMutex.Lock()
+		da.updateVideoMetaFromSPS(obu.Raw, "av1")
+		da.LastSPS = createCopy(obu.Raw)
+		da.cacheMutex.Unlock()
+		return true
+	}
+	return false
+}
@@ -77,6 +77,13 @@ func (da *ScrcpyDriver) updateCache(payload []byte, codec string) {
 	}
 }
 
+// cacheEmpty 读协程和 UpdateDriverConfig 会同时改写缓存，需要持有 cacheMutex 读取
+func (da *ScrcpyDriver) cacheEmpty() bool {
+	da.cacheMutex.RLock()
+	defer da.cacheMutex.RUnlock()
+	return len(da.LastSPS) == 0 && len(da.LastPPS) == 0 && len(da.LastVPS) == 0 && len(da.LastIDR) == 0
+}
+
 func (da *ScrcpyDriver) sendCachedKeyFrame() {
 	da.cacheMutex.RLock()
 	log.Printf("Sending cached key frame with VPS/SPS/PPS: VPS=%d bytes, SPS=%d bytes, PPS=%d bytes, IDR=%d bytes\n", len(da.LastVPS), len(da.LastSPS), len(da.LastPPS), len(da.LastIDR))
@@ -87,6 +94,12 @@ func (da *ScrcpyDriver) sendCachedKeyFrame() {
 	lastPTS := da.LastPTS
 	da.cacheMutex.RUnlock()
 
+	if da.videoCodec() == "av1" {
+		// AV1 缓存的关键帧已经带有序列头
+		log.Println("⚡ Sending cached AV1 key frame")
+		da.VideoChan <- sdriver.AVBox{Data: cachedIDR, PTS: lastPTS, NoDuration: true}
+		return
+	}
 	var merged_data []byte
 	if len(cachedVPS) > 0 {
 		merged_data = append(merged_data, startCode...)
@@ -3,20 +3,71 @@ package scrcpy
 import (
 	"context"
 	"strings"
+	"sync"
 	"webscreen/sdriver"
 )
 
+// 设备的编码器列表按序列号缓存。每个观看者协商编码时都会读取 ConfigDescription，
+// 不缓存的话每次都要执行一次 adb shell
+var (
+	encoderCacheMutex sync.Mutex
+	encoderCache      = map[string][]string{}
+)
+
+// deviceEncoders 返回设备支持的编码器，调用者不能修改返回的切片。获取失败（空列表）不缓存，下次重试
+func deviceEncoders(deviceID string) []string {
+	encoderCacheMutex.Lock()
+	encoders, ok := encoderCache[deviceID]
+	encoderCacheMutex.Unlock()
+	if ok {
+		return encoders
+	}
+	adbClient := NewADBClient(deviceID, "", context.Background())
+	encoders = adbClient.SupportedEncoderList()
+	adbClient.Stop()
+	if len(encoders) > 0 {
+		encoderCacheMutex.Lock()
+		encoderCache[deviceID] = encoders
+		encoderCacheMutex.Unlock()
+	}
+	return encoders
+}
+
+// forgetEncoders 删除已经不在 adb devices 中的设备的缓存，
+// 同一个无线调试地址之后可能连上另一台设备
+func forgetEncoders(present []sdriver.DeviceInfo) {
+	encoderCacheMutex.Lock()
+	defer encoderCacheMutex.Unlock()
+	for deviceID := range encoderCache {
+		found := false
+		for _, d := range present {
+			if d.DeviceID == deviceID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(encoderCache, deviceID)
+		}
+	}
+}
+
 // Receive an optional params
 func ConfigDescription(opt string) []sdriver.ConfigParamDescription {
 	deviceID := opt
 	var encoderListStr string
 	if deviceID != "" {
-		adbClient := NewADBClient(deviceID, "", context.Background())
-		encoderList := adbClient.SupportedEncoderList()
-		encoderListStr = strings.Join(encoderList, ",")
-		adbClient.Stop()
-	} else {
-		encoderListStr = ""
+		encoderListStr = strings.Join(deviceEncoders(deviceID), ",")
+	}
+	videoCodecs := []string{sdriver.VIDEO_CODEC_AUTO, "h264"}
+	// 编码器列表未知时沿用 h264/h265；否则按编码器名字判断，
+	// 例如 c2.qti.hevc.encoder、OMX.MTK.VIDEO.ENCODER.HEVC、c2.android.av1.encoder
+	encoders := strings.ToLower(encoderListStr)
+	if encoders == "" || strings.Contains(encoders, "hevc") {
+		videoCodecs = append(videoCodecs, "h265")
+	}
+	if strings.Contains(encoders, "av1") {
+		videoCodecs = append(videoCodecs, "av1")
 	}
 
 	return []sdriver.ConfigParamDescription{
@@ -40,10 +91,10 @@ func ConfigDescription(opt string) []sdriver.ConfigParamDescription {
 			Name:        "video_codec",
 			Type:        "string",
 			Required:    true,
-			Default:     "h264",
-			Options:     []string{"h264", "h265"},
+			Default:     sdriver.VIDEO_CODEC_AUTO,
+			Options:     videoCodecs,
 			Badge:       true,
-			Description: "video codec to use",
+			Description: "video codec to use, auto picks the best codec supported by both the browser and the device encoders",
 		},
 		{
 			Name:     "video_encoder",
@@ -7,9 +7,6 @@ import (
 )
 
 func (da *ScrcpyDriver) SendTouchEvent(e *sdriver.TouchEvent) {
-	if da.controlConn == nil {
-		return
-	}
 	// log.Printf("sending touch event: %v\n", e)
 	// log.Printf("current video width height: %vx%v", da.VideoMeta.Width, da.VideoMeta.Height)
 	// 1. 预分配一个固定大小的字节切片 (Scrcpy 协议触摸包固定 28 字节)
@@ -32,17 +29,13 @@ func (da *ScrcpyDriver) SendTouchEvent(e *sdriver.TouchEvent) {
 	binary.BigEndian.PutUint32(buf[28:32], e.Buttons)  // Buttons (4 bytes)
 
 	// 3. 一次性发送
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending touch event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendKeyEvent(e *sdriver.KeyEvent) {
-	if da.controlConn == nil {
-		return
-	}
-
 	buf := make([]byte, 14)
 
 	buf[0] = TYPE_INJECT_KEYCODE                    // Type
@@ -51,7 +44,7 @@ func (da *ScrcpyDriver) SendKeyEvent(e *sdriver.KeyEvent) {
 	binary.BigEndian.PutUint32(buf[6:10], 0)        // Repeat (4 bytes)
 	binary.BigEndian.PutUint32(buf[10:14], 0)       // Meta (4 bytes)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending key event: %v\n", err)
 	}
@@ -64,12 +57,9 @@ func (da *ScrcpyDriver) SendKeyEvent(e *sdriver.KeyEvent) {
 // }
 
 func (da *ScrcpyDriver) RotateDevice() {
-	if da.controlConn == nil {
-		return
-	}
 	log.Println("Sending Rotate Device command...")
 	msg := []byte{TYPE_ROTATE_DEVICE}
-	_, err := da.controlConn.Write(msg)
+	err := da.writeControl(msg)
 	if err != nil {
 		log.Printf("Error sending rotate command: %v\n", err)
 	}
@@ -77,9 +67,6 @@ func (da *ScrcpyDriver) RotateDevice() {
 }
 
 func (da *ScrcpyDriver) SendScrollEvent(e *sdriver.ScrollEvent) {
-	if da.controlConn == nil {
-		return
-	}
 	// Scroll Event Structure (21 bytes):
 	// 0: Type (1 byte)
 	// 1-4: PosX (4 bytes)
@@ -100,17 +87,13 @@ func (da *ScrcpyDriver) SendScrollEvent(e *sdriver.ScrollEvent) {
 	binary.BigEndian.PutUint16(buf[15:17], e.VScroll)
 	binary.BigEndian.PutUint32(buf[17:21], e.Buttons)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending scroll event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendSetClipboardEvent(e *sdriver.SetClipboardEvent) {
-	if da.controlConn == nil {
-		return
-	}
-
 	data := e.Content
 	length := len(data)
 
@@ -133,17 +116,13 @@ func (da *ScrcpyDriver) SendSetClipboardEvent(e *sdriver.SetClipboardEvent) {
 	binary.BigEndian.PutUint32(buf[10:14], uint32(length))
 	copy(buf[14:], data)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending set clipboard event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendGetClipboardEvent(e *sdriver.GetClipboardEvent) {
-	if da.controlConn == nil {
-		return
-	}
-
 	// Structure:
 	// Type (1)
 	// CopyKey (1)
@@ -151,17 +130,13 @@ func (da *ScrcpyDriver) SendGetClipboardEvent(e *sdriver.GetClipboardEvent) {
 	buf[0] = byte(e.Type())
 	buf[1] = e.CopyKey
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending get clipboard event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendUHIDCreateEvent(e *sdriver.UHIDCreateEvent) {
-	if da.controlConn == nil {
-		return
-	}
-
 	nameSize := uint8(len(e.Name)) // 强转为 uint8
 
 	// 包总大小:
@@ -206,16 +181,13 @@ func (da *ScrcpyDriver) SendUHIDCreateEvent(e *sdriver.UHIDCreateEvent) {
 
 	// log.Printf("Sending UHID_CREATE (Final Fix): ID=%d NameLen=%d", e.ID, nameSize)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending uhid create event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendUHIDInputEvent(e *sdriver.UHIDInputEvent) {
-	if da.controlConn == nil {
-		return
-	}
 	// Scrcpy UHID Input Protocol:
 	// [1] Type
 	// [2] ID (uint16)
@@ -234,16 +206,13 @@ func (da *ScrcpyDriver) SendUHIDInputEvent(e *sdriver.UHIDInputEvent) {
 	offset += 2
 	copy(buf[offset:], e.Data)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending uhid input event: %v\n", err)
 	}
 }
 
 func (da *ScrcpyDriver) SendUHIDDestroyEvent(e *sdriver.UHIDDestroyEvent) {
-	if da.controlConn == nil {
-		return
-	}
 	// Scrcpy UHID Destroy Protocol:
 	// [1] Type
 	// [2] ID (uint16)
@@ -252,7 +221,7 @@ func (da *ScrcpyDriver) SendUHIDDestroyEvent(e *sdriver.UHIDDestroyEvent) {
 	buf[0] = byte(e.Type())
 	binary.BigEndian.PutUint16(buf[1:], e.ID)
 
-	_, err := da.controlConn.Write(buf)
+	err := da.writeControl(buf)
 	if err != nil {
 		log.Printf("Error sending uhid destroy event: %v\n", err)
 	}
@@ -260,16 +229,24 @@ func (da *ScrcpyDriver) SendUHIDDestroyEvent(e *sdriver.UHIDDestroyEvent) {
 
 func (da *ScrcpyDriver) KeyFrameRequest() error {
 	// return nil
-	if da.controlConn == nil {
-		return nil
-	}
 	log.Println("⚡ Sending Request KeyFrame (Type 99)...")
 	msg := []byte{TYPE_REQUEST_IDR}
 	//<-da.VideoChan
-	_, err := da.controlConn.Write(msg)
+	err := da.writeControl(msg)
 	if err != nil {
 		log.Printf("Error sending keyframe request: %v\n", err)
 		return err
 	}
 	return nil
 }
+
+// writeControl 在持有 controlMu 读锁时写控制连接。重启期间连接为 nil，消息直接丢弃
+func (da *ScrcpyDriver) writeControl(msg []byte) error {
+	da.controlMu.RLock()
+	defer da.controlMu.RUnlock()
+	if da.controlConn == nil {
+		return nil
+	}
+	_, err := da.controlConn.Write(msg)
+	return err
+}
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"webscreen/sdriver"
 	"webscreen/sdriver/comm"
@@ -23,12 +24,16 @@ import (
 var scrcpyServerData embed.FS
 
 const (
-	SCRCPY_SERVER_LOCAL_PATH  = "./scrcpy-server"
 	SCRCPY_SERVER_ANDROID_DST = "/data/local/tmp/scrcpy-server"
-	SCRCPY_PROXY_PORT_DEFAULT = "27183"
 	SCRCPY_VERSION            = "3.3.4"
 )
 
+// 每个驱动实例占用一个本地端口接收 scrcpy-server 的连接
+const (
+	SCRCPY_PROXY_PORT_START = 27183
+	SCRCPY_PROXY_PORT_END   = 27299
+)
+
 type ScrcpyDriver struct {
 	VideoChan   chan sdriver.AVBox
 	AudioChan   chan sdriver.AVBox
@@ -38,22 +43,42 @@ type ScrcpyDriver struct {
 	videoBuffer *comm.LinearBuffer
 	audioBuffer *comm.LinearBuffer
 
+	// metaMutex 保护 mediaMeta 和 capabilities：重启 scrcpy-server 时会改写它们，Agent 和 HTTP 协程同时在读
+	metaMutex  sync.RWMutex
 	mediaMeta  sdriver.MediaMeta
 	deviceName string
 
-	videoConn   net.Conn
-	audioConn   net.Conn
+	videoConn net.Conn
+	audioConn net.Conn
+	// controlMu 保护 controlConn：发送控制消息时持有读锁，重启时持有写锁关闭和替换连接
+	controlMu   sync.RWMutex
 	controlConn net.Conn
 
 	options map[string]string
+	// config 为创建驱动时的配置，UpdateDriverConfig 在此基础上合并
+	config map[string]string
+
+	// reconfigMutex 保证同一时间只有一次重启；readers 用于等待旧连接上的读协程退出
+	reconfigMutex sync.Mutex
+	readers       sync.WaitGroup
+	// scrcpy-server 重启后 PTS 从 0 开始，加上偏移保持时间轴递增
+	ptsOffset uint64
+
+	// 暂停时编码器和连接照常运行，只是丢弃音视频帧；恢复后等到关键帧才继续转发
+	paused       atomic.Bool
+	waitKeyFrame atomic.Bool
 
 	capabilities sdriver.DriverCaps
 
 	ctx       context.Context
 	cancel    context.CancelFunc
 	adbClient *ADBClient
-	scid      string
-	// socketName string
+	// scid 区分同一设备上的多个 scrcpy-server（reverse 的 socket 名和推送路径都带上它）
+	scid string
+	// listener 在驱动的整个生命周期内占用端口，重启 scrcpy-server 时复用
+	listener  net.Listener
+	localPort int
+	stopOnce  sync.Once
 
 	cacheMutex sync.RWMutex
 	LastVPS    []byte
@@ -76,8 +101,7 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 		videoBuffer: comm.NewLinearBuffer(0),
 		audioBuffer: comm.NewLinearBuffer(4 * 1024 * 1024), // 4MB 音频缓冲区
 
-		// scid: GenerateSCID(),
-		scid: "00000000",
+		scid: GenerateSCID(),
 
 		capabilities: sdriver.DriverCaps{
 			IsAndroid: true,
@@ -86,46 +110,49 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 	da.ctx, da.cancel = context.WithCancel(context.Background())
 	da.adbClient = NewADBClient(config["deviceID"], da.scid, da.ctx)
 
-	data, err := scrcpyServerData.ReadFile("bin/scrcpy-server-master")
-	if err != nil {
-		log.Printf("[scrcpy] read scrcpy-server failed: %v", err)
-		return nil, err
-	}
-	err = os.WriteFile(SCRCPY_SERVER_LOCAL_PATH, data, 0755)
+	da.listener, da.localPort, err = listenProxyPort()
 	if err != nil {
-		log.Printf("[scrcpy] write scrcpy-server to local file failed: %v", err)
+		log.Printf("[scrcpy] Listen port failed: %v", err)
+		da.cancel()
 		return nil, err
 	}
-
-	localPort := SCRCPY_PROXY_PORT_DEFAULT
-
-	da.adbClient.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", da.scid))
-	err = da.adbClient.Reverse(fmt.Sprintf("localabstract:scrcpy_%s", da.scid), "tcp:"+localPort)
+	err = da.adbClient.Reverse(scrcpySocketName(da.scid), fmt.Sprintf("tcp:%d", da.localPort))
 	if err != nil {
 		log.Printf("[scrcpy] Set up reverse tunnel failed: %v", err)
-		// listener.Close()
+		da.listener.Close()
+		da.cancel()
 		return nil, err
 	}
-	log.Printf("[scrcpy] set up reverse tunnel success: localabstract:scrcpy_%s -> tcp:%s", da.scid, localPort)
+	log.Printf("[scrcpy] set up reverse tunnel success: %s -> tcp:%d", scrcpySocketName(da.scid), da.localPort)
 
 	if !da.adbClient.SupportOpusAudio() {
 		config["audio"] = "false"
 		log.Println("[scrcpy] Device does not support Opus audio encoding, disabling audio.")
 		da.ControlChan <- sdriver.TextMsgEvent{Msg: "[scrcpy] Device does not support Opus audio encoding, disabling audio."}
 	}
-	err = da.adbClient.PushScrcpyServer(SCRCPY_SERVER_LOCAL_PATH, SCRCPY_SERVER_ANDROID_DST)
+	// da.adbClient.cancel()
+	log.Printf("[scrcpy] driver config: %v", sdriver.RedactConfig(config))
+	options, err := da.buildServerOptions(config)
 	if err != nil {
-		log.Printf("[scrcpy] Push scrcpy-server failed: %v", err)
+		da.Stop()
 		return nil, err
 	}
-	os.Remove(SCRCPY_SERVER_LOCAL_PATH)
-	listener, err := net.Listen("tcp", ":"+localPort)
-	if err != nil {
-		log.Printf("[scrcpy] Listen port failed: %v", err)
+	if err := da.launchServer(options); err != nil {
+		da.Stop()
 		return nil, err
 	}
-	// da.adbClient.cancel()
-	log.Printf("[scrcpy] driver config: %v", config)
+	da.config = config
+	da.options = options
+	da.metaMutex.Lock()
+	da.mediaMeta.BitRate = parseOptionInt(options["video_bit_rate"])
+	da.mediaMeta.FPS = parseOptionInt(options["max_fps"])
+	da.metaMutex.Unlock()
+
+	return da, nil
+}
+
+// buildServerOptions 根据驱动配置和协商出的 WebRTC codec level 生成 scrcpy-server 启动参数
+func (da *ScrcpyDriver) buildServerOptions(config map[string]string) (map[string]string, error) {
 	video_codec_options := ""
 	max_size, err := strconv.Atoi(config["max_size"])
 	if err != nil {
@@ -135,9 +162,9 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 	if err != nil {
 		max_fps = 120
 	}
-	video_bit_rate_str, ok := config["video_bit_rate"]
-	if !ok || video_bit_rate_str == "" {
-		config["video_bit_rate"] = "4M" // 默认 4 Mbps
+	video_bit_rate_str := config["video_bit_rate"]
+	if video_bit_rate_str == "" {
+		video_bit_rate_str = "4M" // 默认 4 Mbps
 	}
 	video_bit_rate, err := utils.ParseBitrate(video_bit_rate_str)
 	if err != nil {
@@ -271,7 +298,7 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 	}
 
 	options := map[string]string{
-		"CLASSPATH":           SCRCPY_SERVER_ANDROID_DST,
+		"CLASSPATH":           da.adbClient.remotePath,
 		"Version":             SCRCPY_VERSION,
 		"scid":                da.scid,
 		"max_size":            strconv.Itoa(max_size),
@@ -301,8 +328,65 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 		options["new_display"] = fmt.Sprintf("%s/%d", config["resolution"], max_fps)
 	}
 
+	return options, nil
+}
+
+// scrcpySocketName 返回 scrcpy-server 使用的 abstract socket 名，与服务端的 "scrcpy_%08x" 一致
+func scrcpySocketName(scid string) string {
+	return "localabstract:scrcpy_" + scid
+}
+
+// listenProxyPort 在 SCRCPY_PROXY_PORT_START ~ SCRCPY_PROXY_PORT_END 中找一个空闲端口监听。
+// 端口被其他驱动实例占用时 Listen 会失败，继续尝试下一个。
+func listenProxyPort() (net.Listener, int, error) {
+	for port := SCRCPY_PROXY_PORT_START; port <= SCRCPY_PROXY_PORT_END; port++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			return listener, port, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no free port in %d-%d for scrcpy", SCRCPY_PROXY_PORT_START, SCRCPY_PROXY_PORT_END)
+}
+
+// pushServer 把内置的 scrcpy-server 写到临时文件并推送到设备，
+// 本地文件名由 os.CreateTemp 生成，多个驱动同时启动也不会互相覆盖
+func (da *ScrcpyDriver) pushServer() error {
+	data, err := scrcpyServerData.ReadFile("bin/scrcpy-server-master")
+	if err != nil {
+		log.Printf("[scrcpy] read scrcpy-server failed: %v", err)
+		return err
+	}
+	file, err := os.CreateTemp("", "scrcpy-server-*.jar")
+	if err != nil {
+		log.Printf("[scrcpy] create temp file failed: %v", err)
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("[scrcpy] write scrcpy-server to local file failed: %v", err)
+		return err
+	}
+	err = da.adbClient.PushScrcpyServer(file.Name(), da.adbClient.remotePath)
+	if err != nil {
+		log.Printf("[scrcpy] Push scrcpy-server failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// launchServer 推送并启动 scrcpy-server，等待视频、音频、控制连接建立。
+// scrcpy-server 启动后会删除自身（cleanup），所以每次启动都要重新推送。
+func (da *ScrcpyDriver) launchServer(options map[string]string) error {
+	if err := da.pushServer(); err != nil {
+		return err
+	}
+	listener := da.listener
+
 	da.adbClient.StartScrcpyServer(options)
-	da.options = options
 	// log.Println("Scrcpy server started successfully")
 	// conns := make([]net.Conn, 3)
 	log.Println("start tcp listening")
@@ -315,47 +399,45 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 	if options["video"] == "true" {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("[scrcpy] Accept failed (可能是 scrcpy-server 启动失败): %v", err)
-			listener.Close()
-			da.adbClient.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", da.scid))
-			return nil, fmt.Errorf("failed to accept connection from scrcpy-server: %v", err)
+			return da.acceptFailed(err)
 		}
 		err = da.readDeviceMeta(conn)
 		if err != nil {
 			log.Println("Failed to read device metadata:", err)
-			return nil, err
+			conn.Close()
+			return err
 		}
 		log.Printf("[scrcpy] Connected Device: %s", da.deviceName)
 
-		da.assignConn(conn)
+		if err := da.assignConn(conn); err != nil {
+			return da.acceptFailed(err)
+		}
 	}
 	if options["audio"] == "true" {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("[scrcpy] Accept failed (可能是 scrcpy-server 启动失败): %v", err)
-			listener.Close()
-			da.adbClient.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", da.scid))
-			return nil, fmt.Errorf("failed to accept connection from scrcpy-server: %v", err)
+			return da.acceptFailed(err)
+		}
+		if err := da.assignConn(conn); err != nil {
+			return da.acceptFailed(err)
 		}
-		da.assignConn(conn)
 	}
 	if options["control"] == "true" {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Printf("[scrcpy] Accept failed (可能是 scrcpy-server 启动失败): %v", err)
-			listener.Close()
-			da.adbClient.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", da.scid))
-			return nil, fmt.Errorf("failed to accept connection from scrcpy-server: %v", err)
+			return da.acceptFailed(err)
 		}
+		da.controlMu.Lock()
 		da.controlConn = conn
+		da.controlMu.Unlock()
+		da.metaMutex.Lock()
 		da.capabilities.CanControl = true
 		da.capabilities.CanUHID = true
 		da.capabilities.CanClipboard = true
+		da.metaMutex.Unlock()
 		log.Println("Scrcpy Control Connection Established")
 	}
 
-	listener.Close()
-
 	// 甜点值
 	if da.videoConn != nil {
 		da.videoConn.(*net.TCPConn).SetReadBuffer(4 * 1024 * 1024)
@@ -368,36 +450,53 @@ func New(config map[string]string) (*ScrcpyDriver, error) {
 	// da.videoConn.(*net.TCPConn).SetReadBuffer(2 * 1024 * 1024)
 	// da.audioConn.(*net.TCPConn).SetReadBuffer(64 * 1024)
 
-	return da, nil
+	return nil
+}
+
+// acceptFailed 处理 scrcpy-server 没有按时连上的情况：关闭已经建立的连接，删除设备上残留的 scrcpy-server。
+// reverse 隧道和监听端口保留到 Stop，供下次启动使用。
+func (da *ScrcpyDriver) acceptFailed(err error) error {
+	log.Printf("[scrcpy] Accept failed (可能是 scrcpy-server 启动失败): %v", err)
+	da.closeConns()
+	da.videoConn, da.audioConn = nil, nil
+	da.adbClient.RemoveScrcpyServer()
+	return fmt.Errorf("failed to accept connection from scrcpy-server: %v", err)
 }
 
 func (da *ScrcpyDriver) ShowDeviceInfo() {
 	log.Printf("[scrcpy] Device Name: %s", da.deviceName)
-	log.Printf("[scrcpy] media Meta: %v", da.mediaMeta)
+	log.Printf("[scrcpy] media Meta: %v", da.MediaMeta())
 }
 
 func (da *ScrcpyDriver) EncoderList() []string {
-	return da.adbClient.SupportedEncoderList()
+	return deviceEncoders(da.adbClient.deviceSerial)
 }
 
 // Please Ensure the input conn is not Control conn
+// 读取元数据失败时关闭 conn 并返回错误，重启中出错时 UpdateDriverConfig 会退回原来的参数
 func (da *ScrcpyDriver) assignConn(conn net.Conn) error {
-	codecID := readCodecID(conn)
+	// scrcpy 的 codec id 固定 4 字节，"av1 "、"aac " 带有空格
+	codecID := strings.TrimSpace(readCodecID(conn))
 	switch codecID {
-	case "h264", "h265", "av1 ":
-		da.videoConn = conn
-		da.mediaMeta.VideoCodec = codecID
-		err := da.readVideoMeta(conn)
+	case "h264", "h265", "av1":
+		width, height, err := da.readVideoMeta(conn)
 		if err != nil {
-			log.Fatalln("Failed to read video metadata:", err)
-			return err
+			conn.Close()
+			return fmt.Errorf("failed to read video metadata: %v", err)
 		}
+		da.videoConn = conn
+		da.metaMutex.Lock()
+		da.mediaMeta.VideoCodec = codecID
+		da.mediaMeta.Width, da.mediaMeta.Height = width, height
 		da.capabilities.CanVideo = true
+		da.metaMutex.Unlock()
 		log.Println("Scrcpy Video Connection Established")
-	case "aac ", "opus":
+	case "aac", "opus":
 		da.audioConn = conn
+		da.metaMutex.Lock()
 		da.mediaMeta.AudioCodec = codecID
 		da.capabilities.CanAudio = true
+		da.metaMutex.Unlock()
 		log.Println("Audio Connection Established")
 		// default:
 		// 	da.controlConn = conn
@@ -417,20 +516,17 @@ func (da *ScrcpyDriver) readDeviceMeta(conn net.Conn) error {
 	return nil
 }
 
-func (da *ScrcpyDriver) readVideoMeta(conn net.Conn) error {
+func (da *ScrcpyDriver) readVideoMeta(conn net.Conn) (width, height uint32, err error) {
 	// Width (4 bytes)
 	// Height (4 bytes)
 	// Codec 已经在外面读取过了，用于确认是哪个通道
 	metaBuf := make([]byte, 8)
 	if _, err := io.ReadFull(conn, metaBuf); err != nil {
 		log.Println("Failed to read metadata:", err)
-		return err
+		return 0, 0, err
 	}
 	// 解析元数据
-	da.mediaMeta.Width = binary.BigEndian.Uint32(metaBuf[0:4])
-	da.mediaMeta.Height = binary.BigEndian.Uint32(metaBuf[4:8])
-
-	return nil
+	return binary.BigEndian.Uint32(metaBuf[0:4]), binary.BigEndian.Uint32(metaBuf[4:8]), nil
 }
 
 func (da *ScrcpyDriver) updateVideoMetaFromSPS(sps []byte, codec string) {
@@ -446,6 +542,8 @@ func (da *ScrcpyDriver) updateVideoMetaFromSPS(sps []byte, codec string) {
 		spsInfo, err = comm.ParseSPS_H264(sps, true)
 	case "h265":
 		spsInfo, err = comm.ParseSPS_H265(sps)
+	case "av1":
+		spsInfo, err = comm.ParseSequenceHeader_AV1(sps)
 	default:
 		log.Println("Unknown codec type for SPS parsing:", codec)
 		return
@@ -455,9 +553,32 @@ func (da *ScrcpyDriver) updateVideoMetaFromSPS(sps []byte, codec string) {
 		log.Println("Failed to parse SPS for video meta update:", err)
 		return
 	}
+	da.metaMutex.Lock()
+	changed := da.mediaMeta.Width != spsInfo.Width || da.mediaMeta.Height != spsInfo.Height
 	da.mediaMeta.Width = spsInfo.Width
 	da.mediaMeta.Height = spsInfo.Height
-	log.Printf("[scrcpy] Updated Video Meta from SPS: Width=%d, Height=%d", da.mediaMeta.Width, da.mediaMeta.Height)
+	da.metaMutex.Unlock()
+	log.Printf("[scrcpy] Updated Video Meta from SPS: Width=%d, Height=%d", spsInfo.Width, spsInfo.Height)
+	if changed {
+		da.notifyMediaMeta()
+	}
+}
+
+// notifyMediaMeta 非阻塞地通知前端媒体参数变化
+func (da *ScrcpyDriver) notifyMediaMeta() {
+	select {
+	case da.ControlChan <- sdriver.MediaMetaEvent{Meta: da.MediaMeta()}:
+	default:
+		log.Println("[scrcpy] control channel full, drop media meta event")
+	}
+}
+
+func parseOptionInt(v string) uint32 {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return uint32(n)
 }
 
 func readScrcpyFrameHeader(headerBuf []byte, header *ScrcpyFrameHeader) error {
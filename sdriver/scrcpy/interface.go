@@ -1,6 +1,8 @@
 package scrcpy
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"time"
 	"webscreen/sdriver"
@@ -12,23 +14,153 @@ func (sd *ScrcpyDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVB
 
 func (sd *ScrcpyDriver) Start() {
 	log.Println("ScrcpyDriver: Start called")
+	sd.startReaders()
+}
+
+func (sd *ScrcpyDriver) startReaders() {
 	if sd.videoConn != nil {
-		go sd.convertVideoFrame()
+		sd.readers.Add(1)
+		go func() {
+			defer sd.readers.Done()
+			sd.convertVideoFrame()
+		}()
 	}
 	if sd.audioConn != nil {
-		go sd.convertAudioFrame()
+		sd.readers.Add(1)
+		go func() {
+			defer sd.readers.Done()
+			sd.convertAudioFrame()
+		}()
 	}
-	if sd.controlConn != nil {
-		go sd.transferControlMsg()
+	if conn := sd.controlConn; conn != nil {
+		sd.readers.Add(1)
+		go func() {
+			defer sd.readers.Done()
+			sd.transferControlMsg(conn)
+		}()
 	}
 }
 
+// 可以在运行中修改的配置项，修改后需要重启 scrcpy-server
+var liveConfigKeys = map[string]bool{
+	"video_bit_rate": true,
+	"max_fps":        true,
+	"max_size":       true,
+}
+
+// UpdateDriverConfig 用新的参数重启 scrcpy-server。
+// VideoChan/AudioChan/ControlChan 保持不变，WebRTC 轨道和 PeerConnection 不受影响，
+// 新的编码器会先发出 SPS/PPS 和 IDR，前端解码器自动切换到新分辨率。
 func (sd *ScrcpyDriver) UpdateDriverConfig(config map[string]string) error {
+	for k := range config {
+		if !liveConfigKeys[k] {
+			return fmt.Errorf("scrcpy: %s cannot be changed while running: %w", k, sdriver.ErrNotSupported)
+		}
+	}
+	sd.reconfigMutex.Lock()
+	defer sd.reconfigMutex.Unlock()
+	// 上一次重启失败后驱动已停止
+	if sd.ctx.Err() != nil {
+		return errors.New("scrcpy: driver stopped")
+	}
+
+	merged := make(map[string]string, len(sd.config)+len(config))
+	for k, v := range sd.config {
+		merged[k] = v
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+	options, err := sd.buildServerOptions(merged)
+	if err != nil {
+		return err
+	}
+	log.Printf("[scrcpy] restarting server with new config: %v", sdriver.RedactConfig(config))
+
+	// 关闭旧连接后 scrcpy-server 会自行退出，等读协程全部返回再替换连接
+	restartAt := time.Now()
+	sd.closeConns()
+	sd.readers.Wait()
+	sd.videoConn, sd.audioConn = nil, nil
+
+	sd.cacheMutex.Lock()
+	sd.LastVPS, sd.LastSPS, sd.LastPPS, sd.LastIDR = nil, nil, nil, nil
+	sd.ptsOffset = sd.LastPTS + uint64(time.Since(restartAt).Microseconds())
+	sd.cacheMutex.Unlock()
+
+	if err := sd.launchServer(options); err != nil {
+		sd.closeConns()
+		sd.videoConn, sd.audioConn = nil, nil
+		// 重启期间调用了 Stop，不再用旧参数重试
+		if sd.ctx.Err() != nil {
+			sd.stopLocked()
+			return errors.New("scrcpy: driver stopped")
+		}
+		log.Printf("[scrcpy] restart failed: %v, restarting with the previous config", err)
+		if rerr := sd.launchServer(sd.options); rerr != nil {
+			// 旧参数也起不来：停止驱动。通道不关闭，SendEvent 仍可能写入缓存的关键帧
+			log.Printf("[scrcpy] restart with the previous config failed: %v", rerr)
+			sd.notifyText(fmt.Sprintf("[scrcpy] restart failed, stream stopped: %v", err))
+			sd.stopLocked()
+			return err
+		}
+		sd.startReaders()
+		sd.notifyText(fmt.Sprintf("[scrcpy] restart failed, previous config kept: %v", err))
+		return err
+	}
+	sd.config = merged
+	sd.options = options
+	sd.metaMutex.Lock()
+	sd.mediaMeta.BitRate = parseOptionInt(options["video_bit_rate"])
+	sd.mediaMeta.FPS = parseOptionInt(options["max_fps"])
+	sd.metaMutex.Unlock()
+	sd.startReaders()
+	sd.notifyMediaMeta()
 	return nil
 }
 
+// notifyText 非阻塞地发送提示消息，没有人读取 ControlChan 时不能阻塞，否则 UpdateDriverConfig 永远不返回
+func (sd *ScrcpyDriver) notifyText(msg string) {
+	select {
+	case sd.ControlChan <- sdriver.TextMsgEvent{Msg: msg}:
+	default:
+		log.Println("[scrcpy] control channel full, drop message:", msg)
+	}
+}
+
+func (sd *ScrcpyDriver) closeConns() {
+	if sd.videoConn != nil {
+		sd.videoConn.Close()
+	}
+	if sd.audioConn != nil {
+		sd.audioConn.Close()
+	}
+	// 关闭后置为 nil，之后的控制消息不会写到已关闭的连接上
+	sd.controlMu.Lock()
+	if sd.controlConn != nil {
+		sd.controlConn.Close()
+		sd.controlConn = nil
+	}
+	sd.controlMu.Unlock()
+}
+
+// Pause 丢弃音视频帧，控制连接不受影响
 func (sd *ScrcpyDriver) Pause() {
-	// sd.stopVideoReader()
+	if sd.paused.Swap(true) {
+		return
+	}
+	log.Println("[scrcpy] paused")
+}
+
+// Resume 恢复转发并请求新的关键帧，关键帧到达前的 P 帧会被丢弃
+func (sd *ScrcpyDriver) Resume() {
+	if !sd.paused.Load() {
+		return
+	}
+	sd.waitKeyFrame.Store(true)
+	sd.paused.Store(false)
+	log.Println("[scrcpy] resumed")
+	sd.KeyFrameRequest()
 }
 
 func (sd *ScrcpyDriver) SendEvent(event sdriver.Event) error {
@@ -62,7 +194,11 @@ func (sd *ScrcpyDriver) SendEvent(event sdriver.Event) error {
 }
 
 func (sd *ScrcpyDriver) RequestIDR(firstFrame bool) {
-	if len(sd.LastSPS) == 0 && len(sd.LastPPS) == 0 && len(sd.LastVPS) == 0 && len(sd.LastIDR) == 0 {
+	// 暂停时不发送缓存的关键帧
+	if sd.paused.Load() {
+		return
+	}
+	if sd.cacheEmpty() {
 		sd.KeyFrameRequest()
 		return
 	}
@@ -83,24 +219,49 @@ func (sd *ScrcpyDriver) RequestIDR(firstFrame bool) {
 }
 
 func (sd *ScrcpyDriver) Capabilities() sdriver.DriverCaps {
+	sd.metaMutex.RLock()
+	defer sd.metaMutex.RUnlock()
 	return sd.capabilities
 }
 
 func (sd *ScrcpyDriver) MediaMeta() sdriver.MediaMeta {
+	sd.metaMutex.RLock()
+	defer sd.metaMutex.RUnlock()
 	return sd.mediaMeta
 }
 
+// videoCodec 视频编码在驱动的生命周期内不变，但重启时会被重新写入
+func (sd *ScrcpyDriver) videoCodec() string {
+	sd.metaMutex.RLock()
+	defer sd.metaMutex.RUnlock()
+	return sd.mediaMeta.VideoCodec
+}
+
+func (sd *ScrcpyDriver) ConfigDescription() []sdriver.ConfigParamDescription {
+	return ConfigDescription(sd.adbClient.deviceSerial)
+}
+
+// Stop 关闭连接、释放监听端口并删除 reverse 隧道，可以重复调用。
+// 正在重启 scrcpy-server 时，先取消 ctx 并关闭监听端口让重启尽快失败，等它返回后再关闭连接，
+// 否则重启中新建立的连接和读协程不会被关闭
 func (sd *ScrcpyDriver) Stop() {
-	if sd.videoConn != nil {
-		sd.videoConn.Close()
-	}
-	if sd.audioConn != nil {
-		sd.audioConn.Close()
-	}
-	if sd.controlConn != nil {
-		sd.controlConn.Close()
-	}
-	// sd.adbClient.ReverseRemove(fmt.Sprintf("localabstract:scrcpy_%s", sd.scid))
-	sd.adbClient.Stop()
 	sd.cancel()
+	if sd.listener != nil {
+		sd.listener.Close()
+	}
+	sd.reconfigMutex.Lock()
+	defer sd.reconfigMutex.Unlock()
+	sd.stopLocked()
+}
+
+// stopLocked 调用者需持有 reconfigMutex
+func (sd *ScrcpyDriver) stopLocked() {
+	sd.stopOnce.Do(func() {
+		sd.cancel()
+		sd.closeConns()
+		if sd.listener != nil {
+			sd.listener.Close()
+		}
+		sd.adbClient.Stop()
+	})
 }
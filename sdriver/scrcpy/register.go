@@ -0,0 +1,14 @@
+package scrcpy
+
+import "webscreen/sdriver"
+
+func init() {
+	sdriver.Register(sdriver.Registration{
+		Name: sdriver.DEVICE_TYPE_ANDROID,
+		New: func(config map[string]string) (sdriver.SDriver, error) {
+			return New(config)
+		},
+		ConfigDescription: ConfigDescription,
+		Devices:           ListDevices,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"io"
 	"log"
+	"net"
 
 	// "bytes"
 	"webscreen/sdriver"
@@ -14,6 +15,7 @@ func (da *ScrcpyDriver) convertVideoFrame() {
 	header := ScrcpyFrameHeader{}
 	var nalTypeF func(byte) byte
 	var nalType byte
+	codec := da.videoCodec()
 	for {
 		// read frame header
 		if _, err := io.ReadFull(da.videoConn, headerBuf[:]); err != nil {
@@ -24,6 +26,7 @@ func (da *ScrcpyDriver) convertVideoFrame() {
 			log.Println("Failed to read scrcpy frame header:", err)
 			return
 		}
+		header.PTS += da.ptsOffset
 		da.LastPTS = header.PTS
 		// showFrameHeaderInfo(frame.Header)
 		frameSize := int(header.Size)
@@ -35,16 +38,35 @@ func (da *ScrcpyDriver) convertVideoFrame() {
 			log.Println("Failed to read video frame payload:", err)
 			return
 		}
-		switch da.mediaMeta.VideoCodec {
+		if codec == "av1" {
+			da.convertAV1Frame(header, payloadBuf)
+			continue
+		}
+		switch codec {
 		case "h265":
 			nalTypeF = func(payloadBuf byte) byte { return (payloadBuf >> 1) & 0x3F }
 		case "h264":
 			nalTypeF = func(payloadBuf byte) byte { return payloadBuf & 0x1F }
 		default:
-			log.Println("Unknown codec type for NALU parsing:", da.mediaMeta.VideoCodec)
+			log.Println("Unknown codec type for NALU parsing:", codec)
 			continue
 		}
 		nalType = nalTypeF(payloadBuf[4]) // 注意：payloadBuf 前 4 字节是起始码
+		// H.264 SPS / H.265 VPS
+		isConfigNAL := nalType == 7 || nalType == 32
+		if da.paused.Load() {
+			// 暂停期间只更新参数集缓存，画面数据（包括 IDR）一律丢弃
+			if isConfigNAL {
+				go da.updateCache(payloadBuf, codec)
+			}
+			continue
+		}
+		if da.waitKeyFrame.Load() && !isConfigNAL {
+			if !header.IsKeyFrame {
+				continue
+			}
+			da.waitKeyFrame.Store(false)
+		}
 		// log.Printf("ScrcpyDriver: isKeyFrame=%v, nal Type=%v, Size=%d bytes\n", header.IsKeyFrame, nalType, len(payloadBuf))
 		// parts := bytes.Split(payloadBuf, []byte{0x00, 0x00, 0x00, 0x01})
 		// for _, part := range parts {
@@ -60,11 +82,11 @@ func (da *ScrcpyDriver) convertVideoFrame() {
 				da.LastIDR = createCopy(payloadBuf[4:]) // 去掉起始码
 				continue
 			case 6, 39, 40: // H.264 SEI / H.265 Prefix/Suffix SEI
-				payloadBuf = PruneSEI(payloadBuf, da.mediaMeta.VideoCodec)
+				payloadBuf = PruneSEI(payloadBuf, codec)
 				da.sendWithCachedConfigFrame(da.LastPTS, payloadBuf)
 				continue
 			case 7, 32: // H.264 SPS / H.265 VPS
-				go da.updateCache(payloadBuf, da.mediaMeta.VideoCodec)
+				go da.updateCache(payloadBuf, codec)
 				da.VideoChan <- sdriver.AVBox{
 					Data:       payloadBuf,
 					PTS:        da.LastPTS,
@@ -77,7 +99,7 @@ func (da *ScrcpyDriver) convertVideoFrame() {
 		}
 		switch nalType {
 		case 7, 32: // H.264 SPS / H.265 VPS
-			go da.updateCache(payloadBuf, da.mediaMeta.VideoCodec)
+			go da.updateCache(payloadBuf, codec)
 			continue
 		}
 
@@ -107,6 +129,9 @@ func (da *ScrcpyDriver) convertAudioFrame() {
 
 		// read frame payload
 		_, _ = io.ReadFull(da.audioConn, payloadBuf)
+		if da.paused.Load() {
+			continue
+		}
 		// if header.IsConfig {
 		// 	log.Println("[scrcpy driver]Received audio config frame, skipping...")
 		// 	continue
@@ -121,10 +146,11 @@ func (da *ScrcpyDriver) convertAudioFrame() {
 	}
 }
 
-func (da *ScrcpyDriver) transferControlMsg() {
+// transferControlMsg 读取 conn 上设备发来的消息。conn 由启动方传入，重启时 controlConn 会被置为 nil
+func (da *ScrcpyDriver) transferControlMsg(conn net.Conn) {
 	header := make([]byte, 5) // Type (1) + Length (4)
 	for {
-		_, err := io.ReadFull(da.controlConn, header)
+		_, err := io.ReadFull(conn, header)
 		if err != nil {
 			log.Println("Control connection read error:", err)
 			return
@@ -136,7 +162,7 @@ func (da *ScrcpyDriver) transferControlMsg() {
 		switch msgType {
 		case DEVICE_MSG_TYPE_CLIPBOARD:
 			content := make([]byte, length)
-			_, err := io.ReadFull(da.controlConn, content)
+			_, err := io.ReadFull(conn, content)
 			if err != nil {
 				log.Println("Control connection read content error:", err)
 				return
@@ -147,7 +173,7 @@ func (da *ScrcpyDriver) transferControlMsg() {
 		default:
 			// Skip unknown message
 			if length > 0 {
-				io.CopyN(io.Discard, da.controlConn, int64(length))
+				io.CopyN(io.Discard, conn, int64(length))
 			}
 		}
 	}
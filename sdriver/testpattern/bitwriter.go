@@ -0,0 +1,96 @@
+package testpattern
+
+// bitWriter 按 MSB 优先写入 RBSP，支持 H.264 的 u(n)/ue(v)/se(v)
+type bitWriter struct {
+	buf   []byte
+	cur   byte
+	nbits uint // cur 中已写入的位数
+}
+
+func (w *bitWriter) writeBit(b uint) {
+	w.cur = w.cur<<1 | byte(b&1)
+	w.nbits++
+	if w.nbits == 8 {
+		w.buf = append(w.buf, w.cur)
+		w.cur = 0
+		w.nbits = 0
+	}
+}
+
+// writeBits 写入 v 的低 n 位
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBit(uint(v>>(i-1)) & 1)
+	}
+}
+
+// writeUE 无符号指数哥伦布编码
+func (w *bitWriter) writeUE(v uint32) {
+	x := uint64(v) + 1
+	n := uint(0)
+	for t := x; t > 1; t >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	for i := n + 1; i > 0; i-- {
+		w.writeBit(uint(x>>(i-1)) & 1)
+	}
+}
+
+// writeSE 有符号指数哥伦布编码
+func (w *bitWriter) writeSE(v int32) {
+	if v > 0 {
+		w.writeUE(uint32(2*v - 1))
+	} else {
+		w.writeUE(uint32(-2 * v))
+	}
+}
+
+func (w *bitWriter) byteAligned() bool {
+	return w.nbits == 0
+}
+
+// alignZero 用 0 补齐到字节边界（pcm_alignment_zero_bit）
+func (w *bitWriter) alignZero() {
+	for !w.byteAligned() {
+		w.writeBit(0)
+	}
+}
+
+// writeBytes 在字节对齐后直接追加原始字节
+func (w *bitWriter) writeBytes(b []byte) {
+	if !w.byteAligned() {
+		for _, v := range b {
+			w.writeBits(uint32(v), 8)
+		}
+		return
+	}
+	w.buf = append(w.buf, b...)
+}
+
+// trailing 写入 rbsp_trailing_bits 并返回 RBSP
+func (w *bitWriter) trailing() []byte {
+	w.writeBit(1)
+	w.alignZero()
+	return w.buf
+}
+
+// nalUnit 给 RBSP 加上 NAL 头并插入防竞争字节，返回不带起始码的 NAL
+func nalUnit(header byte, rbsp []byte) []byte {
+	out := make([]byte, 0, len(rbsp)+len(rbsp)/64+1)
+	out = append(out, header)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 0x03 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
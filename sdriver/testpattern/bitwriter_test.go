@@ -0,0 +1,211 @@
+package testpattern
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"webscreen/sdriver/comm"
+)
+
+// bitReader 是 bitWriter 的逆过程，用于在测试中解析 RBSP
+type bitReader struct {
+	t    *testing.T
+	data []byte
+	pos  int // 已读取的位数
+}
+
+func newBitReader(t *testing.T, rbsp []byte) *bitReader {
+	return &bitReader{t: t, data: rbsp}
+}
+
+func (r *bitReader) readBit() uint32 {
+	r.t.Helper()
+	if r.pos >= len(r.data)*8 {
+		r.t.Fatalf("read past the end of %d bytes", len(r.data))
+	}
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint32(b)
+}
+
+func (r *bitReader) readBits(n int) uint32 {
+	r.t.Helper()
+	var v uint32
+	for range n {
+		v = v<<1 | r.readBit()
+	}
+	return v
+}
+
+func (r *bitReader) readUE() uint32 {
+	r.t.Helper()
+	zeros := 0
+	for r.readBit() == 0 {
+		zeros++
+		if zeros > 32 {
+			r.t.Fatal("invalid exp-golomb code")
+		}
+	}
+	x := uint64(1)
+	for range zeros {
+		x = x<<1 | uint64(r.readBit())
+	}
+	return uint32(x - 1)
+}
+
+func (r *bitReader) readSE() int32 {
+	r.t.Helper()
+	k := r.readUE()
+	if k%2 == 1 {
+		return int32(k/2 + 1)
+	}
+	return -int32(k / 2)
+}
+
+func (r *bitReader) byteAligned() bool {
+	return r.pos%8 == 0
+}
+
+// readBytes 读取 n 个字节，调用者保证已经字节对齐
+func (r *bitReader) readBytes(n int) []byte {
+	r.t.Helper()
+	if !r.byteAligned() {
+		r.t.Fatalf("readBytes at bit %d, not byte aligned", r.pos)
+	}
+	start := r.pos / 8
+	if start+n > len(r.data) {
+		r.t.Fatalf("read %d bytes past the end", start+n-len(r.data))
+	}
+	r.pos += n * 8
+	return r.data[start : start+n]
+}
+
+// expectTrailing 检查剩余部分正好是 rbsp_trailing_bits
+func (r *bitReader) expectTrailing() {
+	r.t.Helper()
+	if r.readBit() != 1 {
+		r.t.Fatalf("rbsp_stop_one_bit missing at bit %d", r.pos-1)
+	}
+	for !r.byteAligned() {
+		if r.readBit() != 0 {
+			r.t.Fatalf("non-zero rbsp_alignment_zero_bit at bit %d", r.pos-1)
+		}
+	}
+	if rest := len(r.data) - r.pos/8; rest != 0 {
+		r.t.Fatalf("%d bytes left after rbsp_trailing_bits", rest)
+	}
+}
+
+// bitString 把已写入的位渲染成 "0101..."，包括还没凑满一个字节的部分
+func bitString(w *bitWriter) string {
+	var sb strings.Builder
+	for _, b := range w.buf {
+		for i := 7; i >= 0; i-- {
+			sb.WriteByte('0' + b>>i&1)
+		}
+	}
+	for i := int(w.nbits) - 1; i >= 0; i-- {
+		sb.WriteByte('0' + w.cur>>i&1)
+	}
+	return sb.String()
+}
+
+func TestExpGolombCodes(t *testing.T) {
+	// H.264 9.1 表 9-2 / 9-3
+	ue := map[uint32]string{
+		0: "1",
+		1: "010",
+		2: "011",
+		3: "00100",
+		6: "00111",
+		7: "0001000",
+	}
+	for v, want := range ue {
+		w := &bitWriter{}
+		w.writeUE(v)
+		if got := bitString(w); got != want {
+			t.Errorf("ue(%d) = %s, want %s", v, got, want)
+		}
+	}
+	se := map[int32]string{
+		0:  "1",
+		1:  "010",
+		-1: "011",
+		2:  "00100",
+		-2: "00101",
+	}
+	for v, want := range se {
+		w := &bitWriter{}
+		w.writeSE(v)
+		if got := bitString(w); got != want {
+			t.Errorf("se(%d) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestBitWriterRoundTrip(t *testing.T) {
+	ues := []uint32{0, 1, 2, 25, 30, 255, 256, 1 << 20, math.MaxUint32 - 1, math.MaxUint32}
+	ses := []int32{0, 1, -1, 26, -26, math.MaxInt32, math.MinInt32 + 1}
+
+	w := &bitWriter{}
+	w.writeBits(0x5, 3)
+	for _, v := range ues {
+		w.writeUE(v)
+	}
+	for _, v := range ses {
+		w.writeSE(v)
+	}
+	w.writeBit(1)
+	w.alignZero()
+	w.writeBytes([]byte{0xAB, 0x00, 0xCD})
+	w.writeBits(0xDEADBEEF, 32)
+	rbsp := w.trailing()
+
+	r := newBitReader(t, rbsp)
+	if v := r.readBits(3); v != 0x5 {
+		t.Errorf("u(3) = %#x, want 0x5", v)
+	}
+	for _, want := range ues {
+		if got := r.readUE(); got != want {
+			t.Errorf("ue = %d, want %d", got, want)
+		}
+	}
+	for _, want := range ses {
+		if got := r.readSE(); got != want {
+			t.Errorf("se = %d, want %d", got, want)
+		}
+	}
+	if r.readBit() != 1 {
+		t.Error("marker bit lost")
+	}
+	for !r.byteAligned() {
+		if r.readBit() != 0 {
+			t.Fatal("alignZero wrote a one bit")
+		}
+	}
+	if got := r.readBytes(3); !bytes.Equal(got, []byte{0xAB, 0x00, 0xCD}) {
+		t.Errorf("bytes = %x, want ab00cd", got)
+	}
+	if v := r.readBits(32); v != 0xDEADBEEF {
+		t.Errorf("u(32) = %#x, want 0xdeadbeef", v)
+	}
+	r.expectTrailing()
+}
+
+func TestNalUnitEmulationPrevention(t *testing.T) {
+	rbsp := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x03, 0x00, 0x00, 0x04}
+	want := []byte{0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x01, 0x00, 0x00, 0x03, 0x03, 0x00, 0x00, 0x04}
+	nal := nalUnit(nalHeaderIDR, rbsp)
+	if !bytes.Equal(nal, want) {
+		t.Fatalf("nalUnit = % x, want % x", nal, want)
+	}
+	// NAL 内不能出现起始码
+	if bytes.Contains(nal, []byte{0x00, 0x00, 0x01}) {
+		t.Error("start code emulated inside the NAL")
+	}
+	if got := comm.RemoveEmulationPreventionBytes(nal[1:]); !bytes.Equal(got, rbsp) {
+		t.Errorf("RBSP after removing emulation prevention = % x, want % x", got, rbsp)
+	}
+}
@@ -0,0 +1,40 @@
+package testpattern
+
+import "webscreen/sdriver"
+
+// ConfigDescription 返回测试图案驱动的配置项，resolution 和 fps 可以在运行中修改
+func ConfigDescription() []sdriver.ConfigParamDescription {
+	return []sdriver.ConfigParamDescription{
+		{
+			Name:        "video_codec",
+			Type:        "string",
+			Required:    true,
+			Default:     "h264",
+			Options:     []string{"h264"},
+			Badge:       true,
+			Description: "video codec, the built-in encoder only produces H.264 baseline",
+		},
+		{
+			Name:        "resolution",
+			Type:        "string",
+			Required:    false,
+			Default:     "640x360",
+			Badge:       true,
+			Description: "pattern resolution, width and height must be even. I_PCM is uncompressed, keep it small",
+		},
+		{
+			Name:        "fps",
+			Type:        "integer",
+			Required:    false,
+			Default:     30,
+			Description: "frames per second",
+		},
+		{
+			Name:        "keyframe_interval",
+			Type:        "integer",
+			Required:    false,
+			Default:     0,
+			Description: "force an IDR every N frames, 0 means only on request (PLI)",
+		},
+	}
+}
@@ -0,0 +1,342 @@
+package testpattern
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webscreen/sdriver"
+)
+
+// TestPatternDriver implements sdriver.SDriver with a synthetic moving pattern
+// encoded in pure Go. It needs no ffmpeg, adb or device, so the whole
+// WebRTCManager -> Agent.ServeVideoStream path can run on CI machines.
+type TestPatternDriver struct {
+	width, height    int
+	fps              int
+	keyframeInterval uint64
+
+	encoder *Encoder
+	pattern *Pattern
+
+	mu       sync.Mutex
+	running  bool
+	paused   bool
+	resumeCh chan struct{}
+	stopOnce sync.Once
+	stopCh   chan struct{}
+
+	forceIDR atomic.Bool
+	// 由 UpdateDriverConfig 设置，loop 在下一帧开始前应用
+	pending *pendingConfig
+
+	videoCh   chan sdriver.AVBox
+	controlCh chan sdriver.Event
+}
+
+type pendingConfig struct {
+	width, height int
+	fps           int
+}
+
+func New(c map[string]string) (*TestPatternDriver, error) {
+	d := &TestPatternDriver{
+		width:     640,
+		height:    360,
+		fps:       30,
+		stopCh:    make(chan struct{}),
+		resumeCh:  make(chan struct{}),
+		videoCh:   make(chan sdriver.AVBox, 16),
+		controlCh: make(chan sdriver.Event, 4),
+	}
+	if codec := c["video_codec"]; codec != "" && codec != "h264" {
+		return nil, fmt.Errorf("testpattern: unsupported video codec %q, only h264 is available", codec)
+	}
+	if res := c["resolution"]; res != "" {
+		width, height, err := parseResolution(res)
+		if err != nil {
+			return nil, err
+		}
+		d.width, d.height = width, height
+	}
+	if v := c["fps"]; v != "" {
+		fps, err := parseFPS(v)
+		if err != nil {
+			return nil, err
+		}
+		d.fps = fps
+	}
+	if v := c["keyframe_interval"]; v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("testpattern: invalid keyframe_interval %q", v)
+		}
+		d.keyframeInterval = n
+	}
+
+	enc, err := NewEncoder(d.width, d.height, d.fps)
+	if err != nil {
+		return nil, err
+	}
+	d.encoder = enc
+	d.pattern = NewPattern(d.width, d.height)
+	log.Printf("Test pattern driver: %dx%d@%d", d.width, d.height, d.fps)
+	return d, nil
+}
+
+func parseResolution(res string) (int, int, error) {
+	w, h, ok := strings.Cut(res, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return 0, 0, fmt.Errorf("testpattern: invalid resolution %q", res)
+	}
+	return width, height, nil
+}
+
+func parseFPS(v string) (int, error) {
+	fps, err := strconv.Atoi(v)
+	if err != nil || fps <= 0 || fps > 120 {
+		return 0, fmt.Errorf("testpattern: invalid fps %q", v)
+	}
+	return fps, nil
+}
+
+// GetReceivers 没有音频，返回 nil 的音频通道，Agent 不会为它启动 ServeAudioStream
+func (d *TestPatternDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVBox, chan sdriver.Event) {
+	return d.videoCh, nil, d.controlCh
+}
+
+// SendEvent is a no-op, the pattern has no input.
+func (d *TestPatternDriver) SendEvent(event sdriver.Event) error { return nil }
+
+// Start starts producing frames. Calling Start on a paused driver resumes it.
+func (d *TestPatternDriver) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running {
+		d.resumeLocked()
+		return
+	}
+	select {
+	case <-d.stopCh:
+		return
+	default:
+	}
+	d.running = true
+	go d.loop()
+}
+
+// Pause stops producing frames until Resume (or Start) is called. A driver paused
+// before Start starts paused and sends nothing until Resume.
+func (d *TestPatternDriver) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paused {
+		return
+	}
+	d.paused = true
+	d.resumeCh = make(chan struct{})
+}
+
+// Resume continues producing frames, starting with an IDR.
+func (d *TestPatternDriver) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resumeLocked()
+}
+
+func (d *TestPatternDriver) resumeLocked() {
+	if !d.paused {
+		return
+	}
+	d.paused = false
+	close(d.resumeCh)
+}
+
+// RequestIDR makes the next frame an IDR with SPS/PPS in front of it.
+func (d *TestPatternDriver) RequestIDR(firstFrame bool) {
+	d.forceIDR.Store(true)
+}
+
+func (d *TestPatternDriver) Capabilities() sdriver.DriverCaps {
+	return sdriver.DriverCaps{CanVideo: true}
+}
+
+// UpdateDriverConfig 支持在运行中修改 resolution 和 fps，新参数从下一帧开始生效，
+// 分辨率变化时会重新生成 SPS/PPS 并发送 IDR。
+func (d *TestPatternDriver) UpdateDriverConfig(config map[string]string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	next := pendingConfig{width: d.width, height: d.height, fps: d.fps}
+	if d.pending != nil {
+		next = *d.pending
+	}
+	for k, v := range config {
+		switch k {
+		case "resolution":
+			width, height, err := parseResolution(v)
+			if err != nil {
+				return err
+			}
+			next.width, next.height = width, height
+		case "fps":
+			fps, err := parseFPS(v)
+			if err != nil {
+				return err
+			}
+			next.fps = fps
+		default:
+			return fmt.Errorf("testpattern: %s cannot be changed while running: %w", k, sdriver.ErrNotSupported)
+		}
+	}
+	d.pending = &next
+	return nil
+}
+
+func (d *TestPatternDriver) MediaMeta() sdriver.MediaMeta {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return sdriver.MediaMeta{
+		VideoCodec: "h264",
+		Width:      uint32(d.width),
+		Height:     uint32(d.height),
+		FPS:        uint32(d.fps),
+	}
+}
+
+func (d *TestPatternDriver) ConfigDescription() []sdriver.ConfigParamDescription {
+	return ConfigDescription()
+}
+
+func (d *TestPatternDriver) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+		d.mu.Lock()
+		running := d.running
+		d.mu.Unlock()
+		// loop 没启动时由这里关闭通道，否则由 loop 退出时关闭
+		if !running {
+			close(d.videoCh)
+			close(d.controlCh)
+		}
+	})
+}
+
+func (d *TestPatternDriver) waitResume() bool {
+	d.mu.Lock()
+	paused, ch := d.paused, d.resumeCh
+	d.mu.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-ch:
+		// 恢复后解码端可能已经丢了参考帧，直接发 IDR
+		d.forceIDR.Store(true)
+		return true
+	case <-d.stopCh:
+		return false
+	}
+}
+
+func (d *TestPatternDriver) send(box sdriver.AVBox) bool {
+	select {
+	case d.videoCh <- box:
+		return true
+	case <-d.stopCh:
+		return false
+	}
+}
+
+func (d *TestPatternDriver) loop() {
+	defer func() {
+		close(d.videoCh)
+		close(d.controlCh)
+	}()
+
+	ticker := time.NewTicker(time.Second / time.Duration(d.fps))
+	defer ticker.Stop()
+
+	// 编码器持有上一帧作为参考，这里双缓冲交替绘制
+	frames := [2]*Frame{NewFrame(d.width, d.height), NewFrame(d.width, d.height)}
+	start := time.Now()
+	var index uint64
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.stopCh:
+			return
+		}
+		if !d.waitResume() {
+			return
+		}
+		d.applyPending(ticker, &frames)
+
+		now := time.Now()
+		f := frames[index%2]
+		d.pattern.Draw(f, index, now)
+
+		if d.forceIDR.Swap(false) || (d.keyframeInterval > 0 && index%d.keyframeInterval == 0) {
+			d.encoder.ForceIDR()
+		}
+		nal, isIDR := d.encoder.Encode(f)
+		pts := uint64(now.Sub(start).Microseconds())
+
+		if isIDR {
+			if !d.send(sdriver.AVBox{Data: d.encoder.SPS(), PTS: pts, NoDuration: true}) ||
+				!d.send(sdriver.AVBox{Data: d.encoder.PPS(), PTS: pts, NoDuration: true}) {
+				return
+			}
+		}
+		if !d.send(sdriver.AVBox{Data: nal, PTS: pts}) {
+			return
+		}
+		index++
+	}
+}
+
+// applyPending 在 loop 协程中应用新配置，MediaMetaEvent 也从这里发出，避免与关闭通道竞争
+func (d *TestPatternDriver) applyPending(ticker *time.Ticker, frames *[2]*Frame) {
+	d.mu.Lock()
+	p := d.pending
+	d.pending = nil
+	if p == nil || (p.width == d.width && p.height == d.height && p.fps == d.fps) {
+		d.mu.Unlock()
+		return
+	}
+	enc, err := NewEncoder(p.width, p.height, p.fps)
+	if err != nil {
+		d.mu.Unlock()
+		log.Printf("[testpattern] apply config failed: %v", err)
+		return
+	}
+	if p.width != d.width || p.height != d.height {
+		d.pattern = NewPattern(p.width, p.height)
+		frames[0], frames[1] = NewFrame(p.width, p.height), NewFrame(p.width, p.height)
+	}
+	if p.fps != d.fps {
+		ticker.Reset(time.Second / time.Duration(p.fps))
+	}
+	// SPS 中带有尺寸和帧率，换编码器后第一帧必然是 IDR
+	d.encoder = enc
+	d.width, d.height, d.fps = p.width, p.height, p.fps
+	meta := sdriver.MediaMeta{
+		VideoCodec: "h264",
+		Width:      uint32(d.width),
+		Height:     uint32(d.height),
+		FPS:        uint32(d.fps),
+	}
+	d.mu.Unlock()
+
+	log.Printf("[testpattern] config changed: %dx%d@%d", meta.Width, meta.Height, meta.FPS)
+	select {
+	case d.controlCh <- sdriver.MediaMetaEvent{Meta: meta}:
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package testpattern
+
+import (
+	"testing"
+	"time"
+
+	"webscreen/sdriver"
+)
+
+func nalType(box sdriver.AVBox) byte {
+	return box.Data[0] & 0x1F
+}
+
+func receive(t *testing.T, ch <-chan sdriver.AVBox) sdriver.AVBox {
+	t.Helper()
+	select {
+	case box, ok := <-ch:
+		if !ok {
+			t.Fatal("video channel closed")
+		}
+		return box
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame from the driver")
+	}
+	return sdriver.AVBox{}
+}
+
+// expectKeyframe 检查接下来是 SPS、PPS 和 IDR，参数集不占帧时长
+func expectKeyframe(t *testing.T, ch <-chan sdriver.AVBox) {
+	t.Helper()
+	for i, want := range []byte{7, 8, 5} {
+		box := receive(t, ch)
+		if got := nalType(box); got != want {
+			t.Fatalf("NAL %d: type %d, want %d", i, got, want)
+		}
+		if box.NoDuration != (want != 5) {
+			t.Errorf("NAL type %d: NoDuration = %v", want, box.NoDuration)
+		}
+	}
+}
+
+func TestRequestIDR(t *testing.T) {
+	d, err := New(map[string]string{"resolution": "32x32", "fps": "120"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoCh, _, _ := d.GetReceivers()
+	d.Start()
+	defer func() {
+		d.Stop()
+		for range videoCh {
+		}
+	}()
+
+	expectKeyframe(t, videoCh)
+	// 方块在移动，之后都是 P 帧
+	for range 3 {
+		if box := receive(t, videoCh); nalType(box) != 1 {
+			t.Fatalf("NAL type %d without RequestIDR, want P slice", nalType(box))
+		}
+	}
+
+	d.RequestIDR(false)
+	// 通道里可能还有请求之前编码好的 P 帧
+	for range cap(d.videoCh) + 1 {
+		box := receive(t, videoCh)
+		switch nalType(box) {
+		case 1:
+			continue
+		case 7:
+			for i, want := range []byte{8, 5} {
+				if got := nalType(receive(t, videoCh)); got != want {
+					t.Fatalf("NAL %d after SPS: type %d, want %d", i, got, want)
+				}
+			}
+			return
+		default:
+			t.Fatalf("NAL type %d before SPS", nalType(box))
+		}
+	}
+	t.Fatal("no IDR after RequestIDR")
+}
@@ -0,0 +1,265 @@
+package testpattern
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// NAL 头：forbidden_zero_bit(1) + nal_ref_idc(2) + nal_unit_type(5)
+const (
+	nalHeaderSPS     byte = 0x67 // ref_idc 3, type 7
+	nalHeaderPPS     byte = 0x68 // ref_idc 3, type 8
+	nalHeaderIDR     byte = 0x65 // ref_idc 3, type 5
+	nalHeaderNonIDR  byte = 0x41 // ref_idc 2, type 1
+	log2MaxFrameNum       = 4
+	mbTypeIPCMInISlc      = 25
+	mbTypeIPCMInPSlc      = 5 + 25 // P slice 中帧内宏块的 mb_type 要加上 5 个 P 类型
+)
+
+// Encoder 是一个极简的 H.264 Constrained Baseline 编码器：
+// IDR 帧所有宏块都是 I_PCM；P 帧对未变化的宏块用 P_Skip，变化的宏块用 I_PCM。
+// I_PCM 是无损的，所以参考帧就是上一帧原图，不需要重建。
+// 码率很高，但实现简单、完全不依赖 cgo/ffmpeg，适合测试画面。
+type Encoder struct {
+	width, height     int
+	mbWidth, mbHeight int
+	fps               int
+
+	sps, pps []byte
+
+	prev      *Frame // 上一帧（即解码端的参考帧）
+	frameNum  uint32
+	idrPicID  uint32
+	needIDR   bool
+	pcmBuffer []byte
+}
+
+// NewEncoder 创建编码器，宽高必须是偶数（4:2:0）
+func NewEncoder(width, height, fps int) (*Encoder, error) {
+	if width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return nil, fmt.Errorf("testpattern: invalid resolution %dx%d, width and height must be positive and even", width, height)
+	}
+	if fps <= 0 {
+		return nil, fmt.Errorf("testpattern: invalid fps %d", fps)
+	}
+	e := &Encoder{
+		width:     width,
+		height:    height,
+		mbWidth:   (width + 15) / 16,
+		mbHeight:  (height + 15) / 16,
+		fps:       fps,
+		needIDR:   true,
+		pcmBuffer: make([]byte, 384),
+	}
+	e.sps = e.buildSPS()
+	e.pps = e.buildPPS()
+	return e, nil
+}
+
+// SPS 返回不带起始码的 SPS NAL
+func (e *Encoder) SPS() []byte { return e.sps }
+
+// PPS 返回不带起始码的 PPS NAL
+func (e *Encoder) PPS() []byte { return e.pps }
+
+// ForceIDR 让下一帧编码为 IDR
+func (e *Encoder) ForceIDR() { e.needIDR = true }
+
+// Encode 编码一帧，返回 slice NAL（不带起始码）以及是否为 IDR。
+// 帧的尺寸必须与编码器一致，编码器会持有该帧作为下一帧的参考。
+func (e *Encoder) Encode(f *Frame) ([]byte, bool) {
+	if e.needIDR || e.prev == nil {
+		e.needIDR = false
+		nal := e.encodeIDR(f)
+		e.prev = f
+		return nal, true
+	}
+	nal := e.encodeP(f)
+	e.prev = f
+	return nal, false
+}
+
+func (e *Encoder) level() uint32 {
+	// 按 MaxFS（每帧宏块数）选择最低满足的 level
+	mbs := e.mbWidth * e.mbHeight
+	switch {
+	case mbs <= 1620:
+		return 30
+	case mbs <= 3600:
+		return 31
+	case mbs <= 5120:
+		return 32
+	case mbs <= 8192:
+		return 40
+	case mbs <= 22080:
+		return 50
+	default:
+		return 51
+	}
+}
+
+func (e *Encoder) buildSPS() []byte {
+	w := &bitWriter{}
+	w.writeBits(66, 8)   // profile_idc: Baseline
+	w.writeBits(0xE0, 8) // constraint_set0/1/2: Constrained Baseline
+	w.writeBits(e.level(), 8)
+	w.writeUE(0)                   // seq_parameter_set_id
+	w.writeUE(log2MaxFrameNum - 4) // log2_max_frame_num_minus4
+	w.writeUE(2)                   // pic_order_cnt_type: 由 frame_num 推导，无 B 帧
+	w.writeUE(1)                   // max_num_ref_frames
+	w.writeBit(0)                  // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(uint32(e.mbWidth - 1))
+	w.writeUE(uint32(e.mbHeight - 1))
+	w.writeBit(1) // frame_mbs_only_flag
+	w.writeBit(1) // direct_8x8_inference_flag
+
+	cropRight := (e.mbWidth*16 - e.width) / 2
+	cropBottom := (e.mbHeight*16 - e.height) / 2
+	if cropRight > 0 || cropBottom > 0 {
+		w.writeBit(1) // frame_cropping_flag
+		w.writeUE(0)
+		w.writeUE(uint32(cropRight))
+		w.writeUE(0)
+		w.writeUE(uint32(cropBottom))
+	} else {
+		w.writeBit(0)
+	}
+
+	// VUI：写入帧率，并声明没有重排序，解码端可以立即输出
+	w.writeBit(1) // vui_parameters_present_flag
+	w.writeBit(0) // aspect_ratio_info_present_flag
+	w.writeBit(0) // overscan_info_present_flag
+	w.writeBit(0) // video_signal_type_present_flag
+	w.writeBit(0) // chroma_loc_info_present_flag
+	w.writeBit(1) // timing_info_present_flag
+	w.writeBits(1, 32)
+	w.writeBits(uint32(2*e.fps), 32)
+	w.writeBit(1) // fixed_frame_rate_flag
+	w.writeBit(0) // nal_hrd_parameters_present_flag
+	w.writeBit(0) // vcl_hrd_parameters_present_flag
+	w.writeBit(0) // pic_struct_present_flag
+	w.writeBit(1) // bitstream_restriction_flag
+	w.writeBit(1) // motion_vectors_over_pic_boundaries_flag
+	w.writeUE(0)  // max_bytes_per_pic_denom
+	w.writeUE(0)  // max_bits_per_mb_denom
+	w.writeUE(16) // log2_max_mv_length_horizontal
+	w.writeUE(16) // log2_max_mv_length_vertical
+	w.writeUE(0)  // max_num_reorder_frames
+	w.writeUE(1)  // max_dec_frame_buffering
+
+	return nalUnit(nalHeaderSPS, w.trailing())
+}
+
+func (e *Encoder) buildPPS() []byte {
+	w := &bitWriter{}
+	w.writeUE(0)  // pic_parameter_set_id
+	w.writeUE(0)  // seq_parameter_set_id
+	w.writeBit(0) // entropy_coding_mode_flag: CAVLC
+	w.writeBit(0) // bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)  // num_slice_groups_minus1
+	w.writeUE(0)  // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)  // num_ref_idx_l1_default_active_minus1
+	w.writeBit(0) // weighted_pred_flag
+	w.writeBits(0, 2)
+	w.writeSE(0)  // pic_init_qp_minus26
+	w.writeSE(0)  // pic_init_qs_minus26
+	w.writeSE(0)  // chroma_qp_index_offset
+	w.writeBit(1) // deblocking_filter_control_present_flag
+	w.writeBit(0) // constrained_intra_pred_flag
+	w.writeBit(0) // redundant_pic_cnt_present_flag
+	return nalUnit(nalHeaderPPS, w.trailing())
+}
+
+func (e *Encoder) encodeIDR(f *Frame) []byte {
+	e.frameNum = 0
+	w := &bitWriter{}
+	w.writeUE(0) // first_mb_in_slice
+	w.writeUE(7) // slice_type: I（本图像所有 slice 同类型）
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(e.frameNum, log2MaxFrameNum)
+	w.writeUE(e.idrPicID)
+	// dec_ref_pic_marking
+	w.writeBit(0) // no_output_of_prior_pics_flag
+	w.writeBit(0) // long_term_reference_flag
+	w.writeSE(0)  // slice_qp_delta
+	w.writeUE(1)  // disable_deblocking_filter_idc: I_PCM 无需去块
+
+	for mby := 0; mby < e.mbHeight; mby++ {
+		for mbx := 0; mbx < e.mbWidth; mbx++ {
+			w.writeUE(mbTypeIPCMInISlc)
+			e.writePCM(w, f, mbx, mby)
+		}
+	}
+
+	e.idrPicID = (e.idrPicID + 1) % 2
+	return nalUnit(nalHeaderIDR, w.trailing())
+}
+
+func (e *Encoder) encodeP(f *Frame) []byte {
+	e.frameNum = (e.frameNum + 1) % (1 << log2MaxFrameNum)
+	w := &bitWriter{}
+	w.writeUE(0) // first_mb_in_slice
+	w.writeUE(5) // slice_type: P
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(e.frameNum, log2MaxFrameNum)
+	w.writeBit(0) // num_ref_idx_active_override_flag
+	w.writeBit(0) // ref_pic_list_modification_flag_l0
+	w.writeBit(0) // adaptive_ref_pic_marking_mode_flag: 滑动窗口
+	w.writeSE(0)  // slice_qp_delta
+	w.writeUE(1)  // disable_deblocking_filter_idc
+
+	skipRun := uint32(0)
+	for mby := 0; mby < e.mbHeight; mby++ {
+		for mbx := 0; mbx < e.mbWidth; mbx++ {
+			if !e.mbChanged(f, mbx, mby) {
+				skipRun++
+				continue
+			}
+			w.writeUE(skipRun) // mb_skip_run
+			skipRun = 0
+			w.writeUE(mbTypeIPCMInPSlc)
+			e.writePCM(w, f, mbx, mby)
+		}
+	}
+	if skipRun > 0 {
+		w.writeUE(skipRun)
+	}
+
+	return nalUnit(nalHeaderNonIDR, w.trailing())
+}
+
+// writePCM 写入一个 I_PCM 宏块：对齐后 256 个亮度 + 2×64 个色度采样，均按宏块内光栅顺序
+func (e *Encoder) writePCM(w *bitWriter, f *Frame, mbx, mby int) {
+	w.alignZero()
+	buf := e.pcmBuffer[:0]
+	for y := 0; y < 16; y++ {
+		buf = append(buf, f.lumaRow(mbx*16, mby*16+y, 16)...)
+	}
+	for _, plane := range [][]byte{f.Cb, f.Cr} {
+		for y := 0; y < 8; y++ {
+			buf = append(buf, f.chromaRow(plane, mbx*8, mby*8+y, 8)...)
+		}
+	}
+	// 早期版本的标准不允许 PCM 采样为 0，统一钳到 1 以兼容老解码器
+	for i, v := range buf {
+		if v == 0 {
+			buf[i] = 1
+		}
+	}
+	w.writeBytes(buf)
+}
+
+func (e *Encoder) mbChanged(f *Frame, mbx, mby int) bool {
+	for y := 0; y < 16; y++ {
+		if !bytes.Equal(f.lumaRow(mbx*16, mby*16+y, 16), e.prev.lumaRow(mbx*16, mby*16+y, 16)) {
+			return true
+		}
+	}
+	for y := 0; y < 8; y++ {
+		if !bytes.Equal(f.chromaRow(f.Cb, mbx*8, mby*8+y, 8), e.prev.chromaRow(e.prev.Cb, mbx*8, mby*8+y, 8)) ||
+			!bytes.Equal(f.chromaRow(f.Cr, mbx*8, mby*8+y, 8), e.prev.chromaRow(e.prev.Cr, mbx*8, mby*8+y, 8)) {
+			return true
+		}
+	}
+	return false
+}
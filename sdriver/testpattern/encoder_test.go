@@ -0,0 +1,258 @@
+package testpattern
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"webscreen/sdriver/comm"
+)
+
+// 40x24 不是宏块的整数倍，覆盖裁剪和部分宏块
+const (
+	testWidth  = 40
+	testHeight = 24
+	testFPS    = 25
+)
+
+func newTestEncoder(t *testing.T) *Encoder {
+	t.Helper()
+	e, err := NewEncoder(testWidth, testHeight, testFPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// rbspReader 检查 NAL 头并返回去掉防竞争字节后的 RBSP 读取器
+func rbspReader(t *testing.T, nal []byte, header byte) *bitReader {
+	t.Helper()
+	if len(nal) == 0 || nal[0] != header {
+		t.Fatalf("NAL header = % x, want %#x", nal[:min(len(nal), 1)], header)
+	}
+	return newBitReader(t, comm.RemoveEmulationPreventionBytes(nal[1:]))
+}
+
+// mbSamples 按 I_PCM 的顺序取出一个宏块的采样
+func mbSamples(f *Frame, mbx, mby int) []byte {
+	var buf []byte
+	for y := 0; y < 16; y++ {
+		buf = append(buf, f.lumaRow(mbx*16, mby*16+y, 16)...)
+	}
+	for _, plane := range [][]byte{f.Cb, f.Cr} {
+		for y := 0; y < 8; y++ {
+			buf = append(buf, f.chromaRow(plane, mbx*8, mby*8+y, 8)...)
+		}
+	}
+	for i, v := range buf {
+		if v == 0 {
+			buf[i] = 1
+		}
+	}
+	return buf
+}
+
+// expectPCM 读取 pcm_alignment_zero_bit 和 384 个采样并与帧比较
+func expectPCM(t *testing.T, r *bitReader, f *Frame, mbx, mby int) {
+	t.Helper()
+	for !r.byteAligned() {
+		if r.readBit() != 0 {
+			t.Fatalf("MB (%d,%d): non-zero pcm_alignment_zero_bit", mbx, mby)
+		}
+	}
+	if got := r.readBytes(384); !bytes.Equal(got, mbSamples(f, mbx, mby)) {
+		t.Fatalf("MB (%d,%d): PCM samples differ from the frame", mbx, mby)
+	}
+}
+
+func TestSPS(t *testing.T) {
+	e := newTestEncoder(t)
+	r := rbspReader(t, e.SPS(), 0x67)
+
+	expect := func(name string, got, want uint32) {
+		t.Helper()
+		if got != want {
+			t.Errorf("%s = %d, want %d", name, got, want)
+		}
+	}
+	expect("profile_idc", r.readBits(8), 66)
+	expect("constraint_flags", r.readBits(8), 0xE0)
+	expect("level_idc", r.readBits(8), 30)
+	expect("seq_parameter_set_id", r.readUE(), 0)
+	expect("log2_max_frame_num_minus4", r.readUE(), log2MaxFrameNum-4)
+	expect("pic_order_cnt_type", r.readUE(), 2)
+	expect("max_num_ref_frames", r.readUE(), 1)
+	expect("gaps_in_frame_num_value_allowed_flag", r.readBit(), 0)
+	expect("pic_width_in_mbs_minus1", r.readUE(), 2)
+	expect("pic_height_in_map_units_minus1", r.readUE(), 1)
+	expect("frame_mbs_only_flag", r.readBit(), 1)
+	expect("direct_8x8_inference_flag", r.readBit(), 1)
+	expect("frame_cropping_flag", r.readBit(), 1)
+	expect("frame_crop_left_offset", r.readUE(), 0)
+	expect("frame_crop_right_offset", r.readUE(), (48-testWidth)/2)
+	expect("frame_crop_top_offset", r.readUE(), 0)
+	expect("frame_crop_bottom_offset", r.readUE(), (32-testHeight)/2)
+
+	expect("vui_parameters_present_flag", r.readBit(), 1)
+	r.readBits(4) // aspect_ratio / overscan / video_signal_type / chroma_loc
+	expect("timing_info_present_flag", r.readBit(), 1)
+	expect("num_units_in_tick", r.readBits(32), 1)
+	expect("time_scale", r.readBits(32), 2*testFPS)
+	expect("fixed_frame_rate_flag", r.readBit(), 1)
+	r.readBits(3) // nal_hrd / vcl_hrd / pic_struct
+	expect("bitstream_restriction_flag", r.readBit(), 1)
+	r.readBit()
+	r.readUE()
+	r.readUE()
+	r.readUE()
+	r.readUE()
+	expect("max_num_reorder_frames", r.readUE(), 0)
+	expect("max_dec_frame_buffering", r.readUE(), 1)
+	r.expectTrailing()
+
+	// 仓库里解析 SPS 的代码（dummy 驱动、MediaMeta）要能得到相同的尺寸
+	info, err := comm.ParseSPS_H264(comm.RemoveEmulationPreventionBytes(e.SPS()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != testWidth || info.Height != testHeight {
+		t.Errorf("ParseSPS_H264 = %dx%d, want %dx%d", info.Width, info.Height, testWidth, testHeight)
+	}
+}
+
+func TestPPS(t *testing.T) {
+	r := rbspReader(t, newTestEncoder(t).PPS(), 0x68)
+	if r.readUE() != 0 || r.readUE() != 0 {
+		t.Error("PPS/SPS id not 0")
+	}
+	if r.readBit() != 0 {
+		t.Error("entropy_coding_mode_flag set, Baseline needs CAVLC")
+	}
+	r.readBit()
+	if r.readUE() != 0 {
+		t.Error("num_slice_groups_minus1 != 0")
+	}
+	r.readUE()
+	r.readUE()
+	if r.readBit() != 0 || r.readBits(2) != 0 {
+		t.Error("weighted prediction enabled")
+	}
+	if r.readSE() != 0 || r.readSE() != 0 || r.readSE() != 0 {
+		t.Error("QP offsets not 0")
+	}
+	if r.readBit() != 1 {
+		t.Error("deblocking_filter_control_present_flag not set, slices cannot disable deblocking")
+	}
+	r.readBits(2)
+	r.expectTrailing()
+}
+
+func drawTestFrame(index uint64) *Frame {
+	f := NewFrame(testWidth, testHeight)
+	NewPattern(testWidth, testHeight).Draw(f, index, time.Unix(0, 0))
+	return f
+}
+
+// expectIDRSlice 解析 IDR slice：所有宏块都是 I_PCM，内容与帧一致
+func expectIDRSlice(t *testing.T, nal []byte, f *Frame, idrPicID uint32) {
+	t.Helper()
+	r := rbspReader(t, nal, 0x65)
+	if v := r.readUE(); v != 0 {
+		t.Errorf("first_mb_in_slice = %d", v)
+	}
+	if v := r.readUE(); v != 7 {
+		t.Errorf("slice_type = %d, want 7 (I)", v)
+	}
+	r.readUE()
+	if v := r.readBits(log2MaxFrameNum); v != 0 {
+		t.Errorf("IDR frame_num = %d, want 0", v)
+	}
+	if v := r.readUE(); v != idrPicID {
+		t.Errorf("idr_pic_id = %d, want %d", v, idrPicID)
+	}
+	r.readBits(2) // dec_ref_pic_marking
+	if v := r.readSE(); v != 0 {
+		t.Errorf("slice_qp_delta = %d", v)
+	}
+	if v := r.readUE(); v != 1 {
+		t.Errorf("disable_deblocking_filter_idc = %d, want 1", v)
+	}
+	for mby := 0; mby < 2; mby++ {
+		for mbx := 0; mbx < 3; mbx++ {
+			if v := r.readUE(); v != mbTypeIPCMInISlc {
+				t.Fatalf("MB (%d,%d): mb_type = %d, want I_PCM", mbx, mby, v)
+			}
+			expectPCM(t, r, f, mbx, mby)
+		}
+	}
+	r.expectTrailing()
+}
+
+func TestIDRSlice(t *testing.T) {
+	e := newTestEncoder(t)
+	f := drawTestFrame(0)
+	nal, isIDR := e.Encode(f)
+	if !isIDR {
+		t.Fatal("first frame is not an IDR")
+	}
+	expectIDRSlice(t, nal, f, 0)
+
+	// 强制 IDR 时即使画面没变也要重新发完整的一帧，idr_pic_id 与上一个 IDR 不同
+	e.ForceIDR()
+	nal, isIDR = e.Encode(drawTestFrame(0))
+	if !isIDR {
+		t.Fatal("frame after ForceIDR is not an IDR")
+	}
+	expectIDRSlice(t, nal, f, 1)
+}
+
+// expectPSliceHeader 解析 P slice 头，返回指向宏块数据的读取器
+func expectPSliceHeader(t *testing.T, nal []byte, frameNum uint32) *bitReader {
+	t.Helper()
+	r := rbspReader(t, nal, 0x41)
+	r.readUE()
+	if v := r.readUE(); v != 5 {
+		t.Errorf("slice_type = %d, want 5 (P)", v)
+	}
+	r.readUE()
+	if v := r.readBits(log2MaxFrameNum); v != frameNum {
+		t.Errorf("frame_num = %d, want %d", v, frameNum)
+	}
+	r.readBits(3)
+	r.readSE()
+	r.readUE()
+	return r
+}
+
+func TestPSlice(t *testing.T) {
+	e := newTestEncoder(t)
+	e.Encode(NewFrame(testWidth, testHeight))
+
+	// 画面不变：整帧跳过
+	nal, isIDR := e.Encode(NewFrame(testWidth, testHeight))
+	if isIDR {
+		t.Fatal("unchanged frame encoded as IDR")
+	}
+	r := expectPSliceHeader(t, nal, 1)
+	if v := r.readUE(); v != 6 {
+		t.Errorf("mb_skip_run = %d, want 6", v)
+	}
+	r.expectTrailing()
+
+	// 只改动第 2 行第 2 个宏块
+	f := NewFrame(testWidth, testHeight)
+	f.fill(16, 16, 4, 4, white)
+	nal, _ = e.Encode(f)
+	r = expectPSliceHeader(t, nal, 2)
+	if v := r.readUE(); v != 4 {
+		t.Errorf("mb_skip_run before the changed MB = %d, want 4", v)
+	}
+	if v := r.readUE(); v != mbTypeIPCMInPSlc {
+		t.Fatalf("mb_type = %d, want I_PCM in P slice", v)
+	}
+	expectPCM(t, r, f, 1, 1)
+	if v := r.readUE(); v != 1 {
+		t.Errorf("trailing mb_skip_run = %d, want 1", v)
+	}
+	r.expectTrailing()
+}
@@ -0,0 +1,173 @@
+package testpattern
+
+import (
+	"fmt"
+	"time"
+)
+
+// Frame 是一帧 YUV 4:2:0 图像，平面按宏块对齐分配，超出可见区域的部分保持不变
+type Frame struct {
+	Width, Height int
+	stride        int // 亮度平面宽度（16 对齐）
+	cstride       int // 色度平面宽度
+
+	Y, Cb, Cr []byte
+}
+
+func NewFrame(width, height int) *Frame {
+	stride := (width + 15) / 16 * 16
+	rows := (height + 15) / 16 * 16
+	f := &Frame{
+		Width:   width,
+		Height:  height,
+		stride:  stride,
+		cstride: stride / 2,
+		Y:       make([]byte, stride*rows),
+		Cb:      make([]byte, stride*rows/4),
+		Cr:      make([]byte, stride*rows/4),
+	}
+	f.fill(0, 0, stride, rows, black)
+	return f
+}
+
+func (f *Frame) lumaRow(x, y, n int) []byte {
+	off := y*f.stride + x
+	return f.Y[off : off+n]
+}
+
+func (f *Frame) chromaRow(plane []byte, x, y, n int) []byte {
+	off := y*f.cstride + x
+	return plane[off : off+n]
+}
+
+type yuv struct{ y, u, v byte }
+
+// rgbToYUV BT.601 limited range
+func rgbToYUV(r, g, b int) yuv {
+	y := (66*r+129*g+25*b+128)>>8 + 16
+	u := (-38*r-74*g+112*b+128)>>8 + 128
+	v := (112*r-94*g-18*b+128)>>8 + 128
+	return yuv{byte(y), byte(u), byte(v)}
+}
+
+var (
+	black = rgbToYUV(0, 0, 0)
+	white = rgbToYUV(235, 235, 235)
+	// 75% SMPTE 彩条：白 黄 青 绿 品红 红 蓝
+	colourBars = []yuv{
+		rgbToYUV(191, 191, 191),
+		rgbToYUV(191, 191, 0),
+		rgbToYUV(0, 191, 191),
+		rgbToYUV(0, 191, 0),
+		rgbToYUV(191, 0, 191),
+		rgbToYUV(191, 0, 0),
+		rgbToYUV(0, 0, 191),
+	}
+	boxColour = rgbToYUV(255, 128, 0)
+)
+
+// fill 填充矩形，坐标为亮度坐标，色度按 2×2 下采样
+func (f *Frame) fill(x0, y0, w, h int, c yuv) {
+	x1, y1 := x0+w, y0+h
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > f.stride {
+		x1 = f.stride
+	}
+	if y1 > len(f.Y)/f.stride {
+		y1 = len(f.Y) / f.stride
+	}
+	for y := y0; y < y1; y++ {
+		row := f.Y[y*f.stride:]
+		for x := x0; x < x1; x++ {
+			row[x] = c.y
+		}
+	}
+	for y := y0 / 2; y < (y1+1)/2; y++ {
+		for x := x0 / 2; x < (x1+1)/2; x++ {
+			f.Cb[y*f.cstride+x] = c.u
+			f.Cr[y*f.cstride+x] = c.v
+		}
+	}
+}
+
+// 5×7 点阵字体，每行低 5 位有效
+var glyphs = map[rune][7]byte{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'#': {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	' ': {},
+}
+
+// drawText 以 scale 倍放大绘制文本，返回绘制宽度
+func (f *Frame) drawText(x, y, scale int, s string, c yuv) int {
+	cx := x
+	for _, r := range s {
+		g := glyphs[r]
+		for row := 0; row < 7; row++ {
+			for col := 0; col < 5; col++ {
+				if g[row]&(0x10>>col) != 0 {
+					f.fill(cx+col*scale, y+row*scale, scale, scale, c)
+				}
+			}
+		}
+		cx += 6 * scale
+	}
+	return cx - x
+}
+
+// Pattern 绘制测试画面：上方彩条，下方帧计数、时钟和一个往返移动的方块。
+// 时钟取服务器本地时间，对比浏览器端看到的时间即可估算端到端延迟。
+type Pattern struct {
+	width, height int
+}
+
+func NewPattern(width, height int) *Pattern {
+	return &Pattern{width: width, height: height}
+}
+
+func (p *Pattern) Draw(f *Frame, frameIndex uint64, now time.Time) {
+	barsHeight := p.height * 2 / 3
+	for i, c := range colourBars {
+		x0 := p.width * i / len(colourBars)
+		x1 := p.width * (i + 1) / len(colourBars)
+		f.fill(x0, 0, x1-x0, barsHeight, c)
+	}
+	f.fill(0, barsHeight, p.width, p.height-barsHeight, black)
+
+	scale := p.height / 120
+	if scale < 1 {
+		scale = 1
+	}
+	lineHeight := 9 * scale
+	margin := 2 * scale
+
+	// 移动方块：每帧 4 像素，碰到边界折返
+	box := lineHeight
+	span := p.width - box
+	if span > 0 {
+		pos := int(frameIndex*4) % (2 * span)
+		if pos > span {
+			pos = 2*span - pos
+		}
+		f.fill(pos, barsHeight+margin, box, box, boxColour)
+	}
+
+	textY := barsHeight + margin + box + margin
+	f.drawText(margin, textY, scale, fmt.Sprintf("#%08d", frameIndex), white)
+	f.drawText(margin, textY+lineHeight, scale, now.Format("15:04:05.000"), white)
+}
@@ -0,0 +1,29 @@
+package testpattern
+
+import "webscreen/sdriver"
+
+func init() {
+	sdriver.Register(sdriver.Registration{
+		Name: sdriver.DEVICE_TYPE_TESTPATTERN,
+		New: func(config map[string]string) (sdriver.SDriver, error) {
+			return New(config)
+		},
+		ConfigDescription: func(string) []sdriver.ConfigParamDescription {
+			return ConfigDescription()
+		},
+		Devices: ListDevices,
+	})
+}
+
+// ListDevices 测试画面在任何机器上都可用
+func ListDevices() ([]sdriver.DeviceInfo, error) {
+	return []sdriver.DeviceInfo{
+		{
+			Type:     sdriver.DEVICE_TYPE_TESTPATTERN,
+			DeviceID: "Test Pattern",
+			IP:       "127.0.0.1",
+			Port:     0,
+			Status:   "active",
+		},
+	}, nil
+}
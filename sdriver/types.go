@@ -1,5 +1,19 @@
 package sdriver
 
+import (
+	"maps"
+	"strings"
+)
+
+// 内置驱动的 device_type
+const (
+	DEVICE_TYPE_SUNSHINE    string = "sunshine"
+	DEVICE_TYPE_LINUX       string = "linux"
+	DEVICE_TYPE_ANDROID     string = "android"
+	DEVICE_TYPE_DUMMY       string = "dummy"
+	DEVICE_TYPE_TESTPATTERN string = "testpattern"
+)
+
 // type DriverConfig map[string]string
 type ConfigParamDescription struct {
 	Name     string   `json:"name"`
@@ -12,6 +26,39 @@ type ConfigParamDescription struct {
 
 	Description string `json:"description"`
 }
+
+// secretConfigWords 名字含有这些词的配置项是密钥，例如 ssh_password，不能写入日志或通过 API 返回
+var secretConfigWords = []string{"password", "passphrase", "secret", "token"}
+
+// IsSecretConfig 返回配置项是否为密钥
+func IsSecretConfig(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretConfigWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactConfig 返回把非空的密钥替换为 *** 的副本，用于日志
+func RedactConfig(cfg map[string]string) map[string]string {
+	redacted := maps.Clone(cfg)
+	for k, v := range redacted {
+		if v != "" && IsSecretConfig(k) {
+			redacted[k] = "***"
+		}
+	}
+	return redacted
+}
+
+// PublicConfig 返回去掉密钥的副本，用于 API 返回
+func PublicConfig(cfg map[string]string) map[string]string {
+	public := maps.Clone(cfg)
+	maps.DeleteFunc(public, func(k, _ string) bool { return IsSecretConfig(k) })
+	return public
+}
+
 type AVBox struct {
 	Data       []byte // H.264/H.265/AV1/.../Opus 裸流数据
 	PTS        uint64 // 相对开始时间的 PTS (Presentation Timestamp)
@@ -23,6 +70,8 @@ type MediaMeta struct {
 	Width      uint32 `json:"width"`
 	Height     uint32 `json:"height"`
 	FPS        uint32 `json:"fps"`
+	// 视频目标码率（bps），未知时为 0
+	BitRate    uint32 `json:"bit_rate,omitempty"`
 	AudioCodec string `json:"audio_codec"`
 }
 
@@ -32,6 +81,8 @@ type DriverCaps struct {
 	CanVideo     bool `json:"can_video"`
 	CanAudio     bool `json:"can_audio"`
 	CanControl   bool `json:"can_control"`
+	CanResize    bool `json:"can_resize"` // UpdateDriverConfig accepts resolution/scale, so the viewer can fit the desktop to its window.
+	CanLaunch    bool `json:"can_launch"` // SendEvent accepts LaunchAppEvent to start apps in the running session.
 
 	IsAndroid bool `json:"is_android"` // If true, show the android-specific buttons, like vol buttons, back, home, recent apps.
 	IsLinux   bool `json:"is_linux"`
@@ -1,13 +1,13 @@
 package sagent
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"maps"
+	"sync"
 	"time"
 	"webscreen/sdriver"
-	linuxDriver "webscreen/sdriver/linux"
-	"webscreen/sdriver/scrcpy"
-	"webscreen/sdriver/sunshine"
 
 	"github.com/pion/webrtc/v4"
 )
@@ -16,6 +16,26 @@ type Agent struct {
 	driver     sdriver.SDriver
 	driverCaps sdriver.DriverCaps
 	config     AgentConfig
+	// 保护 config.DriverConfig，运行中可以通过 UpdateDriverConfig 修改
+	configMu sync.Mutex
+	// reconfigMu 串行化 UpdateDriverConfig。驱动重启可能要好几秒，期间不持有 configMu，Config 不会被阻塞
+	reconfigMu sync.Mutex
+	// stateMu 保护 paused/closed；closed 之后不再向 controlCh 写入，避免写已关闭的通道
+	stateMu sync.Mutex
+	paused  bool
+	closed  bool
+	// pauseMu 串行化 Pause/Resume：修改 paused 和调用驱动在同一个锁内，驱动的状态与 paused 一致
+	pauseMu sync.Mutex
+	// 宏录制/回放，见 macro.go
+	macroMu     sync.Mutex
+	macroRec    *macroRecorder
+	macroCancel context.CancelFunc
+	macroDone   chan struct{}
+	// 服务端录制，见 recording.go
+	recMu sync.RWMutex
+	rec   *mediaRecording
+	// 即时回放缓冲，InitDriver 之后不再修改，见 replay.go
+	replay *replayBuffer
 	// chan
 	videoCh   <-chan sdriver.AVBox
 	audioCh   <-chan sdriver.AVBox
@@ -40,51 +60,42 @@ func New(config AgentConfig, videoTrack *webrtc.TrackLocalStaticRTP, audioTrack
 		useLocalTimestamp: config.UseLocalTimestamp,
 	}
 	log.Printf("AVSync: %v, UseLocalTimestamp: %v", config.AVSync, config.UseLocalTimestamp)
-	log.Printf("Driver config: %+v", config.DriverConfig)
+	log.Printf("Driver config: %+v", sdriver.RedactConfig(config.DriverConfig))
 	return sa
 }
 
 func (sa *Agent) InitDriver(finalCodec webrtc.RTPCodecParameters) error {
 	sa.config.DriverConfig["webrtc_codec_level"] = fmt.Sprintf("%d||%s||%s", finalCodec.PayloadType, finalCodec.MimeType, finalCodec.SDPFmtpLine)
-	switch sa.config.DeviceType {
-	// case DEVICE_TYPE_DUMMY:
-	// 	// 初始化 Dummy Driver
-	// 	dummyDriver, err := dummy.New(sa.config.DriverConfig)
-	// 	if err != nil {
-	// 		log.Printf("Failed to initialize dummy driver: %v", err)
-	// 		return err
-	// 	}
-	// 	sa.driver = dummyDriver
-	case DEVICE_TYPE_ANDROID:
-		// 初始化 Android Driver
-		sa.config.DriverConfig["deviceID"] = sa.config.DeviceID
-		androidDriver, err := scrcpy.New(sa.config.DriverConfig)
-		if err != nil {
-			log.Printf("Failed to initialize Android driver: %v", err)
-			return err
-		}
-		sa.driver = androidDriver
-	case DEVICE_TYPE_LINUX, "xvfb":
-		// 初始化 Linux Driver
-		driver, err := linuxDriver.New(sa.config.DriverConfig)
-		if err != nil {
-			log.Printf("Failed to initialize Linux driver: %v", err)
-			return err
-		}
-		sa.driver = driver
-	case DEVICE_TYPE_SUNSHINE:
-		sunshine.SSTest()
-	default:
-		log.Printf("Unsupported device type: %s", sa.config.DeviceType)
-		return fmt.Errorf("unsupported device type: %s", sa.config.DeviceType)
+	sa.config.DriverConfig["deviceID"] = sa.config.DeviceID
+	driver, err := sdriver.NewDriver(sa.config.DeviceType, sa.config.DriverConfig)
+	if err != nil {
+		log.Printf("Failed to initialize %s driver: %v", sa.config.DeviceType, err)
+		return err
 	}
+	sa.driver = driver
 	sa.driverCaps = sa.driver.Capabilities()
 	sa.videoCh, sa.audioCh, sa.controlCh = sa.driver.GetReceivers()
+	if sa.config.ReplaySeconds > 0 {
+		switch codec := sa.driver.MediaMeta().VideoCodec; codec {
+		case "h264", "h265":
+			sa.replay = newReplayBuffer(codec, time.Duration(sa.config.ReplaySeconds)*time.Second)
+		default:
+			log.Printf("[replay] Instant replay is not supported for %s", codec)
+		}
+	}
 	return nil
 }
 
 func (sa *Agent) Close() {
 	log.Printf("Closing agent for device %s", sa.config.DeviceID)
+	// 等待进行中的 Pause/Resume 完成，之后不会再调用驱动
+	sa.pauseMu.Lock()
+	sa.stateMu.Lock()
+	sa.closed = true
+	sa.stateMu.Unlock()
+	sa.pauseMu.Unlock()
+	sa.StopMacro()
+	sa.StopRecording()
 	if sa.driver != nil {
 		sa.driver.Stop()
 	}
@@ -109,14 +120,107 @@ func (sa *Agent) Start() {
 	go sa.ServeVideoStream()
 	go sa.ServeAudioStream()
 
+	// 在 Start 之前暂停的 Agent 不发送缓存的关键帧，Resume 时驱动会输出新的关键帧
+	if sa.Paused() {
+		return
+	}
 	sa.driver.RequestIDR(true)
 }
 
 func (sa *Agent) PLIRequest() {
+	if sa.Paused() {
+		return
+	}
 	sa.driver.RequestIDR(false)
 }
 
+// Pause 进入隐私模式：驱动停止输出音视频，控制事件仍然可用。所有观看者都会收到状态变化。
+func (sa *Agent) Pause() {
+	sa.setPaused(true)
+}
+
+// Resume 退出隐私模式，驱动保证恢复后的第一帧是关键帧
+func (sa *Agent) Resume() {
+	sa.setPaused(false)
+}
+
+func (sa *Agent) Paused() bool {
+	sa.stateMu.Lock()
+	defer sa.stateMu.Unlock()
+	return sa.paused
+}
+
+func (sa *Agent) setPaused(paused bool) {
+	// 不能持有 stateMu 调用驱动：emit 也要获取 stateMu
+	sa.pauseMu.Lock()
+	defer sa.pauseMu.Unlock()
+	sa.stateMu.Lock()
+	if sa.closed || sa.paused == paused {
+		sa.stateMu.Unlock()
+		return
+	}
+	sa.paused = paused
+	sa.stateMu.Unlock()
+
+	log.Printf("[agent] Device %s paused=%v", sa.config.DeviceID, paused)
+	if paused {
+		sa.driver.Pause()
+	} else {
+		sa.driver.Resume()
+	}
+	sa.emit(sdriver.PauseEvent{Paused: paused})
+}
+
+// Config 返回当前配置的副本，DriverConfig 包含运行中修改过的值
+func (sa *Agent) Config() AgentConfig {
+	sa.configMu.Lock()
+	defer sa.configMu.Unlock()
+	cfg := sa.config
+	cfg.DriverConfig = maps.Clone(sa.config.DriverConfig)
+	return cfg
+}
+
+// UpdateDriverConfig 把配置变更交给驱动，成功后合并到 DriverConfig。
+// 驱动在媒体参数真正变化后会发出 MediaMetaEvent，由 FeedbackEvents 推送给所有观看者。
+func (sa *Agent) UpdateDriverConfig(config map[string]string) error {
+	if len(config) == 0 {
+		return fmt.Errorf("empty config")
+	}
+	sa.reconfigMu.Lock()
+	defer sa.reconfigMu.Unlock()
+	log.Printf("[agent] Update driver config for device %s: %v", sa.config.DeviceID, sdriver.RedactConfig(config))
+	if err := sa.driver.UpdateDriverConfig(config); err != nil {
+		return err
+	}
+	sa.configMu.Lock()
+	maps.Copy(sa.config.DriverConfig, config)
+	sa.configMu.Unlock()
+	return nil
+}
+
 func (sa *Agent) HandleEvent(raw []byte) error {
+	// 配置更新和暂停不需要控制权限，只读驱动也可以使用
+	if len(raw) > 0 && sdriver.EventType(raw[0]) == sdriver.EVENT_TYPE_PAUSE {
+		event, err := sa.parsePauseEvent(raw)
+		if err != nil {
+			return err
+		}
+		sa.setPaused(event.Paused)
+		return nil
+	}
+	if len(raw) > 0 && sdriver.EventType(raw[0]) == sdriver.EVENT_TYPE_UPDATE_CONFIG {
+		event, err := sa.parseUpdateConfigEvent(raw)
+		if err != nil {
+			log.Printf("[agent] Failed to parse update config event: %v", err)
+			return err
+		}
+		if err := sa.UpdateDriverConfig(event.Config); err != nil {
+			log.Printf("[agent] Failed to update driver config: %v", err)
+			sa.notify(fmt.Sprintf("Update config failed: %v", err))
+			return err
+		}
+		return nil
+	}
 	if !sa.driverCaps.CanControl {
 		return fmt.Errorf("driver does not support control events")
 	}
@@ -126,5 +230,42 @@ func (sa *Agent) HandleEvent(raw []byte) error {
 		return err
 	}
 	// log.Printf("Parsed control event: %+v", event)
+	sa.recordMacroEvent(event)
 	return sa.driver.SendEvent(event)
 }
+
+// LaunchApp 在驱动的会话中启动应用（目前只有 Linux 桌面支持），不支持时返回 sdriver.ErrNotSupported
+func (sa *Agent) LaunchApp(command string) error {
+	if !sa.driverCaps.CanLaunch {
+		return sdriver.ErrNotSupported
+	}
+	log.Printf("[agent] Launch app on device %s: %s", sa.config.DeviceID, command)
+	return sa.driver.SendEvent(&sdriver.LaunchAppEvent{Command: command})
+}
+
+// notify 非阻塞地向前端发送提示消息
+// Notify 向该 Agent 的观看者显示一条提示
+func (sa *Agent) Notify(msg string) {
+	sa.notify(msg)
+}
+
+func (sa *Agent) notify(msg string) {
+	sa.emit(sdriver.TextMsgEvent{Msg: msg})
+}
+
+// emit 非阻塞地把 Agent 自己产生的事件放进 controlCh，由 FeedbackEvents 转发给前端
+func (sa *Agent) emit(event sdriver.Event) {
+	if sa.controlCh == nil {
+		return
+	}
+	sa.stateMu.Lock()
+	defer sa.stateMu.Unlock()
+	if sa.closed {
+		return
+	}
+	select {
+	case sa.controlCh <- event:
+	default:
+		log.Printf("[agent] control channel full, drop event %T", event)
+	}
+}
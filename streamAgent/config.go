@@ -17,5 +17,12 @@ func ConfigDescription() []ConfigParamDescription {
 			Default:     true,
 			Description: "Use local timestamp instead of device timestamp. This may reduce latency but the video may be less smooth.",
 		},
+		{
+			Name:        "replay_seconds",
+			Type:        "integer",
+			Required:    false,
+			Default:     0,
+			Description: "Keep the last N seconds in memory so a clip can be saved after something happens. Uses up to 128 MiB of server memory per session. 0 disables instant replay.",
+		},
 	}
 }
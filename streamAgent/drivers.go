@@ -0,0 +1,10 @@
+package sagent
+
+// 内置驱动通过 init() 注册到 sdriver 注册表。
+// 第三方驱动只需在自己的包里调用 sdriver.Register，并在 main 中匿名导入即可。
+import (
+	_ "webscreen/sdriver/dummy"
+	_ "webscreen/sdriver/linux"
+	_ "webscreen/sdriver/scrcpy"
+	_ "webscreen/sdriver/testpattern"
+)
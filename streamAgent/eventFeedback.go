@@ -1,6 +1,7 @@
 package sagent
 
 import (
+	"encoding/json"
 	"iter"
 	"log"
 	"webscreen/sdriver"
@@ -31,6 +32,28 @@ func (sa *Agent) FeedbackEvents() iter.Seq[[]byte] {
 				if !yield(msg) {
 					return
 				}
+			case sdriver.EVENT_TYPE_MEDIA_META:
+				event := event.(sdriver.MediaMetaEvent)
+				content, err := json.Marshal(event.Meta)
+				if err != nil {
+					log.Printf("Failed to marshal media meta: %v", err)
+					continue
+				}
+				msg := make([]byte, 1+len(content))
+				copy(msg[1:], content)
+				msg[0] = byte(sdriver.EVENT_TYPE_MEDIA_META)
+				if !yield(msg) {
+					return
+				}
+			case sdriver.EVENT_TYPE_PAUSE:
+				event := event.(sdriver.PauseEvent)
+				msg := []byte{byte(sdriver.EVENT_TYPE_PAUSE), 0}
+				if event.Paused {
+					msg[1] = 1
+				}
+				if !yield(msg) {
+					return
+				}
 			default:
 				log.Printf("Unhandled event type in ReceiveEvent: %d", eType)
 			}
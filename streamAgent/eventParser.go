@@ -1,7 +1,9 @@
 package sagent
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"webscreen/sdriver"
 )
@@ -38,6 +40,10 @@ func (a *Agent) parseEvent(raw []byte) (sdriver.Event, error) {
 		return a.parseSetClipboardEvent(raw)
 	case sdriver.EVENT_TYPE_REQ_IDR:
 		return a.parseIDRReqEvent()
+	case sdriver.EVENT_TYPE_UPDATE_CONFIG:
+		return a.parseUpdateConfigEvent(raw)
+	case sdriver.EVENT_TYPE_PAUSE:
+		return a.parsePauseEvent(raw)
 	default:
 		return nil, fmt.Errorf("unknown event type: %d", eventType)
 	}
@@ -210,3 +216,42 @@ func (a *Agent) parseSetClipboardEvent(raw []byte) (*sdriver.SetClipboardEvent,
 	}
 	return e, nil
 }
+
+// parsePauseEvent [0x67][paused 1]
+func (a *Agent) parsePauseEvent(raw []byte) (*sdriver.PauseEvent, error) {
+	if len(raw) != 2 {
+		return nil, fmt.Errorf("invalid pause message length: %d", len(raw))
+	}
+	return &sdriver.PauseEvent{Paused: raw[1] == 1}, nil
+}
+
+// parseUpdateConfigEvent [0x65][JSON object]
+func (a *Agent) parseUpdateConfigEvent(raw []byte) (*sdriver.UpdateConfigEvent, error) {
+	if len(raw) < 2 {
+		return nil, fmt.Errorf("invalid update config message length: %d", len(raw))
+	}
+	config, err := ParseConfigJSON(raw[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &sdriver.UpdateConfigEvent{Config: config}, nil
+}
+
+// ParseConfigJSON 解析配置更新的 JSON 对象，值可以是字符串、数字或布尔，统一转为字符串
+func ParseConfigJSON(data []byte) (map[string]string, error) {
+	var values map[string]any
+	// UseNumber 避免大数字被格式化成 4e+06
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid config payload: %v", err)
+	}
+	config := make(map[string]string, len(values))
+	for k, v := range values {
+		if v == nil {
+			return nil, fmt.Errorf("config %s is null", k)
+		}
+		config[k] = fmt.Sprint(v)
+	}
+	return config, nil
+}
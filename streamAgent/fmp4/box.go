@@ -0,0 +1,42 @@
+package fmp4
+
+import "encoding/binary"
+
+// boxWriter 按 ISO/IEC 14496-12 拼装 box，嵌套 box 先写占位 size，结束时回填
+type boxWriter struct {
+	buf []byte
+}
+
+func (w *boxWriter) u8(v uint8) { w.buf = append(w.buf, v) }
+
+func (w *boxWriter) u16(v uint16) { w.buf = binary.BigEndian.AppendUint16(w.buf, v) }
+
+func (w *boxWriter) u32(v uint32) { w.buf = binary.BigEndian.AppendUint32(w.buf, v) }
+
+func (w *boxWriter) u64(v uint64) { w.buf = binary.BigEndian.AppendUint64(w.buf, v) }
+
+func (w *boxWriter) bytes(b []byte) { w.buf = append(w.buf, b...) }
+
+func (w *boxWriter) zeros(n int) { w.buf = append(w.buf, make([]byte, n)...) }
+
+func (w *boxWriter) box(typ string, body func()) {
+	start := len(w.buf)
+	w.u32(0)
+	w.buf = append(w.buf, typ...)
+	body()
+	binary.BigEndian.PutUint32(w.buf[start:], uint32(len(w.buf)-start))
+}
+
+func (w *boxWriter) fullBox(typ string, version uint8, flags uint32, body func()) {
+	w.box(typ, func() {
+		w.u32(uint32(version)<<24 | flags&0xFFFFFF)
+		body()
+	})
+}
+
+// matrix 单位矩阵，mvhd/tkhd 使用
+func (w *boxWriter) matrix() {
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		w.u32(v)
+	}
+}
@@ -0,0 +1,246 @@
+package fmp4
+
+import (
+	"fmt"
+	"webscreen/sdriver/comm"
+)
+
+// writeInit 写出 ftyp + moov（初始化段），样本表都为空，数据全部在后续 moof 中
+func (m *Writer) writeInit() error {
+	var info comm.SPSInfo
+	var err error
+	if m.videoCodec == "h265" {
+		info, err = comm.ParseSPS_H265(m.sps)
+	} else {
+		info, err = comm.ParseSPS_H264(comm.RemoveEmulationPreventionBytes(m.sps), true)
+	}
+	if err != nil {
+		return fmt.Errorf("fmp4: parse SPS: %w", err)
+	}
+	if m.videoCodec == "h265" && len(comm.RemoveEmulationPreventionBytes(m.sps)) < 15 {
+		return fmt.Errorf("fmp4: H.265 SPS too short")
+	}
+
+	w := &boxWriter{}
+	w.box("ftyp", func() {
+		w.bytes([]byte("iso6"))
+		w.u32(0)
+		w.bytes([]byte("iso6isommp41"))
+	})
+	w.box("moov", func() {
+		w.fullBox("mvhd", 0, 0, func() {
+			w.u32(0)    // creation_time
+			w.u32(0)    // modification_time
+			w.u32(1000) // timescale
+			w.u32(0)    // duration，分片文件由 moof 决定
+			w.u32(0x00010000)
+			w.u16(0x0100)
+			w.zeros(10)
+			w.matrix()
+			w.zeros(24)
+			w.u32(audioTrackID + 1) // next_track_ID
+		})
+		m.writeVideoTrak(w, info)
+		if m.hasAudio {
+			m.writeAudioTrak(w)
+		}
+		w.box("mvex", func() {
+			for _, id := range []uint32{videoTrackID, audioTrackID} {
+				if id == audioTrackID && !m.hasAudio {
+					continue
+				}
+				w.fullBox("trex", 0, 0, func() {
+					w.u32(id)
+					w.u32(1) // default_sample_description_index
+					w.u32(0)
+					w.u32(0)
+					w.u32(0)
+				})
+			}
+		})
+	})
+	m.write(w.buf)
+	return m.err
+}
+
+func writeTkhd(w *boxWriter, id uint32, volume uint16, width, height uint32) {
+	// track_enabled | track_in_movie
+	w.fullBox("tkhd", 0, 0x000003, func() {
+		w.u32(0)
+		w.u32(0)
+		w.u32(id)
+		w.u32(0)
+		w.u32(0) // duration
+		w.zeros(8)
+		w.u16(0) // layer
+		w.u16(0) // alternate_group
+		w.u16(volume)
+		w.u16(0)
+		w.matrix()
+		w.u32(width << 16)
+		w.u32(height << 16)
+	})
+}
+
+func writeMdhd(w *boxWriter, timescale uint32) {
+	w.fullBox("mdhd", 0, 0, func() {
+		w.u32(0)
+		w.u32(0)
+		w.u32(timescale)
+		w.u32(0)
+		w.u16(0x55C4) // und
+		w.u16(0)
+	})
+}
+
+func writeHdlr(w *boxWriter, handler, name string) {
+	w.fullBox("hdlr", 0, 0, func() {
+		w.u32(0)
+		w.bytes([]byte(handler))
+		w.zeros(12)
+		w.bytes(append([]byte(name), 0))
+	})
+}
+
+func writeDinf(w *boxWriter) {
+	w.box("dinf", func() {
+		w.fullBox("dref", 0, 0, func() {
+			w.u32(1)
+			w.fullBox("url ", 0, 1, func() {}) // 数据在同一文件内
+		})
+	})
+}
+
+// writeEmptySampleTables 分片文件的 stbl 只保留 stsd，其余表为空
+func writeEmptySampleTables(w *boxWriter) {
+	w.fullBox("stts", 0, 0, func() { w.u32(0) })
+	w.fullBox("stsc", 0, 0, func() { w.u32(0) })
+	w.fullBox("stsz", 0, 0, func() { w.u32(0); w.u32(0) })
+	w.fullBox("stco", 0, 0, func() { w.u32(0) })
+}
+
+func (m *Writer) writeVideoTrak(w *boxWriter, info comm.SPSInfo) {
+	w.box("trak", func() {
+		writeTkhd(w, videoTrackID, 0, info.Width, info.Height)
+		w.box("mdia", func() {
+			writeMdhd(w, videoTimescale)
+			writeHdlr(w, "vide", "VideoHandler")
+			w.box("minf", func() {
+				w.fullBox("vmhd", 0, 1, func() { w.zeros(8) })
+				writeDinf(w)
+				w.box("stbl", func() {
+					w.fullBox("stsd", 0, 0, func() {
+						w.u32(1)
+						m.writeVisualSampleEntry(w, info)
+					})
+					writeEmptySampleTables(w)
+				})
+			})
+		})
+	})
+}
+
+func (m *Writer) writeVisualSampleEntry(w *boxWriter, info comm.SPSInfo) {
+	// 参数集带内传输，使用 avc3/hev1
+	typ := "avc3"
+	if m.videoCodec == "h265" {
+		typ = "hev1"
+	}
+	w.box(typ, func() {
+		w.zeros(6)
+		w.u16(1) // data_reference_index
+		w.zeros(16)
+		w.u16(uint16(info.Width))
+		w.u16(uint16(info.Height))
+		w.u32(0x00480000) // 72 dpi
+		w.u32(0x00480000)
+		w.u32(0)
+		w.u16(1) // frame_count
+		w.zeros(32)
+		w.u16(0x0018)
+		w.u16(0xFFFF)
+		if m.videoCodec == "h265" {
+			m.writeHvcC(w, info)
+		} else {
+			m.writeAvcC(w)
+		}
+	})
+}
+
+func (m *Writer) writeAvcC(w *boxWriter) {
+	w.box("avcC", func() {
+		w.u8(1)
+		w.u8(m.sps[1]) // profile_idc
+		w.u8(m.sps[2]) // constraint flags
+		w.u8(m.sps[3]) // level_idc
+		w.u8(0xFF)     // lengthSizeMinusOne = 3
+		w.u8(0xE1)     // 1 个 SPS
+		w.u16(uint16(len(m.sps)))
+		w.bytes(m.sps)
+		w.u8(1)
+		w.u16(uint16(len(m.pps)))
+		w.bytes(m.pps)
+	})
+}
+
+func (m *Writer) writeHvcC(w *boxWriter, info comm.SPSInfo) {
+	// SPS RBSP: 2 字节 NAL 头 + 1 字节 (vps_id, max_sub_layers, nesting)，随后 12 字节 general profile_tier_level
+	ptl := comm.RemoveEmulationPreventionBytes(m.sps)[3:15]
+	w.box("hvcC", func() {
+		w.u8(1)
+		w.bytes(ptl[:11]) // profile_space/tier/profile_idc, compatibility flags, constraint flags
+		w.u8(ptl[11])     // level_idc
+		w.u16(0xF000)     // min_spatial_segmentation_idc
+		w.u8(0xFC)        // parallelismType
+		w.u8(0xFC | uint8(info.ChromaFormat&0x03))
+		w.u8(0xF8) // bit_depth_luma_minus8
+		w.u8(0xF8) // bit_depth_chroma_minus8
+		w.u16(0)   // avgFrameRate
+		w.u8(0x0F) // numTemporalLayers = 1, temporalIdNested = 1, lengthSizeMinusOne = 3
+		w.u8(3)    // numOfArrays
+		for _, nal := range [][]byte{m.vps, m.sps, m.pps} {
+			w.u8(0x80 | (nal[0]>>1)&0x3F) // array_completeness
+			w.u16(1)
+			w.u16(uint16(len(nal)))
+			w.bytes(nal)
+		}
+	})
+}
+
+func (m *Writer) writeAudioTrak(w *boxWriter) {
+	w.box("trak", func() {
+		writeTkhd(w, audioTrackID, 0x0100, 0, 0)
+		w.box("mdia", func() {
+			writeMdhd(w, audioTimescale)
+			writeHdlr(w, "soun", "SoundHandler")
+			w.box("minf", func() {
+				w.fullBox("smhd", 0, 0, func() { w.u32(0) })
+				writeDinf(w)
+				w.box("stbl", func() {
+					w.fullBox("stsd", 0, 0, func() {
+						w.u32(1)
+						w.box("Opus", func() {
+							w.zeros(6)
+							w.u16(1) // data_reference_index
+							w.zeros(8)
+							w.u16(2)  // channelcount
+							w.u16(16) // samplesize
+							w.u32(0)
+							w.u32(audioTimescale << 16)
+							// OpusSpecificBox，见 Encapsulation of Opus in ISO Base Media File Format
+							w.box("dOps", func() {
+								w.u8(0)
+								w.u8(2)  // OutputChannelCount
+								w.u16(0) // PreSkip，流不是从编码器起点开始录制，不裁剪
+								w.u32(audioTimescale)
+								w.u16(0) // OutputGain
+								w.u8(0)  // ChannelMappingFamily
+							})
+						})
+					})
+					writeEmptySampleTables(w)
+				})
+			})
+		})
+	})
+}
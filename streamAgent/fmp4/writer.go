@@ -0,0 +1,364 @@
+package fmp4
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"webscreen/sdriver/comm"
+)
+
+const (
+	videoTrackID   = 1
+	audioTrackID   = 2
+	videoTimescale = 90000
+	audioTimescale = 48000
+
+	// 分片时长达到 fragmentDuration 后在下一个关键帧处切分；
+	// 画面静止时驱动可能很久不出关键帧，超过 maxFragmentDuration 直接切分
+	fragmentDuration    = 1 * videoTimescale
+	maxFragmentDuration = 4 * videoTimescale
+	// 音频时间戳与按包时长推算的时间相差超过 100ms 时开新分片重新对齐（例如暂停之后）
+	audioResyncThreshold = audioTimescale / 10
+
+	sampleFlagsKey    = 0x02000000 // sample_depends_on = 2
+	sampleFlagsNonKey = 0x01010000 // sample_depends_on = 1, sample_is_non_sync_sample
+)
+
+var ErrUnsupportedCodec = errors.New("fmp4: unsupported codec")
+
+type sample struct {
+	data     []byte
+	time     uint64 // track timescale
+	duration uint32
+	key      bool
+}
+
+// Writer 把 H.264/H.265 Annex B 视频和 Opus 音频封装成 fragmented MP4，不做转码。
+// 第一个带参数集的关键帧到来之前的数据都会被丢弃；参数集在每个关键帧前带内重复
+// （avc3/hev1），所以中途分辨率变化也能正确解码。
+//
+// Writer 不是并发安全的。时间戳单位为微秒，由调用方保证音视频使用同一基准。
+type Writer struct {
+	w          io.Writer
+	videoCodec string
+	hasAudio   bool
+	err        error
+
+	vps, sps, pps []byte
+	initDone      bool
+
+	pendingNALs  [][]byte // 还没有归属到帧的非 VCL NAL（参数集、SEI）
+	held         *sample  // 最后一帧视频，下一帧到来后才能确定时长
+	lastDuration uint32
+
+	video     []sample
+	audio     []sample
+	audioNext uint64
+	seq       uint32
+}
+
+// SupportsVideoCodec 返回 NewWriter 是否能写入该视频编码
+func SupportsVideoCodec(videoCodec string) bool {
+	return videoCodec == "h264" || videoCodec == "h265"
+}
+
+// NewWriter videoCodec 为 "h264" 或 "h265"；hasAudio 为 true 时额外写入一条 Opus 音轨
+func NewWriter(w io.Writer, videoCodec string, hasAudio bool) (*Writer, error) {
+	if !SupportsVideoCodec(videoCodec) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, videoCodec)
+	}
+	return &Writer{
+		w:            w,
+		videoCodec:   videoCodec,
+		hasAudio:     hasAudio,
+		lastDuration: videoTimescale / 30,
+	}, nil
+}
+
+type nalKind int
+
+const (
+	nalOther nalKind = iota
+	nalVPS
+	nalSPS
+	nalPPS
+	nalAUD
+	nalVCL
+	nalKey
+)
+
+func (m *Writer) classify(nal []byte) nalKind {
+	if m.videoCodec == "h265" {
+		if len(nal) < 2 {
+			return nalOther
+		}
+		switch t := (nal[0] >> 1) & 0x3F; {
+		case t == 32:
+			return nalVPS
+		case t == 33:
+			return nalSPS
+		case t == 34:
+			return nalPPS
+		case t == 35:
+			return nalAUD
+		case t >= 16 && t <= 21:
+			return nalKey
+		case t < 32:
+			return nalVCL
+		}
+		return nalOther
+	}
+	switch nal[0] & 0x1F {
+	case 7:
+		return nalSPS
+	case 8:
+		return nalPPS
+	case 9:
+		return nalAUD
+	case 5:
+		return nalKey
+	case 1, 2, 3, 4:
+		return nalVCL
+	}
+	return nalOther
+}
+
+func splitNALs(data []byte) [][]byte {
+	if !bytes.HasPrefix(data, []byte{0, 0, 1}) && !bytes.HasPrefix(data, []byte{0, 0, 0, 1}) {
+		// 不带起始码时整段是一个 NAL，后面仍可能用起始码拼接了其他 NAL
+		data = append([]byte{0, 0, 0, 1}, data...)
+	}
+	return comm.SplitAnnexB(data)
+}
+
+// WriteVideoConfig 只接收数据里的参数集和 SEI，用于驱动发出的 NoDuration 包
+// （单独的 SPS/PPS，或重复发送的缓存关键帧）
+func (m *Writer) WriteVideoConfig(data []byte) error {
+	m.writeVideo(data, 0, true)
+	return m.err
+}
+
+// WriteVideo 写入一个访问单元（或其中的部分 slice），pts 单位微秒
+func (m *Writer) WriteVideo(data []byte, pts uint64) error {
+	m.writeVideo(data, pts, false)
+	return m.err
+}
+
+func (m *Writer) writeVideo(data []byte, pts uint64, configOnly bool) {
+	if m.err != nil {
+		return
+	}
+	var frame [][]byte
+	key := false
+	for _, nal := range splitNALs(data) {
+		if len(nal) == 0 {
+			continue
+		}
+		switch m.classify(nal) {
+		case nalVPS:
+			m.vps = bytes.Clone(nal)
+			m.pendingNALs = append(m.pendingNALs, m.vps)
+		case nalSPS:
+			m.sps = bytes.Clone(nal)
+			m.pendingNALs = append(m.pendingNALs, m.sps)
+		case nalPPS:
+			m.pps = bytes.Clone(nal)
+			m.pendingNALs = append(m.pendingNALs, m.pps)
+		case nalAUD:
+		case nalKey:
+			key = true
+			frame = append(frame, nal)
+		case nalVCL:
+			frame = append(frame, nal)
+		default:
+			m.pendingNALs = append(m.pendingNALs, bytes.Clone(nal))
+		}
+	}
+	if configOnly || len(frame) == 0 {
+		return
+	}
+
+	t := pts * videoTimescale / 1e6
+	// 同一时间戳的多个 slice 属于同一帧
+	if m.held != nil && m.held.time == t {
+		m.held.data = appendNALs(m.held.data, frame)
+		m.held.key = m.held.key || key
+		return
+	}
+	if !m.initDone {
+		if !key || m.sps == nil || m.pps == nil || (m.videoCodec == "h265" && m.vps == nil) {
+			m.pendingNALs = nil
+			return
+		}
+		if m.err = m.writeInit(); m.err != nil {
+			return
+		}
+		m.initDone = true
+	}
+
+	s := &sample{time: t, key: key}
+	if key && !m.hasParameterSets(m.pendingNALs) {
+		s.data = appendNALs(s.data, m.parameterSets())
+	}
+	s.data = appendNALs(s.data, m.pendingNALs)
+	s.data = appendNALs(s.data, frame)
+	m.pendingNALs = nil
+
+	if m.held != nil {
+		// 时间戳回退时沿用上一帧时长，保证解码时间单调递增
+		if t > m.held.time {
+			m.lastDuration = uint32(t - m.held.time)
+		} else {
+			s.time = m.held.time + uint64(m.lastDuration)
+		}
+		m.held.duration = m.lastDuration
+		m.addVideo(*m.held)
+	}
+	m.held = s
+}
+
+func (m *Writer) hasParameterSets(nals [][]byte) bool {
+	for _, nal := range nals {
+		if k := m.classify(nal); k == nalSPS {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Writer) parameterSets() [][]byte {
+	if m.videoCodec == "h265" {
+		return [][]byte{m.vps, m.sps, m.pps}
+	}
+	return [][]byte{m.sps, m.pps}
+}
+
+// appendNALs 以 4 字节长度前缀写入 NAL（AVCC/HVCC 格式）
+func appendNALs(dst []byte, nals [][]byte) []byte {
+	for _, nal := range nals {
+		dst = append(dst, byte(len(nal)>>24), byte(len(nal)>>16), byte(len(nal)>>8), byte(len(nal)))
+		dst = append(dst, nal...)
+	}
+	return dst
+}
+
+func (m *Writer) addVideo(s sample) {
+	if len(m.video) > 0 {
+		elapsed := s.time - m.video[0].time
+		if (s.key && elapsed >= fragmentDuration) || elapsed >= maxFragmentDuration {
+			m.flush()
+		}
+	}
+	m.video = append(m.video, s)
+}
+
+// WriteAudio 写入一个 Opus 包，pts 单位微秒。视频初始化之前的音频会被丢弃。
+func (m *Writer) WriteAudio(data []byte, pts uint64) error {
+	if m.err != nil || !m.hasAudio || !m.initDone {
+		return m.err
+	}
+	// scrcpy 的第一个音频包是编码器配置（OpusHead），不是音频数据
+	if bytes.HasPrefix(data, []byte("OpusHead")) || bytes.HasPrefix(data, []byte("AOPUSHDR")) {
+		return nil
+	}
+	samples := comm.OpusPacketSamples(data)
+	if samples == 0 {
+		return nil
+	}
+	t := pts * audioTimescale / 1e6
+	if len(m.audio) > 0 {
+		drift := int64(t) - int64(m.audioNext)
+		if drift > audioResyncThreshold || drift < -audioResyncThreshold {
+			m.flush()
+		}
+	}
+	if len(m.audio) > 0 {
+		t = m.audioNext
+	}
+	m.audio = append(m.audio, sample{data: bytes.Clone(data), time: t, duration: uint32(samples), key: true})
+	m.audioNext = t + uint64(samples)
+	if (t-m.audio[0].time)*videoTimescale/audioTimescale >= maxFragmentDuration {
+		m.flush()
+	}
+	return m.err
+}
+
+// Close 写出最后一个分片，不会关闭底层的 io.Writer
+func (m *Writer) Close() error {
+	if m.held != nil && m.err == nil {
+		m.held.duration = m.lastDuration
+		m.video = append(m.video, *m.held)
+		m.held = nil
+	}
+	m.flush()
+	return m.err
+}
+
+func (m *Writer) write(b []byte) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = m.w.Write(b)
+}
+
+func (m *Writer) flush() {
+	if m.err != nil || (len(m.video) == 0 && len(m.audio) == 0) {
+		return
+	}
+	m.seq++
+	// 先按 data_offset 为 0 计算 moof 大小，再回填真实偏移
+	moof := m.buildMoof(0)
+	moof = m.buildMoof(uint32(len(moof)) + 8)
+
+	mdat := &boxWriter{}
+	mdat.box("mdat", func() {
+		for _, s := range m.video {
+			mdat.bytes(s.data)
+		}
+		for _, s := range m.audio {
+			mdat.bytes(s.data)
+		}
+	})
+	m.write(moof)
+	m.write(mdat.buf)
+	m.video = m.video[:0]
+	m.audio = m.audio[:0]
+}
+
+func (m *Writer) buildMoof(dataOffset uint32) []byte {
+	w := &boxWriter{}
+	w.box("moof", func() {
+		w.fullBox("mfhd", 0, 0, func() { w.u32(m.seq) })
+		offset := dataOffset
+		for _, t := range []struct {
+			id      uint32
+			samples []sample
+		}{{videoTrackID, m.video}, {audioTrackID, m.audio}} {
+			if len(t.samples) == 0 {
+				continue
+			}
+			w.box("traf", func() {
+				// default-base-is-moof
+				w.fullBox("tfhd", 0, 0x020000, func() { w.u32(t.id) })
+				w.fullBox("tfdt", 1, 0, func() { w.u64(t.samples[0].time) })
+				// data-offset, sample-duration, sample-size, sample-flags
+				w.fullBox("trun", 0, 0x000701, func() {
+					w.u32(uint32(len(t.samples)))
+					w.u32(offset)
+					for _, s := range t.samples {
+						w.u32(s.duration)
+						w.u32(uint32(len(s.data)))
+						if s.key {
+							w.u32(sampleFlagsKey)
+						} else {
+							w.u32(sampleFlagsNonKey)
+						}
+						offset += uint32(len(s.data))
+					}
+				})
+			})
+		}
+	})
+	return w.buf
+}
@@ -0,0 +1,337 @@
+package sagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+	"webscreen/sdriver"
+)
+
+// MacroVersion 宏文件格式版本，格式不兼容时递增
+const MacroVersion = 1
+
+// macroMinLoopInterval 循环回放时每一轮至少持续的时间，避免时长为 0 的宏空转占满 CPU
+const macroMinLoopInterval = 100 * time.Millisecond
+
+var (
+	ErrMacroRecording    = errors.New("macro recording already in progress")
+	ErrMacroNotRecording = errors.New("no macro recording in progress")
+	ErrMacroPlaying      = errors.New("macro playback already in progress")
+)
+
+// Macro 是一段录制下来的控制事件流。
+// 坐标类事件的位置基于录制时的画面尺寸 Width×Height，回放时按目标设备的画面尺寸缩放。
+type Macro struct {
+	Version    int          `json:"version"`
+	DeviceType string       `json:"device_type"`
+	Width      uint32       `json:"width"`
+	Height     uint32       `json:"height"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Duration   int64        `json:"duration_ms"`
+	Events     []MacroEvent `json:"events"`
+}
+
+// MacroEvent 一条事件，T 为相对录制开始的毫秒数，Data 为对应 sdriver 事件结构体的 JSON
+type MacroEvent struct {
+	T    int64             `json:"t"`
+	Type sdriver.EventType `json:"type"`
+	Data json.RawMessage   `json:"data,omitempty"`
+}
+
+// MacroPlayOptions 回放参数
+type MacroPlayOptions struct {
+	// Speed 播放倍速，<= 0 时按 1 处理
+	Speed float64 `json:"speed"`
+	// Loops 播放次数，0 表示一直循环直到 StopMacro
+	Loops int `json:"loops"`
+}
+
+// ReadMacro 读取并校验宏文件
+func ReadMacro(r io.Reader) (*Macro, error) {
+	var m Macro
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid macro file: %v", err)
+	}
+	if m.Version != MacroVersion {
+		return nil, fmt.Errorf("unsupported macro version %d, expected %d", m.Version, MacroVersion)
+	}
+	for i, e := range m.Events {
+		if _, err := e.Event(); err != nil {
+			return nil, fmt.Errorf("macro event %d: %v", i, err)
+		}
+	}
+	return &m, nil
+}
+
+// WriteTo 以 JSON 写出宏文件
+func (m *Macro) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// MacroRecordOptions 录制参数
+type MacroRecordOptions struct {
+	// Clipboard 是否记录设置剪贴板的内容。剪贴板里可能是密码，默认不写入宏文件
+	Clipboard bool `json:"clipboard"`
+}
+
+// newMacroEvent 只记录会发给驱动的输入事件，IDR 请求等不进入宏
+func newMacroEvent(t int64, event sdriver.Event, opts MacroRecordOptions) (MacroEvent, bool) {
+	switch event.(type) {
+	case *sdriver.TouchEvent, *sdriver.MouseEvent, *sdriver.KeyEvent, *sdriver.ScrollEvent,
+		*sdriver.RotateEvent, *sdriver.GetClipboardEvent,
+		*sdriver.UHIDCreateEvent, *sdriver.UHIDInputEvent, *sdriver.UHIDDestroyEvent:
+	case *sdriver.SetClipboardEvent:
+		if !opts.Clipboard {
+			return MacroEvent{}, false
+		}
+	default:
+		return MacroEvent{}, false
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[macro] Failed to encode event %T: %v", event, err)
+		return MacroEvent{}, false
+	}
+	return MacroEvent{T: t, Type: event.Type(), Data: data}, true
+}
+
+// Event 还原为驱动 SendEvent 接受的事件（与 parseEvent 一样返回指针）
+func (e MacroEvent) Event() (sdriver.Event, error) {
+	var event sdriver.Event
+	switch e.Type {
+	case sdriver.EVENT_TYPE_TOUCH:
+		event = &sdriver.TouchEvent{}
+	case sdriver.EVENT_TYPE_MOUSE:
+		event = &sdriver.MouseEvent{}
+	case sdriver.EVENT_TYPE_KEY:
+		event = &sdriver.KeyEvent{}
+	case sdriver.EVENT_TYPE_SCROLL:
+		event = &sdriver.ScrollEvent{}
+	case sdriver.EVENT_TYPE_ROTATE:
+		return &sdriver.RotateEvent{}, nil
+	case sdriver.EVENT_TYPE_GET_CLIPBOARD:
+		event = &sdriver.GetClipboardEvent{}
+	case sdriver.EVENT_TYPE_SET_CLIPBOARD:
+		event = &sdriver.SetClipboardEvent{}
+	case sdriver.EVENT_TYPE_UHID_CREATE:
+		event = &sdriver.UHIDCreateEvent{}
+	case sdriver.EVENT_TYPE_UHID_INPUT:
+		event = &sdriver.UHIDInputEvent{}
+	case sdriver.EVENT_TYPE_UHID_DESTROY:
+		event = &sdriver.UHIDDestroyEvent{}
+	default:
+		return nil, fmt.Errorf("unsupported event type: %d", e.Type)
+	}
+	if err := json.Unmarshal(e.Data, event); err != nil {
+		return nil, fmt.Errorf("invalid %d event data: %v", e.Type, err)
+	}
+	return event, nil
+}
+
+// scaleMacroEvent 把录制时的坐标换算到当前画面尺寸
+func scaleMacroEvent(event sdriver.Event, from, to sdriver.MediaMeta) {
+	if from.Width == 0 || from.Height == 0 || to.Width == 0 || to.Height == 0 {
+		return
+	}
+	sx := func(v uint32) uint32 { return uint32(uint64(v) * uint64(to.Width) / uint64(from.Width)) }
+	sy := func(v uint32) uint32 { return uint32(uint64(v) * uint64(to.Height) / uint64(from.Height)) }
+	switch e := event.(type) {
+	case *sdriver.TouchEvent:
+		e.PosX, e.PosY = sx(e.PosX), sy(e.PosY)
+		e.Width, e.Height = uint16(to.Width), uint16(to.Height)
+	case *sdriver.ScrollEvent:
+		e.PosX, e.PosY = sx(e.PosX), sy(e.PosY)
+		e.Width, e.Height = uint16(to.Width), uint16(to.Height)
+	case *sdriver.MouseEvent:
+		e.PosX, e.PosY = sx(e.PosX), sy(e.PosY)
+	}
+}
+
+type macroRecorder struct {
+	start  time.Time
+	opts   MacroRecordOptions
+	macro  *Macro
+	events []MacroEvent
+}
+
+// StartMacroRecording 开始录制之后经过 HandleEvent 的输入事件
+func (sa *Agent) StartMacroRecording(opts MacroRecordOptions) error {
+	if !sa.driverCaps.CanControl {
+		return fmt.Errorf("driver does not support control events")
+	}
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	if sa.macroRec != nil {
+		return ErrMacroRecording
+	}
+	meta := sa.driver.MediaMeta()
+	sa.macroRec = &macroRecorder{
+		start: time.Now(),
+		opts:  opts,
+		macro: &Macro{
+			Version:    MacroVersion,
+			DeviceType: sa.config.DeviceType,
+			Width:      meta.Width,
+			Height:     meta.Height,
+			CreatedAt:  time.Now(),
+		},
+	}
+	log.Printf("[macro] Start recording on device %s, clipboard: %v", sa.config.DeviceID, opts.Clipboard)
+	return nil
+}
+
+// StopMacroRecording 结束录制并返回宏
+func (sa *Agent) StopMacroRecording() (*Macro, error) {
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	rec := sa.macroRec
+	if rec == nil {
+		return nil, ErrMacroNotRecording
+	}
+	sa.macroRec = nil
+	m := rec.macro
+	m.Events = rec.events
+	m.Duration = time.Since(rec.start).Milliseconds()
+	log.Printf("[macro] Stop recording on device %s, %d events", sa.config.DeviceID, len(m.Events))
+	return m, nil
+}
+
+func (sa *Agent) MacroRecording() bool {
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	return sa.macroRec != nil
+}
+
+func (sa *Agent) recordMacroEvent(event sdriver.Event) {
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	if sa.macroRec == nil {
+		return
+	}
+	if e, ok := newMacroEvent(time.Since(sa.macroRec.start).Milliseconds(), event, sa.macroRec.opts); ok {
+		sa.macroRec.events = append(sa.macroRec.events, e)
+	}
+}
+
+// PlayMacro 在后台回放宏，事件直接交给驱动的 SendEvent。
+// 宏必须来自同类型的设备；同一时间每个 Agent 只能回放一个宏。
+func (sa *Agent) PlayMacro(m *Macro, opts MacroPlayOptions) error {
+	if !sa.driverCaps.CanControl {
+		return fmt.Errorf("driver does not support control events")
+	}
+	if len(m.Events) == 0 {
+		return fmt.Errorf("macro has no events")
+	}
+	if m.DeviceType != sa.config.DeviceType {
+		return fmt.Errorf("macro was recorded on %s, cannot play on %s", m.DeviceType, sa.config.DeviceType)
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	if sa.macroCancel != nil {
+		return ErrMacroPlaying
+	}
+	sa.stateMu.Lock()
+	closed := sa.closed
+	sa.stateMu.Unlock()
+	if closed {
+		return fmt.Errorf("agent is closed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	sa.macroCancel = cancel
+	sa.macroDone = done
+	go func() {
+		defer func() {
+			sa.macroMu.Lock()
+			sa.macroCancel = nil
+			sa.macroDone = nil
+			sa.macroMu.Unlock()
+			cancel()
+			close(done)
+		}()
+		err := sa.playMacro(ctx, m, opts)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("[macro] Playback on device %s failed: %v", sa.config.DeviceID, err)
+			sa.notify(fmt.Sprintf("Macro playback failed: %v", err))
+			return
+		}
+		log.Printf("[macro] Playback on device %s finished", sa.config.DeviceID)
+	}()
+	return nil
+}
+
+// StopMacro 停止正在进行的回放，返回时回放协程已经退出，不会再调用驱动
+func (sa *Agent) StopMacro() {
+	// 回放协程退出时要获取 macroMu，不能持有它等待
+	sa.macroMu.Lock()
+	cancel, done := sa.macroCancel, sa.macroDone
+	sa.macroMu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (sa *Agent) MacroPlaying() bool {
+	sa.macroMu.Lock()
+	defer sa.macroMu.Unlock()
+	return sa.macroCancel != nil
+}
+
+func (sa *Agent) playMacro(ctx context.Context, m *Macro, opts MacroPlayOptions) error {
+	from := sdriver.MediaMeta{Width: m.Width, Height: m.Height}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	log.Printf("[macro] Playing %d events on device %s, speed %.2f, loops %d", len(m.Events), sa.config.DeviceID, opts.Speed, opts.Loops)
+	for loop := 0; opts.Loops == 0 || loop < opts.Loops; loop++ {
+		start := time.Now()
+		for _, e := range m.Events {
+			event, err := e.Event()
+			if err != nil {
+				return err
+			}
+			wait := time.Until(start.Add(time.Duration(float64(e.T) / opts.Speed * float64(time.Millisecond))))
+			if wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			} else if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// 每条事件都取当前尺寸，回放过程中旋转屏幕也能对上
+			scaleMacroEvent(event, from, sa.driver.MediaMeta())
+			if err := sa.driver.SendEvent(event); err != nil {
+				return err
+			}
+		}
+		// 保留录制结尾的停顿，循环时节奏与录制一致；每轮不少于 macroMinLoopInterval
+		loopTime := max(time.Duration(float64(m.Duration)/opts.Speed*float64(time.Millisecond)), macroMinLoopInterval)
+		if wait := time.Until(start.Add(loopTime)); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
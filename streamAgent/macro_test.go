@@ -0,0 +1,110 @@
+package sagent
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"webscreen/sdriver"
+)
+
+// fakeDriver 记录 SendEvent 的调用，Stop 之后再收到事件视为错误
+type fakeDriver struct {
+	mu          sync.Mutex
+	stopped     bool
+	events      int
+	afterStop   int
+	firstEvent  chan struct{}
+	controlChan chan sdriver.Event
+}
+
+func newFakeDriver() *fakeDriver {
+	return &fakeDriver{
+		firstEvent:  make(chan struct{}),
+		controlChan: make(chan sdriver.Event, 10),
+	}
+}
+
+func (d *fakeDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVBox, chan sdriver.Event) {
+	return nil, nil, d.controlChan
+}
+
+func (d *fakeDriver) SendEvent(event sdriver.Event) error {
+	// 模拟驱动写连接的耗时，放大与 Stop 的竞争窗口
+	time.Sleep(time.Millisecond)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		d.afterStop++
+	}
+	d.events++
+	if d.events == 1 {
+		close(d.firstEvent)
+	}
+	return nil
+}
+
+func (d *fakeDriver) Start()                     {}
+func (d *fakeDriver) Pause()                     {}
+func (d *fakeDriver) Resume()                    {}
+func (d *fakeDriver) RequestIDR(firstFrame bool) {}
+func (d *fakeDriver) Capabilities() sdriver.DriverCaps {
+	return sdriver.DriverCaps{CanControl: true}
+}
+func (d *fakeDriver) MediaMeta() sdriver.MediaMeta {
+	return sdriver.MediaMeta{Width: 1080, Height: 1920}
+}
+func (d *fakeDriver) ConfigDescription() []sdriver.ConfigParamDescription { return nil }
+func (d *fakeDriver) UpdateDriverConfig(config map[string]string) error   { return nil }
+
+func (d *fakeDriver) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+}
+
+func newFakeAgent(d *fakeDriver) *Agent {
+	return &Agent{
+		driver:     d,
+		driverCaps: d.Capabilities(),
+		config:     AgentConfig{DeviceType: "fake", DeviceID: "fake-1"},
+		controlCh:  d.controlChan,
+	}
+}
+
+func TestCloseDuringMacroPlayback(t *testing.T) {
+	d := newFakeDriver()
+	sa := newFakeAgent(d)
+
+	e, ok := newMacroEvent(0, &sdriver.KeyEvent{Action: 0, KeyCode: 4}, MacroRecordOptions{})
+	if !ok {
+		t.Fatal("key event was not recorded")
+	}
+	m := &Macro{Version: MacroVersion, DeviceType: "fake", Width: 1080, Height: 1920}
+	for range 1000 {
+		m.Events = append(m.Events, e)
+	}
+	if err := sa.PlayMacro(m, MacroPlayOptions{Speed: 1}); err != nil {
+		t.Fatalf("PlayMacro: %v", err)
+	}
+	select {
+	case <-d.firstEvent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback did not start")
+	}
+
+	sa.Close()
+	if sa.MacroPlaying() {
+		t.Error("macro still playing after Close")
+	}
+	// 给可能残留的回放协程留出时间
+	time.Sleep(20 * time.Millisecond)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.afterStop > 0 {
+		t.Errorf("SendEvent called %d times after the driver was stopped", d.afterStop)
+	}
+	if err := sa.PlayMacro(m, MacroPlayOptions{}); err == nil {
+		t.Error("PlayMacro succeeded on a closed agent")
+	}
+}
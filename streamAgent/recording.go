@@ -0,0 +1,197 @@
+package sagent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+	"webscreen/sdriver"
+	"webscreen/streamAgent/fmp4"
+)
+
+var (
+	ErrRecording    = errors.New("recording already in progress")
+	ErrNotRecording = errors.New("no recording in progress")
+)
+
+// mediaRecording 把驱动输出的 AVBox 旁路写入 fragmented MP4。
+// ServeVideoStream/ServeAudioStream 只做拷贝和非阻塞投递，磁盘写入在单独的协程里完成。
+type mediaRecording struct {
+	path  string
+	file  *os.File
+	mux   *fmp4.Writer
+	start time.Time
+	ch    chan recordedBox
+	done  chan struct{}
+	err   error
+
+	dropped atomic.Int64
+	video   trackClock
+	audio   trackClock
+}
+
+type recordedBox struct {
+	audio      bool
+	noDuration bool
+	data       []byte
+	pts        uint64
+	arrival    time.Time
+}
+
+// trackClock 把驱动的 PTS 换算到录制时间线：第一包按到达时间对齐，之后按 PTS 差值推进。
+// 音视频 PTS 的基准可能不同，各自对齐到录制开始时间即可。
+type trackClock struct {
+	init   bool
+	offset int64
+	last   uint64
+}
+
+func (c *trackClock) timestamp(pts uint64, arrival, start time.Time) uint64 {
+	if !c.init {
+		c.init = true
+		c.offset = arrival.Sub(start).Microseconds() - int64(pts)
+	}
+	t := int64(pts) + c.offset
+	if t < 0 {
+		t = 0
+	}
+	if uint64(t) < c.last {
+		t = int64(c.last)
+	}
+	c.last = uint64(t)
+	return c.last
+}
+
+// StartRecording 开始把当前会话的音视频写入 path，视频从下一个关键帧开始。
+// 视频编码不是 H.264/H.265（例如 AV1）时返回 sdriver.ErrNotSupported，不创建文件。
+func (sa *Agent) StartRecording(path string) error {
+	meta := sa.driver.MediaMeta()
+	if !fmp4.SupportsVideoCodec(meta.VideoCodec) {
+		return fmt.Errorf("recording %s video: %w", meta.VideoCodec, sdriver.ErrNotSupported)
+	}
+	sa.recMu.Lock()
+	defer sa.recMu.Unlock()
+	if sa.rec != nil {
+		return ErrRecording
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	hasAudio := sa.driverCaps.CanAudio && meta.AudioCodec == "opus"
+	mux, err := fmp4.NewWriter(file, meta.VideoCodec, hasAudio)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	rec := &mediaRecording{
+		path:  path,
+		file:  file,
+		mux:   mux,
+		start: time.Now(),
+		ch:    make(chan recordedBox, 256),
+		done:  make(chan struct{}),
+	}
+	sa.rec = rec
+	go rec.run()
+	log.Printf("[recording] Start recording device %s to %s (video %s, audio %v)", sa.config.DeviceID, path, meta.VideoCodec, hasAudio)
+	// 录制从关键帧开始，主动请求一个，免得等到下一个 GOP
+	if !sa.Paused() {
+		sa.driver.RequestIDR(false)
+	}
+	return nil
+}
+
+// StopRecording 结束录制并返回文件路径
+func (sa *Agent) StopRecording() (string, error) {
+	sa.recMu.Lock()
+	rec := sa.rec
+	sa.rec = nil
+	if rec != nil {
+		close(rec.ch)
+	}
+	sa.recMu.Unlock()
+	if rec == nil {
+		return "", ErrNotRecording
+	}
+	<-rec.done
+	log.Printf("[recording] Stop recording device %s: %s", sa.config.DeviceID, rec.path)
+	if dropped := rec.dropped.Load(); dropped > 0 {
+		log.Printf("[recording] %d packets dropped, disk too slow", dropped)
+	}
+	return rec.path, rec.err
+}
+
+// RecordingPath 返回正在录制的文件路径
+func (sa *Agent) RecordingPath() (string, bool) {
+	sa.recMu.RLock()
+	defer sa.recMu.RUnlock()
+	if sa.rec == nil {
+		return "", false
+	}
+	return sa.rec.path, true
+}
+
+// recordBox 把驱动输出的包交给录制和即时回放缓冲
+func (sa *Agent) recordBox(box sdriver.AVBox, audio bool) {
+	sa.recMu.RLock()
+	defer sa.recMu.RUnlock()
+	if sa.rec == nil && sa.replay == nil {
+		return
+	}
+	// 驱动会复用 AVBox.Data 的内存，必须拷贝
+	rb := recordedBox{
+		audio:      audio,
+		noDuration: box.NoDuration,
+		data:       append([]byte(nil), box.Data...),
+		pts:        box.PTS,
+		arrival:    time.Now(),
+	}
+	if sa.replay != nil {
+		sa.replay.add(rb)
+	}
+	if sa.rec == nil {
+		return
+	}
+	select {
+	case sa.rec.ch <- rb:
+	default:
+		sa.rec.dropped.Add(1)
+	}
+}
+
+func writeRecordedBox(mux *fmp4.Writer, box recordedBox, video, audio *trackClock, start time.Time) error {
+	switch {
+	case box.audio:
+		return mux.WriteAudio(box.data, audio.timestamp(box.pts, box.arrival, start))
+	case box.noDuration:
+		return mux.WriteVideoConfig(box.data)
+	default:
+		return mux.WriteVideo(box.data, video.timestamp(box.pts, box.arrival, start))
+	}
+}
+
+func (rec *mediaRecording) run() {
+	defer close(rec.done)
+	for box := range rec.ch {
+		if rec.err != nil {
+			continue
+		}
+		rec.err = writeRecordedBox(rec.mux, box, &rec.video, &rec.audio, rec.start)
+		if rec.err != nil {
+			log.Printf("[recording] Write %s failed: %v", rec.path, rec.err)
+		}
+	}
+	if err := rec.mux.Close(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+	if err := rec.file.Close(); err != nil && rec.err == nil {
+		rec.err = err
+	}
+	if rec.err != nil {
+		rec.err = fmt.Errorf("recording %s: %w", rec.path, rec.err)
+	}
+}
@@ -0,0 +1,138 @@
+package sagent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"webscreen/sdriver/comm"
+	"webscreen/streamAgent/fmp4"
+)
+
+// 回放缓冲最多占用的内存，码率很高时按这个上限裁剪，实际时长会短于 ReplaySeconds
+const replayMaxBytes = 128 << 20
+
+var (
+	ErrReplayDisabled = errors.New("instant replay is disabled for this session")
+	ErrReplayEmpty    = errors.New("instant replay buffer has no keyframe yet")
+)
+
+// replayBuffer 保存最近一段时间的音视频，按 GOP 对齐：每个 gop 都从关键帧开始，
+// 裁剪时整 GOP 丢弃，所以保存出来的片段总能从第一帧开始解码。
+type replayBuffer struct {
+	mu     sync.Mutex
+	codec  string
+	window time.Duration
+
+	gops  []*replayGOP
+	bytes int
+	// NoDuration 的参数集包先放这里，下一帧到来时再决定归入哪个 GOP
+	pending []recordedBox
+}
+
+type replayGOP struct {
+	start time.Time
+	boxes []recordedBox
+	bytes int
+}
+
+func newReplayBuffer(codec string, window time.Duration) *replayBuffer {
+	return &replayBuffer{codec: codec, window: window}
+}
+
+func (r *replayBuffer) add(box recordedBox) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case box.audio:
+		// 第一个关键帧之前的音频没有意义
+		if len(r.gops) == 0 {
+			return
+		}
+	case box.noDuration:
+		r.pending = append(r.pending, box)
+		return
+	case comm.IsKeyFrame(r.codec, box.data):
+		r.gops = append(r.gops, &replayGOP{start: box.arrival})
+	case len(r.gops) == 0:
+		r.pending = r.pending[:0]
+		return
+	}
+
+	gop := r.gops[len(r.gops)-1]
+	if !box.audio {
+		for _, p := range r.pending {
+			gop.boxes = append(gop.boxes, p)
+			gop.bytes += len(p.data)
+			r.bytes += len(p.data)
+		}
+		r.pending = r.pending[:0]
+	}
+	gop.boxes = append(gop.boxes, box)
+	gop.bytes += len(box.data)
+	r.bytes += len(box.data)
+
+	// 剩下的 GOP 仍然覆盖整个窗口时才丢弃最旧的一个
+	for len(r.gops) > 1 && (box.arrival.Sub(r.gops[1].start) >= r.window || r.bytes > replayMaxBytes) {
+		r.bytes -= r.gops[0].bytes
+		r.gops[0] = nil
+		r.gops = r.gops[1:]
+	}
+}
+
+// snapshot 返回当前缓冲的所有包，包本身不会再被修改，可以在锁外读取
+func (r *replayBuffer) snapshot() []recordedBox {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var boxes []recordedBox
+	for _, gop := range r.gops {
+		boxes = append(boxes, gop.boxes...)
+	}
+	return boxes
+}
+
+// ReplayEnabled 是否开启了即时回放缓冲
+func (sa *Agent) ReplayEnabled() bool {
+	return sa.replay != nil
+}
+
+// SaveReplay 把回放缓冲中最近的内容写入 path，返回片段时长
+func (sa *Agent) SaveReplay(path string) (time.Duration, error) {
+	if sa.replay == nil {
+		return 0, ErrReplayDisabled
+	}
+	boxes := sa.replay.snapshot()
+	if len(boxes) == 0 {
+		return 0, ErrReplayEmpty
+	}
+	meta := sa.driver.MediaMeta()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	mux, err := fmp4.NewWriter(file, sa.replay.codec, sa.driverCaps.CanAudio && meta.AudioCodec == "opus")
+	if err == nil {
+		var video, audio trackClock
+		start := boxes[0].arrival
+		for _, box := range boxes {
+			if err = writeRecordedBox(mux, box, &video, &audio, start); err != nil {
+				break
+			}
+		}
+		if closeErr := mux.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("save replay: %w", err)
+	}
+	duration := boxes[len(boxes)-1].arrival.Sub(boxes[0].arrival)
+	log.Printf("[replay] Saved %v of device %s to %s", duration.Round(time.Millisecond), sa.config.DeviceID, path)
+	return duration, nil
+}
@@ -24,6 +24,9 @@ func (sa *Agent) ServeVideoStream() {
 		payloader = &codecs.H264Payloader{}
 	case "video/H265":
 		payloader = &codecs.H265Payloader{}
+	case "video/AV1":
+		// 输入为 Low Overhead 格式的时间单元，时间分隔符 OBU 由打包器去掉
+		payloader = &codecs.AV1Payloader{}
 	default:
 		log.Printf("Unsupported video codec: %s", codec)
 		return
@@ -39,6 +42,7 @@ func (sa *Agent) ServeVideoStream() {
 	// var lastPTS uint64 = 0
 	var exactRtpTimestamp uint32 = 0
 	for vBox := range sa.videoCh {
+		sa.recordBox(vBox, false)
 		switch sa.useLocalTimestamp {
 		case true:
 			elapsedUs := time.Since(sa.startTime).Microseconds()
@@ -68,6 +72,7 @@ func (sa *Agent) ServeAudioStream() {
 	var isInit bool
 
 	for aBox := range sa.audioCh {
+		sa.recordBox(aBox, true)
 		// 计算从 Agent Start() 到现在，本地服务器流逝的真实时间
 		elapsedUs := time.Since(sa.startTime).Microseconds()
 
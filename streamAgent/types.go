@@ -1,23 +1,28 @@
 package sagent
 
+import "webscreen/sdriver"
+
 // type deviceType string
 
 const (
-	DEVICE_TYPE_SUNSHINE string = "sunshine"
-	DEVICE_TYPE_LINUX    string = "linux"
-	DEVICE_TYPE_ANDROID  string = "android"
-	DEVICE_TYPE_DUMMY    string = "dummy"
+	DEVICE_TYPE_SUNSHINE    = sdriver.DEVICE_TYPE_SUNSHINE
+	DEVICE_TYPE_LINUX       = sdriver.DEVICE_TYPE_LINUX
+	DEVICE_TYPE_ANDROID     = sdriver.DEVICE_TYPE_ANDROID
+	DEVICE_TYPE_DUMMY       = sdriver.DEVICE_TYPE_DUMMY
+	DEVICE_TYPE_TESTPATTERN = sdriver.DEVICE_TYPE_TESTPATTERN
 )
 
 type AgentConfig struct {
-	DeviceType        string            `json:"device_type"`
-	DeviceID          string            `json:"device_id"`
-	DeviceIP          string            `json:"device_ip"`
-	DevicePort        string            `json:"device_port"`
-	SDP               string            `json:"sdp"`
-	AVSync            bool              `json:"av_sync"`
-	UseLocalTimestamp bool              `json:"use_local_timestamp"`
-	DriverConfig      map[string]string `json:"driver_config"`
+	DeviceType        string `json:"device_type"`
+	DeviceID          string `json:"device_id"`
+	DeviceIP          string `json:"device_ip"`
+	DevicePort        string `json:"device_port"`
+	SDP               string `json:"sdp"`
+	AVSync            bool   `json:"av_sync"`
+	UseLocalTimestamp bool   `json:"use_local_timestamp"`
+	// 即时回放保留的秒数，0 表示关闭
+	ReplaySeconds int               `json:"replay_seconds"`
+	DriverConfig  map[string]string `json:"driver_config"`
 }
 
 type ConfigParamDescription struct {
@@ -19,48 +19,6 @@ func ExecADB(args ...string) error {
 	return cmd.Run()
 }
 
-// GetDevices returns a list of connected devices
-func GetDevices() ([]AndroidDevice, error) {
-	adbPath, err := utils.GetADBPath()
-	if err != nil {
-		return nil, err
-	}
-	cmd := exec.Command(adbPath, "devices")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, err
-	}
-
-	var adbDevices []AndroidDevice
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "List of devices attached") {
-			continue
-		}
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			switch parts[1] {
-			case "device":
-				adbDevices = append(adbDevices, AndroidDevice{
-					DeviceID: parts[0],
-					Status:   "connected",
-				})
-			case "offline":
-				adbDevices = append(adbDevices, AndroidDevice{
-					DeviceID: parts[0],
-					Status:   "offline",
-				})
-			case "unauthorized":
-				adbDevices = append(adbDevices, AndroidDevice{
-					DeviceID: parts[0],
-					Status:   "unauthorized",
-				})
-			}
-		}
-	}
-	return adbDevices, nil
-}
-
 // ConnectDevice connects to a device via TCP/IP
 func ConnectDevice(address string) error {
 	adbPath, err := utils.GetADBPath()
@@ -1,11 +1,10 @@
 package webservice
 
 import (
-	linuxDriver "webscreen/sdriver/linux"
-	"webscreen/sdriver/scrcpy"
+	"errors"
+	"webscreen/sdriver"
 	sagent "webscreen/streamAgent"
 	"webscreen/webservice/android"
-	"webscreen/webservice/linux"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,32 +13,7 @@ func (wm *WebMaster) handleListDevices(c *gin.Context) {
 	wm.devicesDiscoveredMu.RLock()
 	defer wm.devicesDiscoveredMu.RUnlock()
 
-	var devicesInfo []DeviceInfo
-	devices, err := android.GetDevices()
-	for _, d := range devices {
-		devicesInfo = append(devicesInfo, DeviceInfo{
-			Type:     d.GetType(),
-			DeviceID: d.GetDeviceID(),
-			IP:       d.GetIP(),
-			Port:     d.GetPort(),
-			Status:   d.GetStatus(),
-		})
-	}
-	linuxDevices, err := linux.GetDevices()
-	for _, d := range linuxDevices {
-		devicesInfo = append(devicesInfo, DeviceInfo{
-			Type:     d.GetType(),
-			DeviceID: d.GetDeviceID(),
-			IP:       d.GetIP(),
-			Port:     d.GetPort(),
-			Status:   d.GetStatus(),
-		})
-	}
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
-	}
-
+	devicesInfo := sdriver.ListDevices()
 	c.JSON(200, gin.H{"devices": devicesInfo})
 }
 
@@ -85,6 +59,32 @@ func (wm *WebMaster) handleConnectDevice(c *gin.Context) {
 	c.JSON(200, gin.H{"status": "connected"})
 }
 
+// handleTerminateDevice 结束设备的后台会话（例如 Linux 持久桌面），并断开正在观看的浏览器
+// POST /api/device/terminate
+func (wm *WebMaster) handleTerminateDevice(c *gin.Context) {
+	var req struct {
+		DeviceType string `json:"device_type"`
+		DeviceID   string `json:"device_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.DeviceID == "" {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := sdriver.TerminateDevice(req.DeviceType, req.DeviceID); err != nil {
+		code := 500
+		switch {
+		case errors.Is(err, sdriver.ErrDeviceNotFound):
+			code = 404
+		case errors.Is(err, sdriver.ErrNotSupported):
+			code = 400
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	closed := wm.WebRTCManager.CloseDevice(req.DeviceType, req.DeviceID)
+	c.JSON(200, gin.H{"status": "terminated", "viewers": closed})
+}
+
 func (wm *WebMaster) handlePairDevice(c *gin.Context) {
 	var req struct {
 		DeviceType string `json:"device_type"`
@@ -114,19 +114,14 @@ func (wm *WebMaster) handlePairDevice(c *gin.Context) {
 func (wm *WebMaster) handleDeviceConfigDescription(c *gin.Context) {
 	dtype := c.Query("device_type")
 	id := c.Query("device_id")
-	switch dtype {
-	case sagent.DEVICE_TYPE_ANDROID:
-		desc := scrcpy.ConfigDescription(id)
-		c.JSON(200, desc)
-	case sagent.DEVICE_TYPE_LINUX:
-		desc := linuxDriver.ConfigDescription()
-		c.JSON(200, desc)
-	case "universal":
-		desc := sagent.ConfigDescription()
-		c.JSON(200, desc)
-	default:
+	if dtype == "universal" {
+		c.JSON(200, sagent.ConfigDescription())
+		return
+	}
+	reg, ok := sdriver.Lookup(dtype)
+	if !ok || reg.ConfigDescription == nil {
 		c.JSON(400, gin.H{"error": "Unsupported device type"})
 		return
 	}
-
+	c.JSON(200, reg.ConfigDescription(id))
 }
@@ -0,0 +1,260 @@
+package webservice
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	sagent "webscreen/streamAgent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 宏以 <name>.json 保存在 WebMasterConfig.MacroDir 下，name 只允许字母数字和 -_，避免路径穿越
+var macroNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type MacroInfo struct {
+	Name       string    `json:"name"`
+	DeviceType string    `json:"device_type"`
+	Width      uint32    `json:"width"`
+	Height     uint32    `json:"height"`
+	Events     int       `json:"events"`
+	Duration   int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newMacroInfo(name string, m *sagent.Macro) MacroInfo {
+	return MacroInfo{
+		Name:       name,
+		DeviceType: m.DeviceType,
+		Width:      m.Width,
+		Height:     m.Height,
+		Events:     len(m.Events),
+		Duration:   m.Duration,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func (wm *WebMaster) macroPath(name string) (string, bool) {
+	if !macroNamePattern.MatchString(name) {
+		return "", false
+	}
+	return filepath.Join(wm.config.MacroDir, name+".json"), true
+}
+
+func (wm *WebMaster) loadMacro(name string) (*sagent.Macro, error) {
+	path, ok := wm.macroPath(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sagent.ReadMacro(f)
+}
+
+func (wm *WebMaster) saveMacro(name string, m *sagent.Macro) error {
+	path, ok := wm.macroPath(name)
+	if !ok {
+		return errors.New("invalid macro name")
+	}
+	if err := os.MkdirAll(wm.config.MacroDir, 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免中途失败留下半个文件
+	tmp, err := os.CreateTemp(wm.config.MacroDir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := m.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// GET /api/macro/list
+func (wm *WebMaster) handleListMacros(c *gin.Context) {
+	entries, err := os.ReadDir(wm.config.MacroDir)
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	macros := make([]MacroInfo, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		m, err := wm.loadMacro(name)
+		if err != nil {
+			continue
+		}
+		macros = append(macros, newMacroInfo(name, m))
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	c.JSON(200, gin.H{"macros": macros})
+}
+
+// GET /api/macro/:name 下载宏文件
+func (wm *WebMaster) handleGetMacro(c *gin.Context) {
+	m, err := wm.loadMacro(c.Param("name"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(404, gin.H{"error": "Macro not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, m)
+}
+
+// PUT /api/macro/:name 上传宏文件，可以把其他机器上录制的宏导入进来
+func (wm *WebMaster) handlePutMacro(c *gin.Context) {
+	name := c.Param("name")
+	if !macroNamePattern.MatchString(name) {
+		c.JSON(400, gin.H{"error": "Invalid macro name"})
+		return
+	}
+	m, err := sagent.ReadMacro(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wm.saveMacro(name, m); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "saved", "macro": newMacroInfo(name, m)})
+}
+
+// DELETE /api/macro/:name
+func (wm *WebMaster) handleDeleteMacro(c *gin.Context) {
+	path, ok := wm.macroPath(c.Param("name"))
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid macro name"})
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(404, gin.H{"error": "Macro not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "deleted"})
+}
+
+// POST /api/session/:id/macro/record {"clipboard": true}，body 可以为空，默认不记录剪贴板内容
+func (wm *WebMaster) handleStartMacroRecording(c *gin.Context) {
+	var opts sagent.MacroRecordOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	if err := agent.StartMacroRecording(opts); err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "recording"})
+}
+
+// POST /api/session/:id/macro/save {"name": "login"} 结束录制并保存
+func (wm *WebMaster) handleStopMacroRecording(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !macroNamePattern.MatchString(req.Name) {
+		c.JSON(400, gin.H{"error": "Invalid macro name"})
+		return
+	}
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	m, err := agent.StopMacroRecording()
+	if err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err := wm.saveMacro(req.Name, m); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "saved", "macro": newMacroInfo(req.Name, m)})
+}
+
+// POST /api/session/:id/macro/play {"name": "login", "speed": 2, "loops": 3}
+func (wm *WebMaster) handlePlayMacro(c *gin.Context) {
+	var req struct {
+		Name  string  `json:"name"`
+		Speed float64 `json:"speed"`
+		Loops *int    `json:"loops"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	m, err := wm.loadMacro(req.Name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(404, gin.H{"error": "Macro not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// 不传 loops 时只播放一次，传 0 表示一直循环
+	opts := sagent.MacroPlayOptions{Speed: req.Speed, Loops: 1}
+	if req.Loops != nil {
+		if *req.Loops < 0 {
+			c.JSON(400, gin.H{"error": "Invalid loops"})
+			return
+		}
+		opts.Loops = *req.Loops
+	}
+	if err := agent.PlayMacro(m, opts); err != nil {
+		code := 400
+		if errors.Is(err, sagent.ErrMacroPlaying) {
+			code = 409
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "playing"})
+}
+
+// POST /api/session/:id/macro/stop 停止回放
+func (wm *WebMaster) handleStopMacro(c *gin.Context) {
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	agent.StopMacro()
+	c.JSON(200, gin.H{"status": "stopped"})
+}
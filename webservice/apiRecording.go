@@ -0,0 +1,240 @@
+package webservice
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"webscreen/sdriver"
+	sagent "webscreen/streamAgent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 录制文件名为 <会话 ID>_<时间>.mp4，会话 ID 中的特殊字符替换为 _，见 recordingBaseName
+var (
+	recordingNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+\.mp4$`)
+	recordingUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+type RecordingInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// 正在录制的文件，大小还在增长
+	Active bool `json:"active"`
+}
+
+func (wm *WebMaster) recordingPath(name string) (string, bool) {
+	if !recordingNamePattern.MatchString(name) || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	return filepath.Join(wm.config.RecordingDir, name), true
+}
+
+// recordingBaseName 返回新录制文件名（不含扩展名）：<会话 ID>[_<编码>]_<时间>。
+// 同一设备的多个编码组可能同时录制，指定了 ?codec= 时文件名带上编码。
+func (wm *WebMaster) recordingBaseName(c *gin.Context) string {
+	name := c.Param("id")
+	if codec := c.Query("codec"); codec != "" {
+		name += "_" + codec
+	}
+	return recordingUnsafeChars.ReplaceAllString(name, "_") + "_" + time.Now().Format("20060102-150405")
+}
+
+// activeRecordings 返回所有会话正在写入的文件名
+func (wm *WebMaster) activeRecordings() map[string]bool {
+	active := make(map[string]bool)
+	for _, s := range wm.WebRTCManager.ListSessions() {
+		if s.Recording != "" {
+			active[s.Recording] = true
+		}
+	}
+	return active
+}
+
+func (wm *WebMaster) listRecordings() ([]RecordingInfo, error) {
+	entries, err := os.ReadDir(wm.config.RecordingDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RecordingInfo{}, nil
+		}
+		return nil, err
+	}
+	active := wm.activeRecordings()
+	recordings := make([]RecordingInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !recordingNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, RecordingInfo{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+			Active:    active[entry.Name()],
+		})
+	}
+	// 最新的在前
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].CreatedAt.After(recordings[j].CreatedAt) })
+	return recordings, nil
+}
+
+// applyRecordingRetention 按 RecordingMaxFiles / RecordingMaxBytes 删除最旧的已完成录制
+func (wm *WebMaster) applyRecordingRetention() {
+	recordings, err := wm.listRecordings()
+	if err != nil {
+		log.Printf("[recording] Retention: %v", err)
+		return
+	}
+	var total int64
+	kept := 0
+	for _, r := range recordings {
+		total += r.Size
+		if r.Active {
+			continue
+		}
+		kept++
+		overFiles := wm.config.RecordingMaxFiles > 0 && kept > wm.config.RecordingMaxFiles
+		overBytes := wm.config.RecordingMaxBytes > 0 && total > wm.config.RecordingMaxBytes
+		if !overFiles && !overBytes {
+			continue
+		}
+		path, _ := wm.recordingPath(r.Name)
+		if err := os.Remove(path); err != nil {
+			log.Printf("[recording] Retention: remove %s: %v", r.Name, err)
+			continue
+		}
+		log.Printf("[recording] Retention: removed %s", r.Name)
+		total -= r.Size
+		kept--
+	}
+}
+
+// POST /api/session/:id/recording/start
+func (wm *WebMaster) handleStartRecording(c *gin.Context) {
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	if err := os.MkdirAll(wm.config.RecordingDir, 0755); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	name := wm.recordingBaseName(c) + ".mp4"
+	path, _ := wm.recordingPath(name)
+	if err := agent.StartRecording(path); err != nil {
+		code := 500
+		switch {
+		case errors.Is(err, sagent.ErrRecording) || errors.Is(err, os.ErrExist):
+			code = 409
+		case errors.Is(err, sdriver.ErrNotSupported):
+			code = 400
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "recording", "name": name})
+}
+
+// POST /api/session/:id/recording/stop
+func (wm *WebMaster) handleStopRecording(c *gin.Context) {
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	path, err := agent.StopRecording()
+	if errors.Is(err, sagent.ErrNotRecording) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	wm.applyRecordingRetention()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "stopped", "name": filepath.Base(path)})
+}
+
+// GET /api/recording/list
+func (wm *WebMaster) handleListRecordings(c *gin.Context) {
+	recordings, err := wm.listRecordings()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"recordings": recordings})
+}
+
+// GET /api/recording/:name 下载录制文件
+func (wm *WebMaster) handleDownloadRecording(c *gin.Context) {
+	name := c.Param("name")
+	path, ok := wm.recordingPath(name)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid recording name"})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(404, gin.H{"error": "Recording not found"})
+		return
+	}
+	c.FileAttachment(path, name)
+}
+
+// DELETE /api/recording/:name
+func (wm *WebMaster) handleDeleteRecording(c *gin.Context) {
+	name := c.Param("name")
+	path, ok := wm.recordingPath(name)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid recording name"})
+		return
+	}
+	if wm.activeRecordings()[name] {
+		c.JSON(409, gin.H{"error": "Recording in progress"})
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(404, gin.H{"error": "Recording not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "deleted"})
+}
+
+// POST /api/session/:id/replay/save 把即时回放缓冲保存为录制文件
+func (wm *WebMaster) handleSaveReplay(c *gin.Context) {
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	if err := os.MkdirAll(wm.config.RecordingDir, 0755); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	name := wm.recordingBaseName(c) + "_replay.mp4"
+	path, _ := wm.recordingPath(name)
+	duration, err := agent.SaveReplay(path)
+	if err != nil {
+		code := 500
+		if errors.Is(err, sagent.ErrReplayDisabled) || errors.Is(err, sagent.ErrReplayEmpty) {
+			code = 409
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	wm.applyRecordingRetention()
+	c.JSON(200, gin.H{"status": "saved", "name": name, "duration_ms": duration.Milliseconds()})
+}
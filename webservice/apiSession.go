@@ -0,0 +1,104 @@
+package webservice
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"webscreen/sdriver"
+	sagent "webscreen/streamAgent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/session/list
+func (wm *WebMaster) handleListSessions(c *gin.Context) {
+	c.JSON(200, gin.H{"sessions": wm.WebRTCManager.ListSessions()})
+}
+
+// sessionAgent 返回 :id 对应的 Agent。同一设备有多个编码组时可以用 ?codec= 指定，默认最早启动的一组
+func (wm *WebMaster) sessionAgent(c *gin.Context) (*sagent.Agent, bool) {
+	return wm.WebRTCManager.GetCodecAgent(c.Param("id"), c.Query("codec"))
+}
+
+// handleUpdateSessionConfig 修改正在运行的驱动参数，例如 {"video_bit_rate": "8M", "max_fps": 30}
+// 默认作用于设备的所有编码组，某一组失败时其他组恢复原来的值
+// POST /api/session/:id/config
+func (wm *WebMaster) handleUpdateSessionConfig(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	config, err := sagent.ParseConfigJSON(body)
+	if err != nil || len(config) == 0 {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	agents, err := wm.WebRTCManager.UpdateDeviceConfig(c.Param("id"), c.Query("codec"), config)
+	if err != nil {
+		code := 500
+		switch {
+		case errors.Is(err, errSessionNotFound):
+			c.JSON(404, gin.H{"error": "Session not found"})
+			return
+		case errors.Is(err, sdriver.ErrNotSupported):
+			code = 400
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "updated", "media_meta": agents[0].GetMediaMeta()})
+}
+
+// handlePauseSession 进入隐私模式：停止推流但保留控制，所有编码组的观看者同步
+// POST /api/session/:id/pause
+func (wm *WebMaster) handlePauseSession(c *gin.Context) {
+	agents := wm.WebRTCManager.GetAgents(c.Param("id"))
+	if len(agents) == 0 {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	for _, agent := range agents {
+		agent.Pause()
+	}
+	c.JSON(200, gin.H{"status": "paused"})
+}
+
+// POST /api/session/:id/resume
+func (wm *WebMaster) handleResumeSession(c *gin.Context) {
+	agents := wm.WebRTCManager.GetAgents(c.Param("id"))
+	if len(agents) == 0 {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	for _, agent := range agents {
+		agent.Resume()
+	}
+	c.JSON(200, gin.H{"status": "resumed"})
+}
+
+// handleLaunchApp 在正在运行的桌面中启动应用，例如 {"command": "firefox"}
+// POST /api/session/:id/launch
+func (wm *WebMaster) handleLaunchApp(c *gin.Context) {
+	agent, ok := wm.sessionAgent(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	var req struct {
+		Command string `json:"command"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Command) == "" {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := agent.LaunchApp(req.Command); err != nil {
+		code := 500
+		if errors.Is(err, sdriver.ErrNotSupported) {
+			code = 400
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "launched"})
+}
@@ -0,0 +1,124 @@
+package webservice
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"webscreen/sdriver"
+	sagent "webscreen/streamAgent"
+
+	pionSDP "github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// 默认的视频编码偏好，靠前的优先
+var defaultCodecPreference = []string{"h265", "h264", "av1"}
+
+var codecMimeTypes = map[string]string{
+	"h264": webrtc.MimeTypeH264,
+	"h265": webrtc.MimeTypeH265,
+	"av1":  webrtc.MimeTypeAV1,
+}
+
+func codecFromMimeType(mimeType string) string {
+	for codec, mime := range codecMimeTypes {
+		if strings.EqualFold(mime, mimeType) {
+			return codec
+		}
+	}
+	return ""
+}
+
+// offerVideoCodecs 返回浏览器 offer 中出现的、本服务支持的视频编码
+func offerVideoCodecs(offer string) ([]string, error) {
+	sd := pionSDP.SessionDescription{}
+	if err := sd.Unmarshal([]byte(offer)); err != nil {
+		return nil, fmt.Errorf("parse SDP offer: %w", err)
+	}
+	var codecs []string
+	for _, media := range sd.MediaDescriptions {
+		if media.MediaName.Media != "video" {
+			continue
+		}
+		for _, attr := range media.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+			// rtpmap:96 H264/90000
+			fields := strings.Fields(attr.Value)
+			if len(fields) != 2 {
+				continue
+			}
+			name, _, _ := strings.Cut(fields[1], "/")
+			codec := codecFromMimeType("video/" + name)
+			if codec != "" && !slices.Contains(codecs, codec) {
+				codecs = append(codecs, codec)
+			}
+		}
+	}
+	return codecs, nil
+}
+
+// resolveVideoCodec 确定本次会话的视频编码并写回 config.DriverConfig["video_codec"]。
+//
+//   - 指定的编码浏览器支持时保持不变
+//   - video_codec 为 auto，或指定的编码浏览器不支持而驱动允许自动选择时，
+//     优先加入设备正在推流的编码组（active），不用再启动一路编码；
+//     没有合适的组时按 preference 选出浏览器和驱动都支持的编码
+//   - 其他情况保持指定的编码，交给协商报错
+//
+// 驱动注册了 SingleEncoder 时，设备已有编码组就只能加入它，浏览器不支持该编码则直接报错。
+func resolveVideoCodec(config *sagent.AgentConfig, offer string, active []string, preference []string) (string, error) {
+	if config.DriverConfig == nil {
+		config.DriverConfig = make(map[string]string)
+	}
+	requested := config.DriverConfig["video_codec"]
+	offered, err := offerVideoCodecs(offer)
+	if err != nil {
+		return "", err
+	}
+	if len(active) > 0 && sdriver.SingleEncoder(config.DeviceType) {
+		codec := active[0]
+		if !slices.Contains(offered, codec) {
+			return "", fmt.Errorf("%s %s is already streaming %s, which the browser does not offer (browser: %v)", config.DeviceType, config.DeviceID, codec, offered)
+		}
+		if requested != codec {
+			log.Printf("[codec] %s %s can only run one encoder, joining running %s stream instead of %s", config.DeviceType, config.DeviceID, codec, requested)
+		}
+		config.DriverConfig["video_codec"] = codec
+		return codec, nil
+	}
+	if requested != sdriver.VIDEO_CODEC_AUTO && slices.Contains(offered, requested) {
+		return requested, nil
+	}
+
+	supported, auto := sdriver.VideoCodecs(config.DeviceType, config.DeviceID)
+	if requested != sdriver.VIDEO_CODEC_AUTO {
+		if !auto {
+			// 编码由驱动决定（例如 dummy 的文件），交给协商报错
+			log.Printf("[codec] Browser does not offer %s, and %s cannot switch codec", requested, config.DeviceType)
+			return requested, nil
+		}
+		log.Printf("[codec] Browser does not offer %s, selecting automatically", requested)
+	}
+	if len(preference) == 0 {
+		preference = defaultCodecPreference
+	}
+	// 正在推流的编码不一定在 preference 中（例如手动指定的），排在最后
+	for _, codec := range slices.Concat(preference, active) {
+		if slices.Contains(active, codec) && slices.Contains(offered, codec) {
+			log.Printf("[codec] Joining running %s stream (browser: %v)", codec, offered)
+			config.DriverConfig["video_codec"] = codec
+			return codec, nil
+		}
+	}
+	for _, codec := range preference {
+		if slices.Contains(offered, codec) && slices.Contains(supported, codec) {
+			log.Printf("[codec] Selected %s (browser: %v, device: %v)", codec, offered, supported)
+			config.DriverConfig["video_codec"] = codec
+			return codec, nil
+		}
+	}
+	return "", fmt.Errorf("no common video codec: browser offers %v, device supports %v", offered, supported)
+}
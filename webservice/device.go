@@ -7,11 +7,3 @@ type Device interface {
 	GetPort() int
 	GetStatus() string
 }
-
-type DeviceInfo struct {
-	Type     string `json:"device_type"`
-	DeviceID string `json:"device_id"`
-	IP       string `json:"ip"`
-	Port     int    `json:"port"`
-	Status   string `json:"status"`
-}
@@ -0,0 +1,95 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	sagent "webscreen/streamAgent"
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+// UpdateDeviceConfig 修改设备正在运行的驱动参数，codec 为空时作用于设备的所有编码组。
+// 某一组失败时，已经修改过的组恢复原来的值，返回该组的错误，各组的参数保持一致。
+// 作用于所有编码组并且成功时，配置记入设备的运行时配置，之后新建的编码组沿用，见 liveDriverConfig。
+// 返回被修改的 Agent
+func (manager *WebRTCManager) UpdateDeviceConfig(deviceIdentifier, codec string, config map[string]string) ([]*sagent.Agent, error) {
+	if len(config) == 0 {
+		return nil, fmt.Errorf("empty config")
+	}
+	// 同一时间只有一次修改，否则两次修改在不同编码组上的先后顺序可能不同
+	manager.configMu.Lock()
+	defer manager.configMu.Unlock()
+
+	var agents []*sagent.Agent
+	if codec == "" {
+		agents = manager.GetAgents(deviceIdentifier)
+	} else if agent, ok := manager.GetCodecAgent(deviceIdentifier, codec); ok {
+		agents = []*sagent.Agent{agent}
+	}
+	if len(agents) == 0 {
+		return nil, errSessionNotFound
+	}
+
+	previous := make([]map[string]string, 0, len(agents))
+	for i, agent := range agents {
+		current := agent.Config().DriverConfig
+		prev := make(map[string]string, len(config))
+		for k := range config {
+			if v, ok := current[k]; ok {
+				prev[k] = v
+			}
+		}
+		if err := agent.UpdateDriverConfig(config); err != nil {
+			manager.rollbackConfig(agents[:i], previous, config)
+			return nil, err
+		}
+		previous = append(previous, prev)
+	}
+
+	if codec == "" {
+		manager.Lock()
+		// 设备的编码组都已关闭时不再记录
+		if _, ok := manager.broadcasters[deviceIdentifier]; ok {
+			if manager.deviceConfig[deviceIdentifier] == nil {
+				manager.deviceConfig[deviceIdentifier] = make(map[string]string)
+			}
+			maps.Copy(manager.deviceConfig[deviceIdentifier], config)
+		}
+		manager.Unlock()
+	}
+	return agents, nil
+}
+
+// rollbackConfig 把已经修改的编码组恢复到 previous。原来没有设置的项（驱动默认值）无法还原，只记录日志
+func (manager *WebRTCManager) rollbackConfig(agents []*sagent.Agent, previous []map[string]string, config map[string]string) {
+	for i := len(agents) - 1; i >= 0; i-- {
+		for k := range config {
+			if _, ok := previous[i][k]; !ok {
+				log.Printf("[config] Cannot restore %s of %s stream, it had no previous value", k, agents[i].Config().DeviceID)
+			}
+		}
+		if len(previous[i]) == 0 {
+			continue
+		}
+		if err := agents[i].UpdateDriverConfig(previous[i]); err != nil {
+			log.Printf("[config] Rollback of %s stream failed: %v", agents[i].Config().DeviceID, err)
+		}
+	}
+}
+
+// liveDriverConfig 把设备运行中修改过的配置合并到新编码组的配置中，不修改 config 原来的 DriverConfig。
+// 调用者需持有 manager 的锁
+func (manager *WebRTCManager) liveDriverConfig(deviceIdentifier string, config sagent.AgentConfig) sagent.AgentConfig {
+	live := manager.deviceConfig[deviceIdentifier]
+	if len(live) == 0 {
+		return config
+	}
+	config.DriverConfig = maps.Clone(config.DriverConfig)
+	if config.DriverConfig == nil {
+		config.DriverConfig = make(map[string]string, len(live))
+	}
+	maps.Copy(config.DriverConfig, live)
+	return config
+}
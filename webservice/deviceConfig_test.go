@@ -0,0 +1,91 @@
+package webservice
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	sagent "webscreen/streamAgent"
+)
+
+// newTwoGroupDevice 返回有 h264 和 h265 两个编码组的设备，两组的码率都是 4M
+func newTwoGroupDevice(t *testing.T, manager *WebRTCManager, device string) (first, second *callLogDriver, agents []*sagent.Agent) {
+	t.Helper()
+	groups := map[string]*DeviceBroadcaster{}
+	var drivers []*callLogDriver
+	for _, codec := range []string{"h264", "h265"} {
+		b, agent, d := newTestGroup(t, codec)
+		b.Agent = agent
+		groups[codec] = b
+		if err := agent.UpdateDriverConfig(map[string]string{"video_bit_rate": "4M"}); err != nil {
+			t.Fatal(err)
+		}
+		drivers = append(drivers, d)
+		agents = append(agents, agent)
+		// GetAgents 按创建时间排序
+		time.Sleep(time.Millisecond)
+	}
+	manager.broadcasters[device] = groups
+	return drivers[0], drivers[1], agents
+}
+
+func TestUpdateDeviceConfigRollsBack(t *testing.T) {
+	manager := NewWebRTCManager()
+	const device = "device-1"
+	first, second, agents := newTwoGroupDevice(t, manager, device)
+	second.updateErr = errors.New("restart failed")
+
+	_, err := manager.UpdateDeviceConfig(device, "", map[string]string{"video_bit_rate": "8M"})
+	if err == nil {
+		t.Fatal("UpdateDeviceConfig succeeded although one codec group failed")
+	}
+	want := []string{"Update video_bit_rate=4M", "Update video_bit_rate=8M", "Update video_bit_rate=4M"}
+	if calls := first.Calls(); !slices.Equal(calls, want) {
+		t.Errorf("first group driver calls = %v, want %v", calls, want)
+	}
+	for _, agent := range agents {
+		if v := agent.Config().DriverConfig["video_bit_rate"]; v != "4M" {
+			t.Errorf("%s group video_bit_rate = %s after rollback, want 4M", agent.Config().DriverConfig["video_codec"], v)
+		}
+	}
+	if live := manager.deviceConfig[device]; len(live) != 0 {
+		t.Errorf("failed update recorded as live config: %v", live)
+	}
+}
+
+func TestUpdateDeviceConfigAppliesToNewGroups(t *testing.T) {
+	manager := NewWebRTCManager()
+	const device = "device-1"
+	newTwoGroupDevice(t, manager, device)
+
+	agents, err := manager.UpdateDeviceConfig(device, "", map[string]string{"video_bit_rate": "8M"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 2 {
+		t.Errorf("updated %d groups, want 2", len(agents))
+	}
+
+	// 新的编码组沿用运行中修改过的码率，观看者自己的其他配置保留
+	viewer := sagent.AgentConfig{DriverConfig: map[string]string{"video_codec": "av1", "video_bit_rate": "2M"}}
+	manager.Lock()
+	merged := manager.liveDriverConfig(device, viewer)
+	manager.Unlock()
+	if merged.DriverConfig["video_bit_rate"] != "8M" || merged.DriverConfig["video_codec"] != "av1" {
+		t.Errorf("new group driver config = %v, want video_bit_rate=8M video_codec=av1", merged.DriverConfig)
+	}
+	if viewer.DriverConfig["video_bit_rate"] != "2M" {
+		t.Error("liveDriverConfig modified the viewer's config")
+	}
+
+	// 设备的编码组全部关闭后不再沿用
+	manager.Lock()
+	for _, b := range manager.deviceGroups(device) {
+		manager.removeGroup(device, b)
+	}
+	_, ok := manager.deviceConfig[device]
+	manager.Unlock()
+	if ok {
+		t.Error("live config kept after all codec groups were closed")
+	}
+}
@@ -53,7 +53,7 @@ func (wm *WebMaster) handleScreenWS(c *gin.Context) {
 	// h.Write([]byte(deviceIdentifier))
 	// deviceIdentifier = fmt.Sprintf("%x", h.Sum(nil))
 
-	finalSDP, receiptNo, err := wm.WebRTCManager.NewSubscriber(deviceIdentifier, config.SDP, config)
+	finalSDP, receiptNo, err := wm.WebRTCManager.NewSubscriber(deviceIdentifier, config.SDP, &config)
 	if err != nil {
 		log.Println("Failed to handle new connection:", err)
 		conn.WriteJSON(map[string]any{"status": "error", "message": err.Error(), "stage": "webrtc_init"})
@@ -67,7 +67,8 @@ func (wm *WebMaster) handleScreenWS(c *gin.Context) {
 		return
 	}
 	log.Println("deviceIdentifier:", deviceIdentifier, "receiptNo:", receiptNo)
-	conn.WriteJSON(map[string]any{"status": "ok", "sdp": finalSDP, "stage": "webrtc_init"})
+	// video_codec 为实际使用的编码（auto 已被替换）
+	conn.WriteJSON(map[string]any{"status": "ok", "sdp": finalSDP, "video_codec": config.DriverConfig["video_codec"], "stage": "webrtc_init"})
 
 	sub, exists := wm.WebRTCManager.getSubscriber(deviceIdentifier, receiptNo)
 	if !exists {
@@ -98,7 +99,7 @@ Loop:
 		conn.Close()
 		return
 	}
-	agent, exists := wm.WebRTCManager.GetAgent(deviceIdentifier)
+	agent, exists := wm.WebRTCManager.getSubscriberAgent(deviceIdentifier, receiptNo)
 	if !exists {
 		log.Printf("Failed to get agent for device %s", deviceIdentifier)
 		conn.WriteJSON(map[string]any{"status": "error", "message": "Failed to get agent", "stage": "webrtc_metainfo"})
@@ -108,7 +109,7 @@ Loop:
 	capabilities := agent.Capabilities()
 	log.Printf("Driver Capabilities: %+v", capabilities)
 	media_meta := agent.GetMediaMeta()
-	conn.WriteJSON(map[string]interface{}{"status": "ok", "capabilities": capabilities, "media_meta": media_meta, "stage": "webrtc_metainfo"})
+	conn.WriteJSON(map[string]interface{}{"status": "ok", "capabilities": capabilities, "media_meta": media_meta, "paused": agent.Paused(), "stage": "webrtc_metainfo"})
 }
 
 // func (wm *WebMaster) removeScreenSession(deviceIdentifier string) {
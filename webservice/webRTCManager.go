@@ -3,8 +3,12 @@ package webservice
 import (
 	"fmt"
 	"log"
+	"maps"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
+	"webscreen/sdriver"
 	sagent "webscreen/streamAgent"
 
 	"github.com/pion/interceptor"
@@ -44,26 +48,43 @@ type Subscriber struct {
 	onMessageCallback func([]byte) error
 }
 
+// DeviceBroadcaster 是同一设备、同一视频编码的一组观看者，共享一个 Agent 和一组轨道。
+// 浏览器支持的编码不同时，同一设备可以同时有多个 DeviceBroadcaster，各自运行一路编码。
 type DeviceBroadcaster struct {
+	Codec       string
 	PayloadType uint8
 	VideoTrack  *webrtc.TrackLocalStaticRTP
 	AudioTrack  *webrtc.TrackLocalStaticRTP
 	Agent       *sagent.Agent
 	Subscribers map[uint32]*Subscriber
 	Lock        sync.RWMutex
+
+	created time.Time
+	// agentInit 在 Agent 初始化期间非空，初始化结束（成功或失败）时关闭
+	agentInit chan struct{}
+	// joining 为正在协商、还没有加入 Subscribers 的观看者数量，受 manager 的锁保护
+	joining int
 }
 
 type WebRTCManager struct {
 	sync.RWMutex
-	broadcasters map[string]*DeviceBroadcaster // deviceIdentifier -> Broadcaster
+	broadcasters map[string]map[string]*DeviceBroadcaster // deviceIdentifier -> video codec -> Broadcaster
+	// video_codec 为 auto 时的视频编码偏好，靠前的优先
+	CodecPreference []string
 
 	currentReceiptNumber map[string]uint32
+	// deviceConfig 为设备运行中通过 UpdateDeviceConfig 修改过的配置，新建的编码组沿用，
+	// 设备的编码组全部关闭后清除。configMu 保证同一时间只有一次修改
+	deviceConfig map[string]map[string]string
+	configMu     sync.Mutex
 }
 
 func NewWebRTCManager() *WebRTCManager {
 	wm := &WebRTCManager{
-		broadcasters:         make(map[string]*DeviceBroadcaster),
+		broadcasters:         make(map[string]map[string]*DeviceBroadcaster),
 		currentReceiptNumber: make(map[string]uint32),
+		deviceConfig:         make(map[string]map[string]string),
+		CodecPreference:      defaultCodecPreference,
 	}
 	// go func() {
 	// 	for {
@@ -84,13 +105,27 @@ func NewWebRTCManager() *WebRTCManager {
 	return wm
 }
 
-func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP string, AgentConfig sagent.AgentConfig) (string, uint32, error) {
+// NewSubscriber 为浏览器创建 PeerConnection 并返回 answer。
+// 视频编码根据 offer 确定，结果写回 AgentConfig.DriverConfig["video_codec"]，
+// 观看者加入该编码的组，没有时新建一组（稍后由 Start 启动新的 Agent）。
+func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP string, AgentConfig *sagent.AgentConfig) (string, uint32, error) {
 	offer := webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
 		SDP:  clientSDP,
 	}
 	// log.Println("Handling SDP Offer", sdp)
-	videoMimeType, audioMimeType := getMimeTypeFromConfig(AgentConfig)
+	var activeCodecs []string
+	manager.RLock()
+	for codec := range manager.broadcasters[deviceIdentifier] {
+		activeCodecs = append(activeCodecs, codec)
+	}
+	manager.RUnlock()
+	codec, err := resolveVideoCodec(AgentConfig, clientSDP, activeCodecs, manager.CodecPreference)
+	if err != nil {
+		log.Printf("Failed to select video codec: %v", err)
+		return "", 0, err
+	}
+	videoMimeType, audioMimeType := getMimeTypeFromConfig(*AgentConfig)
 	// Create MediaEngine
 	mimeTypes := []string{videoMimeType, audioMimeType}
 	m := createMediaEngine(mimeTypes)
@@ -113,7 +148,7 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 		return "", 0, err
 	}
 	settingEngine := webrtc.SettingEngine{}
-	err := settingEngine.SetEphemeralUDPPortRange(UDP_PORT_START, UDP_PORT_END)
+	err = settingEngine.SetEphemeralUDPPortRange(UDP_PORT_START, UDP_PORT_END)
 	if err != nil {
 		return "", 0, err
 	}
@@ -133,39 +168,64 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 
 	// 1. Get or Create Broadcaster (and its tracks)
 	manager.Lock()
-	broadcaster, exists := manager.broadcasters[deviceIdentifier]
+	groups, exists := manager.broadcasters[deviceIdentifier]
+	if !exists {
+		groups = make(map[string]*DeviceBroadcaster)
+		manager.broadcasters[deviceIdentifier] = groups
+	}
+	broadcaster, exists := groups[codec]
+	if !exists && len(groups) > 0 && sdriver.SingleEncoder(AgentConfig.DeviceType) {
+		// 选择编码之后另一个观看者可能已经启动了别的编码
+		active := slices.Collect(maps.Keys(groups))
+		manager.Unlock()
+		peerConnection.Close()
+		return "", 0, fmt.Errorf("device %s is already streaming %v, cannot start a %s encoder", deviceIdentifier, active, codec)
+	}
 	if !exists {
 		videoTrack, audioTrack := createAVTrack(videoMimeType, audioMimeType, AgentConfig.AVSync)
 		if videoTrack == nil && audioTrack == nil {
+			if len(groups) == 0 {
+				delete(manager.broadcasters, deviceIdentifier)
+			}
 			manager.Unlock()
+			peerConnection.Close()
 			log.Printf("Failed to create both video and audio tracks")
 			return "", 0, fmt.Errorf("failed to create media tracks")
 		}
 
 		broadcaster = &DeviceBroadcaster{
+			Codec:       codec,
 			VideoTrack:  videoTrack,
 			AudioTrack:  audioTrack,
 			Subscribers: make(map[uint32]*Subscriber),
+			created:     time.Now(),
+		}
+		groups[codec] = broadcaster
+		if len(groups) > 1 {
+			log.Printf("Device %s: new %s stream group alongside %v", deviceIdentifier, codec, activeCodecs)
 		}
-		manager.broadcasters[deviceIdentifier] = broadcaster
 	}
+	broadcaster.joining++
 	manager.Unlock()
 
 	// 2. Add SHARED tracks to PeerConnection
 	rtpSenderVideo, err := peerConnection.AddTrack(broadcaster.VideoTrack)
 	if err != nil {
 		log.Printf("Failed to add video track: %v", err)
+		manager.abortSubscriber(deviceIdentifier, broadcaster, peerConnection)
 		return "", 0, err
 	}
 	rtpSenderAudio, err := peerConnection.AddTrack(broadcaster.AudioTrack)
 	if err != nil {
 		log.Printf("Failed to add audio track: %v", err)
+		manager.abortSubscriber(deviceIdentifier, broadcaster, peerConnection)
 		return "", 0, err
 	}
 
 	// Set Remote Description (Offer from browser)
 	if err := peerConnection.SetRemoteDescription(offer); err != nil {
 		log.Println("set Remote Description failed:", err)
+		manager.abortSubscriber(deviceIdentifier, broadcaster, peerConnection)
 		return "", 0, err
 	}
 
@@ -173,6 +233,7 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 	answer, err := peerConnection.CreateAnswer(nil)
 	if err != nil {
 		log.Println("Create Answer failed:", err)
+		manager.abortSubscriber(deviceIdentifier, broadcaster, peerConnection)
 		return "", 0, err
 	}
 
@@ -181,6 +242,7 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 
 	if err := peerConnection.SetLocalDescription(answer); err != nil {
 		log.Println("Set Local Description failed:", err)
+		manager.abortSubscriber(deviceIdentifier, broadcaster, peerConnection)
 		return "", 0, err
 	}
 
@@ -189,12 +251,16 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 	finalSDP := peerConnection.LocalDescription().SDP
 
 	manager.Lock()
+	// 编号在设备的所有编码组之间唯一
 	receiptNo := manager.currentReceiptNumber[deviceIdentifier]
-	broadcaster.Lock.Lock()
-	if broadcaster.Subscribers[receiptNo] != nil {
+	if old, oldSub, exists := manager.findSubscriber(deviceIdentifier, receiptNo); exists {
 		log.Printf("Warning: Overwriting existing subscriber for device %s, receiptNo %d", deviceIdentifier, receiptNo)
-		broadcaster.Subscribers[receiptNo].PeerConnection.Close()
+		old.Lock.Lock()
+		delete(old.Subscribers, receiptNo)
+		old.Lock.Unlock()
+		oldSub.PeerConnection.Close()
 	}
+	broadcaster.Lock.Lock()
 	sub := &Subscriber{
 		PeerConnection: peerConnection,
 		rtpSenderVideo: rtpSenderVideo,
@@ -202,6 +268,7 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 	}
 	broadcaster.Subscribers[receiptNo] = sub
 	broadcaster.Lock.Unlock()
+	broadcaster.joining--
 
 	manager.currentReceiptNumber[deviceIdentifier] = (manager.currentReceiptNumber[deviceIdentifier] + 1) % MAX_CLIENTS_PER_DEVICE
 	manager.Unlock()
@@ -211,6 +278,21 @@ func (manager *WebRTCManager) NewSubscriber(deviceIdentifier string, clientSDP s
 	return finalSDP, receiptNo, nil
 }
 
+// abortSubscriber 关闭协商失败的 PeerConnection。编码组里没有 Agent 也没有其他观看者时一并移除，
+// 否则它会留在 activeCodecs 里，把之后的观看者引向一路不存在的流
+func (manager *WebRTCManager) abortSubscriber(deviceIdentifier string, broadcaster *DeviceBroadcaster, pc *webrtc.PeerConnection) {
+	pc.Close()
+	manager.Lock()
+	defer manager.Unlock()
+	broadcaster.joining--
+	broadcaster.Lock.RLock()
+	empty := broadcaster.Agent == nil && broadcaster.agentInit == nil && broadcaster.joining == 0 && len(broadcaster.Subscribers) == 0
+	broadcaster.Lock.RUnlock()
+	if empty {
+		manager.removeGroup(deviceIdentifier, broadcaster)
+	}
+}
+
 func (manager *WebRTCManager) Start(deviceIdentifier string, receiptNo uint32, agentConfig sagent.AgentConfig) error {
 	err := manager.ensureAgent(deviceIdentifier, receiptNo, agentConfig)
 	if err != nil {
@@ -218,30 +300,25 @@ func (manager *WebRTCManager) Start(deviceIdentifier string, receiptNo uint32, a
 		return fmt.Errorf("failed to ensure agent: %v", err)
 	}
 	manager.RLock()
-	broadcaster, exists := manager.broadcasters[deviceIdentifier]
+	broadcaster, sub, exists := manager.findSubscriber(deviceIdentifier, receiptNo)
 	manager.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("broadcaster not found")
+		return fmt.Errorf("subscriber not found")
 	}
 
 	broadcaster.Lock.RLock()
-	sub := broadcaster.Subscribers[receiptNo]
 	agent := broadcaster.Agent
 	broadcaster.Lock.RUnlock()
 
-	if sub == nil {
-		return fmt.Errorf("subscriber not found")
-	}
-
 	// PLI handling
 	go ListenRTPVideo(sub.rtpSenderVideo, agent)
 	go ListenRTPAudio(sub.rtpSenderAudio, agent)
 
-	manager.setCleanup(sub.PeerConnection, deviceIdentifier, receiptNo)
+	manager.setCleanup(sub, deviceIdentifier, broadcaster, receiptNo)
 
 	// Data Channel
-	sub.setDataChannelCallback(agent.HandleEvent)
+	sub.setDataChannelCallback(manager.eventHandler(deviceIdentifier, agent))
 
 	// No need to startPushAVSample / startPushEvent loops anymore
 	// The tracks are shared and filled by the Agent loop started in ensureAgent
@@ -251,88 +328,309 @@ func (manager *WebRTCManager) Start(deviceIdentifier string, receiptNo uint32, a
 
 func (manager *WebRTCManager) ensureAgent(deviceIdentifier string, receiptNo uint32, agentConfig sagent.AgentConfig) error {
 	manager.Lock()
-	broadcaster, exists := manager.broadcasters[deviceIdentifier]
+	broadcaster, sub, exists := manager.findSubscriber(deviceIdentifier, receiptNo)
 	if !exists {
 		manager.Unlock()
 		return fmt.Errorf("broadcaster should exist at this point")
 	}
+	// 同组的其他观看者正在初始化 Agent，等它完成后再检查
+	for broadcaster.Agent == nil && broadcaster.agentInit != nil {
+		wait := broadcaster.agentInit
+		manager.Unlock()
+		<-wait
+		manager.Lock()
+	}
+	if broadcaster.Agent != nil {
+		manager.Unlock()
+		return nil
+	}
+	// 初始化失败或观看者都已离开时组已被清除
+	if manager.broadcasters[deviceIdentifier][broadcaster.Codec] != broadcaster {
+		manager.Unlock()
+		return fmt.Errorf("agent init failed or all subscribers left before agent init")
+	}
+	initDone := make(chan struct{})
+	broadcaster.agentInit = initDone
+	// 设备的其他编码组运行中修改过参数时，新的一组使用修改后的值
+	agentConfig = manager.liveDriverConfig(deviceIdentifier, agentConfig)
+	manager.Unlock()
 
-	if broadcaster.Agent == nil {
-		agent := sagent.New(agentConfig, broadcaster.VideoTrack, broadcaster.AudioTrack)
+	// 等待协商和启动驱动都可能很慢（adb、SSH），不持有 manager 的锁，其他设备的请求不受影响
+	agent := sagent.New(agentConfig, broadcaster.VideoTrack, broadcaster.AudioTrack)
+	finalCodec, err := WaitAndGetFinalCodecParams(sub.PeerConnection)
+	if err != nil {
+		log.Printf("Failed to get final codec parameters for device %s: %v", deviceIdentifier, err)
+	} else {
+		err = agent.InitDriver(finalCodec)
+	}
 
-		broadcaster.Lock.RLock()
-		sub := broadcaster.Subscribers[receiptNo]
-		// In case subscriber disconnected while waiting for lock?
-		if sub == nil {
-			broadcaster.Lock.RUnlock()
-			manager.Unlock()
-			return fmt.Errorf("subscriber disconnected before agent init")
+	if err != nil {
+		// 组内没有可用的 Agent，移除整组并断开组内的观看者，之后的连接会重新创建
+		manager.Lock()
+		broadcaster.agentInit = nil
+		close(initDone)
+		pcs := manager.removeGroup(deviceIdentifier, broadcaster)
+		manager.Unlock()
+		for _, pc := range pcs {
+			pc.Close()
 		}
-		pc := sub.PeerConnection
-		broadcaster.Lock.RUnlock()
+		return err
+	}
+	// Agent 放进组里之后才结束初始化，等待的观看者不会再初始化一次
+	err = manager.startAgent(deviceIdentifier, broadcaster, agent)
+	manager.Lock()
+	broadcaster.agentInit = nil
+	close(initDone)
+	manager.Unlock()
+	return err
+}
 
+// startAgent 把初始化好的 Agent 放进编码组并开始推流。
+// 其他编码组处于隐私模式时，新的一路在 Start 之前就暂停，不会把画面发给新加入的观看者
+func (manager *WebRTCManager) startAgent(deviceIdentifier string, broadcaster *DeviceBroadcaster, agent *sagent.Agent) error {
+	manager.Lock()
+	if manager.broadcasters[deviceIdentifier][broadcaster.Codec] != broadcaster {
 		manager.Unlock()
+		agent.Close()
+		return fmt.Errorf("all subscribers left before agent init")
+	}
+	for _, b := range manager.broadcasters[deviceIdentifier] {
+		if b != broadcaster && b.Agent != nil && b.Agent.Paused() {
+			// 持有锁暂停：同时恢复所有编码组的请求要么看不到这个 Agent，要么看到它已经暂停
+			agent.Pause()
+			break
+		}
+	}
+	broadcaster.Agent = agent
+	manager.Unlock()
 
-		finalCodec, err := WaitAndGetFinalCodecParams(pc)
-		if err != nil {
-			log.Printf("Failed to get final codec parameters for device %s: %v", deviceIdentifier, err)
-			return err
+	go agent.Start()
+
+	// Event Loop (Agent -> Browser)
+	go func() {
+		for event := range agent.FeedbackEvents() {
+			broadcaster.Lock.RLock()
+			for _, sub := range broadcaster.Subscribers {
+				if sub.dataChannelUnordered != nil {
+					// Send directly
+					sub.dataChannelUnordered.Send(event)
+				}
+			}
+			broadcaster.Lock.RUnlock()
 		}
+	}()
+	return nil
+}
 
-		// Re-lock to set Agent
-		manager.Lock()
-		// Double check if agent was created by another thread
-		if broadcaster.Agent != nil {
-			manager.Unlock()
-			return nil
+// removeGroup 从设备中移除编码组，返回组内观看者的 PeerConnection，由调用者在释放锁之后关闭。
+// 调用者需持有 manager 的锁
+func (manager *WebRTCManager) removeGroup(deviceIdentifier string, broadcaster *DeviceBroadcaster) []*webrtc.PeerConnection {
+	groups := manager.broadcasters[deviceIdentifier]
+	if groups[broadcaster.Codec] != broadcaster {
+		return nil
+	}
+	delete(groups, broadcaster.Codec)
+	if len(groups) == 0 {
+		delete(manager.broadcasters, deviceIdentifier)
+		delete(manager.currentReceiptNumber, deviceIdentifier)
+		delete(manager.deviceConfig, deviceIdentifier)
+	}
+	broadcaster.Lock.RLock()
+	defer broadcaster.Lock.RUnlock()
+	pcs := make([]*webrtc.PeerConnection, 0, len(broadcaster.Subscribers))
+	for _, sub := range broadcaster.Subscribers {
+		pcs = append(pcs, sub.PeerConnection)
+	}
+	return pcs
+}
+
+// GetAgent 返回设备最早启动的编码组的 Agent
+func (manager *WebRTCManager) GetAgent(deviceIdentifier string) (*sagent.Agent, bool) {
+	return manager.GetCodecAgent(deviceIdentifier, "")
+}
+
+// GetCodecAgent 返回设备指定视频编码组的 Agent，codec 为空时同 GetAgent
+func (manager *WebRTCManager) GetCodecAgent(deviceIdentifier string, codec string) (*sagent.Agent, bool) {
+	manager.RLock()
+	defer manager.RUnlock()
+	for _, b := range manager.deviceGroups(deviceIdentifier) {
+		if b.Agent != nil && (codec == "" || b.Codec == codec) {
+			return b.Agent, true
 		}
+	}
+	return nil, false
+}
 
-		broadcaster.Agent = agent
-		agent.InitDriver(finalCodec)
-		go agent.Start()
-
-		// Event Loop (Agent -> Browser)
-		go func() {
-			for event := range agent.FeedbackEvents() {
-				broadcaster.Lock.RLock()
-				for _, sub := range broadcaster.Subscribers {
-					if sub.dataChannelUnordered != nil {
-						// Send directly
-						sub.dataChannelUnordered.Send(event)
-					}
+// GetAgents 返回设备所有编码组的 Agent，最早启动的在前
+func (manager *WebRTCManager) GetAgents(deviceIdentifier string) []*sagent.Agent {
+	manager.RLock()
+	defer manager.RUnlock()
+	var agents []*sagent.Agent
+	for _, b := range manager.deviceGroups(deviceIdentifier) {
+		if b.Agent != nil {
+			agents = append(agents, b.Agent)
+		}
+	}
+	return agents
+}
+
+// deviceGroups 按创建时间返回设备的所有编码组，调用者需持有 manager 的锁
+func (manager *WebRTCManager) deviceGroups(deviceIdentifier string) []*DeviceBroadcaster {
+	groups := slices.Collect(maps.Values(manager.broadcasters[deviceIdentifier]))
+	slices.SortFunc(groups, func(a, b *DeviceBroadcaster) int { return a.created.Compare(b.created) })
+	return groups
+}
+
+// findSubscriber 在设备的所有编码组中查找观看者，调用者需持有 manager 的锁
+func (manager *WebRTCManager) findSubscriber(deviceIdentifier string, receiptNo uint32) (*DeviceBroadcaster, *Subscriber, bool) {
+	for _, b := range manager.broadcasters[deviceIdentifier] {
+		b.Lock.RLock()
+		sub, exists := b.Subscribers[receiptNo]
+		b.Lock.RUnlock()
+		if exists {
+			return b, sub, true
+		}
+	}
+	return nil, nil, false
+}
+
+// eventHandler 返回观看者 DataChannel 消息的处理函数。
+// 暂停和配置更新作用于设备的所有编码组，保证隐私模式对每个观看者都生效，配置更新见 UpdateDeviceConfig；
+// 其余事件交给观看者所在组的 Agent。
+func (manager *WebRTCManager) eventHandler(deviceIdentifier string, agent *sagent.Agent) func([]byte) error {
+	return func(raw []byte) error {
+		if len(raw) == 0 {
+			return agent.HandleEvent(raw)
+		}
+		switch sdriver.EventType(raw[0]) {
+		case sdriver.EVENT_TYPE_UPDATE_CONFIG:
+			config, err := sagent.ParseConfigJSON(raw[1:])
+			if err != nil {
+				return err
+			}
+			if _, err := manager.UpdateDeviceConfig(deviceIdentifier, "", config); err != nil {
+				log.Printf("[config] Failed to update driver config: %v", err)
+				agent.Notify(fmt.Sprintf("Update config failed: %v", err))
+				return err
+			}
+			return nil
+		case sdriver.EVENT_TYPE_PAUSE:
+			var firstErr error
+			for _, a := range manager.GetAgents(deviceIdentifier) {
+				if err := a.HandleEvent(raw); err != nil && firstErr == nil {
+					firstErr = err
 				}
-				broadcaster.Lock.RUnlock()
 			}
-		}()
-
-		broadcaster.Agent = agent
+			return firstErr
+		default:
+			return agent.HandleEvent(raw)
+		}
 	}
-	manager.Unlock()
+}
 
-	return nil
+// SessionInfo 描述一个正在运行的 Agent（同一设备、同一编码的所有观看者共享）
+type SessionInfo struct {
+	ID string `json:"id"`
+	// 视频编码，同一设备有多个编码组时 ID 相同，用 ?codec= 区分
+	Codec          string            `json:"codec"`
+	DeviceType     string            `json:"device_type"`
+	DeviceID       string            `json:"device_id"`
+	Subscribers    int               `json:"subscribers"`
+	MediaMeta      sdriver.MediaMeta `json:"media_meta"`
+	DriverConfig   map[string]string `json:"driver_config"` // 不含 ssh_password 等密钥，见 sdriver.PublicConfig
+	Paused         bool              `json:"paused"`
+	MacroRecording bool              `json:"macro_recording"`
+	MacroPlaying   bool              `json:"macro_playing"`
+	// 正在写入的录制文件名
+	Recording string `json:"recording,omitempty"`
+	// 是否开启了即时回放缓冲
+	Replay bool `json:"replay"`
 }
 
-func (manager *WebRTCManager) GetAgent(deviceIdentifier string) (*sagent.Agent, bool) {
+// ListSessions 返回所有已启动 Agent 的会话，ID 即 deviceIdentifier，每个编码组一项
+func (manager *WebRTCManager) ListSessions() []SessionInfo {
 	manager.RLock()
 	defer manager.RUnlock()
-	b, exists := manager.broadcasters[deviceIdentifier]
-	if !exists || b.Agent == nil {
-		return nil, false
+	sessions := make([]SessionInfo, 0, len(manager.broadcasters))
+	for id := range manager.broadcasters {
+		for _, b := range manager.deviceGroups(id) {
+			if b.Agent == nil {
+				continue
+			}
+			sessions = append(sessions, b.sessionInfo(id))
+		}
 	}
-	return b.Agent, true
+	return sessions
+}
+
+func (b *DeviceBroadcaster) sessionInfo(id string) SessionInfo {
+	b.Lock.RLock()
+	subscribers := len(b.Subscribers)
+	b.Lock.RUnlock()
+	cfg := b.Agent.Config()
+	recording, _ := b.Agent.RecordingPath()
+	if recording != "" {
+		recording = filepath.Base(recording)
+	}
+	return SessionInfo{
+		ID:             id,
+		Codec:          b.Codec,
+		DeviceType:     cfg.DeviceType,
+		DeviceID:       cfg.DeviceID,
+		Subscribers:    subscribers,
+		MediaMeta:      b.Agent.GetMediaMeta(),
+		DriverConfig:   sdriver.PublicConfig(cfg.DriverConfig),
+		Paused:         b.Agent.Paused(),
+		MacroRecording: b.Agent.MacroRecording(),
+		MacroPlaying:   b.Agent.MacroPlaying(),
+		Recording:      recording,
+		Replay:         b.Agent.ReplayEnabled(),
+	}
+}
+
+// CloseDevice 断开某个设备所有编码组的观看者，Agent 由 setCleanup 关闭。返回断开的观看者数量。
+func (manager *WebRTCManager) CloseDevice(deviceType, deviceID string) int {
+	manager.RLock()
+	var pcs []*webrtc.PeerConnection
+	for _, groups := range manager.broadcasters {
+		for _, b := range groups {
+			if b.Agent == nil {
+				continue
+			}
+			if cfg := b.Agent.Config(); cfg.DeviceType != deviceType || cfg.DeviceID != deviceID {
+				continue
+			}
+			b.Lock.RLock()
+			for _, sub := range b.Subscribers {
+				pcs = append(pcs, sub.PeerConnection)
+			}
+			b.Lock.RUnlock()
+		}
+	}
+	manager.RUnlock()
+	// 关闭时触发的 setCleanup 需要 manager 的写锁
+	for _, pc := range pcs {
+		pc.Close()
+	}
+	return len(pcs)
 }
 
 func (manager *WebRTCManager) getSubscriber(deviceIdentifier string, receiptNo uint32) (*Subscriber, bool) {
 	manager.RLock()
 	defer manager.RUnlock()
-	b, exists := manager.broadcasters[deviceIdentifier]
-	if !exists {
+	_, sub, exists := manager.findSubscriber(deviceIdentifier, receiptNo)
+	return sub, exists
+}
+
+// getSubscriberAgent 返回观看者所在编码组的 Agent
+func (manager *WebRTCManager) getSubscriberAgent(deviceIdentifier string, receiptNo uint32) (*sagent.Agent, bool) {
+	manager.RLock()
+	defer manager.RUnlock()
+	b, _, exists := manager.findSubscriber(deviceIdentifier, receiptNo)
+	if !exists || b.Agent == nil {
 		return nil, false
 	}
-	b.Lock.RLock()
-	defer b.Lock.RUnlock()
-	sub, exists := b.Subscribers[receiptNo]
-	return sub, exists
+	return b.Agent, true
 }
 
 func createMediaEngine(mimeTypes []string) *webrtc.MediaEngine {
@@ -636,30 +934,35 @@ func (sub *Subscriber) setDataChannelCallback(callback func([]byte) error) {
 	// No further action needed here unless we want to support changing callbacks on existing open channels that somehow missed the initial setup (which shouldn't happen).
 }
 
-func (manager *WebRTCManager) setCleanup(pc *webrtc.PeerConnection, deviceIdentifier string, receiptNo uint32) {
+// setCleanup 在观看者断开后把它移出所在的编码组。组内没有观看者时关闭该组的 Agent，
+// 设备的所有编码组都关闭后才清除编号。
+func (manager *WebRTCManager) setCleanup(sub *Subscriber, deviceIdentifier string, broadcaster *DeviceBroadcaster, receiptNo uint32) {
+	pc := sub.PeerConnection
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Printf("PeerConnection state changed: %s\n", state.String())
 		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
 			log.Printf("PeerConnection is in state %s, cleaning up resources\n", state.String())
 			pc.Close()
 			manager.Lock()
-			broadcaster, exists := manager.broadcasters[deviceIdentifier]
-			if exists {
-				broadcaster.Lock.Lock()
+			broadcaster.Lock.Lock()
+			// 编号可能已经分配给了新的观看者
+			if broadcaster.Subscribers[receiptNo] == sub {
 				delete(broadcaster.Subscribers, receiptNo)
-				subCount := len(broadcaster.Subscribers)
-				broadcaster.Lock.Unlock()
-
-				if subCount == 0 {
-					log.Printf("No more subscribers for device %s, closing agent", deviceIdentifier)
-					if broadcaster.Agent != nil {
-						broadcaster.Agent.Close()
-					}
-					delete(manager.broadcasters, deviceIdentifier)
-					delete(manager.currentReceiptNumber, deviceIdentifier)
-				}
+			}
+			subCount := len(broadcaster.Subscribers)
+			broadcaster.Lock.Unlock()
+
+			var agent *sagent.Agent
+			if subCount == 0 && manager.broadcasters[deviceIdentifier][broadcaster.Codec] == broadcaster {
+				log.Printf("No more %s subscribers for device %s, closing agent", broadcaster.Codec, deviceIdentifier)
+				agent = broadcaster.Agent
+				manager.removeGroup(deviceIdentifier, broadcaster)
 			}
 			manager.Unlock()
+			// 关闭 Agent 要停止驱动（可能要等 adb、SSH），不能持有 manager 的锁，否则其他设备的请求都会被阻塞
+			if agent != nil {
+				agent.Close()
+			}
 		}
 	})
 }
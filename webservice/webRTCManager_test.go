@@ -0,0 +1,398 @@
+package webservice
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"webscreen/sdriver"
+	sagent "webscreen/streamAgent"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	testDeviceType = "webservice-test"
+	// testSingleEncoderType 与 testDeviceType 使用同一个驱动，但注册为 SingleEncoder
+	testSingleEncoderType = "webservice-test-single"
+)
+
+// callLogDriver 记录 Start/Pause/Resume/RequestIDR 的调用顺序
+type callLogDriver struct {
+	mu        sync.Mutex
+	calls     []string
+	started   chan struct{}
+	videoCh   chan sdriver.AVBox
+	controlCh chan sdriver.Event
+	// onStop 在 Stop 中调用，测试用它检查调用 Stop 时的加锁状态
+	onStop func()
+	// updateErr 非空时 UpdateDriverConfig 返回它
+	updateErr error
+}
+
+func (d *callLogDriver) record(call string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+}
+
+func (d *callLogDriver) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.calls)
+}
+
+func (d *callLogDriver) GetReceivers() (<-chan sdriver.AVBox, <-chan sdriver.AVBox, chan sdriver.Event) {
+	return d.videoCh, nil, d.controlCh
+}
+func (d *callLogDriver) SendEvent(event sdriver.Event) error { return nil }
+func (d *callLogDriver) Start() {
+	d.record("Start")
+	close(d.started)
+}
+func (d *callLogDriver) Pause()                     { d.record("Pause") }
+func (d *callLogDriver) Resume()                    { d.record("Resume") }
+func (d *callLogDriver) RequestIDR(firstFrame bool) { d.record("RequestIDR") }
+func (d *callLogDriver) Capabilities() sdriver.DriverCaps {
+	return sdriver.DriverCaps{CanVideo: true}
+}
+func (d *callLogDriver) MediaMeta() sdriver.MediaMeta {
+	return sdriver.MediaMeta{VideoCodec: "h264", Width: 640, Height: 480}
+}
+func (d *callLogDriver) Stop() {
+	d.record("Stop")
+	if d.onStop != nil {
+		d.onStop()
+	}
+}
+func (d *callLogDriver) ConfigDescription() []sdriver.ConfigParamDescription { return nil }
+
+// UpdateDriverConfig 记录为 "Update k=v,..."，键按字母排序
+func (d *callLogDriver) UpdateDriverConfig(config map[string]string) error {
+	var kvs []string
+	for _, k := range slices.Sorted(maps.Keys(config)) {
+		kvs = append(kvs, k+"="+config[k])
+	}
+	d.record("Update " + strings.Join(kvs, ","))
+	return d.updateErr
+}
+
+var (
+	testDriversMu sync.Mutex
+	testDrivers   []*callLogDriver
+)
+
+func newCallLogDriver(config map[string]string) (sdriver.SDriver, error) {
+	d := &callLogDriver{
+		started:   make(chan struct{}),
+		videoCh:   make(chan sdriver.AVBox),
+		controlCh: make(chan sdriver.Event, 10),
+	}
+	testDriversMu.Lock()
+	testDrivers = append(testDrivers, d)
+	testDriversMu.Unlock()
+	return d, nil
+}
+
+func init() {
+	sdriver.Register(sdriver.Registration{
+		Name: testDeviceType,
+		New:  newCallLogDriver,
+	})
+	sdriver.Register(sdriver.Registration{
+		Name:          testSingleEncoderType,
+		New:           newCallLogDriver,
+		SingleEncoder: true,
+	})
+}
+
+// newTestGroup 创建一个编码组和已经初始化驱动（未启动）的 Agent
+func newTestGroup(t *testing.T, codec string) (*DeviceBroadcaster, *sagent.Agent, *callLogDriver) {
+	t.Helper()
+	mime := map[string]string{"h264": webrtc.MimeTypeH264, "h265": webrtc.MimeTypeH265}[codec]
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mime, ClockRate: 90000}, "video", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := sagent.New(sagent.AgentConfig{
+		DeviceType:   testDeviceType,
+		DeviceID:     "device-1",
+		DriverConfig: map[string]string{"video_codec": codec},
+	}, track, nil)
+	if err := agent.InitDriver(webrtc.RTPCodecParameters{RTPCodecCapability: track.Codec()}); err != nil {
+		t.Fatal(err)
+	}
+	testDriversMu.Lock()
+	d := testDrivers[len(testDrivers)-1]
+	testDriversMu.Unlock()
+	b := &DeviceBroadcaster{
+		Codec:       codec,
+		VideoTrack:  track,
+		Subscribers: make(map[uint32]*Subscriber),
+		created:     time.Now(),
+	}
+	return b, agent, d
+}
+
+func TestNewCodecGroupJoinsPaused(t *testing.T) {
+	manager := NewWebRTCManager()
+	const device = "device-1"
+
+	first, firstAgent, _ := newTestGroup(t, "h264")
+	manager.broadcasters[device] = map[string]*DeviceBroadcaster{"h264": first}
+	if err := manager.startAgent(device, first, firstAgent); err != nil {
+		t.Fatal(err)
+	}
+	firstAgent.Pause()
+
+	second, secondAgent, d := newTestGroup(t, "h265")
+	manager.Lock()
+	manager.broadcasters[device]["h265"] = second
+	manager.Unlock()
+	if err := manager.startAgent(device, second, secondAgent); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-d.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent was not started")
+	}
+
+	if !secondAgent.Paused() {
+		t.Error("new codec group is not paused")
+	}
+	// 暂停必须发生在 Start 之前，并且不能补发缓存的关键帧
+	if calls := d.Calls(); !slices.Equal(calls, []string{"Pause", "Start"}) {
+		t.Errorf("driver calls = %v, want [Pause Start]", calls)
+	}
+	firstAgent.Close()
+	secondAgent.Close()
+}
+
+// newClientOffer 创建只支持 videoMimeTypes 和 Opus 的浏览器端，返回它和它的 offer
+func newClientOffer(t *testing.T, videoMimeTypes ...string) (*webrtc.PeerConnection, string) {
+	t.Helper()
+	m := createMediaEngine(append(videoMimeTypes, webrtc.MimeTypeOpus))
+	client, err := webrtc.NewAPI(webrtc.WithMediaEngine(m)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, offer.SDP
+}
+
+// 只能有一路编码的设备上，新的观看者只能加入正在运行的编码组，不能再启动一个编码
+func TestSingleEncoderJoinsActiveGroup(t *testing.T) {
+	manager := NewWebRTCManager()
+	const device = "device-1"
+	videoTrack, audioTrack := createAVTrack(webrtc.MimeTypeH264, webrtc.MimeTypeOpus, false)
+	running := &DeviceBroadcaster{
+		Codec:       "h264",
+		VideoTrack:  videoTrack,
+		AudioTrack:  audioTrack,
+		Subscribers: make(map[uint32]*Subscriber),
+		created:     time.Now(),
+	}
+	manager.broadcasters[device] = map[string]*DeviceBroadcaster{"h264": running}
+	newConfig := func() *sagent.AgentConfig {
+		return &sagent.AgentConfig{
+			DeviceType:   testSingleEncoderType,
+			DeviceID:     device,
+			DriverConfig: map[string]string{"video_codec": "h265"},
+		}
+	}
+	groups := func() []string {
+		manager.RLock()
+		defer manager.RUnlock()
+		return slices.Sorted(maps.Keys(manager.broadcasters[device]))
+	}
+
+	// 浏览器不支持正在运行的编码时直接失败
+	_, offer := newClientOffer(t, webrtc.MimeTypeH265)
+	if _, _, err := manager.NewSubscriber(device, offer, newConfig()); err == nil {
+		t.Error("NewSubscriber started a second encoder for an H.265-only browser")
+	}
+	if g := groups(); !slices.Equal(g, []string{"h264"}) {
+		t.Errorf("codec groups = %v, want [h264]", g)
+	}
+
+	// 浏览器支持时忽略指定的 h265，加入 h264 组
+	_, offer = newClientOffer(t, webrtc.MimeTypeH264, webrtc.MimeTypeH265)
+	config := newConfig()
+	_, receiptNo, err := manager.NewSubscriber(device, offer, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec := config.DriverConfig["video_codec"]; codec != "h264" {
+		t.Errorf("video_codec = %s, want h264", codec)
+	}
+	if g := groups(); !slices.Equal(g, []string{"h264"}) {
+		t.Errorf("codec groups = %v, want [h264]", g)
+	}
+	running.Lock.RLock()
+	sub, ok := running.Subscribers[receiptNo]
+	running.Lock.RUnlock()
+	if !ok {
+		t.Fatal("subscriber did not join the running group")
+	}
+	sub.PeerConnection.Close()
+}
+
+// 协商失败时不能在设备上留下空的编码组，否则之后的观看者会被引向一路不存在的流
+func TestNewSubscriberBadOfferRemovesGroup(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 DTLS 指纹的 offer 能选出编码，但 SetRemoteDescription 会失败
+	var lines []string
+	for line := range strings.SplitSeq(offer.SDP, "\r\n") {
+		if !strings.HasPrefix(line, "a=fingerprint:") {
+			lines = append(lines, line)
+		}
+	}
+
+	manager := NewWebRTCManager()
+	config := &sagent.AgentConfig{
+		DeviceType:   testDeviceType,
+		DeviceID:     "device-1",
+		DriverConfig: map[string]string{"video_codec": "h264"},
+	}
+	if _, _, err := manager.NewSubscriber("device-1", strings.Join(lines, "\r\n"), config); err == nil {
+		t.Fatal("NewSubscriber accepted an offer without fingerprint")
+	}
+	manager.RLock()
+	defer manager.RUnlock()
+	if groups, ok := manager.broadcasters["device-1"]; ok {
+		t.Errorf("stale codec groups left after a failed offer: %v", slices.Collect(maps.Keys(groups)))
+	}
+}
+
+// 测试图案驱动不依赖设备，可以把 NewSubscriber -> Start -> Agent -> RTP 整条链路跑一遍
+func TestTestPatternStreamsRTP(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := make(chan webrtc.RTPCodecParameters, 1)
+	client.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeVideo {
+			return
+		}
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+		received <- track.Codec()
+	})
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(client)
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gatherComplete
+
+	manager := NewWebRTCManager()
+	config := sagent.AgentConfig{
+		DeviceType: sdriver.DEVICE_TYPE_TESTPATTERN,
+		DeviceID:   "Test Pattern",
+		DriverConfig: map[string]string{
+			"video_codec": sdriver.VIDEO_CODEC_AUTO,
+			"resolution":  "64x64",
+			"fps":         "30",
+		},
+	}
+	device := config.DeviceType + "_" + config.DeviceID
+	answer, receiptNo, err := manager.NewSubscriber(device, client.LocalDescription().SDP, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec := config.DriverConfig["video_codec"]; codec != "h264" {
+		t.Errorf("video_codec = %s, want h264", codec)
+	}
+	if err := client.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.CloseDevice(config.DeviceType, config.DeviceID)
+	if err := manager.Start(device, receiptNo, config); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case codec := <-received:
+		if !strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264) {
+			t.Errorf("client received %s, want H264", codec.MimeType)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("no RTP packet received on the client")
+	}
+}
+
+// 最后一个观看者断开时关闭 Agent 会停止驱动，不能持有 manager 的锁
+func TestCleanupClosesAgentOutsideLock(t *testing.T) {
+	manager := NewWebRTCManager()
+	const device = "device-1"
+
+	b, agent, d := newTestGroup(t, "h264")
+	manager.broadcasters[device] = map[string]*DeviceBroadcaster{"h264": b}
+	if err := manager.startAgent(device, b, agent); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &Subscriber{PeerConnection: pc}
+	b.Subscribers[0] = sub
+	manager.setCleanup(sub, device, b, 0)
+
+	stopped := make(chan bool, 1)
+	d.onStop = func() {
+		locked := !manager.TryLock()
+		if !locked {
+			manager.Unlock()
+		}
+		stopped <- locked
+	}
+	pc.Close()
+	select {
+	case locked := <-stopped:
+		if locked {
+			t.Error("driver stopped while the manager lock was held")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent was not closed after the last subscriber left")
+	}
+	if _, ok := manager.GetAgent(device); ok {
+		t.Error("codec group still registered after the last subscriber left")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,6 +13,16 @@ import (
 
 type WebMasterConfig struct {
 	EnableAndroidDiscover bool
+	// 宏文件保存目录
+	MacroDir string
+	// 录制文件保存目录；保留上限，0 表示不限制
+	RecordingDir      string
+	RecordingMaxFiles int
+	RecordingMaxBytes int64
+	// video_codec 为 auto 时的视频编码偏好，靠前的优先
+	CodecPreference []string
+	// 注册 POST /api/session/:id/launch。它在会话里执行任意命令，还要求设置了 PIN
+	EnableLaunch bool
 }
 
 type WebMaster struct {
@@ -42,6 +53,9 @@ func New(config WebMasterConfig, staticFS fs.FS) *WebMaster {
 		UnlockAttemptRecords: make(map[string]UnlockAttemptRecord),
 		WebRTCManager:        NewWebRTCManager(),
 	}
+	if len(config.CodecPreference) > 0 {
+		wm.WebRTCManager.CodecPreference = config.CodecPreference
+	}
 	wm.jwtSecret = []byte(time.Now().String())
 	return wm
 }
@@ -49,6 +63,10 @@ func New(config WebMasterConfig, staticFS fs.FS) *WebMaster {
 func Default(staticFS fs.FS) *WebMaster {
 	wm := New(WebMasterConfig{
 		EnableAndroidDiscover: true,
+		MacroDir:              "macros",
+		RecordingDir:          "recordings",
+		RecordingMaxFiles:     100,
+		RecordingMaxBytes:     20 << 30,
 	}, staticFS)
 	return wm
 }
@@ -87,7 +105,37 @@ func (wm *WebMaster) setRouter() {
 		api.GET("/device/list", wm.handleListDevices)
 		api.POST("/device/connect", wm.handleConnectDevice)
 		api.POST("/device/pair", wm.handlePairDevice)
+		api.POST("/device/terminate", wm.handleTerminateDevice)
 		api.GET("/device/configDescription", wm.handleDeviceConfigDescription)
+
+		api.GET("/session/list", wm.handleListSessions)
+		api.POST("/session/:id/config", wm.handleUpdateSessionConfig)
+		api.POST("/session/:id/pause", wm.handlePauseSession)
+		api.POST("/session/:id/resume", wm.handleResumeSession)
+		if wm.config.EnableLaunch {
+			if wm.pin != "" {
+				api.POST("/session/:id/launch", wm.handleLaunchApp)
+			} else {
+				log.Println("-enable_launch needs a PIN, launch API disabled")
+			}
+		}
+		api.POST("/session/:id/macro/record", wm.handleStartMacroRecording)
+		api.POST("/session/:id/macro/save", wm.handleStopMacroRecording)
+		api.POST("/session/:id/macro/play", wm.handlePlayMacro)
+		api.POST("/session/:id/macro/stop", wm.handleStopMacro)
+
+		api.POST("/session/:id/recording/start", wm.handleStartRecording)
+		api.POST("/session/:id/recording/stop", wm.handleStopRecording)
+		api.POST("/session/:id/replay/save", wm.handleSaveReplay)
+
+		api.GET("/macro/list", wm.handleListMacros)
+		api.GET("/macro/:name", wm.handleGetMacro)
+		api.PUT("/macro/:name", wm.handlePutMacro)
+		api.DELETE("/macro/:name", wm.handleDeleteMacro)
+
+		api.GET("/recording/list", wm.handleListRecordings)
+		api.GET("/recording/:name", wm.handleDownloadRecording)
+		api.DELETE("/recording/:name", wm.handleDeleteRecording)
 		// api.GET("/generalConfigDescription", wm.handleGeneralConfigDescription)
 
 		// api.POST("/device/discovery", wm.handleListDevicesDiscoveried)
@@ -104,6 +152,30 @@ func (wm *WebMaster) SetPIN(pin string) {
 	wm.pin = pin
 }
 
+// SetCodecPreference 设置自动选择视频编码时的偏好顺序，例如 []string{"av1", "h265", "h264"}
+func (wm *WebMaster) SetCodecPreference(preference []string) {
+	var codecs []string
+	for _, codec := range preference {
+		codec = strings.ToLower(strings.TrimSpace(codec))
+		if _, ok := codecMimeTypes[codec]; !ok {
+			log.Printf("Ignoring unknown codec in preference: %q", codec)
+			continue
+		}
+		codecs = append(codecs, codec)
+	}
+	if len(codecs) == 0 {
+		return
+	}
+	log.Printf("Codec preference set to: %v", codecs)
+	wm.config.CodecPreference = codecs
+	wm.WebRTCManager.CodecPreference = codecs
+}
+
+// SetLaunchEnabled 开启启动应用的 API，需要同时设置 PIN，在 Serve 之前调用
+func (wm *WebMaster) SetLaunchEnabled(enabled bool) {
+	wm.config.EnableLaunch = enabled
+}
+
 func (wm *WebMaster) Serve(host, port string) {
 	// if wm.config.EnableAndroidDiscover {
 	// 	go wm.AndroidDevicesDiscovery()